@@ -51,7 +51,7 @@ func createAuthResponseHelper(stub *shimtest.MockStub, authResponse auth.AuthRes
 func TestCreateAuthRequestWithEncryptedData(t *testing.T) {
 	// 初始化
 	stub := createMockStub(t, "TestCreateAuthRequestWithEncryptedData")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// 创建加密文档
 	encryptedData := getSampleEncryptedData1()
@@ -79,7 +79,7 @@ func TestCreateAuthRequestWithEncryptedData(t *testing.T) {
 func TestCreateAuthRequestWithOffchainData(t *testing.T) {
 	// 初始化
 	stub := createMockStub(t, "TestCreateAuthRequestWithOffchainData")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// 创建链下数据
 	targetFunction := "createOffchainData"
@@ -109,7 +109,7 @@ func TestCreateAuthRequestWithOffchainData(t *testing.T) {
 func TestCreateAuthRequestWithPlainData(t *testing.T) {
 	// 初始化
 	stub := createMockStub(t, "TestCreateAuthRequestWithPlainData")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// 创建明文文档
 	targetFunction := "createPlainData"
@@ -129,7 +129,7 @@ func TestCreateAuthRequestWithRegulatorEncryptedData(t *testing.T) {
 func TestCreateAuthRequestWithExcessiveParameters(t *testing.T) {
 	// 初始化
 	stub := createMockStub(t, "TestCreateAuthRequestWithExcessiveParameters")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// 创建加密文档
 	encryptedData := getSampleEncryptedData1()
@@ -150,7 +150,7 @@ func TestCreateAuthRequestWithExcessiveParameters(t *testing.T) {
 func TestCreateAuthRequestWithNonExistentResourceID(t *testing.T) {
 	// 初始化
 	stub := createMockStub(t, "TestCreateAuthRequestWithNonExistentResourceID")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// 创建授权请求
 	authRequest := getSampleAuthRequest1("NON_EXISTENT_RESOURCE_ID")
@@ -161,7 +161,7 @@ func TestCreateAuthRequestWithNonExistentResourceID(t *testing.T) {
 func TestCreateAuthRequestIndexStatus(t *testing.T) {
 	// 初始化
 	stub := createMockStub(t, "TestCreateAuthRequestIndexStatus")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// 创建两份加密数据
 	sampleEncryptedData1 := getSampleEncryptedData1()
@@ -205,7 +205,7 @@ func TestCreateAuthRequestIndexStatus(t *testing.T) {
 func TestCreateAuthResponseWithNormalProcess(t *testing.T) {
 	// 初始化
 	stub := createMockStub(t, "TestCreateAuthResponseWithNormalProcess")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// user1 创建加密数据
 	sampleEncryptedData := getSampleEncryptedData1()
@@ -239,7 +239,7 @@ func TestCreateAuthResponseWithNormalProcess(t *testing.T) {
 func TestCreateAuthResponseWithExcessiveParameters(t *testing.T) {
 	// 初始化
 	stub := createMockStub(t, "TestCreateAuthResponseWithExcessiveParameters")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// user1 创建加密数据
 	sampleEncryptedData := getSampleEncryptedData1()
@@ -264,7 +264,7 @@ func TestCreateAuthResponseWithExcessiveParameters(t *testing.T) {
 func TestCreateAuthResponseTwice(t *testing.T) {
 	// 初始化
 	stub := createMockStub(t, "TestCreateAuthResponseTwice")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// user1 创建加密数据
 	sampleEncryptedData := getSampleEncryptedData1()
@@ -291,7 +291,7 @@ func TestCreateAuthResponseWithNonExistentSessionID(t *testing.T) {
 
 	// 初始化
 	stub := createMockStub(t, "TestCreateAuthResponseWithNonExistentSessionID")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// 直接创建授权批复
 	sampleAuthResponse := getSampleAuthResponse1()
@@ -302,7 +302,7 @@ func TestCreateAuthResponseWithNonExistentSessionID(t *testing.T) {
 func TestCreateAuthResponseWithOthersResource(t *testing.T) {
 	// 初始化
 	stub := createMockStub(t, "TestCreateAuthResponseWithOthersResource")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// user1 创建加密数据
 	sampleEncryptedData := getSampleEncryptedData1()
@@ -327,7 +327,7 @@ func TestCreateAuthResponseWithOthersResource(t *testing.T) {
 func TestCreateAuthResponseIndexStatus(t *testing.T) {
 	// 初始化
 	stub := createMockStub(t, "TestCreateAuthResponseIndexStatus")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// user1 创建两份加密数据
 	sampleEncryptedData1 := getSampleEncryptedData1()
@@ -380,7 +380,7 @@ func TestCreateAuthResponseIndexStatus(t *testing.T) {
 func TestGetAuthRequestWithNormalParameters(t *testing.T) {
 	// 初始化
 	stub := createMockStub(t, "TestGetAuthRequestWithNormalParameters")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// user1 创建加密数据
 	sampleEncryptedData := getSampleEncryptedData1()
@@ -412,7 +412,7 @@ func TestGetAuthRequestWithNormalParameters(t *testing.T) {
 func TestGetAuthRequestWithExcessiveParameters(t *testing.T) {
 	// 初始化
 	stub := createMockStub(t, "TestGetAuthRequestWithExcessiveParameters")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// user1 创建加密数据
 	sampleEncryptedData := getSampleEncryptedData1()
@@ -433,7 +433,7 @@ func TestGetAuthRequestWithExcessiveParameters(t *testing.T) {
 func TestGetAuthRequestWithNonExistentSessionID(t *testing.T) {
 	// 初始化
 	stub := createMockStub(t, "TestGetAuthRequestWithNonExistentSessionID")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// GetAuthRequest
 	targetFunction := "getAuthRequest"
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/big"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/keyswitch"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/sm2keyutils"
+	"github.com/XiaoYao-austin/ppks"
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+// 以零知识证明验证密钥置换结果中的份额。份额须是由份额生成者的密钥置换私钥对加密的对称密钥置换到访问申请者的密钥置换公钥下得到的。
+//
+// 参数：
+//   密钥置换结果
+//   访问申请者的密钥置换公钥（[64]byte 的 Base64 编码）
+//   加密的对称密钥（[128]byte）
+//
+// 返回：
+//   份额是否通过验证。份额、证明或公钥无法解析时返回错误。
+func verifyKeySwitchShareHelper(ksResult *keyswitch.KeySwitchResult, targetKeySwitchPK string, encryptedKeyBytes []byte) (bool, error) {
+	shareBytes, err := base64.StdEncoding.DecodeString(ksResult.Share)
+	if err != nil {
+		return false, fmt.Errorf("无法解析份额: %v", err)
+	}
+	share, err := deserializeCipherText(shareBytes)
+	if err != nil {
+		return false, fmt.Errorf("无法解析份额: %v", err)
+	}
+
+	proofBytes, err := base64.StdEncoding.DecodeString(ksResult.ZKProof)
+	if err != nil || len(proofBytes) != 96 {
+		return false, fmt.Errorf("无法解析零知识证明，应为 96 字节的 Base64 编码")
+	}
+	proofC := new(big.Int).SetBytes(proofBytes[:32])
+	proofR1 := new(big.Int).SetBytes(proofBytes[32:64])
+	proofR2 := new(big.Int).SetBytes(proofBytes[64:])
+
+	shareCreatorPK, err := deserializeSM2PublicKeyFromBase64(ksResult.KeySwitchPK)
+	if err != nil {
+		return false, fmt.Errorf("无法解析份额生成者的密钥置换公钥: %v", err)
+	}
+
+	targetPK, err := deserializeSM2PublicKeyFromBase64(targetKeySwitchPK)
+	if err != nil {
+		return false, fmt.Errorf("无法解析访问申请者的密钥置换公钥: %v", err)
+	}
+
+	encryptedKey, err := deserializeCipherText(encryptedKeyBytes)
+	if err != nil {
+		return false, fmt.Errorf("无法解析加密的对称密钥: %v", err)
+	}
+
+	return ppks.ShareProofVryNoB(proofC, proofR1, proofR2, share, shareCreatorPK, targetPK, &encryptedKey.K)
+}
+
+// 检查链下交付的份额的承诺。承诺应为 32 字节的 Base64 编码，且结果中不应另带份额与零知识证明。
+func checkKeySwitchShareCommitmentHelper(ksResult *keyswitch.KeySwitchResult) error {
+	if ksResult.Share != "" || ksResult.ZKProof != "" {
+		return fmt.Errorf("链下交付的份额不应上链")
+	}
+
+	commitmentBytes, err := base64.StdEncoding.DecodeString(ksResult.Commitment)
+	if err != nil || len(commitmentBytes) != 32 {
+		return fmt.Errorf("份额的承诺应为 32 字节的 Base64 编码")
+	}
+
+	return nil
+}
+
+// 将 [128]byte 解析为 `ppks.CipherText`，前 64 字节为点 K，后 64 字节为点 C。与客户端的序列化格式一致。
+func deserializeCipherText(cipherTextBytes []byte) (*ppks.CipherText, error) {
+	if len(cipherTextBytes) != 128 {
+		return nil, fmt.Errorf("长度不正确，应为 128 字节")
+	}
+
+	pointK, err := deserializeSM2PublicKey(cipherTextBytes[:64])
+	if err != nil {
+		return nil, err
+	}
+
+	pointC, err := deserializeSM2PublicKey(cipherTextBytes[64:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &ppks.CipherText{
+		K: ppks.CurvePoint(*pointK),
+		C: ppks.CurvePoint(*pointC),
+	}, nil
+}
+
+func deserializeSM2PublicKeyFromBase64(publicKeyAsBase64 string) (*sm2.PublicKey, error) {
+	publicKeyBytes, err := base64.StdEncoding.DecodeString(publicKeyAsBase64)
+	if err != nil {
+		return nil, err
+	}
+
+	return deserializeSM2PublicKey(publicKeyBytes)
+}
+
+// 将 [64]byte 解析为 SM2 公钥（曲线上的点），前 32 字节为 X，后 32 字节为 Y。
+func deserializeSM2PublicKey(publicKeyBytes []byte) (*sm2.PublicKey, error) {
+	if len(publicKeyBytes) != 64 {
+		return nil, fmt.Errorf("公钥长度不正确，应为 64 字节")
+	}
+
+	x := new(big.Int).SetBytes(publicKeyBytes[:32])
+	y := new(big.Int).SetBytes(publicKeyBytes[32:])
+
+	return sm2keyutils.ConvertBigIntegersToPublicKey(x, y)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/base64"
+	"math/big"
+	"testing"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/keyswitch"
+	"github.com/XiaoYao-austin/ppks"
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+func TestVerifyKeySwitchShare(t *testing.T) {
+	serverSK, err := ppks.GenPrivKey()
+	expectNil(t, err)
+	targetSK, err := ppks.GenPrivKey()
+	expectNil(t, err)
+	encryptedKey, err := ppks.PointEncrypt(&serverSK.PublicKey, ppks.GenPoint())
+	expectNil(t, err)
+	encryptedKeyBytes := serializeCipherTextForTest(encryptedKey)
+	targetKeySwitchPK := base64.StdEncoding.EncodeToString(serializeSM2PublicKeyForTest(&targetSK.PublicKey))
+
+	ksResult := generateSampleKeySwitchResult(t, "ks1", serverSK, &targetSK.PublicKey, encryptedKey)
+	isShareVerified, err := verifyKeySwitchShareHelper(&ksResult, targetKeySwitchPK, encryptedKeyBytes)
+	expectNil(t, err)
+	expectEqual(t, true, isShareVerified)
+
+	// 以其他访问申请者的公钥验证
+	otherSK, err := ppks.GenPrivKey()
+	expectNil(t, err)
+	otherKeySwitchPK := base64.StdEncoding.EncodeToString(serializeSM2PublicKeyForTest(&otherSK.PublicKey))
+	isShareVerified, err = verifyKeySwitchShareHelper(&ksResult, otherKeySwitchPK, encryptedKeyBytes)
+	expectNil(t, err)
+	expectEqual(t, false, isShareVerified)
+
+	// 篡改证明
+	proofBytes, _ := base64.StdEncoding.DecodeString(ksResult.ZKProof)
+	proofBytes[95] ^= 1
+	tamperedResult := ksResult
+	tamperedResult.ZKProof = base64.StdEncoding.EncodeToString(proofBytes)
+	isShareVerified, err = verifyKeySwitchShareHelper(&tamperedResult, targetKeySwitchPK, encryptedKeyBytes)
+	expectNil(t, err)
+	expectEqual(t, false, isShareVerified)
+
+	// 份额不是曲线上的点
+	malformedResult := ksResult
+	malformedResult.Share = base64.StdEncoding.EncodeToString(make([]byte, 128))
+	_, err = verifyKeySwitchShareHelper(&malformedResult, targetKeySwitchPK, encryptedKeyBytes)
+	if err == nil {
+		t.Fatal("无法解析的份额应返回错误")
+	}
+}
+
+// 以份额生成者的密钥置换私钥为访问申请者生成份额及其零知识证明
+func generateSampleKeySwitchResult(t *testing.T, ksSessionID string, serverSK *sm2.PrivateKey, targetPK *sm2.PublicKey, encryptedKey *ppks.CipherText) keyswitch.KeySwitchResult {
+	share, rand, err := ppks.ShareCal(targetPK, &encryptedKey.K, serverSK)
+	expectNil(t, err)
+	proofC, proofR1, proofR2, err := ppks.ShareProofGenNoB(rand, serverSK, share, targetPK, &encryptedKey.K)
+	expectNil(t, err)
+
+	var proofBytes []byte
+	proofBytes = append(proofBytes, serializeBigIntForTest(proofC)...)
+	proofBytes = append(proofBytes, serializeBigIntForTest(proofR1)...)
+	proofBytes = append(proofBytes, serializeBigIntForTest(proofR2)...)
+
+	return keyswitch.KeySwitchResult{
+		KeySwitchSessionID: ksSessionID,
+		Share:              base64.StdEncoding.EncodeToString(serializeCipherTextForTest(share)),
+		ZKProof:            base64.StdEncoding.EncodeToString(proofBytes),
+		KeySwitchPK:        base64.StdEncoding.EncodeToString(serializeSM2PublicKeyForTest(&serverSK.PublicKey)),
+	}
+}
+
+func serializeCipherTextForTest(cipherText *ppks.CipherText) []byte {
+	pointK := sm2.PublicKey(cipherText.K)
+	pointC := sm2.PublicKey(cipherText.C)
+	return append(serializeSM2PublicKeyForTest(&pointK), serializeSM2PublicKeyForTest(&pointC)...)
+}
+
+func serializeSM2PublicKeyForTest(publicKey *sm2.PublicKey) []byte {
+	return append(serializeBigIntForTest(publicKey.X), serializeBigIntForTest(publicKey.Y)...)
+}
+
+func serializeBigIntForTest(n *big.Int) []byte {
+	return n.FillBytes(make([]byte, 32))
+}
@@ -196,9 +196,12 @@ func (uc *UniversalCC) createEncryptedData(stub shim.ChaincodeStubInterface, arg
 		return shim.Error(fmt.Sprintf("无法存储密钥: %v", err))
 	}
 
-	dbPolicyKey := getKeyForResPolicy(resourceID)
-	if err = stub.PutState(dbPolicyKey, []byte(encryptedData.Policy)); err != nil {
-		return shim.Error(fmt.Sprintf("无法存储策略: %v", err))
+	if err = uc.putResourcePolicyHelper(stub, resourceID, encryptedData.Policy, encryptedData.PolicyTemplate); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err = uc.recordResourceKeyEpochOnCreationHelper(stub, resourceID, encryptedData.KeyEpoch); err != nil {
+		return shim.Error(err.Error())
 	}
 
 	metadataStoredBytes, err := json.Marshal(metadataStored)
@@ -304,9 +307,12 @@ func (uc *UniversalCC) createOffchainData(stub shim.ChaincodeStubInterface, args
 		return shim.Error(fmt.Sprintf("无法存储密钥: %v", err))
 	}
 
-	dbPolicyKey := getKeyForResPolicy(resourceID)
-	if err = stub.PutState(dbPolicyKey, []byte(offchainData.Policy)); err != nil {
-		return shim.Error(fmt.Sprintf("无法存储策略: %v", err))
+	if err = uc.putResourcePolicyHelper(stub, resourceID, offchainData.Policy, offchainData.PolicyTemplate); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err = uc.recordResourceKeyEpochOnCreationHelper(stub, resourceID, offchainData.KeyEpoch); err != nil {
+		return shim.Error(err.Error())
 	}
 
 	metadataStoredBytes, err := json.Marshal(metadataStored)
@@ -408,18 +414,16 @@ func (uc *UniversalCC) getPolicy(stub shim.ChaincodeStubInterface, args []string
 	// 解析第一个参数为 resourceID
 	resourceID := args[0]
 
-	// 读 policy 并返回，若未找到则返回 codeNotFound
-	dbKey := getKeyForResPolicy(resourceID)
-	dataBytes, err := stub.GetState(dbKey)
+	// 读 policy 并返回，若未找到则返回 codeNotFound。引用了策略模板的资源返回其固定版本中的策略。
+	policyText, err := uc.getResourcePolicyHelper(stub, resourceID)
 	if err != nil {
+		if err == errorcode.ErrorNotFound {
+			return shim.Error(errorcode.CodeNotFound)
+		}
 		return shim.Error(fmt.Sprintf("无法读取策略: %v", err))
 	}
 
-	if len(dataBytes) == 0 {
-		return shim.Error(errorcode.CodeNotFound)
-	}
-
-	return shim.Success(dataBytes)
+	return shim.Success([]byte(policyText))
 }
 
 // 此段保留作为 composite key 索引方案参考
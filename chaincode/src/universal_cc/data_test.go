@@ -22,7 +22,7 @@ func TestCreatePlainDataWithNormalData(t *testing.T) {
 	targetFunction := "createPlainData"
 
 	stub := createMockStub(t, "TestCreatePlainDataWithNormalData")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// Prepare the arg
 	samplePlainData1 := getSamplePlainData1()
@@ -57,7 +57,7 @@ func TestCreatePlainDataWithDuplicateResourceIDs(t *testing.T) {
 	targetFunction := "createPlainData"
 
 	stub := createMockStub(t, "TestCreatePlainDataWithDuplicateResourceIDs")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// Prepare the args
 	samplePlainData1 := getSamplePlainData1()
@@ -80,7 +80,7 @@ func TestCreatePlainDataWithExcessiveParameters(t *testing.T) {
 	targetFunction := "createPlainData"
 
 	stub := createMockStub(t, "TestCreatePlainDataWithExcessiveParameters")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// Prepare the arg
 	samplePlainData1 := getSamplePlainData1()
@@ -95,7 +95,7 @@ func TestCreatePlainDataWithCorruptHashAndSize(t *testing.T) {
 	targetFunction := "createPlainData"
 
 	stub := createMockStub(t, "TestCreatePlainDataWithCorruptHashAndSize")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// Prepare the args
 	samplePlainDataCorruptHash := getSamplePlainData1()
@@ -118,7 +118,7 @@ func TestCreatePlainDataWithCorruptHashAndSize(t *testing.T) {
 func TestCreateEncryptedDataWithNormalData(t *testing.T) {
 	targetFunction := "createEncryptedData"
 	stub := createMockStub(t, "TestCreateEncryptedDataWithNormalData")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// Prepare the arg
 	sampleEncryptedData1 := getSampleEncryptedData1()
@@ -152,7 +152,7 @@ func TestCreateEncryptedDataWithNormalData(t *testing.T) {
 func TestCreateEncryptedDataWithExcessiveParameters(t *testing.T) {
 	targetFunction := "createEncryptedData"
 	stub := createMockStub(t, "TestCreateEncryptedDataWithExcessiveParameters")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// Prepare the arg
 	sampleEncryptedData1 := getSampleEncryptedData1()
@@ -166,7 +166,7 @@ func TestCreateEncryptedDataWithExcessiveParameters(t *testing.T) {
 func TestCreateEncryptedDataWithDuplicateResourceIDs(t *testing.T) {
 	targetFunction := "createEncryptedData"
 	stub := createMockStub(t, "TestCreatePlainDataWithDuplicateResourceIDs")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// Prepare the args
 	sampleEncryptedData1 := getSampleEncryptedData1()
@@ -185,10 +185,31 @@ func TestCreateEncryptedDataWithDuplicateResourceIDs(t *testing.T) {
 	expectResponseStatusERROR(t, &resp)
 }
 
+func TestCreateEncryptedDataWithInvalidPolicy(t *testing.T) {
+	targetFunction := "createEncryptedData"
+	stub := createMockStub(t, "TestCreateEncryptedDataWithInvalidPolicy")
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	// A policy with syntax errors and a policy referring to an unknown attribute
+	for _, policy := range []string{`(DeptType == "computer"`, `Role == "admin"`} {
+		sampleEncryptedData1 := getSampleEncryptedData1()
+		sampleEncryptedData1.Policy = policy
+		dataBytes, _ := json.Marshal(sampleEncryptedData1)
+
+		// Invoke with the invalid policy and expect the response status to be ERROR
+		resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte(targetFunction), dataBytes})
+		expectResponseStatusERROR(t, &resp)
+
+		// Nothing should be stored
+		expectNil(t, stub.State[getKeyForResMetadata(sampleEncryptedData1.Metadata.ResourceID)])
+		expectNil(t, stub.State[getKeyForResPolicy(sampleEncryptedData1.Metadata.ResourceID)])
+	}
+}
+
 func TestCreateOffchainDataWithNormalData(t *testing.T) {
 	targetFunction := "createOffchainData"
 	stub := createMockStub(t, "TestCreateOffchainDataWithNormalData")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// Prepare the arg
 	sampleOffchainData1 := getSampleOffchainData1()
@@ -217,7 +238,7 @@ func TestCreateOffchainDataWithNormalData(t *testing.T) {
 func TestCreateOffchainDataWithExcessiveParameters(t *testing.T) {
 	targetFunction := "createOffchainData"
 	stub := createMockStub(t, "TestCreateOffchainDataWithExcessiveParameters")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// Prepare the arg
 	sampleOffchainData1 := getSampleOffchainData1()
@@ -231,7 +252,7 @@ func TestCreateOffchainDataWithExcessiveParameters(t *testing.T) {
 func TestCreateOffchainDataWithDuplicateResourceIDs(t *testing.T) {
 	targetFunction := "createOffchainData"
 	stub := createMockStub(t, "TestCreateOffchainDataWithDuplicateResourceIDs")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// Prepare the args
 	sampleOffchainData1 := getSampleOffchainData1()
@@ -251,10 +272,31 @@ func TestCreateOffchainDataWithDuplicateResourceIDs(t *testing.T) {
 	expectResponseStatusERROR(t, &resp)
 }
 
+func TestCreateOffchainDataWithInvalidPolicy(t *testing.T) {
+	targetFunction := "createOffchainData"
+	stub := createMockStub(t, "TestCreateOffchainDataWithInvalidPolicy")
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	// A policy with syntax errors and a policy referring to an unknown attribute
+	for _, policy := range []string{"Encryption strategy", `Role == "admin"`} {
+		sampleOffchainData1 := getSampleOffchainData1()
+		sampleOffchainData1.Policy = policy
+		dataBytes, _ := json.Marshal(sampleOffchainData1)
+
+		// Invoke with the invalid policy and expect the response status to be ERROR
+		resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte(targetFunction), dataBytes})
+		expectResponseStatusERROR(t, &resp)
+
+		// Nothing should be stored
+		expectNil(t, stub.State[getKeyForResMetadata(sampleOffchainData1.Metadata.ResourceID)])
+		expectNil(t, stub.State[getKeyForResPolicy(sampleOffchainData1.Metadata.ResourceID)])
+	}
+}
+
 func TestGetMetadata(t *testing.T) {
 	targetFunction := "createPlainData"
 	stub := createMockStub(t, "TestGetMetadata")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// Prepare the arg
 	samplePlainData1 := getSamplePlainData1()
@@ -286,7 +328,7 @@ func TestGetMetadata(t *testing.T) {
 func TestGetMetadataWithExcessiveParameters(t *testing.T) {
 	targetFunction := "createPlainData"
 	stub := createMockStub(t, "TestGetMetadataWithExcessiveParameters")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// Prepare the arg
 	samplePlainData1 := getSamplePlainData1()
@@ -308,7 +350,7 @@ func TestGetMetadataWithExcessiveParameters(t *testing.T) {
 func TestGetMetadataWithNonExistentID(t *testing.T) {
 	targetFunction := "createPlainData"
 	stub := createMockStub(t, "TestGetMetadataWithNonExistentID")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// Prepare the arg
 	samplePlainData1 := getSamplePlainData1()
@@ -333,7 +375,7 @@ func TestGetMetadataWithNonExistentID(t *testing.T) {
 func TestGetData(t *testing.T) {
 	targetFunction := "createPlainData"
 	stub := createMockStub(t, "TestGetData")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// Prepare the arg
 	samplePlainData1 := getSamplePlainData1()
@@ -359,7 +401,7 @@ func TestGetData(t *testing.T) {
 func TestGetDataWithExcessiveParameters(t *testing.T) {
 	targetFunction := "getData"
 	stub := createMockStub(t, "TestGetDataWithExcessiveParameters")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// Prepare the args
 	samplePlainData1 := getSamplePlainData1()
@@ -372,7 +414,7 @@ func TestGetDataWithExcessiveParameters(t *testing.T) {
 func TestGetDataWithNonExistentID(t *testing.T) {
 	targetFunction := "createPlainData"
 	stub := createMockStub(t, "TestGetDataWithNonExistentID")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// Prepare the arg
 	samplePlainData1 := getSamplePlainData1()
@@ -396,7 +438,7 @@ func TestGetDataWithNonExistentID(t *testing.T) {
 func TestGetKey(t *testing.T) {
 	targetFunction := "createEncryptedData"
 	stub := createMockStub(t, "TestGetKey")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// Prepare the EncryptedData
 	sampleEncryptedData1 := getSampleEncryptedData1()
@@ -423,7 +465,7 @@ func TestGetKey(t *testing.T) {
 
 func TestGetKeyWithExcessiveParameters(t *testing.T) {
 	stub := createMockStub(t, "TestGetKeyWithExcessiveParameters")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// Prepare the arg
 	targetFunction := "getKey"
@@ -436,7 +478,7 @@ func TestGetKeyWithExcessiveParameters(t *testing.T) {
 func TestGetKeyWithNonExistentID(t *testing.T) {
 	targetFunction := "createEncryptedData"
 	stub := createMockStub(t, "TestGetKeyWithNonExistentID")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// Prepare the arg
 	sampleEncryptedData1 := getSampleEncryptedData1()
@@ -462,7 +504,7 @@ func TestGetKeyWithNonExistentID(t *testing.T) {
 func TestGetPolicy(t *testing.T) {
 	targetFunction := "createEncryptedData"
 	stub := createMockStub(t, "TestGetPolicy")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// Prepare the arg with encyprted data
 	sampleEncryptedData1 := getSampleEncryptedData1()
@@ -498,7 +540,7 @@ func TestGetPolicy(t *testing.T) {
 
 func TestGetPolicyWithExcessiveParameters(t *testing.T) {
 	stub := createMockStub(t, "TestGetPolicyWithExcessiveParameters")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// Prepare the args
 	targetFunction := "getPolicy"
@@ -515,7 +557,7 @@ func TestGetPolicyWithNonExistentID(t *testing.T) {
 	// createEncryptedData
 	targetFunction := "createEncryptedData"
 	stub := createMockStub(t, "TestGetPolicyWithNonExistentID")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// Prepare the arg
 	sampleEncryptedData1 := getSampleEncryptedData1()
@@ -537,7 +579,7 @@ func TestGetPolicyWithNonExistentID(t *testing.T) {
 
 //func TestLinkEntityIDWithDocumentID(t *testing.T) {
 //	stub := createMockStub(t, "TestLinkEntityIDWithDocumentID")
-//	_ = initChaincode(stub, [][]byte{})
+//	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 //
 //	// Prepare the args
 //	asset := getSamplePlainData1()
@@ -593,7 +635,7 @@ func TestGetPolicyWithNonExistentID(t *testing.T) {
 //
 //func TestLinkEntityIDWithDocumentIDWithExcessiveParameters(t *testing.T) {
 //	stub := createMockStub(t, "TestLinkEntityIDWithDocumentIDWithExcessiveParameters")
-//	_ = initChaincode(stub, [][]byte{})
+//	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 //
 //	// Prepare the args
 //	asset := getSamplePlainData1()
@@ -607,7 +649,7 @@ func TestGetPolicyWithNonExistentID(t *testing.T) {
 //
 //func TestLinkEntityIDWithDocumentIDWithNonExistentEntityID(t *testing.T) {
 //	stub := createMockStub(t, "TestLinkEntityIDWithDocumentIDWithNonExistentEntityID")
-//	_ = initChaincode(stub, [][]byte{})
+//	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 //
 //	// Prepare the args
 //	asset := getSamplePlainData1()
@@ -641,7 +683,7 @@ func TestGetPolicyWithNonExistentID(t *testing.T) {
 
 //func TestListDocumentIDsByEntityID(t *testing.T) {
 //	stub := createMockStub(t, "TestLinkEntityIDWithDocumentID")
-//	_ = initChaincode(stub, [][]byte{})
+//	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 //
 //	// Prepare the args
 //	asset := getSamplePlainData1()
@@ -688,7 +730,7 @@ func TestGetPolicyWithNonExistentID(t *testing.T) {
 
 func TestListDocumentIDsByEntityIDWithExcessiveParameters(t *testing.T) {
 	stub := createMockStub(t, "TestListDocumentIDsByEntityIDWithExcessiveParameters")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// Prepare the args
 	doc1 := getSamplePlainData1()
@@ -702,7 +744,7 @@ func TestListDocumentIDsByEntityIDWithExcessiveParameters(t *testing.T) {
 
 //func TestListDocumentIDsByNonExistentEntityID(t *testing.T) {
 //	stub := createMockStub(t, "TestLinkEntityIDWithDocumentID")
-//	_ = initChaincode(stub, [][]byte{})
+//	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 //
 //	// Prepare the args
 //	asset := getSamplePlainData1()
@@ -737,7 +779,7 @@ func TestListDocumentIDsByEntityIDWithExcessiveParameters(t *testing.T) {
 
 func TestListDocumentIDsByCreatorWithExcessiveParameters(t *testing.T) {
 	stub := createMockStub(t, "TestListDocumentIDsByCreatorWithExcessiveParameters")
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	targetFunction := "listDocumentIDsWithCreator"
 	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte(targetFunction), []byte("document"), []byte("true"), []byte(strconv.Itoa(10)), {}, []byte("EXCESSIVE PARAMETER")})
@@ -877,10 +919,9 @@ func getSampleOffchainData1() data.OffchainData {
 			Size:         uint64(len([]byte(data1))),
 			Extensions:   extensionsMap,
 		},
-		Key: base64.StdEncoding.EncodeToString([]byte("123456")),
-		CID: "654321",
-		// TODO: 测试时填充
-		Policy: "Encryption strategy",
+		Key:    base64.StdEncoding.EncodeToString([]byte("123456")),
+		CID:    "654321",
+		Policy: `(DeptType == "computer" && DeptLevel == 2)`,
 	}
 }
 
@@ -901,9 +942,8 @@ func getSampleOffchainData2() data.OffchainData {
 			Size:         uint64(len([]byte(data2))),
 			Extensions:   extensionsMap,
 		},
-		Key: base64.StdEncoding.EncodeToString([]byte("123456")),
-		CID: "654321",
-		// TODO: 测试时填充
-		Policy: "Encryption strategy",
+		Key:    base64.StdEncoding.EncodeToString([]byte("123456")),
+		CID:    "654321",
+		Policy: `(DeptType == "computer" && DeptLevel == 1)`,
 	}
 }
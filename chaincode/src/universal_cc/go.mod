@@ -8,7 +8,7 @@ replace github.com/XiaoYao-austin/ppks => ../../../ppks/
 
 require (
 	gitee.com/czyczk/fabric-sdk-tutorial v0.0.0
-	github.com/casbin/casbin v1.9.1
+	github.com/XiaoYao-austin/ppks v1.0.0
 	github.com/gogo/protobuf v1.3.2
 	github.com/google/uuid v1.2.0
 	github.com/hyperledger/fabric-ca v1.4.9
@@ -17,4 +17,5 @@ require (
 	github.com/mitchellh/mapstructure v1.4.2
 	github.com/sirupsen/logrus v1.8.1
 	github.com/stretchr/testify v1.7.0
+	github.com/tjfoc/gmsm v1.4.1
 )
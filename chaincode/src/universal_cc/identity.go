@@ -1,11 +1,14 @@
 package main
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"strconv"
 
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/identity"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/policy"
 	"github.com/hyperledger/fabric-ca/lib/attrmgr"
 	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
 	"github.com/hyperledger/fabric-chaincode-go/shim"
@@ -33,6 +36,22 @@ func (uc *UniversalCC) getDepartmentIdentity(stub shim.ChaincodeStubInterface, a
 	return shim.Success(identityBytes)
 }
 
+func (uc *UniversalCC) getCallerPublicKey(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 0 {
+		return shim.Error("参数数量不正确。应为 0 个")
+	}
+
+	// 返回调用者身份的公钥（Base64 编码的 DER），与链上记录的创建者的形式一致
+	pkDER, err := getPKDERFromStub(stub)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法获取公钥: %v", err))
+	}
+
+	return shim.Success([]byte(base64.StdEncoding.EncodeToString(pkDER)))
+}
+
+// 获取调用者的部门身份信息。属性登记簿中登记了调用者的属性时，登记的属性优先于证书上的同名属性，未登记的属性仍取自证书。
 func (uc *UniversalCC) getDepartmentIdentityHelper(stub shim.ChaincodeStubInterface) (*identity.DepartmentIdentityStored, error) {
 	cert, err := cid.GetX509Certificate(stub)
 	if err != nil {
@@ -45,11 +64,31 @@ func (uc *UniversalCC) getDepartmentIdentityHelper(stub shim.ChaincodeStubInterf
 		return nil, fmt.Errorf("无法获取属性: %v", err)
 	}
 
-	// 将从证书中得到的属性 map 转为 struct
+	mergedAttrs := make(map[string]string, len(attrs.Attrs))
+	for name, value := range attrs.Attrs {
+		mergedAttrs[name] = value
+	}
+
+	// 以属性登记簿中登记的属性覆盖证书上的属性
+	pkDER, err := getPKDERFromStub(stub)
+	if err != nil {
+		return nil, fmt.Errorf("无法获取公钥: %v", err)
+	}
+	registered, err := uc.getRegisteredAttributesHelper(stub, base64.StdEncoding.EncodeToString(pkDER))
+	if err != nil && err != errorcode.ErrorNotFound {
+		return nil, err
+	}
+	if registered != nil {
+		for name, value := range registered.Attributes {
+			mergedAttrs[name] = value
+		}
+	}
+
+	// 将合并后的属性 map 转为 struct
 	var identity identity.DepartmentIdentityStored
-	_ = mapstructure.Decode(attrs.Attrs, &identity)
+	_ = mapstructure.Decode(mergedAttrs, &identity)
 
-	deptLevelStr := attrs.Attrs["DeptLevel"]
+	deptLevelStr := mergedAttrs["DeptLevel"]
 	if deptLevelStr != "" {
 		deptLevel, err := strconv.Atoi(deptLevelStr)
 		if err != nil {
@@ -61,3 +100,258 @@ func (uc *UniversalCC) getDepartmentIdentityHelper(stub shim.ChaincodeStubInterf
 
 	return &identity, nil
 }
+
+func (uc *UniversalCC) updateRegisteredAttributes(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 1 {
+		return shim.Error("参数数量不正确。应为 1 个")
+	}
+
+	// 只有管理员可以更新属性登记簿
+	isAdmin, err := uc.isAdminHelper(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isAdmin {
+		return shim.Error(errorcode.CodeForbidden)
+	}
+
+	// 解析第 0 个参数为 identity.RegisteredAttributesUpdate
+	var update identity.RegisteredAttributesUpdate
+	if err = json.Unmarshal([]byte(args[0]), &update); err != nil {
+		return shim.Error(fmt.Sprintf("无法解析参数中的 JSON 对象: %v", err))
+	}
+
+	if _, err = base64.StdEncoding.DecodeString(update.PublicKey); err != nil || update.PublicKey == "" {
+		return shim.Error("公钥应为 Base64 编码的 DER")
+	}
+
+	// 只能登记部门身份属性
+	isKnown := make(map[string]bool, len(policy.DepartmentIdentityAttributeNames))
+	for _, name := range policy.DepartmentIdentityAttributeNames {
+		isKnown[name] = true
+	}
+	for name, value := range update.Attributes {
+		if !isKnown[name] {
+			return shim.Error(fmt.Sprintf("不能登记属性 '%v'", name))
+		}
+		if name == "DeptLevel" {
+			if _, err = strconv.Atoi(value); err != nil {
+				return shim.Error("DeptLevel 应为整数")
+			}
+		}
+	}
+
+	// 确定新版本的版本号
+	latest, err := uc.getRegisteredAttributesHelper(stub, update.PublicKey)
+	if err != nil && err != errorcode.ErrorNotFound {
+		return shim.Error(err.Error())
+	}
+	version := 1
+	if latest != nil {
+		version = latest.Version + 1
+	}
+
+	// 获取更新者与时间戳
+	updater, err := getPKDERFromStub(stub)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法获取更新者: %v", err))
+	}
+
+	timestamp, err := getTimeFromStub(stub)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法获得时间戳: %v", err))
+	}
+
+	registered := identity.RegisteredAttributesStored{
+		PublicKey:  update.PublicKey,
+		Version:    version,
+		Attributes: update.Attributes,
+		Reason:     update.Reason,
+		Updater:    base64.StdEncoding.EncodeToString(updater),
+		Timestamp:  timestamp,
+	}
+	if registered.Attributes == nil {
+		registered.Attributes = map[string]string{}
+	}
+	registeredBytes, err := json.Marshal(registered)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化登记属性: %v", err))
+	}
+
+	// 各版本均保留以供审计，最新版本另存一份以便在求值时读取
+	if err = stub.PutState(getKeyForRegisteredAttributesVersion(update.PublicKey, version), registeredBytes); err != nil {
+		return shim.Error(fmt.Sprintf("无法存储登记属性: %v", err))
+	}
+	if err = stub.PutState(getKeyForRegisteredAttributes(update.PublicKey), registeredBytes); err != nil {
+		return shim.Error(fmt.Sprintf("无法存储登记属性: %v", err))
+	}
+
+	return shim.Success([]byte(strconv.Itoa(version)))
+}
+
+func (uc *UniversalCC) getRegisteredAttributes(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 1 {
+		return shim.Error("参数数量不正确。应为 1 个")
+	}
+
+	// 第 0 个参数为身份的公钥
+	registered, err := uc.getRegisteredAttributesHelper(stub, args[0])
+	if err != nil {
+		if err == errorcode.ErrorNotFound {
+			return shim.Error(errorcode.CodeNotFound)
+		}
+		return shim.Error(err.Error())
+	}
+
+	registeredBytes, err := json.Marshal(registered)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化登记属性: %v", err))
+	}
+
+	return shim.Success(registeredBytes)
+}
+
+func (uc *UniversalCC) listRegisteredAttributesHistory(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 1 {
+		return shim.Error("参数数量不正确。应为 1 个")
+	}
+
+	// 第 0 个参数为身份的公钥。按版本从旧到新列出。
+	startKey := getKeyPrefixForRegisteredAttributesVersion(args[0])
+	endKey := string(BytesPrefix([]byte(startKey)))
+	resultsIterator, err := stub.GetStateByRange(startKey, endKey)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法查询登记属性: %v", err))
+	}
+	defer resultsIterator.Close()
+
+	history := []identity.RegisteredAttributesStored{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		var registered identity.RegisteredAttributesStored
+		if err = json.Unmarshal(queryResponse.Value, &registered); err != nil {
+			return shim.Error(fmt.Sprintf("无法解析登记属性: %v", err))
+		}
+		history = append(history, registered)
+	}
+
+	historyBytes, err := json.Marshal(history)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化登记属性: %v", err))
+	}
+
+	return shim.Success(historyBytes)
+}
+
+// 获取身份最新的登记属性。没有登记时返回 `errorcode.ErrorNotFound`。
+func (uc *UniversalCC) getRegisteredAttributesHelper(stub shim.ChaincodeStubInterface, publicKeyAsBase64 string) (*identity.RegisteredAttributesStored, error) {
+	registeredBytes, err := stub.GetState(getKeyForRegisteredAttributes(publicKeyAsBase64))
+	if err != nil {
+		return nil, fmt.Errorf("无法读取登记属性: %v", err)
+	}
+	if len(registeredBytes) == 0 {
+		return nil, errorcode.ErrorNotFound
+	}
+
+	var registered identity.RegisteredAttributesStored
+	if err = json.Unmarshal(registeredBytes, &registered); err != nil {
+		return nil, fmt.Errorf("无法解析登记属性: %v", err)
+	}
+
+	return &registered, nil
+}
+
+// 获取调用者的 MSP 与证书身份。注册 ID 与角色优先取自 Fabric CA 签发的证书属性 `hf.EnrollmentID` 与 `hf.Type`，
+// 没有时分别取证书主体的通用名（CN）与 NodeOU 角色。
+func getCallerIdentityHelper(stub shim.ChaincodeStubInterface) (*policy.CallerIdentity, error) {
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return nil, fmt.Errorf("无法获取 MSP ID: %v", err)
+	}
+
+	cert, err := cid.GetX509Certificate(stub)
+	if err != nil {
+		return nil, fmt.Errorf("无法获取证书: %v", err)
+	}
+
+	caller := &policy.CallerIdentity{
+		MSPID:        mspID,
+		EnrollmentID: cert.Subject.CommonName,
+		CommonName:   cert.Subject.CommonName,
+	}
+	if len(cert.Subject.Organization) > 0 {
+		caller.Org = cert.Subject.Organization[0]
+	}
+	// 按照 Fabric NodeOU 的约定，证书的组织单元（OU）表示角色
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		if ou == "admin" || ou == "client" || ou == "peer" || ou == "orderer" {
+			caller.Role = ou
+			break
+		}
+	}
+
+	if enrollmentID, ok, err := cid.GetAttributeValue(stub, "hf.EnrollmentID"); err != nil {
+		return nil, fmt.Errorf("无法获取证书属性: %v", err)
+	} else if ok && enrollmentID != "" {
+		caller.EnrollmentID = enrollmentID
+	}
+	if role, ok, err := cid.GetAttributeValue(stub, "hf.Type"); err != nil {
+		return nil, fmt.Errorf("无法获取证书属性: %v", err)
+	} else if ok && role != "" {
+		caller.Role = role
+	}
+
+	return caller, nil
+}
+
+// 判断调用者是否为管理员。调用者须属于初始化链码时指定的管理员 MSP，且按照 Fabric NodeOU 的约定，其证书的组织单元（OU）为 admin。
+func (uc *UniversalCC) isAdminHelper(stub shim.ChaincodeStubInterface) (bool, error) {
+	adminMSPIDsBytes, err := stub.GetState(AdminMSP)
+	if err != nil {
+		return false, fmt.Errorf("无法获取管理员的 MSP ID: %v", err)
+	}
+	if len(adminMSPIDsBytes) == 0 {
+		return false, nil
+	}
+
+	var adminMSPIDs []string
+	if err = json.Unmarshal(adminMSPIDsBytes, &adminMSPIDs); err != nil {
+		return false, fmt.Errorf("无法解析管理员的 MSP ID: %v", err)
+	}
+
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return false, fmt.Errorf("无法获取 MSP ID: %v", err)
+	}
+
+	isAdminMSP := false
+	for _, adminMSPID := range adminMSPIDs {
+		if mspID == adminMSPID {
+			isAdminMSP = true
+			break
+		}
+	}
+	if !isAdminMSP {
+		return false, nil
+	}
+
+	cert, err := cid.GetX509Certificate(stub)
+	if err != nil {
+		return false, fmt.Errorf("无法获取证书: %v", err)
+	}
+
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		if ou == "admin" {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
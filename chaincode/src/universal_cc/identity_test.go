@@ -1,17 +1,21 @@
 package main
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"testing"
 
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/identity"
 	"github.com/google/uuid"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/peer"
 )
 
 func TestGetDepartmentIdentityWithAttributedCert(t *testing.T) {
 	// 用带属性的证书初始化
 	stub := createMockStubWithCert(t, "TestGetDepartmentIdentityWithAttributedCert", exampleCertUser3)
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// 获取部门身份信息
 	targetFunction := "getDepartmentIdentity"
@@ -31,10 +35,144 @@ func TestGetDepartmentIdentityWithAttributedCert(t *testing.T) {
 func TestGetDepartmentIdentityWithExccesiveParameters(t *testing.T) {
 	// 用带属性的证书初始化
 	stub := createMockStubWithCert(t, "TestGetDepartmentIdentityWithAttributedCert", exampleCertUser3)
-	_ = initChaincode(stub, [][]byte{})
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
 
 	// 获取部门身份信息
 	targetFunction := "getDepartmentIdentity"
 	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte(targetFunction), []byte("EXCCESIVE_PARAMETER")})
 	expectResponseStatusERROR(t, &resp)
 }
+
+func TestGetDepartmentIdentityWithRegisteredAttributes(t *testing.T) {
+	stub := createMockStubWithCert(t, "TestGetDepartmentIdentityWithRegisteredAttributes", exampleCertAdmin1)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	// 管理员为 exampleCertUser3 登记 DeptName 与 DeptLevel
+	pkDER, _ := getPKDERFromCertString(exampleCertUser3)
+	update := identity.RegisteredAttributesUpdate{
+		PublicKey:  base64.StdEncoding.EncodeToString(pkDER),
+		Attributes: map[string]string{"DeptName": "813", "DeptLevel": "1"},
+		Reason:     "部门调整",
+	}
+	resp := invokeUpdateRegisteredAttributes(stub, update)
+	expectResponseStatusOK(t, &resp)
+	expectEqual(t, "1", string(resp.Payload))
+
+	// 登记的属性优先，未登记的属性仍取自证书
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertUser3))
+	deptIdentity := getDepartmentIdentityFromStub(t, stub)
+	expectEqual(t, "813", deptIdentity.DeptName)
+	expectEqual(t, 1, deptIdentity.DeptLevel)
+	expectEqual(t, "computer", deptIdentity.DeptType)
+	expectEqual(t, "804", deptIdentity.SuperDeptName)
+
+	// 清除登记后恢复为证书上的属性
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertAdmin1))
+	update.Attributes = nil
+	update.Reason = "撤销调整"
+	resp = invokeUpdateRegisteredAttributes(stub, update)
+	expectResponseStatusOK(t, &resp)
+	expectEqual(t, "2", string(resp.Payload))
+
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertUser3))
+	deptIdentity = getDepartmentIdentityFromStub(t, stub)
+	expectEqual(t, "812", deptIdentity.DeptName)
+	expectEqual(t, 2, deptIdentity.DeptLevel)
+
+	// 历史中保留所有版本
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("listRegisteredAttributesHistory"), []byte(update.PublicKey)})
+	expectResponseStatusOK(t, &resp)
+	var history []identity.RegisteredAttributesStored
+	err := json.Unmarshal(resp.Payload, &history)
+	expectNil(t, err)
+	if len(history) != 2 {
+		t.Fatalf("应有 2 个版本，实际为 %v 个", len(history))
+	}
+	expectEqual(t, 1, history[0].Version)
+	expectEqual(t, "部门调整", history[0].Reason)
+	expectEqual(t, "813", history[0].Attributes["DeptName"])
+	expectEqual(t, 2, history[1].Version)
+	expectEqual(t, 0, len(history[1].Attributes))
+
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("getRegisteredAttributes"), []byte(update.PublicKey)})
+	expectResponseStatusOK(t, &resp)
+	var registered identity.RegisteredAttributesStored
+	_ = json.Unmarshal(resp.Payload, &registered)
+	expectEqual(t, 2, registered.Version)
+}
+
+func TestUpdateRegisteredAttributesAsNonAdmin(t *testing.T) {
+	stub := createMockStubWithCert(t, "TestUpdateRegisteredAttributesAsNonAdmin", exampleCertUser3)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	pkDER, _ := getPKDERFromCertString(exampleCertUser3)
+	update := identity.RegisteredAttributesUpdate{
+		PublicKey:  base64.StdEncoding.EncodeToString(pkDER),
+		Attributes: map[string]string{"DeptLevel": "1"},
+	}
+	resp := invokeUpdateRegisteredAttributes(stub, update)
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeForbidden, resp.Message)
+}
+
+func TestUpdateRegisteredAttributesAsAdminOfOtherMSP(t *testing.T) {
+	pkDER, _ := getPKDERFromCertString(exampleCertUser3)
+	update := identity.RegisteredAttributesUpdate{
+		PublicKey:  base64.StdEncoding.EncodeToString(pkDER),
+		Attributes: map[string]string{"DeptLevel": "1"},
+	}
+
+	// 组织单元为 admin 但不属于管理员 MSP 的身份不是管理员
+	stub := createMockStubWithCert(t, "TestUpdateRegisteredAttributesAsAdminOfOtherMSP", exampleCertAdmin1)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+	setMockStubCreator(t, stub, "Org2MSP", []byte(exampleCertAdmin1))
+	resp := invokeUpdateRegisteredAttributes(stub, update)
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeForbidden, resp.Message)
+
+	// 初始化时未指定管理员 MSP 则没有管理员
+	stub = createMockStubWithCert(t, "TestUpdateRegisteredAttributesAsAdminOfOtherMSP", exampleCertAdmin1)
+	_ = initChaincode(stub, [][]byte{})
+	resp = invokeUpdateRegisteredAttributes(stub, update)
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeForbidden, resp.Message)
+}
+
+func TestUpdateRegisteredAttributesWithInvalidAttributes(t *testing.T) {
+	stub := createMockStubWithCert(t, "TestUpdateRegisteredAttributesWithInvalidAttributes", exampleCertAdmin1)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	pkDER, _ := getPKDERFromCertString(exampleCertUser3)
+	pkAsBase64 := base64.StdEncoding.EncodeToString(pkDER)
+	updates := []identity.RegisteredAttributesUpdate{
+		{PublicKey: pkAsBase64, Attributes: map[string]string{"Role": "admin"}},
+		{PublicKey: pkAsBase64, Attributes: map[string]string{"DeptLevel": "high"}},
+		{PublicKey: "", Attributes: map[string]string{"DeptLevel": "1"}},
+		{PublicKey: "NOT_BASE64!", Attributes: map[string]string{"DeptLevel": "1"}},
+	}
+
+	for _, update := range updates {
+		resp := invokeUpdateRegisteredAttributes(stub, update)
+		expectResponseStatusERROR(t, &resp)
+	}
+
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("getRegisteredAttributes"), []byte(pkAsBase64)})
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeNotFound, resp.Message)
+}
+
+func invokeUpdateRegisteredAttributes(stub *shimtest.MockStub, update identity.RegisteredAttributesUpdate) peer.Response {
+	updateBytes, _ := json.Marshal(update)
+	return stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("updateRegisteredAttributes"), updateBytes})
+}
+
+func getDepartmentIdentityFromStub(t *testing.T, stub *shimtest.MockStub) identity.DepartmentIdentityStored {
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("getDepartmentIdentity")})
+	expectResponseStatusOK(t, &resp)
+
+	var deptIdentity identity.DepartmentIdentityStored
+	err := json.Unmarshal(resp.Payload, &deptIdentity)
+	expectNil(t, err)
+
+	return deptIdentity
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/data"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/keyswitch"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/query"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+func (uc *UniversalCC) publishCollectiveKey(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 1 {
+		return shim.Error("参数数量不正确。应为 1 个")
+	}
+
+	// 只有管理员可以发布集合公钥
+	isAdmin, err := uc.isAdminHelper(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isAdmin {
+		return shim.Error(errorcode.CodeForbidden)
+	}
+
+	// 解析第 0 个参数为 keyswitch.CollectiveKey
+	var collectiveKey keyswitch.CollectiveKey
+	if err = json.Unmarshal([]byte(args[0]), &collectiveKey); err != nil {
+		return shim.Error(fmt.Sprintf("无法解析参数中的 JSON 对象: %v", err))
+	}
+
+	if pkBytes, err := base64.StdEncoding.DecodeString(collectiveKey.PublicKey); err != nil || len(pkBytes) != 64 {
+		return shim.Error("集合公钥应为 64 字节的 Base64 编码")
+	}
+
+	// 纪元须依次递增
+	latestEpoch, err := uc.getLatestCollectiveKeyEpochHelper(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if collectiveKey.Epoch != latestEpoch+1 {
+		return shim.Error(fmt.Sprintf("纪元应为 %v", latestEpoch+1))
+	}
+
+	creator, err := getPKDERFromStub(stub)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法获取创建者: %v", err))
+	}
+
+	timestamp, err := getTimeFromStub(stub)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法获得时间戳: %v", err))
+	}
+
+	collectiveKeyStored := keyswitch.CollectiveKeyStored{
+		Epoch:     collectiveKey.Epoch,
+		PublicKey: collectiveKey.PublicKey,
+		Creator:   base64.StdEncoding.EncodeToString(creator),
+		Timestamp: timestamp,
+	}
+	collectiveKeyStoredBytes, err := json.Marshal(collectiveKeyStored)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化集合公钥: %v", err))
+	}
+
+	// 最新的集合公钥另存一份，以便直接读取
+	if err = stub.PutState(getKeyForCollectiveKeyVersion(collectiveKey.Epoch), collectiveKeyStoredBytes); err != nil {
+		return shim.Error(fmt.Sprintf("无法存储集合公钥: %v", err))
+	}
+	if err = stub.PutState(getKeyForCollectiveKey(), collectiveKeyStoredBytes); err != nil {
+		return shim.Error(fmt.Sprintf("无法存储集合公钥: %v", err))
+	}
+
+	return shim.Success([]byte(stub.GetTxID()))
+}
+
+func (uc *UniversalCC) getCollectiveKey(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	lenArgs := len(args)
+	if lenArgs > 1 {
+		return shim.Error("参数数量不正确。应为 0 或 1 个")
+	}
+
+	// 未指定纪元时获取最新的集合公钥
+	dbKey := getKeyForCollectiveKey()
+	if lenArgs == 1 {
+		epoch, err := strconv.Atoi(args[0])
+		if err != nil {
+			return shim.Error(fmt.Sprintf("无法解析参数 epoch，值为 %v。应为整数", args[0]))
+		}
+		dbKey = getKeyForCollectiveKeyVersion(epoch)
+	}
+
+	collectiveKeyStoredBytes, err := stub.GetState(dbKey)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法读取集合公钥: %v", err))
+	}
+	if len(collectiveKeyStoredBytes) == 0 {
+		return shim.Error(errorcode.CodeNotFound)
+	}
+
+	return shim.Success(collectiveKeyStoredBytes)
+}
+
+// 获取最新发布的集合公钥的纪元。未发布过时为 0。
+func (uc *UniversalCC) getLatestCollectiveKeyEpochHelper(stub shim.ChaincodeStubInterface) (int, error) {
+	collectiveKeyStoredBytes, err := stub.GetState(getKeyForCollectiveKey())
+	if err != nil {
+		return 0, fmt.Errorf("无法读取集合公钥: %v", err)
+	}
+	if len(collectiveKeyStoredBytes) == 0 {
+		return 0, nil
+	}
+
+	var collectiveKeyStored keyswitch.CollectiveKeyStored
+	if err = json.Unmarshal(collectiveKeyStoredBytes, &collectiveKeyStored); err != nil {
+		return 0, fmt.Errorf("无法解析集合公钥: %v", err)
+	}
+
+	return collectiveKeyStored.Epoch, nil
+}
+
+func (uc *UniversalCC) updateResourceKey(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 1 {
+		return shim.Error("参数数量不正确。应为 1 个")
+	}
+
+	// 只有管理员可以更新资源的加密密钥
+	isAdmin, err := uc.isAdminHelper(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isAdmin {
+		return shim.Error(errorcode.CodeForbidden)
+	}
+
+	// 解析第 0 个参数为 keyswitch.ResourceKeyUpdate
+	var resourceKeyUpdate keyswitch.ResourceKeyUpdate
+	if err = json.Unmarshal([]byte(args[0]), &resourceKeyUpdate); err != nil {
+		return shim.Error(fmt.Sprintf("无法解析参数中的 JSON 对象: %v", err))
+	}
+
+	// 密钥须为 128 字节的密文，其中的点 K 与 C 均须在曲线上
+	keyDecoded, err := base64.StdEncoding.DecodeString(resourceKeyUpdate.Key)
+	if err != nil {
+		return shim.Error("无法解析密钥")
+	}
+	if _, err = deserializeCipherText(keyDecoded); err != nil {
+		return shim.Error(fmt.Sprintf("密钥不是合法的密文: %v", err))
+	}
+
+	// 只能更新为最新发布的纪元
+	latestEpoch, err := uc.getLatestCollectiveKeyEpochHelper(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if resourceKeyUpdate.Epoch != latestEpoch || latestEpoch == 0 {
+		return shim.Error(fmt.Sprintf("纪元应为最新发布的集合公钥的纪元 %v", latestEpoch))
+	}
+
+	resourceKeyEpoch, err := uc.getResourceKeyEpochHelper(stub, resourceKeyUpdate.ResourceID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if resourceKeyEpoch == nil {
+		return shim.Error(errorcode.CodeNotFound)
+	}
+	if resourceKeyEpoch.Epoch >= resourceKeyUpdate.Epoch {
+		return shim.Error(fmt.Sprintf("资源 '%v' 的密钥已处于纪元 %v", resourceKeyUpdate.ResourceID, resourceKeyEpoch.Epoch))
+	}
+
+	// 旧密钥按其纪元保留，以便撤销更新
+	if err = archiveResourceKeyHelper(stub, resourceKeyUpdate.ResourceID, resourceKeyEpoch.Epoch); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err = stub.PutState(getKeyForResKey(resourceKeyUpdate.ResourceID), keyDecoded); err != nil {
+		return shim.Error(fmt.Sprintf("无法存储密钥: %v", err))
+	}
+
+	if err = putResourceKeyEpochHelper(stub, resourceKeyUpdate.ResourceID, resourceKeyUpdate.Epoch, true); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success([]byte(stub.GetTxID()))
+}
+
+func (uc *UniversalCC) revertResourceKey(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 1 {
+		return shim.Error("参数数量不正确。应为 1 个")
+	}
+
+	// 只有管理员可以撤销资源密钥的更新
+	isAdmin, err := uc.isAdminHelper(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isAdmin {
+		return shim.Error(errorcode.CodeForbidden)
+	}
+
+	resourceID := args[0]
+	resourceKeyEpoch, err := uc.getResourceKeyEpochHelper(stub, resourceID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if resourceKeyEpoch == nil {
+		return shim.Error(errorcode.CodeNotFound)
+	}
+
+	// 找出保留的旧密钥中纪元最大者
+	startKey := getKeyPrefixForResKeyVersion(resourceID)
+	endKey := getKeyForResKeyVersion(resourceID, resourceKeyEpoch.Epoch)
+	resultsIterator, err := stub.GetStateByRange(startKey, endKey)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法查询旧密钥: %v", err))
+	}
+	defer resultsIterator.Close()
+
+	var previousKey []byte
+	previousEpoch := -1
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		previousKey = queryResponse.Value
+		if previousEpoch, err = strconv.Atoi(queryResponse.Key[len(startKey):]); err != nil {
+			return shim.Error(fmt.Sprintf("无法解析旧密钥的纪元: %v", err))
+		}
+	}
+	if previousEpoch < 0 {
+		return shim.Error(fmt.Sprintf("资源 '%v' 没有早于纪元 %v 的密钥", resourceID, resourceKeyEpoch.Epoch))
+	}
+
+	// 当前的密钥同样按其纪元保留，使撤销本身也可被撤销
+	if err = archiveResourceKeyHelper(stub, resourceID, resourceKeyEpoch.Epoch); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err = stub.PutState(getKeyForResKey(resourceID), previousKey); err != nil {
+		return shim.Error(fmt.Sprintf("无法存储密钥: %v", err))
+	}
+
+	if err = putResourceKeyEpochHelper(stub, resourceID, previousEpoch, true); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success([]byte(stub.GetTxID()))
+}
+
+// 将资源当前的加密密钥按其所属的纪元保留。
+func archiveResourceKeyHelper(stub shim.ChaincodeStubInterface, resourceID string, epoch int) error {
+	keyBytes, err := stub.GetState(getKeyForResKey(resourceID))
+	if err != nil {
+		return fmt.Errorf("无法读取密钥: %v", err)
+	}
+
+	if err = stub.PutState(getKeyForResKeyVersion(resourceID, epoch), keyBytes); err != nil {
+		return fmt.Errorf("无法保留旧密钥: %v", err)
+	}
+
+	return nil
+}
+
+func (uc *UniversalCC) getResourceKeyEpoch(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 1 {
+		return shim.Error("参数数量不正确。应为 1 个")
+	}
+
+	resourceKeyEpoch, err := uc.getResourceKeyEpochHelper(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if resourceKeyEpoch == nil {
+		return shim.Error(errorcode.CodeNotFound)
+	}
+
+	resourceKeyEpochBytes, err := json.Marshal(resourceKeyEpoch)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化资源的密钥纪元: %v", err))
+	}
+
+	return shim.Success(resourceKeyEpochBytes)
+}
+
+// 获取资源的加密密钥所属的纪元。未记录过纪元的资源属于纪元 0。资源没有加密密钥时返回 nil。
+func (uc *UniversalCC) getResourceKeyEpochHelper(stub shim.ChaincodeStubInterface, resourceID string) (*keyswitch.ResourceKeyEpochStored, error) {
+	keyBytes, err := stub.GetState(getKeyForResKey(resourceID))
+	if err != nil {
+		return nil, fmt.Errorf("无法读取密钥: %v", err)
+	}
+	if len(keyBytes) == 0 {
+		return nil, nil
+	}
+
+	resourceKeyEpochBytes, err := stub.GetState(getKeyForResKeyEpoch(resourceID))
+	if err != nil {
+		return nil, fmt.Errorf("无法读取资源的密钥纪元: %v", err)
+	}
+	if len(resourceKeyEpochBytes) == 0 {
+		return &keyswitch.ResourceKeyEpochStored{ResourceID: resourceID}, nil
+	}
+
+	var resourceKeyEpoch keyswitch.ResourceKeyEpochStored
+	if err = json.Unmarshal(resourceKeyEpochBytes, &resourceKeyEpoch); err != nil {
+		return nil, fmt.Errorf("无法解析资源的密钥纪元: %v", err)
+	}
+
+	return &resourceKeyEpoch, nil
+}
+
+// 记录资源的加密密钥所属的纪元。`isUpdate` 为真时记录调用者为更新者。
+func putResourceKeyEpochHelper(stub shim.ChaincodeStubInterface, resourceID string, epoch int, isUpdate bool) error {
+	timestamp, err := getTimeFromStub(stub)
+	if err != nil {
+		return fmt.Errorf("无法获得时间戳: %v", err)
+	}
+
+	resourceKeyEpoch := keyswitch.ResourceKeyEpochStored{
+		ResourceID: resourceID,
+		Epoch:      epoch,
+		Timestamp:  timestamp,
+	}
+
+	if isUpdate {
+		updater, err := getPKDERFromStub(stub)
+		if err != nil {
+			return fmt.Errorf("无法获取调用者: %v", err)
+		}
+		resourceKeyEpoch.Updater = base64.StdEncoding.EncodeToString(updater)
+	}
+
+	resourceKeyEpochBytes, err := json.Marshal(resourceKeyEpoch)
+	if err != nil {
+		return fmt.Errorf("无法序列化资源的密钥纪元: %v", err)
+	}
+
+	if err = stub.PutState(getKeyForResKeyEpoch(resourceID), resourceKeyEpochBytes); err != nil {
+		return fmt.Errorf("无法存储资源的密钥纪元: %v", err)
+	}
+
+	return nil
+}
+
+// 检查创建资源时声明的密钥纪元，并在其不为 0 时记录。纪元不能超过最新发布的集合公钥的纪元。
+func (uc *UniversalCC) recordResourceKeyEpochOnCreationHelper(stub shim.ChaincodeStubInterface, resourceID string, epoch int) error {
+	if epoch == 0 {
+		return nil
+	}
+
+	latestEpoch, err := uc.getLatestCollectiveKeyEpochHelper(stub)
+	if err != nil {
+		return err
+	}
+	if epoch < 0 || epoch > latestEpoch {
+		return fmt.Errorf("密钥纪元应在 0 至 %v 之间", latestEpoch)
+	}
+
+	return putResourceKeyEpochHelper(stub, resourceID, epoch, false)
+}
+
+func (uc *UniversalCC) listEncryptedResourceIDs(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 2 {
+		return shim.Error("参数数量不正确。应为 2 个")
+	}
+
+	// args = [pageSize int, bookmark string]
+	pageSizeStr := args[0]
+	pageSize, err := strconv.Atoi(pageSizeStr)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法解析参数 pageSize，值为 %v。应为正整数", pageSizeStr))
+	}
+	if pageSize <= 0 {
+		return shim.Error(fmt.Sprintf("参数 pageSize 值为 %v。应为正整数", pageSizeStr))
+	}
+
+	bookmarkBytes, err := base64.StdEncoding.DecodeString(args[1])
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法解析书签: %v", err))
+	}
+	bookmark := string(bookmarkBytes)
+
+	// 加密资源与链下资源带有加密的对称密钥
+	queryConditions := map[string]interface{}{
+		"selector": map[string]interface{}{
+			"resourceType": map[string]interface{}{
+				"$in": []data.ResourceType{data.Encrypted, data.Offchain},
+			},
+		},
+	}
+	queryConditionsBytes, err := json.Marshal(queryConditions)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化查询条件: %v", err))
+	}
+
+	it, respMetadata, err := stub.GetQueryResultWithPagination(string(queryConditionsBytes), int32(pageSize), bookmark)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法执行条件查询: %v", err))
+	}
+
+	defer it.Close()
+
+	resourceIDs := []string{}
+	for it.HasNext() {
+		entry, err := it.Next()
+		if err != nil {
+			return shim.Error(fmt.Sprintf("无法执行条件查询: %v", err))
+		}
+
+		resourceID, err := extractResourceIDFromKeyForResMetadata(entry.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		resourceIDs = append(resourceIDs, resourceID)
+	}
+
+	paginationResult := query.IDsWithPagination{
+		IDs:      resourceIDs,
+		Bookmark: base64.StdEncoding.EncodeToString([]byte(respMetadata.Bookmark)),
+	}
+	paginationResultAsBytes, err := json.Marshal(paginationResult)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化结果列表: %v", err))
+	}
+
+	return shim.Success(paginationResultAsBytes)
+}
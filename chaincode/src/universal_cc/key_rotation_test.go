@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/keyswitch"
+	"github.com/XiaoYao-austin/ppks"
+	"github.com/google/uuid"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+func TestPublishCollectiveKey(t *testing.T) {
+	stub := createMockStubWithCert(t, "TestPublishCollectiveKey", exampleCertUser3)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	// 未发布过集合公钥
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("getCollectiveKey")})
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeNotFound, resp.Message)
+
+	// 非管理员不能发布
+	resp = invokePublishCollectiveKey(stub, 1)
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeForbidden, resp.Message)
+
+	// 纪元须依次递增
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertAdmin1))
+	resp = invokePublishCollectiveKey(stub, 2)
+	expectResponseStatusERROR(t, &resp)
+
+	resp = invokePublishCollectiveKey(stub, 1)
+	expectResponseStatusOK(t, &resp)
+	resp = invokePublishCollectiveKey(stub, 1)
+	expectResponseStatusERROR(t, &resp)
+	resp = invokePublishCollectiveKey(stub, 2)
+	expectResponseStatusOK(t, &resp)
+
+	// 默认获取最新的集合公钥，也可按纪元获取
+	expectEqual(t, 2, getCollectiveKeyForTest(t, stub).Epoch)
+	expectEqual(t, 1, getCollectiveKeyForTest(t, stub, 1).Epoch)
+}
+
+func TestUpdateResourceKey(t *testing.T) {
+	stub := createMockStubWithCert(t, "TestUpdateResourceKey", exampleCertAdmin1)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	keys := getSampleEncryptedKeysForTest(t, 3)
+	createSampleEncryptedDataWithIDAndKey(t, stub, "101", keys[0], `DeptType == "computer"`)
+
+	// 创建时未声明纪元的资源属于纪元 0
+	expectEqual(t, 0, getResourceKeyEpochForTest(t, stub, "101").Epoch)
+
+	// 只能更新为已发布的最新纪元
+	resp := invokeUpdateResourceKey(stub, "101", keys[1], 1)
+	expectResponseStatusERROR(t, &resp)
+
+	resp = invokePublishCollectiveKey(stub, 1)
+	expectResponseStatusOK(t, &resp)
+
+	resp = invokeUpdateResourceKey(stub, "102", keys[1], 1)
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeNotFound, resp.Message)
+
+	// 密钥须为点均在曲线上的 128 字节密文
+	notOnCurve := append([]byte{}, keys[1]...)
+	notOnCurve[127] ^= 1
+	for _, invalidKey := range [][]byte{[]byte("key1"), keys[1][:64], notOnCurve} {
+		resp = invokeUpdateResourceKey(stub, "101", invalidKey, 1)
+		expectResponseStatusERROR(t, &resp)
+	}
+	expectEqual(t, keys[0], stub.State[getKeyForResKey("101")])
+
+	resp = invokeUpdateResourceKey(stub, "101", keys[1], 1)
+	expectResponseStatusOK(t, &resp)
+	expectEqual(t, keys[1], stub.State[getKeyForResKey("101")])
+
+	// 旧密钥按其纪元保留
+	expectEqual(t, keys[0], stub.State[getKeyForResKeyVersion("101", 0)])
+
+	resourceKeyEpoch := getResourceKeyEpochForTest(t, stub, "101")
+	expectEqual(t, 1, resourceKeyEpoch.Epoch)
+	pkDER, err := getPKDERFromCertString(exampleCertAdmin1)
+	expectNil(t, err)
+	expectEqual(t, base64.StdEncoding.EncodeToString(pkDER), resourceKeyEpoch.Updater)
+
+	// 已处于该纪元的资源不再更新
+	resp = invokeUpdateResourceKey(stub, "101", keys[2], 1)
+	expectResponseStatusERROR(t, &resp)
+	expectEqual(t, keys[1], stub.State[getKeyForResKey("101")])
+
+	// 非管理员不能更新
+	resp = invokePublishCollectiveKey(stub, 2)
+	expectResponseStatusOK(t, &resp)
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertUser3))
+	resp = invokeUpdateResourceKey(stub, "101", keys[2], 2)
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeForbidden, resp.Message)
+}
+
+func TestRevertResourceKey(t *testing.T) {
+	stub := createMockStubWithCert(t, "TestRevertResourceKey", exampleCertAdmin1)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	keys := getSampleEncryptedKeysForTest(t, 3)
+	createSampleEncryptedDataWithIDAndKey(t, stub, "101", keys[0], `DeptType == "computer"`)
+
+	// 没有旧密钥时无法撤销
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("revertResourceKey"), []byte("101")})
+	expectResponseStatusERROR(t, &resp)
+
+	resp = invokePublishCollectiveKey(stub, 1)
+	expectResponseStatusOK(t, &resp)
+	resp = invokeUpdateResourceKey(stub, "101", keys[1], 1)
+	expectResponseStatusOK(t, &resp)
+	resp = invokePublishCollectiveKey(stub, 2)
+	expectResponseStatusOK(t, &resp)
+	resp = invokeUpdateResourceKey(stub, "101", keys[2], 2)
+	expectResponseStatusOK(t, &resp)
+
+	// 非管理员不能撤销
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertUser3))
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("revertResourceKey"), []byte("101")})
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeForbidden, resp.Message)
+
+	// 每次撤销恢复纪元最近的旧密钥
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertAdmin1))
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("revertResourceKey"), []byte("101")})
+	expectResponseStatusOK(t, &resp)
+	expectEqual(t, keys[1], stub.State[getKeyForResKey("101")])
+	expectEqual(t, 1, getResourceKeyEpochForTest(t, stub, "101").Epoch)
+
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("revertResourceKey"), []byte("101")})
+	expectResponseStatusOK(t, &resp)
+	expectEqual(t, keys[0], stub.State[getKeyForResKey("101")])
+	expectEqual(t, 0, getResourceKeyEpochForTest(t, stub, "101").Epoch)
+
+	// 撤销后可再次更新为最新纪元，被撤销的密钥仍保留
+	expectEqual(t, keys[2], stub.State[getKeyForResKeyVersion("101", 2)])
+	resp = invokeUpdateResourceKey(stub, "101", keys[2], 2)
+	expectResponseStatusOK(t, &resp)
+	expectEqual(t, keys[2], stub.State[getKeyForResKey("101")])
+}
+
+func TestCreateEncryptedDataWithKeyEpoch(t *testing.T) {
+	stub := createMockStubWithCert(t, "TestCreateEncryptedDataWithKeyEpoch", exampleCertAdmin1)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	sampleEncryptedData := getSampleEncryptedData1()
+	sampleEncryptedData.KeyEpoch = 1
+	dataBytes, _ := json.Marshal(sampleEncryptedData)
+
+	// 纪元不能超过最新发布的集合公钥的纪元
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("createEncryptedData"), dataBytes})
+	expectResponseStatusERROR(t, &resp)
+
+	resp = invokePublishCollectiveKey(stub, 1)
+	expectResponseStatusOK(t, &resp)
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("createEncryptedData"), dataBytes})
+	expectResponseStatusOK(t, &resp)
+
+	expectEqual(t, 1, getResourceKeyEpochForTest(t, stub, sampleEncryptedData.Metadata.ResourceID).Epoch)
+}
+
+// 生成若干个以随机公钥加密的密钥（序列化后）
+func getSampleEncryptedKeysForTest(t *testing.T, n int) [][]byte {
+	sk, err := ppks.GenPrivKey()
+	expectNil(t, err)
+
+	var keys [][]byte
+	for i := 0; i < n; i++ {
+		encryptedKey, err := ppks.PointEncrypt(&sk.PublicKey, ppks.GenPoint())
+		expectNil(t, err)
+		keys = append(keys, serializeCipherTextForTest(encryptedKey))
+	}
+
+	return keys
+}
+
+func invokePublishCollectiveKey(stub *shimtest.MockStub, epoch int) peer.Response {
+	collectiveKey := keyswitch.CollectiveKey{
+		Epoch:     epoch,
+		PublicKey: getSampleServerKeySwitchPK(),
+	}
+	collectiveKeyBytes, _ := json.Marshal(collectiveKey)
+
+	return stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("publishCollectiveKey"), collectiveKeyBytes})
+}
+
+func invokeUpdateResourceKey(stub *shimtest.MockStub, resourceID string, encryptedKey []byte, epoch int) peer.Response {
+	resourceKeyUpdate := keyswitch.ResourceKeyUpdate{
+		ResourceID: resourceID,
+		Key:        base64.StdEncoding.EncodeToString(encryptedKey),
+		Epoch:      epoch,
+	}
+	resourceKeyUpdateBytes, _ := json.Marshal(resourceKeyUpdate)
+
+	return stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("updateResourceKey"), resourceKeyUpdateBytes})
+}
+
+func getCollectiveKeyForTest(t *testing.T, stub *shimtest.MockStub, epoch ...int) *keyswitch.CollectiveKeyStored {
+	args := [][]byte{[]byte("getCollectiveKey")}
+	for _, e := range epoch {
+		args = append(args, []byte(strconv.Itoa(e)))
+	}
+
+	resp := stub.MockInvoke(uuid.NewString(), args)
+	expectResponseStatusOK(t, &resp)
+
+	var collectiveKeyStored keyswitch.CollectiveKeyStored
+	err := json.Unmarshal(resp.Payload, &collectiveKeyStored)
+	expectNil(t, err)
+
+	return &collectiveKeyStored
+}
+
+func getResourceKeyEpochForTest(t *testing.T, stub *shimtest.MockStub, resourceID string) *keyswitch.ResourceKeyEpochStored {
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("getResourceKeyEpoch"), []byte(resourceID)})
+	expectResponseStatusOK(t, &resp)
+
+	var resourceKeyEpoch keyswitch.ResourceKeyEpochStored
+	err := json.Unmarshal(resp.Payload, &resourceKeyEpoch)
+	expectNil(t, err)
+
+	return &resourceKeyEpoch
+}
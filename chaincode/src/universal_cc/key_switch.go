@@ -5,17 +5,19 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"strings"
+	"time"
 
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/auth"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/keyswitch"
-	"github.com/casbin/casbin"
-	"github.com/casbin/casbin/model"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/policy"
 	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-protos-go/peer"
 )
 
+// 未配置时密钥置换会话的有效期（秒）
+const defaultKeySwitchSessionTTL = 600
+
 func (uc *UniversalCC) createKeySwitchTrigger(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 	// 检查参数个数
 	if len(args) != 2 {
@@ -38,19 +40,24 @@ func (uc *UniversalCC) createKeySwitchTrigger(stub shim.ChaincodeStubInterface,
 	// 获取ksSessionID
 	ksSessionID := stub.GetTxID()
 
-	// 获取 authSessionID
-	validationResult := false
-	authSessionID := ksTrigger.AuthSessionID
+	// 确定会话涵盖的资源。多资源会话以 resourceIDs 指定资源，并以 authSessionIDs 按资源指定授权会话。
+	resourceIDs := []string{ksTrigger.ResourceID}
+	authSessionIDs := map[string]string{ksTrigger.ResourceID: ksTrigger.AuthSessionID}
+	if len(ksTrigger.ResourceIDs) != 0 {
+		if ksTrigger.ResourceID != "" || ksTrigger.AuthSessionID != "" {
+			return shim.Error("多资源会话应以 resourceIDs 指定资源，并以 authSessionIDs 指定授权会话")
+		}
 
-	// 获取 resourceID，验证资源是否存在
-	resourceID := ksTrigger.ResourceID
-	key := getKeyForResMetadata(resourceID)
-	metadata, err := stub.GetState(key)
-	if err != nil {
-		return shim.Error(fmt.Sprintf("无法确定元数据的可用性: %v", err))
+		resourceIDs = ksTrigger.ResourceIDs
+		authSessionIDs = ksTrigger.AuthSessionIDs
 	}
-	if metadata == nil {
-		return shim.Error("资源 ID 不存在")
+
+	isResourceIDSeen := map[string]bool{}
+	for _, resourceID := range resourceIDs {
+		if isResourceIDSeen[resourceID] {
+			return shim.Error(fmt.Sprintf("资源 ID '%v' 重复", resourceID))
+		}
+		isResourceIDSeen[resourceID] = true
 	}
 
 	// 获取创建者与时间戳
@@ -70,127 +77,180 @@ func (uc *UniversalCC) createKeySwitchTrigger(stub shim.ChaincodeStubInterface,
 		return shim.Error("用于密钥置换的公钥未指定")
 	}
 
+	// 用于密钥置换的公钥须已登记在调用者名下，以免份额被导向他人的公钥
+	ksPKRegistration, err := uc.getKeySwitchPKRegistrationHelper(stub, creatorAsBase64, ksTrigger.KeySwitchPK)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if ksPKRegistration == nil {
+		return shim.Error(errorcode.CodeForbidden)
+	}
+
+	// 链下交付份额的地址须为该公钥登记时一并登记的地址，以免密钥置换服务器被导向任意地址
+	if ksTrigger.ShareDeliveryURL != "" && ksTrigger.ShareDeliveryURL != ksPKRegistration.ShareDeliveryURL {
+		return shim.Error("链下交付份额的地址应为登记密钥置换公钥时登记的地址")
+	}
+
+	// 逐个资源进行授权或访问策略检查，任一资源未通过即拒绝整个会话
+	for _, resourceID := range resourceIDs {
+		if err = uc.validateKeySwitchResourceHelper(stub, resourceID, authSessionIDs[resourceID], creatorAsBase64); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	validationResult := true
+
+	// 按链上的会话配置确定会话完成所需的份额数量与过期时间
+	ksSessionConfig, err := uc.getKeySwitchSessionConfigHelper(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	numSharesExpected := ksSessionConfig.Threshold
+	if numSharesExpected == 0 {
+		ksServers, err := uc.listKeySwitchServersHelper(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		numSharesExpected = len(ksServers)
+	}
+
+	// 构建 KeySwitchTriggerStored 并存储上链
+	ksTriggerToBeStored := keyswitch.KeySwitchTriggerStored{
+		KeySwitchSessionID: ksSessionID,
+		ResourceID:         ksTrigger.ResourceID,
+		ResourceIDs:        ksTrigger.ResourceIDs,
+		AuthSessionID:      ksTrigger.AuthSessionID,
+		AuthSessionIDs:     ksTrigger.AuthSessionIDs,
+		Creator:            creatorAsBase64,
+		KeySwitchPK:        ksTrigger.KeySwitchPK,
+		Timestamp:          timestamp,
+		ValidationResult:   validationResult,
+		State:              keyswitch.Open,
+		NumSharesExpected:  numSharesExpected,
+		ExpiresAt:          timestamp.Add(time.Duration(ksSessionConfig.SessionTTL) * time.Second),
+		ShareDeliveryURL:   ksTrigger.ShareDeliveryURL,
+	}
+	data, err := json.Marshal(ksTriggerToBeStored)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化 KeySwitchTriggerStored: %v", err))
+	}
+	key := getKeyForKeySwitchTrigger(ksSessionID)
+	err = stub.PutState(key, data)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法存储 KeySwitchTriggerStored: %v", err))
+	}
+
+	// 发事件
+	err = stub.SetEvent(eventID, data)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法生成事件 '%v': %v", eventID, err))
+	}
+
+	return shim.Success([]byte(ksSessionID))
+}
+
+// 检查访问申请者能否访问某一资源。指定了授权会话时依据其批复，否则依据资源的访问策略。
+//
+// 参数：
+//   资源 ID
+//   授权会话 ID。为空时执行 ABAC。
+//   访问申请者的公钥（Base64 编码）
+//
+// 返回：
+//   资源不存在、未获授权或不满足访问策略时的错误
+func (uc *UniversalCC) validateKeySwitchResourceHelper(stub shim.ChaincodeStubInterface, resourceID string, authSessionID string, creatorAsBase64 string) error {
+	// 验证资源是否存在
+	metadata, err := stub.GetState(getKeyForResMetadata(resourceID))
+	if err != nil {
+		return fmt.Errorf("无法确定元数据的可用性: %v", err)
+	}
+	if metadata == nil {
+		return fmt.Errorf("资源 ID 不存在")
+	}
+
 	if authSessionID != "" {
 		// 获取 AuthRequestStored，验证其中资源 ID 是否相同。若请求不存在，则另外报错。
 		authReq := uc.getAuthRequest(stub, []string{authSessionID})
 		if authReq.Payload == nil {
-			return shim.Error("该授权会话不存在")
+			return fmt.Errorf("该授权会话不存在")
 		}
 		var authRequestStored auth.AuthRequestStored
 		err = json.Unmarshal(authReq.Payload, &authRequestStored)
 		if err != nil {
-			return shim.Error(fmt.Sprintf("AuthRequestStored 无法解析成 JSON 对象: %v", err))
+			return fmt.Errorf("AuthRequestStored 无法解析成 JSON 对象: %v", err)
 		}
 		if authRequestStored.ResourceID != resourceID {
-			return shim.Error("资源 ID 与授权会话 ID 不匹配")
+			return fmt.Errorf("资源 ID 与授权会话 ID 不匹配")
 		}
 
 		// 验证 AuthRequestStored.Creator 是否等于链码调用者 Creator
 		if authRequestStored.Creator != creatorAsBase64 {
-			return shim.Error("不是申请授权者本人")
+			return fmt.Errorf("不是申请授权者本人")
 		}
 
-		// 如果 authSessionID 不为空值，则获取 AuthResponseStored，并解析成 JSON 对象。若批复不存在，则另外报错。
+		// 获取 AuthResponseStored，并解析成 JSON 对象。若批复不存在，则另外报错。
 		authResp, err := uc.getAuthResponseHelper(stub, authSessionID)
 		if err != nil {
 			if err == errorcode.ErrorNotFound {
-				return shim.Error("该授权会话申请未得到批复")
-			} else {
-				return shim.Error(err.Error())
+				return fmt.Errorf("该授权会话申请未得到批复")
 			}
+			return err
 		}
 
 		var authResponseStored auth.AuthResponseStored
 		err = json.Unmarshal(authResp, &authResponseStored)
 		if err != nil {
-			return shim.Error(fmt.Sprintf("AuthResponseStored 无法解析成 JSON 对象: %v", err))
+			return fmt.Errorf("AuthResponseStored 无法解析成 JSON 对象: %v", err)
 		}
 
 		// 根据 AuthResponseStored 中的结果得到最终判断结果
-		if authResponseStored.Result == true {
-			validationResult = true
-		} else {
-			return shim.Error(errorcode.CodeForbidden)
-		}
-	} else {
-		// 如果 authSessionID 为空值，执行 abac
-		// 从当前客户端的证书上获取部门信息
-		deptIdentity, err := uc.getDepartmentIdentityHelper(stub)
-		if err != nil {
-			return shim.Error(err.Error())
+		if !authResponseStored.Result {
+			return fmt.Errorf(errorcode.CodeForbidden)
 		}
 
-		// 根据资源 ID，得到资源的访问策略
-		resourceID := ksTrigger.ResourceID
-		key := getKeyForResPolicy(resourceID)
-		Policy, err := stub.GetState(key)
-		if err != nil {
-			return shim.Error(fmt.Sprintf("无法确定 policy 的可用性: %v", err))
-		}
-		if Policy == nil {
-			return shim.Error("该资源的访问策略不存在")
-		}
+		return nil
+	}
 
-		// TODO:完善访问策略
-		s := string(Policy)
-		parts := strings.Split(s, "|| ")
-		s = strings.Join(parts, "|| r.sub.")
-		parts = strings.Split(s, "(")
-		s = strings.Join(parts, "(r.sub.")
-		parts = strings.Split(s, "&& ")
-		s = strings.Join(parts, "&& r.sub.")
-		policy := "m = " + s
-
-		// 执行abac，并得到最终判断结果
-		modeltext := `
-		[request_definition]
-		r = sub, obj
-	
-		[policy_definition]
-		p = act
-	
-		[policy_effect]
-		e = some(where (p.eft == allow))
-	
-		[matchers]
-		`
-		modeltext = modeltext + policy
-		m := model.Model{}
-		m.LoadModelFromText(modeltext)
-		e := casbin.NewEnforcer(m)
-		validationResult = e.Enforce(deptIdentity, "", "")
-		if validationResult == false {
-			return shim.Error(errorcode.CodeForbidden)
-		}
+	// 未指定授权会话时执行 abac
+	// 从当前客户端的证书上获取部门信息
+	deptIdentity, err := uc.getDepartmentIdentityHelper(stub)
+	if err != nil {
+		return err
 	}
 
-	// 构建 KeySwitchTriggerStored 并存储上链
-	ksTriggerToBeStored := keyswitch.KeySwitchTriggerStored{
-		KeySwitchSessionID: ksSessionID,
-		ResourceID:         ksTrigger.ResourceID,
-		AuthSessionID:      authSessionID,
-		Creator:            creatorAsBase64,
-		KeySwitchPK:        ksTrigger.KeySwitchPK,
-		Timestamp:          timestamp,
-		ValidationResult:   validationResult,
+	// 根据资源 ID，得到资源的访问策略。引用了策略模板的资源使用其固定版本中的策略。
+	policyText, err := uc.getResourcePolicyHelper(stub, resourceID)
+	if err != nil {
+		if err == errorcode.ErrorNotFound {
+			return fmt.Errorf("该资源的访问策略不存在")
+		}
+		return err
 	}
-	data, err := json.Marshal(ksTriggerToBeStored)
+
+	// 解析访问策略，以部门身份信息、组织层级谓词与上下文属性求值，得到最终判断结果
+	expr, err := policy.Parse(policyText)
 	if err != nil {
-		return shim.Error(fmt.Sprintf("无法序列化 KeySwitchTriggerStored: %v", err))
+		return fmt.Errorf("无法解析访问策略: %v", err)
 	}
-	key = getKeyForKeySwitchTrigger(ksSessionID)
-	err = stub.PutState(key, data)
+
+	attrs, err := uc.getPolicyAttributesHelper(stub, deptIdentity, resourceID)
 	if err != nil {
-		return shim.Error(fmt.Sprintf("无法存储 KeySwitchTriggerStored: %v", err))
+		return err
 	}
 
-	// 发事件
-	err = stub.SetEvent(eventID, data)
+	validationResult, err := expr.Evaluate(attrs)
 	if err != nil {
-		return shim.Error(fmt.Sprintf("无法生成事件 '%v': %v", eventID, err))
+		return fmt.Errorf("无法对访问策略求值: %v", err)
+	}
+	if !validationResult {
+		// 附上不满足的条件，以便申请者了解被拒绝的原因
+		denialMessage, err := uc.getPolicyDenialMessageHelper(stub, resourceID, expr, attrs)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%s", denialMessage)
 	}
 
-	return shim.Success([]byte(ksSessionID))
+	return nil
 }
 
 func (uc *UniversalCC) createKeySwitchResult(stub shim.ChaincodeStubInterface, args []string) peer.Response {
@@ -218,16 +278,102 @@ func (uc *UniversalCC) createKeySwitchResult(stub shim.ChaincodeStubInterface, a
 		return shim.Error("该 KeySwitchTriggerStored 不存在")
 	}
 
-	// 获取创建者与时间戳
+	// 只接受仍处于开放状态的会话的结果
+	timestamp, err := getTimeFromStub(stub)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法获得时间戳: %v", err))
+	}
+	switch getKeySwitchSessionStateHelper(ksTriggerStored, timestamp) {
+	case keyswitch.Complete:
+		return shim.Error("密钥置换会话已完成")
+	case keyswitch.Expired:
+		return shim.Error("密钥置换会话已过期")
+	}
+
+	// 获取创建者
 	creator, err := getPKDERFromStub(stub)
 	if err != nil {
 		return shim.Error(fmt.Sprintf("无法获取创建者: %v", err))
 	}
 	creatorAsBase64 := base64.StdEncoding.EncodeToString(creator)
 
-	timestamp, err := getTimeFromStub(stub)
+	// 只接受已登记的密钥置换服务器以其登记的密钥置换公钥提交的结果
+	server, err := uc.getKeySwitchServerHelper(stub, creatorAsBase64)
 	if err != nil {
-		return shim.Error(fmt.Sprintf("无法获得时间戳: %v", err))
+		return shim.Error(err.Error())
+	}
+	if server == nil {
+		return shim.Error(errorcode.CodeForbidden)
+	}
+	if server.KeySwitchPK != ksResult.KeySwitchPK {
+		return shim.Error("密钥置换公钥与该服务器登记的不一致")
+	}
+
+	// 每个服务器在一个会话中只能提交一次结果
+	key := getKeyForKeySwitchResponse(ksSessionID, creatorAsBase64)
+	existingResult, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法确定 KeySwitchResultStored 的可用性: %v", err))
+	}
+	if len(existingResult) != 0 {
+		return shim.Error("该服务器已提交过此会话的密钥置换结果")
+	}
+
+	// 链下交付份额的结果只带有份额的承诺，只有启用了链下份额交付的会话接受
+	isCommitted := ksResult.Commitment != ""
+	for _, resourceShare := range ksResult.Shares {
+		isCommitted = isCommitted || resourceShare.Commitment != ""
+	}
+	if isCommitted && ksTriggerStored.ShareDeliveryURL == "" {
+		return shim.Error("该密钥置换会话未启用链下份额交付")
+	}
+
+	// 以触发器中访问申请者的密钥置换公钥与资源的加密密钥验证份额，拒绝未通过验证的份额。多资源会话须按触发器中资源的顺序为每个资源提交一份份额。
+	sharesToVerify := []keyswitch.KeySwitchResult{ksResult}
+	resourceIDs := ksTriggerStored.GetResourceIDs()
+	if len(ksTriggerStored.ResourceIDs) != 0 {
+		if len(ksResult.Shares) != len(resourceIDs) {
+			return shim.Error(fmt.Sprintf("份额数量不正确。应为 %v 份", len(resourceIDs)))
+		}
+
+		sharesToVerify = nil
+		for i, resourceShare := range ksResult.Shares {
+			if resourceShare.ResourceID != resourceIDs[i] {
+				return shim.Error(fmt.Sprintf("第 %v 份份额的资源 ID 应为 '%v'", i, resourceIDs[i]))
+			}
+			sharesToVerify = append(sharesToVerify, keyswitch.KeySwitchResult{
+				Share:       resourceShare.Share,
+				ZKProof:     resourceShare.ZKProof,
+				KeySwitchPK: ksResult.KeySwitchPK,
+				Commitment:  resourceShare.Commitment,
+			})
+		}
+	}
+
+	for i, resourceID := range resourceIDs {
+		// 链码无法验证链下交付的份额，只检查承诺的形式。份额由访问申请者收到后以承诺核对并验证。
+		if isCommitted {
+			if err = checkKeySwitchShareCommitmentHelper(&sharesToVerify[i]); err != nil {
+				return shim.Error(err.Error())
+			}
+			continue
+		}
+
+		encryptedKeyBytes, err := stub.GetState(getKeyForResKey(resourceID))
+		if err != nil {
+			return shim.Error(fmt.Sprintf("无法读取密钥: %v", err))
+		}
+		if len(encryptedKeyBytes) == 0 {
+			return shim.Error(fmt.Sprintf("资源 '%v' 的密钥不存在", resourceID))
+		}
+
+		isShareVerified, err := verifyKeySwitchShareHelper(&sharesToVerify[i], ksTriggerStored.KeySwitchPK, encryptedKeyBytes)
+		if err != nil {
+			return shim.Error(fmt.Sprintf("无法验证份额: %v", err))
+		}
+		if !isShareVerified {
+			return shim.Error("份额未通过零知识证明验证")
+		}
 	}
 
 	// 构建 KeySwitchResultStored 并存储上链
@@ -235,22 +381,42 @@ func (uc *UniversalCC) createKeySwitchResult(stub shim.ChaincodeStubInterface, a
 		KeySwitchSessionID: ksSessionID,
 		Share:              ksResult.Share,
 		ZKProof:            ksResult.ZKProof,
+		Shares:             ksResult.Shares,
 		KeySwitchPK:        ksResult.KeySwitchPK,
 		Creator:            creatorAsBase64,
 		Timestamp:          timestamp,
+		ValidationResult:   !isCommitted,
+		Commitment:         ksResult.Commitment,
 	}
 	data, err := json.Marshal(ksResultStored)
 	if err != nil {
 		return shim.Error(fmt.Sprintf("无法序列化 KeySwitchResultStored: %v", err))
 	}
-	key := getKeyForKeySwitchResponse(ksSessionID, creatorAsBase64)
 	err = stub.PutState(key, data)
 	if err != nil {
 		return shim.Error(fmt.Sprintf("无法存储 KeySwitchResultStored: %v", err))
 	}
 
-	// 发事件
+	// 收齐所需的通过验证的份额后将会话标记为完成。由于一笔交易只能发出一个事件，此时以完成事件代替结果事件，两者内容相同。
+	// 链下交付的份额未经链码验证，不计入其中，因此启用链下份额交付的会话保持开放直至过期。
 	eventID := getKeyPrefixForKeySwitchResponse(ksSessionID)
+	numResults, err := countVerifiedKeySwitchResultsHelper(stub, ksSessionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if ksTriggerStored.NumSharesExpected > 0 && numResults >= ksTriggerStored.NumSharesExpected {
+		ksTriggerStored.State = keyswitch.Complete
+		ksTriggerBytes, err := json.Marshal(ksTriggerStored)
+		if err != nil {
+			return shim.Error(fmt.Sprintf("无法序列化 KeySwitchTriggerStored: %v", err))
+		}
+		if err = stub.PutState(getKeyForKeySwitchTrigger(ksSessionID), ksTriggerBytes); err != nil {
+			return shim.Error(fmt.Sprintf("无法存储 KeySwitchTriggerStored: %v", err))
+		}
+		eventID = getEventIDForKeySwitchCompletion(ksSessionID)
+	}
+
+	// 发事件
 	value := getKeyForKeySwitchResponse(ksSessionID, creatorAsBase64)
 	err = stub.SetEvent(eventID, []byte(value))
 	if err != nil {
@@ -283,6 +449,148 @@ func (uc *UniversalCC) getKeySwitchTriggerHelper(stub shim.ChaincodeStubInterfac
 	return &keySwitchTriggerStored, nil
 }
 
+func (uc *UniversalCC) getKeySwitchTrigger(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数个数
+	if len(args) != 1 {
+		return shim.Error("参数数量不正确。应为 1 个")
+	}
+
+	ksTriggerStored, err := uc.getKeySwitchTriggerHelper(stub, args[0])
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法确定 KeySwitchTriggerStored 的可用性: %v", err))
+	}
+	if ksTriggerStored == nil {
+		return shim.Error(errorcode.CodeNotFound)
+	}
+
+	// 过期不经交易触发，故在读取时按交易时间给出会话当前的状态
+	timestamp, err := getTimeFromStub(stub)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法获得时间戳: %v", err))
+	}
+	ksTriggerStored.State = getKeySwitchSessionStateHelper(ksTriggerStored, timestamp)
+
+	ksTriggerBytes, err := json.Marshal(ksTriggerStored)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化 KeySwitchTriggerStored: %v", err))
+	}
+
+	return shim.Success(ksTriggerBytes)
+}
+
+func (uc *UniversalCC) setKeySwitchSessionConfig(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数个数
+	if len(args) != 1 {
+		return shim.Error("参数数量不正确。应为 1 个")
+	}
+
+	// 只有管理员可以配置密钥置换会话
+	isAdmin, err := uc.isAdminHelper(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isAdmin {
+		return shim.Error(errorcode.CodeForbidden)
+	}
+
+	// 解析第 0 个参数为 keyswitch.KeySwitchSessionConfig
+	var ksSessionConfig keyswitch.KeySwitchSessionConfig
+	if err = json.Unmarshal([]byte(args[0]), &ksSessionConfig); err != nil {
+		return shim.Error(fmt.Sprintf("无法解析参数中的 JSON 对象: %v", err))
+	}
+	if ksSessionConfig.SessionTTL <= 0 {
+		return shim.Error("会话的有效期应为正整数")
+	}
+	if ksSessionConfig.Threshold < 0 {
+		return shim.Error("门限值不能为负数")
+	}
+
+	ksSessionConfigBytes, err := json.Marshal(ksSessionConfig)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化密钥置换会话配置: %v", err))
+	}
+	if err = stub.PutState(getKeyForKeySwitchSessionConfig(), ksSessionConfigBytes); err != nil {
+		return shim.Error(fmt.Sprintf("无法存储密钥置换会话配置: %v", err))
+	}
+
+	return shim.Success(nil)
+}
+
+func (uc *UniversalCC) getKeySwitchSessionConfig(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数个数
+	if len(args) != 0 {
+		return shim.Error("参数数量不正确。应为 0 个")
+	}
+
+	ksSessionConfig, err := uc.getKeySwitchSessionConfigHelper(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	ksSessionConfigBytes, err := json.Marshal(ksSessionConfig)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化密钥置换会话配置: %v", err))
+	}
+
+	return shim.Success(ksSessionConfigBytes)
+}
+
+// 获取密钥置换会话配置。未配置时会话有效期为 `defaultKeySwitchSessionTTL` 秒，并需要所有登记的服务器的份额。
+func (uc *UniversalCC) getKeySwitchSessionConfigHelper(stub shim.ChaincodeStubInterface) (*keyswitch.KeySwitchSessionConfig, error) {
+	ksSessionConfigBytes, err := stub.GetState(getKeyForKeySwitchSessionConfig())
+	if err != nil {
+		return nil, fmt.Errorf("无法读取密钥置换会话配置: %v", err)
+	}
+	if len(ksSessionConfigBytes) == 0 {
+		return &keyswitch.KeySwitchSessionConfig{SessionTTL: defaultKeySwitchSessionTTL}, nil
+	}
+
+	var ksSessionConfig keyswitch.KeySwitchSessionConfig
+	if err = json.Unmarshal(ksSessionConfigBytes, &ksSessionConfig); err != nil {
+		return nil, fmt.Errorf("无法解析密钥置换会话配置: %v", err)
+	}
+
+	return &ksSessionConfig, nil
+}
+
+// 获取会话在给定时间的状态。开放的会话超过过期时间即视为过期。
+func getKeySwitchSessionStateHelper(ksTriggerStored *keyswitch.KeySwitchTriggerStored, timestamp time.Time) keyswitch.KeySwitchSessionState {
+	if ksTriggerStored.State == keyswitch.Open && timestamp.After(ksTriggerStored.ExpiresAt) {
+		return keyswitch.Expired
+	}
+
+	return ksTriggerStored.State
+}
+
+// 统计会话中已提交且通过链码验证的密钥置换结果数量
+func countVerifiedKeySwitchResultsHelper(stub shim.ChaincodeStubInterface, keySwitchSessionID string) (int, error) {
+	startKey := getKeyPrefixForKeySwitchResponse(keySwitchSessionID) + "_"
+	endKey := string(BytesPrefix([]byte(startKey)))
+	resultsIterator, err := stub.GetStateByRange(startKey, endKey)
+	if err != nil {
+		return 0, fmt.Errorf("无法查询密钥置换结果: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	numResults := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		var ksResultStored keyswitch.KeySwitchResultStored
+		if err = json.Unmarshal(queryResponse.Value, &ksResultStored); err != nil {
+			return 0, fmt.Errorf("无法解析密钥置换结果: %v", err)
+		}
+		if ksResultStored.ValidationResult {
+			numResults++
+		}
+	}
+
+	return numResults, nil
+}
+
 func (uc *UniversalCC) getKeySwitchResult(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 	// 检查参数个数
 	if len(args) != 1 {
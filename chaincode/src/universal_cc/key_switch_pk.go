@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/keyswitch"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+func (uc *UniversalCC) registerKeySwitchPK(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 1 {
+		return shim.Error("参数数量不正确。应为 1 个")
+	}
+
+	// 解析第 0 个参数为 keyswitch.KeySwitchPKRegistration
+	var registration keyswitch.KeySwitchPKRegistration
+	if err := json.Unmarshal([]byte(args[0]), &registration); err != nil {
+		return shim.Error(fmt.Sprintf("无法解析参数中的 JSON 对象: %v", err))
+	}
+
+	keySwitchPK, err := deserializeSM2PublicKeyFromBase64(registration.KeySwitchPK)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("密钥置换公钥应为 64 字节的 Base64 编码: %v", err))
+	}
+
+	// 链下交付份额的地址须为 HTTP(S) 地址
+	if registration.ShareDeliveryURL != "" && !strings.HasPrefix(registration.ShareDeliveryURL, "http://") && !strings.HasPrefix(registration.ShareDeliveryURL, "https://") {
+		return shim.Error("链下交付份额的地址应为 HTTP 或 HTTPS 地址")
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(registration.Signature)
+	if err != nil || len(signature) == 0 {
+		return shim.Error("签名应为 Base64 编码")
+	}
+
+	// 登记者为调用者本人
+	owner, err := getPKDERFromStub(stub)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法获取创建者: %v", err))
+	}
+	ownerAsBase64 := base64.StdEncoding.EncodeToString(owner)
+
+	// 以签名证明调用者持有对应的密钥置换私钥
+	message := keyswitch.GetKeySwitchPKRegistrationMessage(ownerAsBase64, registration.KeySwitchPK)
+	if !keySwitchPK.Verify(message, signature) {
+		return shim.Error("签名未通过验证，无法证明持有该密钥置换公钥对应的私钥")
+	}
+
+	timestamp, err := getTimeFromStub(stub)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法获得时间戳: %v", err))
+	}
+
+	registrationStored := keyswitch.KeySwitchPKRegistrationStored{
+		Owner:            ownerAsBase64,
+		KeySwitchPK:      registration.KeySwitchPK,
+		ShareDeliveryURL: registration.ShareDeliveryURL,
+		Timestamp:        timestamp,
+	}
+	registrationStoredBytes, err := json.Marshal(registrationStored)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化密钥置换公钥登记: %v", err))
+	}
+
+	if err = stub.PutState(getKeyForKeySwitchPK(ownerAsBase64, registration.KeySwitchPK), registrationStoredBytes); err != nil {
+		return shim.Error(fmt.Sprintf("无法存储密钥置换公钥登记: %v", err))
+	}
+
+	return shim.Success(nil)
+}
+
+func (uc *UniversalCC) revokeKeySwitchPK(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 1 {
+		return shim.Error("参数数量不正确。应为 1 个")
+	}
+
+	// 第 0 个参数为密钥置换公钥。只能撤销调用者本人的登记。
+	keySwitchPK := args[0]
+	owner, err := getPKDERFromStub(stub)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法获取创建者: %v", err))
+	}
+	ownerAsBase64 := base64.StdEncoding.EncodeToString(owner)
+
+	registration, err := uc.getKeySwitchPKRegistrationHelper(stub, ownerAsBase64, keySwitchPK)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if registration == nil {
+		return shim.Error(errorcode.CodeNotFound)
+	}
+
+	if err = stub.DelState(getKeyForKeySwitchPK(ownerAsBase64, keySwitchPK)); err != nil {
+		return shim.Error(fmt.Sprintf("无法移除密钥置换公钥登记: %v", err))
+	}
+
+	return shim.Success(nil)
+}
+
+func (uc *UniversalCC) listKeySwitchPKs(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) > 1 {
+		return shim.Error("参数数量不正确。应为 0 或 1 个")
+	}
+
+	// 第 0 个参数为身份的公钥（Base64 编码的 DER）。未指定时为调用者本人。
+	var ownerAsBase64 string
+	if len(args) == 1 {
+		ownerAsBase64 = args[0]
+	} else {
+		owner, err := getPKDERFromStub(stub)
+		if err != nil {
+			return shim.Error(fmt.Sprintf("无法获取创建者: %v", err))
+		}
+		ownerAsBase64 = base64.StdEncoding.EncodeToString(owner)
+	}
+
+	startKey := getKeyForKeySwitchPK(ownerAsBase64, "")
+	endKey := string(BytesPrefix([]byte(startKey)))
+	resultsIterator, err := stub.GetStateByRange(startKey, endKey)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法查询密钥置换公钥登记: %v", err))
+	}
+	defer resultsIterator.Close()
+
+	registrations := []keyswitch.KeySwitchPKRegistrationStored{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		var registration keyswitch.KeySwitchPKRegistrationStored
+		if err = json.Unmarshal(queryResponse.Value, &registration); err != nil {
+			return shim.Error(fmt.Sprintf("无法解析密钥置换公钥登记: %v", err))
+		}
+		registrations = append(registrations, registration)
+	}
+
+	registrationsBytes, err := json.Marshal(registrations)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化密钥置换公钥登记: %v", err))
+	}
+
+	return shim.Success(registrationsBytes)
+}
+
+// 获取某一身份对某一密钥置换公钥的登记。未登记时返回 nil。
+func (uc *UniversalCC) getKeySwitchPKRegistrationHelper(stub shim.ChaincodeStubInterface, ownerAsBase64 string, keySwitchPK string) (*keyswitch.KeySwitchPKRegistrationStored, error) {
+	registrationBytes, err := stub.GetState(getKeyForKeySwitchPK(ownerAsBase64, keySwitchPK))
+	if err != nil {
+		return nil, fmt.Errorf("无法读取密钥置换公钥登记: %v", err)
+	}
+	if len(registrationBytes) == 0 {
+		return nil, nil
+	}
+
+	var registration keyswitch.KeySwitchPKRegistrationStored
+	if err = json.Unmarshal(registrationBytes, &registration); err != nil {
+		return nil, fmt.Errorf("无法解析密钥置换公钥登记: %v", err)
+	}
+
+	return &registration, nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/keyswitch"
+	"github.com/XiaoYao-austin/ppks"
+	"github.com/google/uuid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+func TestRegisterKeySwitchPK(t *testing.T) {
+	stub := createMockStubWithCert(t, "TestRegisterKeySwitchPK", exampleCertUser3)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	targetSK, err := ppks.GenPrivKey()
+	expectNil(t, err)
+	otherSK, err := ppks.GenPrivKey()
+	expectNil(t, err)
+	targetKeySwitchPK := base64.StdEncoding.EncodeToString(serializeSM2PublicKeyForTest(&targetSK.PublicKey))
+
+	// 签名须由密钥置换公钥对应的私钥生成
+	owner, err := getPKDERFromStub(stub)
+	expectNil(t, err)
+	ownerAsBase64 := base64.StdEncoding.EncodeToString(owner)
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("getCallerPublicKey")})
+	expectResponseStatusOK(t, &resp)
+	expectEqual(t, ownerAsBase64, string(resp.Payload))
+
+	resp = invokeRegisterKeySwitchPKWithSignature(stub, targetKeySwitchPK, signKeySwitchPKRegistrationForTest(t, otherSK, ownerAsBase64, targetKeySwitchPK))
+	expectResponseStatusERROR(t, &resp)
+
+	// 签名须针对登记者本人，其他身份的签名不能重放
+	user1PKDER, err := getPKDERFromCertString(exampleCertUser1)
+	expectNil(t, err)
+	user1AsBase64 := base64.StdEncoding.EncodeToString(user1PKDER)
+	resp = invokeRegisterKeySwitchPKWithSignature(stub, targetKeySwitchPK, signKeySwitchPKRegistrationForTest(t, targetSK, user1AsBase64, targetKeySwitchPK))
+	expectResponseStatusERROR(t, &resp)
+
+	resp = invokeRegisterKeySwitchPK(stub, targetSK)
+	expectResponseStatusOK(t, &resp)
+
+	registrations := listKeySwitchPKsForTest(t, stub)
+	expectEqual(t, 1, len(registrations))
+	expectEqual(t, ownerAsBase64, registrations[0].Owner)
+	expectEqual(t, targetKeySwitchPK, registrations[0].KeySwitchPK)
+	expectEqual(t, "", registrations[0].ShareDeliveryURL)
+
+	// 链下交付份额的地址须为 HTTP(S) 地址。重新登记时更新该地址。
+	resp = invokeRegisterKeySwitchPKWithShareDeliveryURL(stub, targetSK, "file:///etc/passwd")
+	expectResponseStatusERROR(t, &resp)
+	resp = invokeRegisterKeySwitchPKWithShareDeliveryURL(stub, targetSK, "https://requester/api/v1/ks/shares")
+	expectResponseStatusOK(t, &resp)
+	registrations = listKeySwitchPKsForTest(t, stub)
+	expectEqual(t, 1, len(registrations))
+	expectEqual(t, "https://requester/api/v1/ks/shares", registrations[0].ShareDeliveryURL)
+
+	// 其他身份可以查询，但不能撤销
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertUser1))
+	expectEqual(t, 0, len(listKeySwitchPKsForTest(t, stub)))
+	expectEqual(t, 1, len(listKeySwitchPKsForTest(t, stub, ownerAsBase64)))
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("revokeKeySwitchPK"), []byte(targetKeySwitchPK)})
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeNotFound, resp.Message)
+
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertUser3))
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("revokeKeySwitchPK"), []byte(targetKeySwitchPK)})
+	expectResponseStatusOK(t, &resp)
+	expectEqual(t, 0, len(listKeySwitchPKsForTest(t, stub)))
+}
+
+func TestCreateKeySwitchTriggerWithUnregisteredKeySwitchPK(t *testing.T) {
+	stub := createMockStubWithCert(t, "TestCreateKeySwitchTriggerWithUnregisteredKeySwitchPK", exampleCertUser3)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+	resourceID := createSampleEncryptedDataWithPolicy(t, stub, `DeptType == "computer"`)
+
+	targetSK, err := ppks.GenPrivKey()
+	expectNil(t, err)
+	targetKeySwitchPK := base64.StdEncoding.EncodeToString(serializeSM2PublicKeyForTest(&targetSK.PublicKey))
+
+	// 未登记的密钥置换公钥
+	resp := invokeCreateKeySwitchTriggerWithKeySwitchPK(stub, resourceID, targetKeySwitchPK)
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeForbidden, resp.Message)
+
+	// 登记在他人名下的密钥置换公钥
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertUser1))
+	resp = invokeRegisterKeySwitchPK(stub, targetSK)
+	expectResponseStatusOK(t, &resp)
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertUser3))
+	resp = invokeCreateKeySwitchTriggerWithKeySwitchPK(stub, resourceID, targetKeySwitchPK)
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeForbidden, resp.Message)
+
+	// 登记在本人名下后可以创建
+	resp = invokeRegisterKeySwitchPK(stub, targetSK)
+	expectResponseStatusOK(t, &resp)
+	resp = invokeCreateKeySwitchTriggerWithKeySwitchPK(stub, resourceID, targetKeySwitchPK)
+	expectResponseStatusOK(t, &resp)
+}
+
+// 以调用者的身份登记 sk 对应的密钥置换公钥
+func invokeRegisterKeySwitchPK(stub *shimtest.MockStub, sk *sm2.PrivateKey) peer.Response {
+	return invokeRegisterKeySwitchPKWithShareDeliveryURL(stub, sk, "")
+}
+
+// 以调用者的身份登记 sk 对应的密钥置换公钥及链下交付份额的地址
+func invokeRegisterKeySwitchPKWithShareDeliveryURL(stub *shimtest.MockStub, sk *sm2.PrivateKey, shareDeliveryURL string) peer.Response {
+	owner, err := getPKDERFromStub(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	keySwitchPK := base64.StdEncoding.EncodeToString(serializeSM2PublicKeyForTest(&sk.PublicKey))
+	signature, err := sk.Sign(rand.Reader, keyswitch.GetKeySwitchPKRegistrationMessage(base64.StdEncoding.EncodeToString(owner), keySwitchPK), nil)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	registration := keyswitch.KeySwitchPKRegistration{
+		KeySwitchPK:      keySwitchPK,
+		Signature:        base64.StdEncoding.EncodeToString(signature),
+		ShareDeliveryURL: shareDeliveryURL,
+	}
+	registrationBytes, _ := json.Marshal(registration)
+
+	return stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("registerKeySwitchPK"), registrationBytes})
+}
+
+func invokeRegisterKeySwitchPKWithSignature(stub *shimtest.MockStub, keySwitchPK string, signature []byte) peer.Response {
+	registration := keyswitch.KeySwitchPKRegistration{
+		KeySwitchPK: keySwitchPK,
+		Signature:   base64.StdEncoding.EncodeToString(signature),
+	}
+	registrationBytes, _ := json.Marshal(registration)
+
+	return stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("registerKeySwitchPK"), registrationBytes})
+}
+
+func signKeySwitchPKRegistrationForTest(t *testing.T, sk *sm2.PrivateKey, ownerAsBase64 string, keySwitchPK string) []byte {
+	signature, err := sk.Sign(rand.Reader, keyswitch.GetKeySwitchPKRegistrationMessage(ownerAsBase64, keySwitchPK), nil)
+	expectNil(t, err)
+
+	return signature
+}
+
+func listKeySwitchPKsForTest(t *testing.T, stub *shimtest.MockStub, owner ...string) []keyswitch.KeySwitchPKRegistrationStored {
+	args := [][]byte{[]byte("listKeySwitchPKs")}
+	for _, o := range owner {
+		args = append(args, []byte(o))
+	}
+
+	resp := stub.MockInvoke(uuid.NewString(), args)
+	expectResponseStatusOK(t, &resp)
+
+	var registrations []keyswitch.KeySwitchPKRegistrationStored
+	err := json.Unmarshal(resp.Payload, &registrations)
+	expectNil(t, err)
+
+	return registrations
+}
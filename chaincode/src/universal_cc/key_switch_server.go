@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/keyswitch"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+func (uc *UniversalCC) registerKeySwitchServer(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 1 {
+		return shim.Error("参数数量不正确。应为 1 个")
+	}
+
+	// 只有管理员可以维护密钥置换服务器登记
+	isAdmin, err := uc.isAdminHelper(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isAdmin {
+		return shim.Error(errorcode.CodeForbidden)
+	}
+
+	// 解析第 0 个参数为 keyswitch.KeySwitchServer
+	var server keyswitch.KeySwitchServer
+	if err = json.Unmarshal([]byte(args[0]), &server); err != nil {
+		return shim.Error(fmt.Sprintf("无法解析参数中的 JSON 对象: %v", err))
+	}
+
+	if strings.TrimSpace(server.Name) == "" {
+		return shim.Error("服务器名称不能为空")
+	}
+	if publicKeyBytes, err := base64.StdEncoding.DecodeString(server.PublicKey); err != nil || len(publicKeyBytes) == 0 {
+		return shim.Error("服务器身份的公钥应为 Base64 编码的 DER")
+	}
+	if _, err := deserializeSM2PublicKeyFromBase64(server.KeySwitchPK); err != nil {
+		return shim.Error(fmt.Sprintf("密钥置换公钥应为 64 字节的 Base64 编码: %v", err))
+	}
+
+	// 获取登记者与时间戳
+	creator, err := getPKDERFromStub(stub)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法获取创建者: %v", err))
+	}
+
+	timestamp, err := getTimeFromStub(stub)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法获得时间戳: %v", err))
+	}
+
+	serverStored := keyswitch.KeySwitchServerStored{
+		PublicKey:   server.PublicKey,
+		Name:        server.Name,
+		KeySwitchPK: server.KeySwitchPK,
+		Creator:     base64.StdEncoding.EncodeToString(creator),
+		Timestamp:   timestamp,
+	}
+	serverStoredBytes, err := json.Marshal(serverStored)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化密钥置换服务器: %v", err))
+	}
+
+	if err = stub.PutState(getKeyForKeySwitchServer(server.PublicKey), serverStoredBytes); err != nil {
+		return shim.Error(fmt.Sprintf("无法存储密钥置换服务器: %v", err))
+	}
+
+	return shim.Success(nil)
+}
+
+func (uc *UniversalCC) deregisterKeySwitchServer(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 1 {
+		return shim.Error("参数数量不正确。应为 1 个")
+	}
+
+	// 只有管理员可以维护密钥置换服务器登记
+	isAdmin, err := uc.isAdminHelper(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isAdmin {
+		return shim.Error(errorcode.CodeForbidden)
+	}
+
+	// 第 0 个参数为服务器身份的公钥
+	publicKeyAsBase64 := args[0]
+	server, err := uc.getKeySwitchServerHelper(stub, publicKeyAsBase64)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if server == nil {
+		return shim.Error(errorcode.CodeNotFound)
+	}
+
+	if err = stub.DelState(getKeyForKeySwitchServer(publicKeyAsBase64)); err != nil {
+		return shim.Error(fmt.Sprintf("无法移除密钥置换服务器: %v", err))
+	}
+	if err = stub.DelState(getKeyForKeySwitchServerHeartbeat(publicKeyAsBase64)); err != nil {
+		return shim.Error(fmt.Sprintf("无法移除密钥置换服务器的心跳: %v", err))
+	}
+
+	return shim.Success(nil)
+}
+
+func (uc *UniversalCC) listKeySwitchServers(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 0 {
+		return shim.Error("参数数量不正确。应为 0 个")
+	}
+
+	servers, err := uc.listKeySwitchServersHelper(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	serversBytes, err := json.Marshal(servers)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化密钥置换服务器: %v", err))
+	}
+
+	return shim.Success(serversBytes)
+}
+
+func (uc *UniversalCC) recordKeySwitchServerHeartbeat(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 1 {
+		return shim.Error("参数数量不正确。应为 1 个")
+	}
+
+	// 解析第 0 个参数为 keyswitch.KeySwitchServerHeartbeat
+	var heartbeat keyswitch.KeySwitchServerHeartbeat
+	if err := json.Unmarshal([]byte(args[0]), &heartbeat); err != nil {
+		return shim.Error(fmt.Sprintf("无法解析参数中的 JSON 对象: %v", err))
+	}
+
+	// 只有登记的密钥置换服务器可以记录心跳，且只能记录自己的
+	creator, err := getPKDERFromStub(stub)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法获取创建者: %v", err))
+	}
+	creatorAsBase64 := base64.StdEncoding.EncodeToString(creator)
+
+	server, err := uc.getKeySwitchServerHelper(stub, creatorAsBase64)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if server == nil {
+		return shim.Error(errorcode.CodeForbidden)
+	}
+
+	timestamp, err := getTimeFromStub(stub)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法获得时间戳: %v", err))
+	}
+
+	heartbeatStored := keyswitch.KeySwitchServerHeartbeatStored{
+		PublicKey:     creatorAsBase64,
+		Version:       heartbeat.Version,
+		LastSessionID: heartbeat.LastSessionID,
+		NumWorkers:    heartbeat.NumWorkers,
+		Timestamp:     timestamp,
+	}
+	heartbeatStoredBytes, err := json.Marshal(heartbeatStored)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化密钥置换服务器的心跳: %v", err))
+	}
+
+	if err = stub.PutState(getKeyForKeySwitchServerHeartbeat(creatorAsBase64), heartbeatStoredBytes); err != nil {
+		return shim.Error(fmt.Sprintf("无法存储密钥置换服务器的心跳: %v", err))
+	}
+
+	return shim.Success(nil)
+}
+
+func (uc *UniversalCC) listKeySwitchServerHeartbeats(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 0 {
+		return shim.Error("参数数量不正确。应为 0 个")
+	}
+
+	startKey := getKeyForKeySwitchServerHeartbeat("")
+	endKey := string(BytesPrefix([]byte(startKey)))
+	resultsIterator, err := stub.GetStateByRange(startKey, endKey)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法查询密钥置换服务器的心跳: %v", err))
+	}
+	defer resultsIterator.Close()
+
+	heartbeats := []keyswitch.KeySwitchServerHeartbeatStored{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		var heartbeatStored keyswitch.KeySwitchServerHeartbeatStored
+		if err = json.Unmarshal(queryResponse.Value, &heartbeatStored); err != nil {
+			return shim.Error(fmt.Sprintf("无法解析密钥置换服务器的心跳: %v", err))
+		}
+		heartbeats = append(heartbeats, heartbeatStored)
+	}
+
+	heartbeatsBytes, err := json.Marshal(heartbeats)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化密钥置换服务器的心跳: %v", err))
+	}
+
+	return shim.Success(heartbeatsBytes)
+}
+
+// 获取登记的密钥置换服务器。未登记时返回 nil。
+func (uc *UniversalCC) getKeySwitchServerHelper(stub shim.ChaincodeStubInterface, publicKeyAsBase64 string) (*keyswitch.KeySwitchServerStored, error) {
+	serverBytes, err := stub.GetState(getKeyForKeySwitchServer(publicKeyAsBase64))
+	if err != nil {
+		return nil, fmt.Errorf("无法读取密钥置换服务器: %v", err)
+	}
+	if len(serverBytes) == 0 {
+		return nil, nil
+	}
+
+	var server keyswitch.KeySwitchServerStored
+	if err = json.Unmarshal(serverBytes, &server); err != nil {
+		return nil, fmt.Errorf("无法解析密钥置换服务器: %v", err)
+	}
+
+	return &server, nil
+}
+
+// 列出所有登记的密钥置换服务器
+func (uc *UniversalCC) listKeySwitchServersHelper(stub shim.ChaincodeStubInterface) ([]keyswitch.KeySwitchServerStored, error) {
+	startKey := getKeyForKeySwitchServer("")
+	endKey := string(BytesPrefix([]byte(startKey)))
+	resultsIterator, err := stub.GetStateByRange(startKey, endKey)
+	if err != nil {
+		return nil, fmt.Errorf("无法查询密钥置换服务器: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	servers := []keyswitch.KeySwitchServerStored{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var serverStored keyswitch.KeySwitchServerStored
+		if err = json.Unmarshal(queryResponse.Value, &serverStored); err != nil {
+			return nil, fmt.Errorf("无法解析密钥置换服务器: %v", err)
+		}
+		servers = append(servers, serverStored)
+	}
+
+	return servers, nil
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/keyswitch"
+	"github.com/XiaoYao-austin/ppks"
+	"github.com/google/uuid"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+func TestRegisterKeySwitchServer(t *testing.T) {
+	stub := createMockStubWithCert(t, "TestRegisterKeySwitchServer", exampleCertAdmin1)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	serverPK := registerSampleKeySwitchServer(t, stub, getSampleServerKeySwitchPK())
+
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("listKeySwitchServers")})
+	expectResponseStatusOK(t, &resp)
+	var servers []keyswitch.KeySwitchServerStored
+	err := json.Unmarshal(resp.Payload, &servers)
+	expectNil(t, err)
+	if len(servers) != 1 {
+		t.Fatalf("应有 1 个登记的服务器，实际为 %v 个", len(servers))
+	}
+	expectEqual(t, serverPK, servers[0].PublicKey)
+	expectEqual(t, "server1", servers[0].Name)
+	expectEqual(t, getSampleServerKeySwitchPK(), servers[0].KeySwitchPK)
+
+	// 移除登记
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("deregisterKeySwitchServer"), []byte(serverPK)})
+	expectResponseStatusOK(t, &resp)
+	expectEqual(t, 0, len(stub.State[getKeyForKeySwitchServer(serverPK)]))
+
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("deregisterKeySwitchServer"), []byte(serverPK)})
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeNotFound, resp.Message)
+}
+
+func TestRegisterKeySwitchServerAsNonAdmin(t *testing.T) {
+	stub := createMockStubWithCert(t, "TestRegisterKeySwitchServerAsNonAdmin", exampleCertUser3)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	server := keyswitch.KeySwitchServer{
+		PublicKey:   base64.StdEncoding.EncodeToString([]byte("pk")),
+		Name:        "server1",
+		KeySwitchPK: getSampleServerKeySwitchPK(),
+	}
+	serverBytes, _ := json.Marshal(server)
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("registerKeySwitchServer"), serverBytes})
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeForbidden, resp.Message)
+}
+
+func TestRegisterKeySwitchServerWithInvalidKeySwitchPK(t *testing.T) {
+	stub := createMockStubWithCert(t, "TestRegisterKeySwitchServerWithInvalidKeySwitchPK", exampleCertAdmin1)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	// 长度正确但不在曲线上的点
+	notOnCurve := make([]byte, 64)
+	for i := range notOnCurve {
+		notOnCurve[i] = 1
+	}
+
+	pkDER, _ := getPKDERFromCertString(exampleCertUser3)
+	for _, ksPK := range []string{base64.StdEncoding.EncodeToString(notOnCurve), base64.StdEncoding.EncodeToString([]byte("pk")), "NOT_BASE64!"} {
+		server := keyswitch.KeySwitchServer{
+			PublicKey:   base64.StdEncoding.EncodeToString(pkDER),
+			Name:        "server1",
+			KeySwitchPK: ksPK,
+		}
+		serverBytes, _ := json.Marshal(server)
+		resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("registerKeySwitchServer"), serverBytes})
+		expectResponseStatusERROR(t, &resp)
+	}
+	expectEqual(t, 0, len(stub.State[getKeyForKeySwitchServer(base64.StdEncoding.EncodeToString(pkDER))]))
+}
+
+func TestRecordKeySwitchServerHeartbeat(t *testing.T) {
+	stub := createMockStubWithCert(t, "TestRecordKeySwitchServerHeartbeat", exampleCertAdmin1)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+	serverPK := registerSampleKeySwitchServer(t, stub, getSampleServerKeySwitchPK())
+
+	heartbeat := keyswitch.KeySwitchServerHeartbeat{
+		Version:       "1.0.0",
+		LastSessionID: "session1",
+		NumWorkers:    4,
+	}
+	heartbeatBytes, _ := json.Marshal(heartbeat)
+
+	// 未登记的身份不能记录心跳
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("recordKeySwitchServerHeartbeat"), heartbeatBytes})
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeForbidden, resp.Message)
+
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertUser3))
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("recordKeySwitchServerHeartbeat"), heartbeatBytes})
+	expectResponseStatusOK(t, &resp)
+
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("listKeySwitchServerHeartbeats")})
+	expectResponseStatusOK(t, &resp)
+	var heartbeats []keyswitch.KeySwitchServerHeartbeatStored
+	err := json.Unmarshal(resp.Payload, &heartbeats)
+	expectNil(t, err)
+	if len(heartbeats) != 1 {
+		t.Fatalf("应有 1 个心跳，实际为 %v 个", len(heartbeats))
+	}
+	expectEqual(t, serverPK, heartbeats[0].PublicKey)
+	expectEqual(t, "1.0.0", heartbeats[0].Version)
+	expectEqual(t, "session1", heartbeats[0].LastSessionID)
+	expectEqual(t, 4, heartbeats[0].NumWorkers)
+
+	// 移除登记时一并移除心跳
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertAdmin1))
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("deregisterKeySwitchServer"), []byte(serverPK)})
+	expectResponseStatusOK(t, &resp)
+	expectEqual(t, 0, len(stub.State[getKeyForKeySwitchServerHeartbeat(serverPK)]))
+}
+
+func TestCreateKeySwitchResultFromRegisteredServer(t *testing.T) {
+	serverSK, err := ppks.GenPrivKey()
+	expectNil(t, err)
+	targetSK, err := ppks.GenPrivKey()
+	expectNil(t, err)
+	encryptedKey, err := ppks.PointEncrypt(&serverSK.PublicKey, ppks.GenPoint())
+	expectNil(t, err)
+
+	// 管理员将 exampleCertUser3 登记为密钥置换服务器
+	stub := createMockStubWithCert(t, "TestCreateKeySwitchResultFromRegisteredServer", exampleCertAdmin1)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+	serverPK := registerSampleKeySwitchServer(t, stub, base64.StdEncoding.EncodeToString(serializeSM2PublicKeyForTest(&serverSK.PublicKey)))
+
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertUser3))
+	resourceID := createSampleEncryptedDataWithKey(t, stub, serializeCipherTextForTest(encryptedKey))
+	resp := invokeCreateKeySwitchTriggerForTarget(stub, resourceID, targetSK)
+	expectResponseStatusOK(t, &resp)
+	ksSessionID := string(resp.Payload)
+	ksResult := generateSampleKeySwitchResult(t, ksSessionID, serverSK, &targetSK.PublicKey, encryptedKey)
+
+	// 密钥置换公钥与登记的不一致
+	otherSK, err := ppks.GenPrivKey()
+	expectNil(t, err)
+	resp = invokeCreateKeySwitchResult(stub, generateSampleKeySwitchResult(t, ksSessionID, otherSK, &targetSK.PublicKey, encryptedKey))
+	expectResponseStatusERROR(t, &resp)
+
+	// 份额未通过零知识证明验证
+	proofBytes, _ := base64.StdEncoding.DecodeString(ksResult.ZKProof)
+	proofBytes[0] ^= 1
+	tamperedResult := ksResult
+	tamperedResult.ZKProof = base64.StdEncoding.EncodeToString(proofBytes)
+	resp = invokeCreateKeySwitchResult(stub, tamperedResult)
+	expectResponseStatusERROR(t, &resp)
+	expectEqual(t, 0, len(stub.State[getKeyForKeySwitchResponse(ksSessionID, serverPK)]))
+
+	// 未登记的提交者
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertAdmin1))
+	resp = invokeCreateKeySwitchResult(stub, ksResult)
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeForbidden, resp.Message)
+
+	// 以登记的密钥置换公钥提交有效的份额
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertUser3))
+	resp = invokeCreateKeySwitchResult(stub, ksResult)
+	expectResponseStatusOK(t, &resp)
+	var ksResultStored keyswitch.KeySwitchResultStored
+	err = json.Unmarshal(stub.State[getKeyForKeySwitchResponse(ksSessionID, serverPK)], &ksResultStored)
+	expectNil(t, err)
+	expectEqual(t, true, ksResultStored.ValidationResult)
+}
+
+func TestCreateKeySwitchResultWithCommitment(t *testing.T) {
+	serverSK, err := ppks.GenPrivKey()
+	expectNil(t, err)
+	targetSK, err := ppks.GenPrivKey()
+	expectNil(t, err)
+	encryptedKey, err := ppks.PointEncrypt(&serverSK.PublicKey, ppks.GenPoint())
+	expectNil(t, err)
+	targetKeySwitchPK := base64.StdEncoding.EncodeToString(serializeSM2PublicKeyForTest(&targetSK.PublicKey))
+
+	stub := createMockStubWithCert(t, "TestCreateKeySwitchResultWithCommitment", exampleCertAdmin1)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+	serverPK := registerSampleKeySwitchServer(t, stub, base64.StdEncoding.EncodeToString(serializeSM2PublicKeyForTest(&serverSK.PublicKey)))
+
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertUser3))
+	resourceID := createSampleEncryptedDataWithKey(t, stub, serializeCipherTextForTest(encryptedKey))
+	resp := invokeRegisterKeySwitchPKWithShareDeliveryURL(stub, targetSK, "https://requester/api/v1/ks/shares")
+	expectResponseStatusOK(t, &resp)
+
+	// 链下交付份额的地址须为登记密钥置换公钥时登记的地址
+	resp = invokeCreateMultiResourceKeySwitchTrigger(stub, keyswitch.KeySwitchTrigger{ResourceID: resourceID, KeySwitchPK: targetKeySwitchPK, ShareDeliveryURL: "http://169.254.169.254/latest/meta-data"})
+	expectResponseStatusERROR(t, &resp)
+	expectEqual(t, "链下交付份额的地址应为登记密钥置换公钥时登记的地址", resp.Message)
+
+	// 未启用链下份额交付的会话不接受承诺
+	resp = invokeCreateKeySwitchTriggerWithKeySwitchPK(stub, resourceID, targetKeySwitchPK)
+	expectResponseStatusOK(t, &resp)
+	ksResult := generateSampleKeySwitchResult(t, string(resp.Payload), serverSK, &targetSK.PublicKey, encryptedKey)
+	commitment, err := keyswitch.GetKeySwitchShareCommitment(ksResult.Share, ksResult.ZKProof)
+	expectNil(t, err)
+	resp = invokeCreateKeySwitchResult(stub, keyswitch.KeySwitchResult{KeySwitchSessionID: ksResult.KeySwitchSessionID, KeySwitchPK: ksResult.KeySwitchPK, Commitment: commitment})
+	expectResponseStatusERROR(t, &resp)
+	expectEqual(t, "该密钥置换会话未启用链下份额交付", resp.Message)
+
+	resp = invokeCreateMultiResourceKeySwitchTrigger(stub, keyswitch.KeySwitchTrigger{ResourceID: resourceID, KeySwitchPK: targetKeySwitchPK, ShareDeliveryURL: "https://requester/api/v1/ks/shares"})
+	expectResponseStatusOK(t, &resp)
+	ksSessionID := string(resp.Payload)
+	expectEqual(t, "https://requester/api/v1/ks/shares", getKeySwitchTriggerForTest(t, stub, ksSessionID).ShareDeliveryURL)
+	ksResult = generateSampleKeySwitchResult(t, ksSessionID, serverSK, &targetSK.PublicKey, encryptedKey)
+	commitment, err = keyswitch.GetKeySwitchShareCommitment(ksResult.Share, ksResult.ZKProof)
+	expectNil(t, err)
+
+	// 份额不应与承诺一同上链，承诺须为 32 字节
+	committedResult := ksResult
+	committedResult.Commitment = commitment
+	resp = invokeCreateKeySwitchResult(stub, committedResult)
+	expectResponseStatusERROR(t, &resp)
+
+	committedResult = keyswitch.KeySwitchResult{KeySwitchSessionID: ksSessionID, KeySwitchPK: ksResult.KeySwitchPK, Commitment: base64.StdEncoding.EncodeToString([]byte("short"))}
+	resp = invokeCreateKeySwitchResult(stub, committedResult)
+	expectResponseStatusERROR(t, &resp)
+
+	// 链上只记录承诺，份额留待访问申请者验证
+	committedResult.Commitment = commitment
+	resp = invokeCreateKeySwitchResult(stub, committedResult)
+	expectResponseStatusOK(t, &resp)
+	var ksResultStored keyswitch.KeySwitchResultStored
+	err = json.Unmarshal(stub.State[getKeyForKeySwitchResponse(ksSessionID, serverPK)], &ksResultStored)
+	expectNil(t, err)
+	expectEqual(t, commitment, ksResultStored.Commitment)
+	expectEqual(t, "", ksResultStored.Share)
+	expectEqual(t, false, ksResultStored.ValidationResult)
+
+	// 未经验证的结果不计入完成所需的份额，会话保持开放直至过期
+	expectEqual(t, 1, getKeySwitchTriggerForTest(t, stub, ksSessionID).NumSharesExpected)
+	expectEqual(t, keyswitch.Open, getKeySwitchTriggerForTest(t, stub, ksSessionID).State)
+}
+
+// 将 exampleCertUser3 登记为密钥置换服务器，返回其身份的公钥（Base64 编码）
+func registerSampleKeySwitchServer(t *testing.T, stub *shimtest.MockStub, ksPK string) string {
+	return registerKeySwitchServerWithCert(t, stub, exampleCertUser3, ksPK)
+}
+
+// 将证书所属的身份登记为密钥置换服务器，返回其身份的公钥（Base64 编码）。调用者须为管理员。
+func registerKeySwitchServerWithCert(t *testing.T, stub *shimtest.MockStub, certPEM string, ksPK string) string {
+	pkDER, err := getPKDERFromCertString(certPEM)
+	expectNil(t, err)
+
+	server := keyswitch.KeySwitchServer{
+		PublicKey:   base64.StdEncoding.EncodeToString(pkDER),
+		Name:        "server1",
+		KeySwitchPK: ksPK,
+	}
+	serverBytes, _ := json.Marshal(server)
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("registerKeySwitchServer"), serverBytes})
+	expectResponseStatusOK(t, &resp)
+
+	return server.PublicKey
+}
+
+// 以曲线的基点作为示例的密钥置换公钥
+func getSampleServerKeySwitchPK() string {
+	params := sm2.P256Sm2().Params()
+	return base64.StdEncoding.EncodeToString(serializeSM2PublicKeyForTest(&sm2.PublicKey{Curve: params, X: params.Gx, Y: params.Gy}))
+}
+
+// 以真实的加密密钥创建加密数据，返回资源 ID
+func createSampleEncryptedDataWithKey(t *testing.T, stub *shimtest.MockStub, encryptedKey []byte) string {
+	sampleEncryptedData := getSampleEncryptedData1()
+	sampleEncryptedData.Key = base64.StdEncoding.EncodeToString(encryptedKey)
+	sampleEncryptedData.Policy = `DeptType == "computer"`
+	dataBytes, _ := json.Marshal(sampleEncryptedData)
+
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("createEncryptedData"), dataBytes})
+	expectResponseStatusOK(t, &resp)
+
+	return sampleEncryptedData.Metadata.ResourceID
+}
+
+func invokeCreateKeySwitchResult(stub *shimtest.MockStub, ksResult keyswitch.KeySwitchResult) peer.Response {
+	ksResultBytes, _ := json.Marshal(ksResult)
+
+	return stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("createKeySwitchResult"), ksResultBytes})
+}
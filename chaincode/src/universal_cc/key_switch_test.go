@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/accesspolicy"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/keyswitch"
+	"github.com/XiaoYao-austin/ppks"
+	"github.com/google/uuid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+func TestCreateKeySwitchTriggerWithSatisfiedPolicy(t *testing.T) {
+	// exampleCertUser3 的属性为 DeptType: computer, DeptLevel: 2, DeptName: 812, SuperDeptName: 804
+	policies := []string{
+		`(DeptType == "computer" && DeptLevel == 2)`,
+		`DeptType=="computer"&&DeptLevel<=2`,
+		`DeptName in ["812", "813"] || DeptLevel > 5`,
+		`!(SuperDeptName == "805") && DeptName not in ["813"]`,
+	}
+
+	for _, policy := range policies {
+		stub := createMockStubWithCert(t, "TestCreateKeySwitchTriggerWithSatisfiedPolicy", exampleCertUser3)
+		_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+		resourceID := createSampleEncryptedDataWithPolicy(t, stub, policy)
+
+		resp := invokeCreateKeySwitchTrigger(stub, resourceID)
+		expectResponseStatusOK(t, &resp)
+
+		// 检查存储的 KeySwitchTriggerStored
+		ksSessionID := string(resp.Payload)
+		var ksTriggerStored keyswitch.KeySwitchTriggerStored
+		err := json.Unmarshal(stub.State[getKeyForKeySwitchTrigger(ksSessionID)], &ksTriggerStored)
+		expectNil(t, err)
+		expectEqual(t, resourceID, ksTriggerStored.ResourceID)
+		expectEqual(t, true, ksTriggerStored.ValidationResult)
+	}
+}
+
+func TestCreateKeySwitchTriggerWithUnsatisfiedPolicy(t *testing.T) {
+	policies := []string{
+		`(DeptType == "computer" && DeptLevel == 1)`,
+		`DeptName not in ["812"]`,
+		`!(DeptType == "computer")`,
+	}
+
+	for _, policy := range policies {
+		stub := createMockStubWithCert(t, "TestCreateKeySwitchTriggerWithUnsatisfiedPolicy", exampleCertUser3)
+		_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+		resourceID := createSampleEncryptedDataWithPolicy(t, stub, policy)
+
+		resp := invokeCreateKeySwitchTrigger(stub, resourceID)
+		expectResponseStatusERROR(t, &resp)
+		expectStringEndsWith(t, errorcode.CodeForbidden, resp.Message)
+	}
+}
+
+func TestCreateKeySwitchTriggerWithInvalidPolicy(t *testing.T) {
+	// 语法正确、属性名合法，但类型不匹配的策略只有在求值时才能发现
+	policies := []string{
+		`DeptLevel == "2"`,
+		`DeptName in [812]`,
+	}
+
+	for _, policy := range policies {
+		stub := createMockStubWithCert(t, "TestCreateKeySwitchTriggerWithInvalidPolicy", exampleCertUser3)
+		_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+		resourceID := createSampleEncryptedDataWithPolicy(t, stub, policy)
+
+		// 语法错误与求值错误都不应被当作拒绝
+		resp := invokeCreateKeySwitchTrigger(stub, resourceID)
+		expectResponseStatusERROR(t, &resp)
+		expectNotEqual(t, errorcode.CodeForbidden, resp.Message)
+	}
+}
+
+func TestCreateKeySwitchTriggerWithDenialReason(t *testing.T) {
+	stub := createMockStubWithCert(t, "TestCreateKeySwitchTriggerWithDenialReason", exampleCertAdmin1)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	// 配置 DeptLevel 与资源属性在拒绝原因中脱敏
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("setPolicyRedactedAttributes"), []byte(`["DeptLevel", "Resource."]`)})
+	expectResponseStatusOK(t, &resp)
+
+	// exampleCertUser3 的属性为 DeptType: computer, DeptLevel: 2, DeptName: 812
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertUser3))
+	policy := `DeptType == "computer" && DeptLevel == 1 && !(DeptName == "812")`
+	resourceID := createSampleEncryptedDataWithPolicy(t, stub, policy)
+
+	resp = invokeCreateKeySwitchTrigger(stub, resourceID)
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeForbidden, resp.Message)
+
+	// 拒绝原因列出不满足的条件及其比较的属性值
+	detail, ok := errorcode.ExtractDetail(resp.Message, errorcode.CodeForbidden)
+	expectEqual(t, true, ok)
+	var reason accesspolicy.PolicyDenialReason
+	err := json.Unmarshal([]byte(detail), &reason)
+	expectNil(t, err)
+	expectEqual(t, resourceID, reason.ResourceID)
+	if len(reason.FailedClauses) != 2 {
+		t.Fatalf("应有 2 个不满足的条件，实际为 %v 个", len(reason.FailedClauses))
+	}
+
+	expectEqual(t, "DeptLevel == 1", reason.FailedClauses[0].Clause)
+	expectEqual(t, accesspolicy.RedactedValue, reason.FailedClauses[0].Values["DeptLevel"])
+
+	expectEqual(t, `DeptName == "812"`, reason.FailedClauses[1].Clause)
+	expectEqual(t, true, reason.FailedClauses[1].IsNegated)
+	expectEqual(t, "812", reason.FailedClauses[1].Values["DeptName"])
+}
+
+// 以指定的访问策略创建加密数据，返回资源 ID
+func TestKeySwitchSessionCompletion(t *testing.T) {
+	server1SK, err := ppks.GenPrivKey()
+	expectNil(t, err)
+	server2SK, err := ppks.GenPrivKey()
+	expectNil(t, err)
+	targetSK, err := ppks.GenPrivKey()
+	expectNil(t, err)
+	collPK := ppks.CollPubKey([]sm2.PublicKey{server1SK.PublicKey, server2SK.PublicKey})
+	encryptedKey, err := ppks.PointEncrypt(collPK, ppks.GenPoint())
+	expectNil(t, err)
+
+	// 管理员登记 2 个服务器，会话需要 2 份份额才完成
+	stub := createMockStubWithCert(t, "TestKeySwitchSessionCompletion", exampleCertAdmin1)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+	registerKeySwitchServerWithCert(t, stub, exampleCertUser3, base64.StdEncoding.EncodeToString(serializeSM2PublicKeyForTest(&server1SK.PublicKey)))
+	registerKeySwitchServerWithCert(t, stub, exampleCertUser1, base64.StdEncoding.EncodeToString(serializeSM2PublicKeyForTest(&server2SK.PublicKey)))
+
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertUser3))
+	resourceID := createSampleEncryptedDataWithKey(t, stub, serializeCipherTextForTest(encryptedKey))
+	resp := invokeCreateKeySwitchTriggerForTarget(stub, resourceID, targetSK)
+	expectResponseStatusOK(t, &resp)
+	ksSessionID := string(resp.Payload)
+	ksTriggerStored := getKeySwitchTriggerForTest(t, stub, ksSessionID)
+	expectEqual(t, keyswitch.Open, ksTriggerStored.State)
+	expectEqual(t, 2, ksTriggerStored.NumSharesExpected)
+
+	// 第 1 份份额只发出结果事件
+	ksResult1 := generateSampleKeySwitchResult(t, ksSessionID, server1SK, &targetSK.PublicKey, encryptedKey)
+	resp = invokeCreateKeySwitchResult(stub, ksResult1)
+	expectResponseStatusOK(t, &resp)
+	expectEqual(t, getKeyPrefixForKeySwitchResponse(ksSessionID), getLastEventForTest(t, stub).EventName)
+	expectEqual(t, keyswitch.Open, getKeySwitchTriggerForTest(t, stub, ksSessionID).State)
+
+	// 同一服务器不能再次提交
+	resp = invokeCreateKeySwitchResult(stub, ksResult1)
+	expectResponseStatusERROR(t, &resp)
+
+	// 第 2 份份额使会话完成，并发出完成事件
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertUser1))
+	ksResult2 := generateSampleKeySwitchResult(t, ksSessionID, server2SK, &targetSK.PublicKey, encryptedKey)
+	resp = invokeCreateKeySwitchResult(stub, ksResult2)
+	expectResponseStatusOK(t, &resp)
+	expectEqual(t, getEventIDForKeySwitchCompletion(ksSessionID), getLastEventForTest(t, stub).EventName)
+	expectEqual(t, keyswitch.Complete, getKeySwitchTriggerForTest(t, stub, ksSessionID).State)
+
+	// 完成后不再接收结果
+	resp = invokeCreateKeySwitchResult(stub, ksResult2)
+	expectResponseStatusERROR(t, &resp)
+	expectEqual(t, "密钥置换会话已完成", resp.Message)
+}
+
+func TestKeySwitchSessionExpiry(t *testing.T) {
+	serverSK, err := ppks.GenPrivKey()
+	expectNil(t, err)
+	targetSK, err := ppks.GenPrivKey()
+	expectNil(t, err)
+	encryptedKey, err := ppks.PointEncrypt(&serverSK.PublicKey, ppks.GenPoint())
+	expectNil(t, err)
+
+	stub := createMockStubWithCert(t, "TestKeySwitchSessionExpiry", exampleCertAdmin1)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+	registerSampleKeySwitchServer(t, stub, base64.StdEncoding.EncodeToString(serializeSM2PublicKeyForTest(&serverSK.PublicKey)))
+
+	// 管理员配置会话有效期
+	ksSessionConfigBytes, _ := json.Marshal(keyswitch.KeySwitchSessionConfig{SessionTTL: 60})
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("setKeySwitchSessionConfig"), ksSessionConfigBytes})
+	expectResponseStatusOK(t, &resp)
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("getKeySwitchSessionConfig")})
+	expectResponseStatusOK(t, &resp)
+	expectEqual(t, string(ksSessionConfigBytes), string(resp.Payload))
+
+	// 非管理员不能配置
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertUser3))
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("setKeySwitchSessionConfig"), ksSessionConfigBytes})
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeForbidden, resp.Message)
+
+	resourceID := createSampleEncryptedDataWithKey(t, stub, serializeCipherTextForTest(encryptedKey))
+	resp = invokeCreateKeySwitchTriggerForTarget(stub, resourceID, targetSK)
+	expectResponseStatusOK(t, &resp)
+	ksSessionID := string(resp.Payload)
+	ksTriggerStored := getKeySwitchTriggerForTest(t, stub, ksSessionID)
+	expectEqual(t, 60*time.Second, ksTriggerStored.ExpiresAt.Sub(ksTriggerStored.Timestamp))
+
+	// 将过期时间改到过去，模拟有效期已过
+	ksTriggerStored.ExpiresAt = time.Now().Add(-time.Second)
+	ksTriggerBytes, _ := json.Marshal(ksTriggerStored)
+	stub.State[getKeyForKeySwitchTrigger(ksSessionID)] = ksTriggerBytes
+	expectEqual(t, keyswitch.Expired, getKeySwitchTriggerForTest(t, stub, ksSessionID).State)
+
+	resp = invokeCreateKeySwitchResult(stub, generateSampleKeySwitchResult(t, ksSessionID, serverSK, &targetSK.PublicKey, encryptedKey))
+	expectResponseStatusERROR(t, &resp)
+	expectEqual(t, "密钥置换会话已过期", resp.Message)
+}
+
+func TestMultiResourceKeySwitchSession(t *testing.T) {
+	serverSK, err := ppks.GenPrivKey()
+	expectNil(t, err)
+	targetSK, err := ppks.GenPrivKey()
+	expectNil(t, err)
+	encryptedKey1, err := ppks.PointEncrypt(&serverSK.PublicKey, ppks.GenPoint())
+	expectNil(t, err)
+	encryptedKey2, err := ppks.PointEncrypt(&serverSK.PublicKey, ppks.GenPoint())
+	expectNil(t, err)
+	targetKeySwitchPK := base64.StdEncoding.EncodeToString(serializeSM2PublicKeyForTest(&targetSK.PublicKey))
+
+	stub := createMockStubWithCert(t, "TestMultiResourceKeySwitchSession", exampleCertAdmin1)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+	registerSampleKeySwitchServer(t, stub, base64.StdEncoding.EncodeToString(serializeSM2PublicKeyForTest(&serverSK.PublicKey)))
+
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertUser3))
+	createSampleEncryptedDataWithIDAndKey(t, stub, "101", serializeCipherTextForTest(encryptedKey1), `DeptType == "computer"`)
+	createSampleEncryptedDataWithIDAndKey(t, stub, "102", serializeCipherTextForTest(encryptedKey2), `DeptType == "computer"`)
+	createSampleEncryptedDataWithIDAndKey(t, stub, "103", serializeCipherTextForTest(encryptedKey2), `DeptType == "finance"`)
+
+	resp := invokeRegisterKeySwitchPK(stub, targetSK)
+	expectResponseStatusOK(t, &resp)
+
+	// 任一资源不满足访问策略即拒绝整个会话
+	resp = invokeCreateMultiResourceKeySwitchTrigger(stub, keyswitch.KeySwitchTrigger{ResourceIDs: []string{"101", "103"}, KeySwitchPK: targetKeySwitchPK})
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeForbidden, resp.Message)
+
+	// 资源 ID 不能重复，也不能与单资源的字段同时使用
+	resp = invokeCreateMultiResourceKeySwitchTrigger(stub, keyswitch.KeySwitchTrigger{ResourceIDs: []string{"101", "101"}, KeySwitchPK: targetKeySwitchPK})
+	expectResponseStatusERROR(t, &resp)
+	resp = invokeCreateMultiResourceKeySwitchTrigger(stub, keyswitch.KeySwitchTrigger{ResourceID: "101", ResourceIDs: []string{"102"}, KeySwitchPK: targetKeySwitchPK})
+	expectResponseStatusERROR(t, &resp)
+
+	resp = invokeCreateMultiResourceKeySwitchTrigger(stub, keyswitch.KeySwitchTrigger{ResourceIDs: []string{"101", "102"}, KeySwitchPK: targetKeySwitchPK})
+	expectResponseStatusOK(t, &resp)
+	ksSessionID := string(resp.Payload)
+	ksTriggerStored := getKeySwitchTriggerForTest(t, stub, ksSessionID)
+	expectEqual(t, []string{"101", "102"}, ksTriggerStored.GetResourceIDs())
+
+	// 以服务器身份提交各资源的份额
+	ksResult1 := generateSampleKeySwitchResult(t, ksSessionID, serverSK, &targetSK.PublicKey, encryptedKey1)
+	ksResult2 := generateSampleKeySwitchResult(t, ksSessionID, serverSK, &targetSK.PublicKey, encryptedKey2)
+	share1 := keyswitch.KeySwitchShare{ResourceID: "101", Share: ksResult1.Share, ZKProof: ksResult1.ZKProof}
+	share2 := keyswitch.KeySwitchShare{ResourceID: "102", Share: ksResult2.Share, ZKProof: ksResult2.ZKProof}
+	ksResult := keyswitch.KeySwitchResult{
+		KeySwitchSessionID: ksSessionID,
+		KeySwitchPK:        ksResult1.KeySwitchPK,
+	}
+
+	// 份额须与资源一一对应且顺序一致
+	ksResult.Shares = []keyswitch.KeySwitchShare{share1}
+	resp = invokeCreateKeySwitchResult(stub, ksResult)
+	expectResponseStatusERROR(t, &resp)
+	ksResult.Shares = []keyswitch.KeySwitchShare{share2, share1}
+	resp = invokeCreateKeySwitchResult(stub, ksResult)
+	expectResponseStatusERROR(t, &resp)
+
+	// 任一份额未通过验证即拒绝整个结果
+	ksResult.Shares = []keyswitch.KeySwitchShare{share1, {ResourceID: "102", Share: ksResult1.Share, ZKProof: ksResult1.ZKProof}}
+	resp = invokeCreateKeySwitchResult(stub, ksResult)
+	expectResponseStatusERROR(t, &resp)
+	expectEqual(t, "份额未通过零知识证明验证", resp.Message)
+
+	ksResult.Shares = []keyswitch.KeySwitchShare{share1, share2}
+	resp = invokeCreateKeySwitchResult(stub, ksResult)
+	expectResponseStatusOK(t, &resp)
+	expectEqual(t, keyswitch.Complete, getKeySwitchTriggerForTest(t, stub, ksSessionID).State)
+
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("listKeySwitchResultsByID"), []byte(ksSessionID)})
+	expectResponseStatusOK(t, &resp)
+	var ksResultsStored []keyswitch.KeySwitchResultStored
+	expectNil(t, json.Unmarshal(resp.Payload, &ksResultsStored))
+	expectEqual(t, 1, len(ksResultsStored))
+	expectEqual(t, share2.Share, ksResultsStored[0].GetResultForResource("102").Share)
+}
+
+func createSampleEncryptedDataWithPolicy(t *testing.T, stub *shimtest.MockStub, policy string) string {
+	sampleEncryptedData := getSampleEncryptedData1()
+	sampleEncryptedData.Policy = policy
+	dataBytes, _ := json.Marshal(sampleEncryptedData)
+
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("createEncryptedData"), dataBytes})
+	expectResponseStatusOK(t, &resp)
+
+	return sampleEncryptedData.Metadata.ResourceID
+}
+
+// 为调用者登记一个新生成的密钥置换公钥，并以其创建密钥置换触发器
+func invokeCreateKeySwitchTrigger(stub *shimtest.MockStub, resourceID string) peer.Response {
+	targetSK, err := ppks.GenPrivKey()
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return invokeCreateKeySwitchTriggerForTarget(stub, resourceID, targetSK)
+}
+
+// 为调用者登记 targetSK 对应的密钥置换公钥，并以其创建密钥置换触发器
+func invokeCreateKeySwitchTriggerForTarget(stub *shimtest.MockStub, resourceID string, targetSK *sm2.PrivateKey) peer.Response {
+	if resp := invokeRegisterKeySwitchPK(stub, targetSK); resp.Status != shim.OK {
+		return resp
+	}
+
+	return invokeCreateKeySwitchTriggerWithKeySwitchPK(stub, resourceID, base64.StdEncoding.EncodeToString(serializeSM2PublicKeyForTest(&targetSK.PublicKey)))
+}
+
+func invokeCreateKeySwitchTriggerWithKeySwitchPK(stub *shimtest.MockStub, resourceID string, ksPK string) peer.Response {
+	ksTrigger := keyswitch.KeySwitchTrigger{
+		ResourceID:  resourceID,
+		KeySwitchPK: ksPK,
+	}
+	ksTriggerBytes, _ := json.Marshal(ksTrigger)
+
+	return stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("createKeySwitchTrigger"), ksTriggerBytes, []byte("ks_trigger_event")})
+}
+
+func getKeySwitchTriggerForTest(t *testing.T, stub *shimtest.MockStub, ksSessionID string) *keyswitch.KeySwitchTriggerStored {
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("getKeySwitchTrigger"), []byte(ksSessionID)})
+	expectResponseStatusOK(t, &resp)
+
+	var ksTriggerStored keyswitch.KeySwitchTriggerStored
+	err := json.Unmarshal(resp.Payload, &ksTriggerStored)
+	expectNil(t, err)
+
+	return &ksTriggerStored
+}
+
+// 取出事件通道中的全部事件，返回最后一个
+func getLastEventForTest(t *testing.T, stub *shimtest.MockStub) *peer.ChaincodeEvent {
+	var lastEvent *peer.ChaincodeEvent
+	for {
+		select {
+		case event := <-stub.ChaincodeEventsChannel:
+			lastEvent = event
+		default:
+			if lastEvent == nil {
+				t.Fatal("没有事件")
+			}
+			return lastEvent
+		}
+	}
+}
+
+func invokeCreateMultiResourceKeySwitchTrigger(stub *shimtest.MockStub, ksTrigger keyswitch.KeySwitchTrigger) peer.Response {
+	ksTriggerBytes, _ := json.Marshal(ksTrigger)
+
+	return stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("createKeySwitchTrigger"), ksTriggerBytes, []byte("ks_trigger_event")})
+}
+
+// 以指定的资源 ID、加密密钥与访问策略创建加密数据
+func createSampleEncryptedDataWithIDAndKey(t *testing.T, stub *shimtest.MockStub, resourceID string, encryptedKey []byte, policy string) {
+	sampleEncryptedData := getSampleEncryptedData1()
+	sampleEncryptedData.Metadata.ResourceID = resourceID
+	sampleEncryptedData.Key = base64.StdEncoding.EncodeToString(encryptedKey)
+	sampleEncryptedData.Policy = policy
+	dataBytes, _ := json.Marshal(sampleEncryptedData)
+
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("createEncryptedData"), dataBytes})
+	expectResponseStatusOK(t, &resp)
+}
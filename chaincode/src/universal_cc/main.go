@@ -1,7 +1,10 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	// 链码容器中不一定有时区数据库，嵌入一份以便按所配置的时区计算时间属性
+	_ "time/tzdata"
 
 	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-protos-go/peer"
@@ -11,10 +14,27 @@ import (
 type UniversalCC struct{}
 
 // Init 用于初始化链码。
+//
+// 参数：
+//   管理员所属的 MSP ID（可多个）。只有这些 MSP 中组织单元（OU）为 admin 的身份才被视为管理员。不指定时没有管理员。
 func (uc *UniversalCC) Init(stub shim.ChaincodeStubInterface) peer.Response {
 	args := stub.GetArgs()
-	if len(args) != 0 {
-		return shim.Error("初始化不接收参数")
+
+	adminMSPIDs := []string{}
+	for _, arg := range args {
+		if len(arg) == 0 {
+			return shim.Error("管理员的 MSP ID 不能为空")
+		}
+		adminMSPIDs = append(adminMSPIDs, string(arg))
+	}
+
+	adminMSPIDsBytes, err := json.Marshal(adminMSPIDs)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化管理员的 MSP ID: %v", err))
+	}
+
+	if err = stub.PutState(AdminMSP, adminMSPIDsBytes); err != nil {
+		return shim.Error(fmt.Sprintf("无法保存管理员的 MSP ID: %v", err))
 	}
 
 	return shim.Success(nil)
@@ -63,13 +83,82 @@ func (uc *UniversalCC) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
 		return uc.createKeySwitchTrigger(stub, args)
 	case "createKeySwitchResult":
 		return uc.createKeySwitchResult(stub, args)
+	case "getKeySwitchTrigger":
+		return uc.getKeySwitchTrigger(stub, args)
 	case "getKeySwitchResult":
 		return uc.getKeySwitchResult(stub, args)
 	case "listKeySwitchResultsByID":
 		return uc.listKeySwitchResultsByID(stub, args)
+	case "setKeySwitchSessionConfig":
+		return uc.setKeySwitchSessionConfig(stub, args)
+	case "getKeySwitchSessionConfig":
+		return uc.getKeySwitchSessionConfig(stub, args)
 	// identity.go
 	case "getDepartmentIdentity":
 		return uc.getDepartmentIdentity(stub, args)
+	case "getCallerPublicKey":
+		return uc.getCallerPublicKey(stub, args)
+	case "updateRegisteredAttributes":
+		return uc.updateRegisteredAttributes(stub, args)
+	case "getRegisteredAttributes":
+		return uc.getRegisteredAttributes(stub, args)
+	case "listRegisteredAttributesHistory":
+		return uc.listRegisteredAttributesHistory(stub, args)
+	// policy.go
+	case "evaluatePolicy":
+		return uc.evaluatePolicy(stub, args)
+	case "createPolicyTemplate":
+		return uc.createPolicyTemplate(stub, args)
+	case "getPolicyTemplate":
+		return uc.getPolicyTemplate(stub, args)
+	case "listPolicyTemplates":
+		return uc.listPolicyTemplates(stub, args)
+	case "setPolicyTimeZone":
+		return uc.setPolicyTimeZone(stub, args)
+	case "getPolicyTimeZone":
+		return uc.getPolicyTimeZone(stub, args)
+	case "setPolicyRedactedAttributes":
+		return uc.setPolicyRedactedAttributes(stub, args)
+	case "getPolicyRedactedAttributes":
+		return uc.getPolicyRedactedAttributes(stub, args)
+	// organization.go
+	case "putOrgUnit":
+		return uc.putOrgUnit(stub, args)
+	case "removeOrgUnit":
+		return uc.removeOrgUnit(stub, args)
+	case "listOrgUnits":
+		return uc.listOrgUnits(stub, args)
+	// key_switch_server.go
+	case "registerKeySwitchServer":
+		return uc.registerKeySwitchServer(stub, args)
+	case "deregisterKeySwitchServer":
+		return uc.deregisterKeySwitchServer(stub, args)
+	case "listKeySwitchServers":
+		return uc.listKeySwitchServers(stub, args)
+	case "recordKeySwitchServerHeartbeat":
+		return uc.recordKeySwitchServerHeartbeat(stub, args)
+	case "listKeySwitchServerHeartbeats":
+		return uc.listKeySwitchServerHeartbeats(stub, args)
+	// key_switch_pk.go
+	case "registerKeySwitchPK":
+		return uc.registerKeySwitchPK(stub, args)
+	case "revokeKeySwitchPK":
+		return uc.revokeKeySwitchPK(stub, args)
+	case "listKeySwitchPKs":
+		return uc.listKeySwitchPKs(stub, args)
+	// key_rotation.go
+	case "publishCollectiveKey":
+		return uc.publishCollectiveKey(stub, args)
+	case "getCollectiveKey":
+		return uc.getCollectiveKey(stub, args)
+	case "updateResourceKey":
+		return uc.updateResourceKey(stub, args)
+	case "revertResourceKey":
+		return uc.revertResourceKey(stub, args)
+	case "getResourceKeyEpoch":
+		return uc.getResourceKeyEpoch(stub, args)
+	case "listEncryptedResourceIDs":
+		return uc.listEncryptedResourceIDs(stub, args)
 	}
 
 	return shim.Error("未知的链码函数调用")
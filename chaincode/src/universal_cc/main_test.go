@@ -20,12 +20,27 @@ func TestInitWithNoParameter(t *testing.T) {
 	}
 }
 
-// Init with one parameter. Should return error.
+// Init with one parameter. Should store it as the admin MSP ID.
 func TestInitWithOneParameter(t *testing.T) {
 	mockStub := createMockStub(t, "TestInitWithOneParameter")
 
+	// Expect the chaincode to get initialized with the admin MSP ID stored
+	arguments := [][]byte{[]byte("Org1MSP")}
+	resp := initChaincode(mockStub, arguments)
+
+	if resp.Status != shim.OK {
+		testLogger.Infof("Failed to initialize chaincode: %v\n", resp.Message)
+		t.FailNow()
+	}
+	expectStateEqual(t, mockStub, AdminMSP, []byte(`["Org1MSP"]`))
+}
+
+// Init with an empty parameter. Should return error.
+func TestInitWithEmptyParameter(t *testing.T) {
+	mockStub := createMockStub(t, "TestInitWithEmptyParameter")
+
 	// Expect the chaincode to return an error
-	arguments := [][]byte{[]byte("Whatever")}
+	arguments := [][]byte{[]byte("")}
 	resp := initChaincode(mockStub, arguments)
 
 	if resp.Status != shim.ERROR {
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/identity"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+func (uc *UniversalCC) putOrgUnit(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 1 {
+		return shim.Error("参数数量不正确。应为 1 个")
+	}
+
+	// 只有管理员可以维护组织树
+	isAdmin, err := uc.isAdminHelper(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isAdmin {
+		return shim.Error(errorcode.CodeForbidden)
+	}
+
+	// 解析第 0 个参数为 identity.OrgUnit
+	var orgUnit identity.OrgUnit
+	if err = json.Unmarshal([]byte(args[0]), &orgUnit); err != nil {
+		return shim.Error(fmt.Sprintf("无法解析参数中的 JSON 对象: %v", err))
+	}
+
+	if strings.TrimSpace(orgUnit.DeptName) == "" {
+		return shim.Error("部门名称不能为空")
+	}
+
+	// 上级部门须已在组织树中，且不能是该部门自身或其下级部门，以保证组织树无环
+	tree := &stubOrganizationTree{stub: stub}
+	for superDeptName := orgUnit.SuperDeptName; superDeptName != ""; {
+		if superDeptName == orgUnit.DeptName {
+			return shim.Error("上级部门不能是该部门自身或其下级部门")
+		}
+
+		nextSuperDeptName, isFound, err := tree.GetSuperDeptName(superDeptName)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if !isFound {
+			return shim.Error(fmt.Sprintf("上级部门 '%v' 不在组织树中", superDeptName))
+		}
+		superDeptName = nextSuperDeptName
+	}
+
+	// 获取写入者与时间戳
+	creator, err := getPKDERFromStub(stub)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法获取创建者: %v", err))
+	}
+
+	timestamp, err := getTimeFromStub(stub)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法获得时间戳: %v", err))
+	}
+
+	orgUnitStored := identity.OrgUnitStored{
+		DeptName:      orgUnit.DeptName,
+		SuperDeptName: orgUnit.SuperDeptName,
+		Creator:       base64.StdEncoding.EncodeToString(creator),
+		Timestamp:     timestamp,
+	}
+	orgUnitStoredBytes, err := json.Marshal(orgUnitStored)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化部门: %v", err))
+	}
+
+	if err = stub.PutState(getKeyForOrgUnit(orgUnit.DeptName), orgUnitStoredBytes); err != nil {
+		return shim.Error(fmt.Sprintf("无法存储部门: %v", err))
+	}
+
+	return shim.Success(nil)
+}
+
+func (uc *UniversalCC) removeOrgUnit(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 1 {
+		return shim.Error("参数数量不正确。应为 1 个")
+	}
+
+	// 只有管理员可以维护组织树
+	isAdmin, err := uc.isAdminHelper(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isAdmin {
+		return shim.Error(errorcode.CodeForbidden)
+	}
+
+	// 第 0 个参数为部门名称
+	deptName := args[0]
+	orgUnits, err := uc.listOrgUnitsHelper(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// 仍有下级部门的部门不能移除
+	isFound := false
+	for _, orgUnit := range orgUnits {
+		if orgUnit.DeptName == deptName {
+			isFound = true
+		}
+		if orgUnit.SuperDeptName == deptName {
+			return shim.Error(fmt.Sprintf("部门 '%v' 仍有下级部门 '%v'，不能移除", deptName, orgUnit.DeptName))
+		}
+	}
+	if !isFound {
+		return shim.Error(errorcode.CodeNotFound)
+	}
+
+	if err = stub.DelState(getKeyForOrgUnit(deptName)); err != nil {
+		return shim.Error(fmt.Sprintf("无法移除部门: %v", err))
+	}
+
+	return shim.Success(nil)
+}
+
+func (uc *UniversalCC) listOrgUnits(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 0 {
+		return shim.Error("参数数量不正确。应为 0 个")
+	}
+
+	orgUnits, err := uc.listOrgUnitsHelper(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	orgUnitsBytes, err := json.Marshal(orgUnits)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化部门: %v", err))
+	}
+
+	return shim.Success(orgUnitsBytes)
+}
+
+func (uc *UniversalCC) listOrgUnitsHelper(stub shim.ChaincodeStubInterface) ([]identity.OrgUnitStored, error) {
+	startKey := getKeyForOrgUnit("")
+	endKey := string(BytesPrefix([]byte(startKey)))
+	resultsIterator, err := stub.GetStateByRange(startKey, endKey)
+	if err != nil {
+		return nil, fmt.Errorf("无法查询组织树: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	orgUnits := []identity.OrgUnitStored{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var orgUnitStored identity.OrgUnitStored
+		if err = json.Unmarshal(queryResponse.Value, &orgUnitStored); err != nil {
+			return nil, fmt.Errorf("无法解析部门: %v", err)
+		}
+		orgUnits = append(orgUnits, orgUnitStored)
+	}
+
+	return orgUnits, nil
+}
+
+// stubOrganizationTree 以账本上的部门记录实现 `policy.OrganizationTree`。
+type stubOrganizationTree struct {
+	stub shim.ChaincodeStubInterface
+}
+
+func (tree *stubOrganizationTree) GetSuperDeptName(deptName string) (string, bool, error) {
+	orgUnitStoredBytes, err := tree.stub.GetState(getKeyForOrgUnit(deptName))
+	if err != nil {
+		return "", false, fmt.Errorf("无法读取部门: %v", err)
+	}
+	if len(orgUnitStoredBytes) == 0 {
+		return "", false, nil
+	}
+
+	var orgUnitStored identity.OrgUnitStored
+	if err = json.Unmarshal(orgUnitStoredBytes, &orgUnitStored); err != nil {
+		return "", false, fmt.Errorf("无法解析部门: %v", err)
+	}
+
+	return orgUnitStored.SuperDeptName, true, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/identity"
+	"github.com/google/uuid"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+func TestPutOrgUnitAsAdmin(t *testing.T) {
+	stub := createMockStubWithCert(t, "TestPutOrgUnitAsAdmin", exampleCertAdmin1)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+	putSampleOrgUnits(t, stub)
+
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("listOrgUnits")})
+	expectResponseStatusOK(t, &resp)
+	var orgUnits []identity.OrgUnitStored
+	err := json.Unmarshal(resp.Payload, &orgUnits)
+	expectNil(t, err)
+	expectEqual(t, len(getSampleOrgUnits()), len(orgUnits))
+
+	// 上级部门不在组织树中
+	resp = invokePutOrgUnit(stub, identity.OrgUnit{DeptName: "900", SuperDeptName: "NON_EXISTENT"})
+	expectResponseStatusERROR(t, &resp)
+
+	// 将部门移到其下级部门之下会形成环
+	resp = invokePutOrgUnit(stub, identity.OrgUnit{DeptName: "Manufacturing", SuperDeptName: "812"})
+	expectResponseStatusERROR(t, &resp)
+	resp = invokePutOrgUnit(stub, identity.OrgUnit{DeptName: "804", SuperDeptName: "804"})
+	expectResponseStatusERROR(t, &resp)
+
+	// 仍有下级部门的部门不能移除，叶子部门可以移除
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("removeOrgUnit"), []byte("804")})
+	expectResponseStatusERROR(t, &resp)
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("removeOrgUnit"), []byte("812")})
+	expectResponseStatusOK(t, &resp)
+	expectEqual(t, 0, len(stub.State[getKeyForOrgUnit("812")]))
+
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("removeOrgUnit"), []byte("812")})
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeNotFound, resp.Message)
+}
+
+func TestPutOrgUnitAsNonAdmin(t *testing.T) {
+	stub := createMockStubWithCert(t, "TestPutOrgUnitAsNonAdmin", exampleCertUser3)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	resp := invokePutOrgUnit(stub, getSampleOrgUnits()[0])
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeForbidden, resp.Message)
+
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("removeOrgUnit"), []byte("Manufacturing")})
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeForbidden, resp.Message)
+}
+
+func TestCreateKeySwitchTriggerWithOrganizationPredicates(t *testing.T) {
+	// exampleCertUser3 的属性为 DeptLevel: 2, DeptName: 812, SuperDeptName: 804
+	// 组织树为 Manufacturing -> 804 -> 812
+	policies := map[string]bool{
+		`descendantOf("Manufacturing")`:                   true,
+		`descendantOf("804") && levelAtMost(2)`:           true,
+		`descendantOf("Finance")`:                         false,
+		`descendantOf("Manufacturing") && levelAtMost(1)`: false,
+	}
+
+	for policy, isAllowed := range policies {
+		stub := createMockStubWithCert(t, "TestCreateKeySwitchTriggerWithOrganizationPredicates", exampleCertAdmin1)
+		_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+		putSampleOrgUnits(t, stub)
+
+		setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertUser3))
+		resourceID := createSampleEncryptedDataWithPolicy(t, stub, policy)
+
+		resp := invokeCreateKeySwitchTrigger(stub, resourceID)
+		if isAllowed {
+			expectResponseStatusOK(t, &resp)
+		} else {
+			expectResponseStatusERROR(t, &resp)
+			expectStringEndsWith(t, errorcode.CodeForbidden, resp.Message)
+		}
+	}
+}
+
+func TestCreateKeySwitchTriggerWithoutOrganizationTree(t *testing.T) {
+	// 组织树为空时，只能依据证书中的上级部门判断
+	policies := map[string]bool{
+		`descendantOf("804")`:           true,
+		`descendantOf("Manufacturing")`: false,
+	}
+
+	for policy, isAllowed := range policies {
+		stub := createMockStubWithCert(t, "TestCreateKeySwitchTriggerWithoutOrganizationTree", exampleCertUser3)
+		_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+		resourceID := createSampleEncryptedDataWithPolicy(t, stub, policy)
+
+		resp := invokeCreateKeySwitchTrigger(stub, resourceID)
+		if isAllowed {
+			expectResponseStatusOK(t, &resp)
+		} else {
+			expectResponseStatusERROR(t, &resp)
+			expectStringEndsWith(t, errorcode.CodeForbidden, resp.Message)
+		}
+	}
+}
+
+func putSampleOrgUnits(t *testing.T, stub *shimtest.MockStub) {
+	for _, orgUnit := range getSampleOrgUnits() {
+		resp := invokePutOrgUnit(stub, orgUnit)
+		expectResponseStatusOK(t, &resp)
+	}
+}
+
+func invokePutOrgUnit(stub *shimtest.MockStub, orgUnit identity.OrgUnit) peer.Response {
+	orgUnitBytes, _ := json.Marshal(orgUnit)
+	return stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("putOrgUnit"), orgUnitBytes})
+}
+
+// 组织树
+// Manufacturing -> 804 -> 812；Finance
+func getSampleOrgUnits() []identity.OrgUnit {
+	return []identity.OrgUnit{
+		{DeptName: "Manufacturing"},
+		{DeptName: "804", SuperDeptName: "Manufacturing"},
+		{DeptName: "812", SuperDeptName: "804"},
+		{DeptName: "Finance"},
+	}
+}
@@ -0,0 +1,556 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/accesspolicy"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/data"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/identity"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/policy"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+func (uc *UniversalCC) evaluatePolicy(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 1 {
+		return shim.Error("参数数量不正确。应为 1 个")
+	}
+
+	// 解析第 0 个参数为 accesspolicy.PolicyEvaluationRequest
+	var req accesspolicy.PolicyEvaluationRequest
+	if err := json.Unmarshal([]byte(args[0]), &req); err != nil {
+		return shim.Error(fmt.Sprintf("无法解析参数中的 JSON 对象: %v", err))
+	}
+
+	// 以与资源创建时相同的规则检查访问策略
+	if err := policy.Validate(req.Policy, policy.SubjectNames); err != nil {
+		return shim.Error(fmt.Sprintf("访问策略不合法: %v", err))
+	}
+
+	expr, err := policy.Parse(req.Policy)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法解析访问策略: %v", err))
+	}
+
+	// 未指定部门身份信息时，使用调用者证书上的部门身份信息
+	deptIdentity := req.DepartmentIdentity
+	if deptIdentity == nil {
+		deptIdentity, err = uc.getDepartmentIdentityHelper(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	// 以与 createKeySwitchTrigger 相同的方式求值，并给出各条件的结果
+	attrs, err := uc.getPolicyAttributesHelper(stub, deptIdentity, req.ResourceID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	isAllowed, clauses, err := policy.Explain(expr, attrs)
+	result := accesspolicy.PolicyEvaluationResult{
+		IsAllowed:      isAllowed && err == nil,
+		MatchedClauses: []string{},
+		FailedClauses:  []string{},
+	}
+	if err != nil {
+		result.ErrorMessage = err.Error()
+	}
+
+	for _, clause := range clauses {
+		if clause.IsSatisfied() {
+			result.MatchedClauses = append(result.MatchedClauses, clause.Clause)
+		} else {
+			result.FailedClauses = append(result.FailedClauses, clause.Clause)
+		}
+	}
+
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化试算结果: %v", err))
+	}
+
+	return shim.Success(resultBytes)
+}
+
+func (uc *UniversalCC) setPolicyTimeZone(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 1 {
+		return shim.Error("参数数量不正确。应为 1 个")
+	}
+
+	// 只有管理员可以配置时区
+	isAdmin, err := uc.isAdminHelper(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isAdmin {
+		return shim.Error(errorcode.CodeForbidden)
+	}
+
+	// 第 0 个参数为 IANA 时区名，如 "Asia/Shanghai"
+	if _, err = time.LoadLocation(args[0]); err != nil || args[0] == "" {
+		return shim.Error(fmt.Sprintf("未知的时区 '%v'", args[0]))
+	}
+
+	if err = stub.PutState(getKeyForPolicyTimeZone(), []byte(args[0])); err != nil {
+		return shim.Error(fmt.Sprintf("无法存储时区: %v", err))
+	}
+
+	return shim.Success(nil)
+}
+
+func (uc *UniversalCC) getPolicyTimeZone(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 0 {
+		return shim.Error("参数数量不正确。应为 0 个")
+	}
+
+	location, err := uc.getPolicyLocationHelper(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success([]byte(location.String()))
+}
+
+func (uc *UniversalCC) setPolicyRedactedAttributes(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 1 {
+		return shim.Error("参数数量不正确。应为 1 个")
+	}
+
+	// 只有管理员可以配置脱敏的属性
+	isAdmin, err := uc.isAdminHelper(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isAdmin {
+		return shim.Error(errorcode.CodeForbidden)
+	}
+
+	// 解析第 0 个参数为属性名列表。以 "." 结尾的为属性名前缀。
+	var names []string
+	if err = json.Unmarshal([]byte(args[0]), &names); err != nil {
+		return shim.Error(fmt.Sprintf("无法解析参数中的 JSON 数组: %v", err))
+	}
+	if names == nil {
+		names = []string{}
+	}
+
+	namesBytes, err := json.Marshal(names)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化属性名列表: %v", err))
+	}
+
+	if err = stub.PutState(getKeyForPolicyRedactedAttributes(), namesBytes); err != nil {
+		return shim.Error(fmt.Sprintf("无法存储属性名列表: %v", err))
+	}
+
+	return shim.Success(nil)
+}
+
+func (uc *UniversalCC) getPolicyRedactedAttributes(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 0 {
+		return shim.Error("参数数量不正确。应为 0 个")
+	}
+
+	names, err := uc.getPolicyRedactedAttributesHelper(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	namesBytes, err := json.Marshal(names)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化属性名列表: %v", err))
+	}
+
+	return shim.Success(namesBytes)
+}
+
+func (uc *UniversalCC) createPolicyTemplate(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 1 {
+		return shim.Error("参数数量不正确。应为 1 个")
+	}
+
+	// 只有管理员可以管理策略模板
+	isAdmin, err := uc.isAdminHelper(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isAdmin {
+		return shim.Error(errorcode.CodeForbidden)
+	}
+
+	// 解析第 0 个参数为 accesspolicy.PolicyTemplate
+	var template accesspolicy.PolicyTemplate
+	if err = json.Unmarshal([]byte(args[0]), &template); err != nil {
+		return shim.Error(fmt.Sprintf("无法解析参数中的 JSON 对象: %v", err))
+	}
+
+	if strings.TrimSpace(template.TemplateID) == "" {
+		return shim.Error("模板 ID 不能为空")
+	}
+
+	if err = policy.Validate(template.Policy, policy.SubjectNames); err != nil {
+		return shim.Error(fmt.Sprintf("访问策略不合法: %v", err))
+	}
+
+	// 确定新版本的版本号
+	latest, err := uc.getPolicyTemplateHelper(stub, template.TemplateID, 0)
+	if err != nil && err != errorcode.ErrorNotFound {
+		return shim.Error(err.Error())
+	}
+	version := 1
+	if latest != nil {
+		version = latest.Version + 1
+	}
+
+	// 获取创建者与时间戳
+	creator, err := getPKDERFromStub(stub)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法获取创建者: %v", err))
+	}
+	creatorAsBase64 := base64.StdEncoding.EncodeToString(creator)
+
+	timestamp, err := getTimeFromStub(stub)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法获得时间戳: %v", err))
+	}
+
+	templateStored := accesspolicy.PolicyTemplateStored{
+		TemplateID:  template.TemplateID,
+		Version:     version,
+		Description: template.Description,
+		Policy:      template.Policy,
+		Creator:     creatorAsBase64,
+		Timestamp:   timestamp,
+	}
+	templateStoredBytes, err := json.Marshal(templateStored)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化策略模板: %v", err))
+	}
+
+	// 各版本均保留，最新版本另存一份以便列出
+	if err = stub.PutState(getKeyForPolicyTemplateVersion(template.TemplateID, version), templateStoredBytes); err != nil {
+		return shim.Error(fmt.Sprintf("无法存储策略模板: %v", err))
+	}
+	if err = stub.PutState(getKeyForPolicyTemplate(template.TemplateID), templateStoredBytes); err != nil {
+		return shim.Error(fmt.Sprintf("无法存储策略模板: %v", err))
+	}
+
+	return shim.Success([]byte(strconv.Itoa(version)))
+}
+
+func (uc *UniversalCC) getPolicyTemplate(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	lenArgs := len(args)
+	if lenArgs < 1 || lenArgs > 2 {
+		return shim.Error("参数数量不正确。应为 1 或 2 个")
+	}
+
+	// 第 0 个参数为模板 ID；若第 1 个参数有指定，则解析为版本号，否则获取最新版本
+	templateID := args[0]
+	version := 0
+	if lenArgs == 2 {
+		var err error
+		version, err = strconv.Atoi(args[1])
+		if err != nil || version <= 0 {
+			return shim.Error("模板版本应为正整数")
+		}
+	}
+
+	templateStored, err := uc.getPolicyTemplateHelper(stub, templateID, version)
+	if err != nil {
+		if err == errorcode.ErrorNotFound {
+			return shim.Error(errorcode.CodeNotFound)
+		}
+		return shim.Error(err.Error())
+	}
+
+	templateStoredBytes, err := json.Marshal(templateStored)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化策略模板: %v", err))
+	}
+
+	return shim.Success(templateStoredBytes)
+}
+
+func (uc *UniversalCC) listPolicyTemplates(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	// 检查参数数量
+	if len(args) != 0 {
+		return shim.Error("参数数量不正确。应为 0 个")
+	}
+
+	// 列出各模板的最新版本
+	startKey := getKeyForPolicyTemplate("")
+	endKey := string(BytesPrefix([]byte(startKey)))
+	resultsIterator, err := stub.GetStateByRange(startKey, endKey)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法查询策略模板: %v", err))
+	}
+	defer resultsIterator.Close()
+
+	templates := []accesspolicy.PolicyTemplateStored{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		var templateStored accesspolicy.PolicyTemplateStored
+		if err = json.Unmarshal(queryResponse.Value, &templateStored); err != nil {
+			return shim.Error(fmt.Sprintf("无法解析策略模板: %v", err))
+		}
+		templates = append(templates, templateStored)
+	}
+
+	templatesBytes, err := json.Marshal(templates)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("无法序列化策略模板: %v", err))
+	}
+
+	return shim.Success(templatesBytes)
+}
+
+// 构建访问策略求值所用的属性，包括部门身份属性、基于链上组织树的组织层级谓词与上下文属性。
+// `resourceID` 不为空时加入该资源的资源属性。
+func (uc *UniversalCC) getPolicyAttributesHelper(stub shim.ChaincodeStubInterface, deptIdentity *identity.DepartmentIdentityStored, resourceID string) (policy.Attributes, error) {
+	attrs := policy.NewAttributesFromDepartmentIdentity(deptIdentity)
+	policy.AddOrganizationPredicates(attrs, deptIdentity, &stubOrganizationTree{stub: stub})
+
+	// 交易时间按所配置的时区计算
+	timestamp, err := getTimeFromStub(stub)
+	if err != nil {
+		return nil, fmt.Errorf("无法获得时间戳: %v", err)
+	}
+	location, err := uc.getPolicyLocationHelper(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	caller, err := getCallerIdentityHelper(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := &policy.Context{
+		Time:   timestamp.In(location),
+		Caller: *caller,
+	}
+
+	if resourceID != "" {
+		metadataBytes, err := stub.GetState(getKeyForResMetadata(resourceID))
+		if err != nil {
+			return nil, fmt.Errorf("无法读取元数据: %v", err)
+		}
+		if len(metadataBytes) == 0 {
+			return nil, fmt.Errorf("资源 '%v' 不存在", resourceID)
+		}
+
+		var metadata data.ResMetadataStored
+		if err = json.Unmarshal(metadataBytes, &metadata); err != nil {
+			return nil, fmt.Errorf("无法解析元数据: %v", err)
+		}
+		ctx.Resource = &metadata
+	}
+
+	policy.AddContextAttributes(attrs, ctx)
+
+	return attrs, nil
+}
+
+// 获取拒绝原因中需要脱敏的属性名列表。以 "." 结尾的为属性名前缀。未配置时为空。
+func (uc *UniversalCC) getPolicyRedactedAttributesHelper(stub shim.ChaincodeStubInterface) ([]string, error) {
+	namesBytes, err := stub.GetState(getKeyForPolicyRedactedAttributes())
+	if err != nil {
+		return nil, fmt.Errorf("无法读取脱敏配置: %v", err)
+	}
+	if len(namesBytes) == 0 {
+		return []string{}, nil
+	}
+
+	var names []string
+	if err = json.Unmarshal(namesBytes, &names); err != nil {
+		return nil, fmt.Errorf("无法解析脱敏配置: %v", err)
+	}
+
+	return names, nil
+}
+
+// 构建访问策略拒绝访问的原因，得到附有该原因的 `errorcode.CodeForbidden` 错误信息。列出所有不满足的条件及其比较的属性值，按配置脱敏。
+func (uc *UniversalCC) getPolicyDenialMessageHelper(stub shim.ChaincodeStubInterface, resourceID string, expr policy.Expr, attrs policy.Attributes) (string, error) {
+	redactedNames, err := uc.getPolicyRedactedAttributesHelper(stub)
+	if err != nil {
+		return "", err
+	}
+
+	isRedacted := func(name string) bool {
+		for _, redactedName := range redactedNames {
+			if name == redactedName || (strings.HasSuffix(redactedName, ".") && strings.HasPrefix(name, redactedName)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	_, clauses, _ := policy.Explain(expr, attrs)
+	reason := accesspolicy.PolicyDenialReason{
+		ResourceID:    resourceID,
+		FailedClauses: []accesspolicy.PolicyClauseFailure{},
+	}
+	for _, clause := range clauses {
+		if clause.IsSatisfied() {
+			continue
+		}
+
+		failure := accesspolicy.PolicyClauseFailure{
+			Clause:    clause.Clause,
+			IsNegated: clause.IsNegated,
+			Values:    clause.Values,
+		}
+		for name := range failure.Values {
+			if isRedacted(name) {
+				failure.Values[name] = accesspolicy.RedactedValue
+			}
+		}
+		if clause.Err != nil {
+			failure.ErrorMessage = clause.Err.Error()
+		}
+		reason.FailedClauses = append(reason.FailedClauses, failure)
+	}
+
+	reasonBytes, err := json.Marshal(reason)
+	if err != nil {
+		return "", fmt.Errorf("无法序列化拒绝原因: %v", err)
+	}
+
+	return errorcode.WithDetail(errorcode.CodeForbidden, string(reasonBytes)), nil
+}
+
+// 获取访问策略中时间属性所用的时区。未配置时为 UTC。
+func (uc *UniversalCC) getPolicyLocationHelper(stub shim.ChaincodeStubInterface) (*time.Location, error) {
+	nameBytes, err := stub.GetState(getKeyForPolicyTimeZone())
+	if err != nil {
+		return nil, fmt.Errorf("无法读取时区: %v", err)
+	}
+	if len(nameBytes) == 0 {
+		return time.UTC, nil
+	}
+
+	location, err := time.LoadLocation(string(nameBytes))
+	if err != nil {
+		return nil, fmt.Errorf("无法加载时区 '%v': %v", string(nameBytes), err)
+	}
+
+	return location, nil
+}
+
+// 获取指定版本的策略模板。版本为 0 时获取最新版本。模板或版本不存在时返回 `errorcode.ErrorNotFound`。
+func (uc *UniversalCC) getPolicyTemplateHelper(stub shim.ChaincodeStubInterface, templateID string, version int) (*accesspolicy.PolicyTemplateStored, error) {
+	key := getKeyForPolicyTemplate(templateID)
+	if version != 0 {
+		key = getKeyForPolicyTemplateVersion(templateID, version)
+	}
+
+	templateStoredBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取策略模板: %v", err)
+	}
+	if len(templateStoredBytes) == 0 {
+		return nil, errorcode.ErrorNotFound
+	}
+
+	var templateStored accesspolicy.PolicyTemplateStored
+	if err = json.Unmarshal(templateStoredBytes, &templateStored); err != nil {
+		return nil, fmt.Errorf("无法解析策略模板: %v", err)
+	}
+
+	return &templateStored, nil
+}
+
+// 获取资源的访问策略文本。资源引用了策略模板时，返回其所固定的模板版本中的策略。资源没有访问策略时返回 `errorcode.ErrorNotFound`。
+func (uc *UniversalCC) getResourcePolicyHelper(stub shim.ChaincodeStubInterface, resourceID string) (string, error) {
+	refBytes, err := stub.GetState(getKeyForResPolicyTemplateReference(resourceID))
+	if err != nil {
+		return "", fmt.Errorf("无法确定 policy 的可用性: %v", err)
+	}
+
+	if len(refBytes) != 0 {
+		var ref accesspolicy.PolicyTemplateReference
+		if err = json.Unmarshal(refBytes, &ref); err != nil {
+			return "", fmt.Errorf("无法解析策略模板引用: %v", err)
+		}
+
+		templateStored, err := uc.getPolicyTemplateHelper(stub, ref.TemplateID, ref.Version)
+		if err != nil {
+			if err == errorcode.ErrorNotFound {
+				return "", fmt.Errorf("资源引用的策略模板 '%v' 版本 %v 不存在", ref.TemplateID, ref.Version)
+			}
+			return "", err
+		}
+
+		return templateStored.Policy, nil
+	}
+
+	policyBytes, err := stub.GetState(getKeyForResPolicy(resourceID))
+	if err != nil {
+		return "", fmt.Errorf("无法确定 policy 的可用性: %v", err)
+	}
+	if len(policyBytes) == 0 {
+		return "", errorcode.ErrorNotFound
+	}
+
+	return string(policyBytes), nil
+}
+
+// 检查并存储资源的访问策略。`ref` 不为 nil 时固定所引用模板的版本并存储引用，否则检查并存储 `policyText`。
+func (uc *UniversalCC) putResourcePolicyHelper(stub shim.ChaincodeStubInterface, resourceID string, policyText string, ref *accesspolicy.PolicyTemplateReference) error {
+	if ref == nil {
+		if err := policy.Validate(policyText, policy.SubjectNames); err != nil {
+			return fmt.Errorf("访问策略不合法: %v", err)
+		}
+
+		if err := stub.PutState(getKeyForResPolicy(resourceID), []byte(policyText)); err != nil {
+			return fmt.Errorf("无法存储策略: %v", err)
+		}
+
+		return nil
+	}
+
+	if policyText != "" {
+		return fmt.Errorf("不能同时指定访问策略与策略模板")
+	}
+
+	// 固定引用的版本，使模板之后的更新不影响已发布的资源
+	templateStored, err := uc.getPolicyTemplateHelper(stub, ref.TemplateID, ref.Version)
+	if err != nil {
+		if err == errorcode.ErrorNotFound {
+			return fmt.Errorf("策略模板 '%v' 不存在或没有版本 %v", ref.TemplateID, ref.Version)
+		}
+		return err
+	}
+
+	pinnedRef := accesspolicy.PolicyTemplateReference{
+		TemplateID: templateStored.TemplateID,
+		Version:    templateStored.Version,
+	}
+	refBytes, err := json.Marshal(pinnedRef)
+	if err != nil {
+		return fmt.Errorf("无法序列化策略模板引用: %v", err)
+	}
+
+	if err = stub.PutState(getKeyForResPolicyTemplateReference(resourceID), refBytes); err != nil {
+		return fmt.Errorf("无法存储策略模板引用: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/accesspolicy"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/identity"
+	"github.com/google/uuid"
+)
+
+func TestEvaluatePolicyWithCallerIdentity(t *testing.T) {
+	targetFunction := "evaluatePolicy"
+	stub := createMockStubWithCert(t, "TestEvaluatePolicyWithCallerIdentity", exampleCertUser3)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	// exampleCertUser3 的属性为 DeptType: computer, DeptLevel: 2, DeptName: 812, SuperDeptName: 804
+	req := accesspolicy.PolicyEvaluationRequest{
+		Policy: `DeptType == "computer" && (DeptLevel == 1 || DeptName in ["812"])`,
+	}
+	reqBytes, _ := json.Marshal(req)
+	numStates := len(stub.State)
+
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte(targetFunction), reqBytes})
+	expectResponseStatusOK(t, &resp)
+
+	var result accesspolicy.PolicyEvaluationResult
+	err := json.Unmarshal(resp.Payload, &result)
+	expectNil(t, err)
+	expectEqual(t, true, result.IsAllowed)
+	expectEqual(t, []string{`DeptType == "computer"`, `DeptName in ["812"]`}, result.MatchedClauses)
+	expectEqual(t, []string{`DeptLevel == 1`}, result.FailedClauses)
+	expectEqual(t, "", result.ErrorMessage)
+
+	// 试算不应写入任何状态
+	expectEqual(t, numStates, len(stub.State))
+}
+
+func TestEvaluatePolicyWithSuppliedIdentity(t *testing.T) {
+	targetFunction := "evaluatePolicy"
+	stub := createMockStubWithCert(t, "TestEvaluatePolicyWithSuppliedIdentity", exampleCertUser3)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	req := accesspolicy.PolicyEvaluationRequest{
+		Policy: `DeptType == "computer" && DeptLevel <= 2`,
+		DepartmentIdentity: &identity.DepartmentIdentityStored{
+			DeptType:  "computer",
+			DeptLevel: 3,
+		},
+	}
+	reqBytes, _ := json.Marshal(req)
+
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte(targetFunction), reqBytes})
+	expectResponseStatusOK(t, &resp)
+
+	var result accesspolicy.PolicyEvaluationResult
+	err := json.Unmarshal(resp.Payload, &result)
+	expectNil(t, err)
+	expectEqual(t, false, result.IsAllowed)
+	expectEqual(t, []string{`DeptType == "computer"`}, result.MatchedClauses)
+	expectEqual(t, []string{`DeptLevel <= 2`}, result.FailedClauses)
+}
+
+func TestEvaluatePolicyWithEvaluationError(t *testing.T) {
+	targetFunction := "evaluatePolicy"
+	stub := createMockStubWithCert(t, "TestEvaluatePolicyWithEvaluationError", exampleCertUser3)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	req := accesspolicy.PolicyEvaluationRequest{
+		Policy: `DeptLevel == "2" || DeptType == "computer"`,
+	}
+	reqBytes, _ := json.Marshal(req)
+
+	// 求值出错时应视为拒绝并给出错误信息
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte(targetFunction), reqBytes})
+	expectResponseStatusOK(t, &resp)
+
+	var result accesspolicy.PolicyEvaluationResult
+	err := json.Unmarshal(resp.Payload, &result)
+	expectNil(t, err)
+	expectEqual(t, false, result.IsAllowed)
+	expectEqual(t, []string{`DeptLevel == "2"`}, result.FailedClauses)
+	expectNotEqual(t, "", result.ErrorMessage)
+}
+
+func TestEvaluatePolicyWithInvalidPolicy(t *testing.T) {
+	targetFunction := "evaluatePolicy"
+	stub := createMockStubWithCert(t, "TestEvaluatePolicyWithInvalidPolicy", exampleCertUser3)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	for _, policy := range []string{`DeptType == `, `Role == "admin"`} {
+		reqBytes, _ := json.Marshal(accesspolicy.PolicyEvaluationRequest{Policy: policy})
+		resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte(targetFunction), reqBytes})
+		expectResponseStatusERROR(t, &resp)
+	}
+}
+
+func TestCreatePolicyTemplateAsAdmin(t *testing.T) {
+	targetFunction := "createPolicyTemplate"
+	stub := createMockStubWithCert(t, "TestCreatePolicyTemplateAsAdmin", exampleCertAdmin1)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	// 以同一 ID 创建两次，应分别得到版本 1 与版本 2
+	template := getSamplePolicyTemplate()
+	templateBytes, _ := json.Marshal(template)
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte(targetFunction), templateBytes})
+	expectResponseStatusOK(t, &resp)
+	expectEqual(t, "1", string(resp.Payload))
+
+	template.Policy = `DeptType == "computer" && DeptLevel <= 3`
+	templateBytes, _ = json.Marshal(template)
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte(targetFunction), templateBytes})
+	expectResponseStatusOK(t, &resp)
+	expectEqual(t, "2", string(resp.Payload))
+
+	// 不指定版本时获取最新版本
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("getPolicyTemplate"), []byte(template.TemplateID)})
+	expectResponseStatusOK(t, &resp)
+	var templateStored accesspolicy.PolicyTemplateStored
+	_ = json.Unmarshal(resp.Payload, &templateStored)
+	expectEqual(t, 2, templateStored.Version)
+	expectEqual(t, template.Policy, templateStored.Policy)
+	expectEqual(t, template.Description, templateStored.Description)
+
+	// 指定版本时获取该版本
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("getPolicyTemplate"), []byte(template.TemplateID), []byte("1")})
+	expectResponseStatusOK(t, &resp)
+	_ = json.Unmarshal(resp.Payload, &templateStored)
+	expectEqual(t, 1, templateStored.Version)
+	expectEqual(t, getSamplePolicyTemplate().Policy, templateStored.Policy)
+
+	// 不存在的版本
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("getPolicyTemplate"), []byte(template.TemplateID), []byte("3")})
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeNotFound, resp.Message)
+
+	// 列出模板时每个模板只出现最新版本
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("listPolicyTemplates")})
+	expectResponseStatusOK(t, &resp)
+	var templates []accesspolicy.PolicyTemplateStored
+	_ = json.Unmarshal(resp.Payload, &templates)
+	expectEqual(t, 1, len(templates))
+	expectEqual(t, 2, templates[0].Version)
+}
+
+func TestCreatePolicyTemplateAsNonAdmin(t *testing.T) {
+	stub := createMockStubWithCert(t, "TestCreatePolicyTemplateAsNonAdmin", exampleCertUser3)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	templateBytes, _ := json.Marshal(getSamplePolicyTemplate())
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("createPolicyTemplate"), templateBytes})
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeForbidden, resp.Message)
+}
+
+func TestCreatePolicyTemplateWithInvalidPolicy(t *testing.T) {
+	stub := createMockStubWithCert(t, "TestCreatePolicyTemplateWithInvalidPolicy", exampleCertAdmin1)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	template := getSamplePolicyTemplate()
+	template.Policy = `Role == "admin"`
+	templateBytes, _ := json.Marshal(template)
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("createPolicyTemplate"), templateBytes})
+	expectResponseStatusERROR(t, &resp)
+}
+
+func TestKeySwitchTriggerWithPolicyTemplate(t *testing.T) {
+	stub := createMockStubWithCert(t, "TestKeySwitchTriggerWithPolicyTemplate", exampleCertAdmin1)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	// 管理员创建模板版本 1：DeptLevel == 2
+	template := getSamplePolicyTemplate()
+	templateBytes, _ := json.Marshal(template)
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("createPolicyTemplate"), templateBytes})
+	expectResponseStatusOK(t, &resp)
+
+	// 以 exampleCertUser3 的身份创建引用该模板（最新版本）的资源
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertUser3))
+	sampleEncryptedData := getSampleEncryptedData1()
+	sampleEncryptedData.Policy = ""
+	sampleEncryptedData.PolicyTemplate = &accesspolicy.PolicyTemplateReference{TemplateID: template.TemplateID}
+	dataBytes, _ := json.Marshal(sampleEncryptedData)
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("createEncryptedData"), dataBytes})
+	expectResponseStatusOK(t, &resp)
+
+	// 资源应固定引用版本 1
+	var ref accesspolicy.PolicyTemplateReference
+	_ = json.Unmarshal(stub.State[getKeyForResPolicyTemplateReference(sampleEncryptedData.Metadata.ResourceID)], &ref)
+	expectEqual(t, 1, ref.Version)
+
+	// 管理员将模板更新为版本 2：DeptLevel == 1。已发布的资源不受影响。
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertAdmin1))
+	template.Policy = `DeptType == "computer" && DeptLevel == 1`
+	templateBytes, _ = json.Marshal(template)
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("createPolicyTemplate"), templateBytes})
+	expectResponseStatusOK(t, &resp)
+
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertUser3))
+	resp = invokeCreateKeySwitchTrigger(stub, sampleEncryptedData.Metadata.ResourceID)
+	expectResponseStatusOK(t, &resp)
+
+	// getPolicy 返回固定版本中的策略
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("getPolicy"), []byte(sampleEncryptedData.Metadata.ResourceID)})
+	expectResponseStatusOK(t, &resp)
+	expectEqual(t, getSamplePolicyTemplate().Policy, string(resp.Payload))
+}
+
+func TestCreateEncryptedDataWithPolicyAndPolicyTemplate(t *testing.T) {
+	stub := createMockStubWithCert(t, "TestCreateEncryptedDataWithPolicyAndPolicyTemplate", exampleCertAdmin1)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	templateBytes, _ := json.Marshal(getSamplePolicyTemplate())
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("createPolicyTemplate"), templateBytes})
+	expectResponseStatusOK(t, &resp)
+
+	// 同时指定策略与模板
+	sampleEncryptedData := getSampleEncryptedData1()
+	sampleEncryptedData.PolicyTemplate = &accesspolicy.PolicyTemplateReference{TemplateID: getSamplePolicyTemplate().TemplateID}
+	dataBytes, _ := json.Marshal(sampleEncryptedData)
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("createEncryptedData"), dataBytes})
+	expectResponseStatusERROR(t, &resp)
+
+	// 引用不存在的模板
+	sampleEncryptedData.Policy = ""
+	sampleEncryptedData.PolicyTemplate = &accesspolicy.PolicyTemplateReference{TemplateID: "NON_EXISTENT"}
+	dataBytes, _ = json.Marshal(sampleEncryptedData)
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("createEncryptedData"), dataBytes})
+	expectResponseStatusERROR(t, &resp)
+}
+
+func TestCreateKeySwitchTriggerWithContextConditions(t *testing.T) {
+	// getSampleEncryptedData1 的扩展字段 dataType 为 document，调用者的 MSP ID 为 Org1MSP
+	policies := map[string]bool{
+		`Resource.dataType == "document" && Resource.ID == "101"`: true,
+		`Caller.MSPID == "Org1MSP"`:                               true,
+		`Tx.Date > "2000-01-01" && Tx.Date < "2999-01-01"`:        true,
+		`Caller.MSPID == "Org2MSP"`:                               false,
+		`Tx.Date >= "2999-01-01"`:                                 false,
+	}
+
+	for policy, isAllowed := range policies {
+		stub := createMockStubWithCert(t, "TestCreateKeySwitchTriggerWithContextConditions", exampleCertUser3)
+		_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+		resourceID := createSampleEncryptedDataWithPolicy(t, stub, policy)
+
+		resp := invokeCreateKeySwitchTrigger(stub, resourceID)
+		if isAllowed {
+			expectResponseStatusOK(t, &resp)
+		} else {
+			expectResponseStatusERROR(t, &resp)
+			expectStringEndsWith(t, errorcode.CodeForbidden, resp.Message)
+		}
+	}
+}
+
+func TestCreateKeySwitchTriggerWithCallerIdentityConditions(t *testing.T) {
+	// exampleCertUser3 的证书主体为 O=Hyperledger, OU=peer, CN=peer0，证书属性 hf.EnrollmentID 为 peer0，hf.Type 为 peer
+	// exampleCertAdmin1 的证书主体为 O=org1.lab805.com, OU=admin, CN=Admin@org1.lab805.com，没有证书属性
+	policies := []struct {
+		cert      string
+		policy    string
+		isAllowed bool
+	}{
+		{exampleCertUser3, `Caller.Org == "Hyperledger" && Caller.Role == "peer"`, true},
+		{exampleCertUser3, `Caller.EnrollmentID == "peer0" && Caller.CommonName == "peer0"`, true},
+		{exampleCertUser3, `Caller.MSPID == "Org1MSP" && Caller.Role in ["client", "admin"]`, false},
+		{exampleCertAdmin1, `Caller.Org == "org1.lab805.com" && Caller.Role == "admin"`, true},
+		{exampleCertAdmin1, `Caller.EnrollmentID == "Admin@org1.lab805.com"`, true},
+	}
+
+	for _, p := range policies {
+		stub := createMockStubWithCert(t, "TestCreateKeySwitchTriggerWithCallerIdentityConditions", p.cert)
+		_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+		resourceID := createSampleEncryptedDataWithPolicy(t, stub, p.policy)
+
+		resp := invokeCreateKeySwitchTrigger(stub, resourceID)
+		if p.isAllowed {
+			expectResponseStatusOK(t, &resp)
+		} else {
+			expectResponseStatusERROR(t, &resp)
+			expectStringEndsWith(t, errorcode.CodeForbidden, resp.Message)
+		}
+	}
+}
+
+func TestCreateKeySwitchTriggerAfterEmbargoDate(t *testing.T) {
+	stub := createMockStubWithCert(t, "TestCreateKeySwitchTriggerAfterEmbargoDate", exampleCertUser3)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	// 禁运日期已过，不再允许访问
+	sampleEncryptedData := getSampleEncryptedData1()
+	sampleEncryptedData.Metadata.Extensions["embargoDate"] = "2000-01-01"
+	sampleEncryptedData.Policy = `Tx.Date < Resource.embargoDate`
+	dataBytes, _ := json.Marshal(sampleEncryptedData)
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("createEncryptedData"), dataBytes})
+	expectResponseStatusOK(t, &resp)
+
+	resp = invokeCreateKeySwitchTrigger(stub, sampleEncryptedData.Metadata.ResourceID)
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeForbidden, resp.Message)
+}
+
+func TestSetPolicyTimeZone(t *testing.T) {
+	stub := createMockStubWithCert(t, "TestSetPolicyTimeZone", exampleCertAdmin1)
+	_ = initChaincode(stub, [][]byte{[]byte("Org1MSP")})
+
+	// 未配置时为 UTC
+	resp := stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("getPolicyTimeZone")})
+	expectResponseStatusOK(t, &resp)
+	expectEqual(t, "UTC", string(resp.Payload))
+
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("setPolicyTimeZone"), []byte("Asia/Shanghai")})
+	expectResponseStatusOK(t, &resp)
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("getPolicyTimeZone")})
+	expectResponseStatusOK(t, &resp)
+	expectEqual(t, "Asia/Shanghai", string(resp.Payload))
+
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("setPolicyTimeZone"), []byte("Mars/Olympus")})
+	expectResponseStatusERROR(t, &resp)
+
+	// 时间属性按所配置的时区计算。2021-03-07T01:30:00Z 为上海时间 09:30。
+	stub.MockTransactionStart(uuid.NewString())
+	stub.TxTimestamp.Seconds = 1615080600
+	stub.TxTimestamp.Nanos = 0
+	attrs, err := new(UniversalCC).getPolicyAttributesHelper(stub, &identity.DepartmentIdentityStored{}, "")
+	stub.MockTransactionEnd("")
+	expectNil(t, err)
+	expectEqual(t, "09:30", attrs["Tx.Clock"])
+	expectEqual(t, "2021-03-07T09:30:00+08:00", attrs["Tx.Time"])
+
+	// 只有管理员可以配置时区
+	setMockStubCreator(t, stub, "Org1MSP", []byte(exampleCertUser3))
+	resp = stub.MockInvoke(uuid.NewString(), [][]byte{[]byte("setPolicyTimeZone"), []byte("UTC")})
+	expectResponseStatusERROR(t, &resp)
+	expectStringEndsWith(t, errorcode.CodeForbidden, resp.Message)
+}
+
+// 访问策略模板
+// 模板 ID: "computer-level-2"
+func getSamplePolicyTemplate() accesspolicy.PolicyTemplate {
+	return accesspolicy.PolicyTemplate{
+		TemplateID:  "computer-level-2",
+		Description: "计算机类 2 级部门",
+		Policy:      `DeptType == "computer" && DeptLevel == 2`,
+	}
+}
@@ -89,6 +89,24 @@ CCqGSM49BAMCA0cAMEQCIC4PUwJHhxi20JJT+yAdB+i4UWNcPmIFNNFHyHYwgvCm
 AiBQxf8/6m576DKRpTB+x1BAOhnk2MoNdm9Qrv4OC5Oykw==
 -----END CERTIFICATE-----`
 
+// Admin@org1.lab805.com
+// 组织单元（OU）为 admin，不带部门属性
+const exampleCertAdmin1 = `-----BEGIN CERTIFICATE-----
+MIICYTCCAgegAwIBAgIUQl5wlmVj6jm2uhCyl3lcjewBBUcwCgYIKoZIzj0EAwIw
+gYQxCzAJBgNVBAYTAlVTMRMwEQYDVQQIDApDYWxpZm9ybmlhMRYwFAYDVQQHDA1T
+YW4gRnJhbmNpc2NvMRgwFgYDVQQKDA9vcmcxLmxhYjgwNS5jb20xDjAMBgNVBAsM
+BWFkbWluMR4wHAYDVQQDDBVBZG1pbkBvcmcxLmxhYjgwNS5jb20wIBcNMjYxMDE4
+MjAxNDI0WhgPMjEyNjA5MjQyMDE0MjRaMIGEMQswCQYDVQQGEwJVUzETMBEGA1UE
+CAwKQ2FsaWZvcm5pYTEWMBQGA1UEBwwNU2FuIEZyYW5jaXNjbzEYMBYGA1UECgwP
+b3JnMS5sYWI4MDUuY29tMQ4wDAYDVQQLDAVhZG1pbjEeMBwGA1UEAwwVQWRtaW5A
+b3JnMS5sYWI4MDUuY29tMFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAE05zuyhtZ
+SCFAxFGlOxfU+xzo4DdoNzY0pCfgpHL48Z4sTi0zTGFLqQp++QYFlKMm3fc5sDrB
+ZcIGgZwXAHIK1aNTMFEwHQYDVR0OBBYEFMJaGDkkC7C8SpIt1Ra9X4rGUNXiMB8G
+A1UdIwQYMBaAFMJaGDkkC7C8SpIt1Ra9X4rGUNXiMA8GA1UdEwEB/wQFMAMBAf8w
+CgYIKoZIzj0EAwIDSAAwRQIhANZJkuzxUUXAOKGuYcYUecdZM68QuyVolfSz6w3a
+QS8mAiAccpBByGWFFVkXHi4Hz5QBdye8e/i//kHp4leh2vIPXQ==
+-----END CERTIFICATE-----`
+
 // Check if the actual value is equal to the expected value.
 func expectEqual(t *testing.T, expected interface{}, actual interface{}) {
 	isEqual := assert.Equal(t, expected, actual)
@@ -100,8 +118,8 @@ func expectEqual(t *testing.T, expected interface{}, actual interface{}) {
 
 // Check if the actual value is NOT equal to the expected value.
 func expectNotEqual(t *testing.T, expected interface{}, actual interface{}) {
-	isEqual := assert.Equal(t, expected, actual)
-	if isEqual {
+	isNotEqual := assert.NotEqual(t, expected, actual)
+	if !isNotEqual {
 		testLogger.Infof("Value was '%v'. Expecting to be different\n", actual)
 		t.FailNow()
 	}
@@ -118,8 +136,8 @@ func expectNil(t *testing.T, actual interface{}) {
 
 // Check if the actual value is NOT nil.
 func expectNotNil(t *testing.T, actual interface{}) {
-	isNil := assert.Nil(t, actual)
-	if isNil {
+	isNotNil := assert.NotNil(t, actual)
+	if !isNotNil {
 		testLogger.Infof("Value was nil. Expecting not to be nil\n")
 		t.FailNow()
 	}
@@ -19,6 +19,22 @@ const (
 	KS = "ks"
 	// RegKey 对应监管者公钥的 key
 	RegKey = "regKey"
+	// PolicyTpl 对应访问策略模板的 key 的前缀
+	PolicyTpl = "policytpl"
+	// Org 对应组织树中部门的 key 的前缀
+	Org = "org"
+	// AttrReg 对应属性登记簿的 key 的前缀
+	AttrReg = "attrreg"
+	// PolicyTZ 对应访问策略时区配置的 key
+	PolicyTZ = "policytz"
+	// PolicyRedact 对应拒绝原因脱敏配置的 key
+	PolicyRedact = "policyredact"
+	// KSConfig 对应密钥置换会话配置的 key
+	KSConfig = "ksconfig"
+	// KSCollKey 对应最新发布的集合公钥的 key
+	KSCollKey = "kscollkey"
+	// AdminMSP 对应管理员所属的 MSP ID 列表的 key
+	AdminMSP = "adminmsp"
 )
 
 func getKeyForResData(resourceID string) string {
@@ -33,10 +49,62 @@ func getKeyForResKey(resourceID string) string {
 	return fmt.Sprintf("res_%s_key", resourceID)
 }
 
+func getKeyForResKeyEpoch(resourceID string) string {
+	return fmt.Sprintf("res_%s_keyepoch", resourceID)
+}
+
+// 资源被替换的旧密钥按其纪元存于此 key 下。纪元补零至定长，使各纪元按 key 排序即按纪元排序。
+func getKeyForResKeyVersion(resourceID string, epoch int) string {
+	return fmt.Sprintf("res_%s_keyver_%010d", resourceID, epoch)
+}
+
+func getKeyPrefixForResKeyVersion(resourceID string) string {
+	return fmt.Sprintf("res_%s_keyver_", resourceID)
+}
+
 func getKeyForResPolicy(resourceID string) string {
 	return fmt.Sprintf("res_%s_policy", resourceID)
 }
 
+func getKeyForResPolicyTemplateReference(resourceID string) string {
+	return fmt.Sprintf("res_%s_policytpl", resourceID)
+}
+
+// 模板的最新版本存于此 key 下，以便按前缀列出所有模板
+func getKeyForPolicyTemplate(templateID string) string {
+	return fmt.Sprintf("%s_%s", PolicyTpl, templateID)
+}
+
+func getKeyForPolicyTemplateVersion(templateID string, version int) string {
+	return fmt.Sprintf("%sver_%s_%d", PolicyTpl, templateID, version)
+}
+
+func getKeyForPolicyTimeZone() string {
+	return PolicyTZ
+}
+
+func getKeyForPolicyRedactedAttributes() string {
+	return PolicyRedact
+}
+
+func getKeyForOrgUnit(deptName string) string {
+	return fmt.Sprintf("%s_%s", Org, deptName)
+}
+
+// 身份最新的登记属性存于此 key 下
+func getKeyForRegisteredAttributes(publicKeyAsBase64 string) string {
+	return fmt.Sprintf("%s_%s", AttrReg, publicKeyAsBase64)
+}
+
+// 版本号补零至定长，使各版本按 key 排序即按版本排序
+func getKeyForRegisteredAttributesVersion(publicKeyAsBase64 string, version int) string {
+	return fmt.Sprintf("%shist_%s_%010d", AttrReg, publicKeyAsBase64, version)
+}
+
+func getKeyPrefixForRegisteredAttributesVersion(publicKeyAsBase64 string) string {
+	return fmt.Sprintf("%shist_%s_", AttrReg, publicKeyAsBase64)
+}
+
 func getKeyForAuthRequest(authSessionID string) string {
 	return fmt.Sprintf("auth_%s_req", authSessionID)
 }
@@ -57,6 +125,36 @@ func getKeyPrefixForKeySwitchResponse(keySwitchSessionID string) string {
 	return fmt.Sprintf("ks_%s_result", keySwitchSessionID)
 }
 
+func getKeyForKeySwitchServer(publicKeyAsBase64 string) string {
+	return fmt.Sprintf("ksserver_%s", publicKeyAsBase64)
+}
+
+func getKeyForKeySwitchServerHeartbeat(publicKeyAsBase64 string) string {
+	return fmt.Sprintf("ksheartbeat_%s", publicKeyAsBase64)
+}
+
+// 以身份为前缀，使同一身份的登记可按范围列出
+func getKeyForKeySwitchPK(ownerAsBase64 string, keySwitchPK string) string {
+	return fmt.Sprintf("kspk_%s_%s", ownerAsBase64, keySwitchPK)
+}
+
+func getKeyForKeySwitchSessionConfig() string {
+	return KSConfig
+}
+
+func getKeyForCollectiveKey() string {
+	return KSCollKey
+}
+
+// 纪元补零至定长，使各纪元按 key 排序即按纪元排序
+func getKeyForCollectiveKeyVersion(epoch int) string {
+	return fmt.Sprintf("kscollkeyver_%010d", epoch)
+}
+
+func getEventIDForKeySwitchCompletion(keySwitchSessionID string) string {
+	return fmt.Sprintf("ks_%s_complete", keySwitchSessionID)
+}
+
 func extractResourceIDFromKeyForResMetadata(dbKey string) (string, error) {
 	parts := strings.Split(dbKey, "_")
 	if len(parts) != 3 {
@@ -7,10 +7,14 @@ import (
 	"os"
 	"path"
 
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/appinit"
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/utils/cipherutils"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/sm2keyutils"
 	"github.com/XiaoYao-austin/ppks"
 	"github.com/pkg/errors"
 	"github.com/tjfoc/gmsm/sm2"
 	"github.com/tjfoc/gmsm/x509"
+	"gopkg.in/yaml.v2"
 )
 
 func generateKeys(dirKeys string, users []string) error {
@@ -33,44 +37,133 @@ func generateKeys(dirKeys string, users []string) error {
 			return errors.Wrapf(err, "cannot generate a private key for '%v'", user)
 		}
 
-		pubKey := privKey.PublicKey
-
 		privKeys = append(privKeys, *privKey)
-		pubKeys = append(pubKeys, pubKey)
+		pubKeys = append(pubKeys, privKey.PublicKey)
 
-		// Create a directory for the user
-		if _, err = os.Stat(path.Join(dirKeys, user)); os.IsNotExist(err) {
-			os.Mkdir(path.Join(dirKeys, user), 0755)
+		if err = saveKeyPair(dirKeys, user, privKey); err != nil {
+			return err
 		}
+	}
+
+	// Construct a collective key pair and save it
+	collPrivKey := ppks.CollPrivKey(privKeys)
+	collPubKey := ppks.CollPubKey(pubKeys)
+
+	return saveCollectiveKeyPair(dirKeys, collPrivKey, collPubKey)
+}
+
+// generateThresholdKeys generates the keys for the t-of-n mode. The collective private key is generated at random and split into shares for the key switch servers using Shamir's secret sharing. Any `config.Threshold` of the servers are able to perform the key switch process. The other users are generated keys as usual. The threshold key info required by the clients is saved as `threshold.yaml`.
+func generateThresholdKeys(dirKeys string, users []string, config *thresholdConfig) error {
+	// Exit if the dir exists
+	if _, err := os.Stat(dirKeys); os.IsExist(err) {
+		return fmt.Errorf("the sm2 keys are already generated. Delete the folder first before running again")
+	}
+
+	// Create the dir
+	os.Mkdir(dirKeys, 0755)
 
-		// Save the private key and the public key to files
-		// Private key
-		privKeyDer, err := x509.MarshalSm2UnecryptedPrivateKey(privKey)
+	// Generate a collective key pair and split the private key
+	collPrivKey, err := ppks.GenPrivKey()
+	if err != nil {
+		return errors.Wrap(err, "cannot generate the collective private key")
+	}
+
+	shares, err := cipherutils.SplitSM2PrivateKey(collPrivKey, config.Threshold, len(config.Servers))
+	if err != nil {
+		return errors.Wrap(err, "cannot split the collective private key")
+	}
+
+	// The share of a server is used as its private key
+	info := appinit.ThresholdKeyInfo{Threshold: config.Threshold}
+	for i, server := range config.Servers {
+		if err = saveKeyPair(dirKeys, server, shares[i]); err != nil {
+			return err
+		}
+
+		pubKeyPem, err := sm2keyutils.ConvertPublicKeyToPEM(&shares[i].PublicKey)
 		if err != nil {
-			return errors.Wrapf(err, "cannot save the private key for '%v'", user)
+			return errors.Wrapf(err, "cannot save the public key for '%v'", server)
 		}
-		privKeyPemBlock := pem.Block{
-			Type:  "PRIVATE KEY",
-			Bytes: privKeyDer,
+
+		info.ShareHolders = append(info.ShareHolders, appinit.ThresholdShareHolder{
+			Name:      server,
+			Index:     i + 1,
+			PublicKey: string(pubKeyPem),
+		})
+	}
+
+	// Generate keys for the rest of the users
+	isServer := map[string]bool{}
+	for _, server := range config.Servers {
+		isServer[server] = true
+	}
+
+	for _, user := range users {
+		if isServer[user] {
+			continue
 		}
-		privKeyPem := pem.EncodeToMemory(&privKeyPemBlock)
-		ioutil.WriteFile(path.Join(dirKeys, user, "sk"), privKeyPem, 0644)
 
-		// Public key
-		pubKeyDer, err := x509.MarshalSm2PublicKey(&pubKey)
+		privKey, err := ppks.GenPrivKey()
 		if err != nil {
-			return errors.Wrapf(err, "cannot save the public key for '%v'", user)
+			return errors.Wrapf(err, "cannot generate a private key for '%v'", user)
 		}
-		pubKeyPemBlock := pem.Block{
-			Type:  "PUBLIC KEY",
-			Bytes: pubKeyDer,
+
+		if err = saveKeyPair(dirKeys, user, privKey); err != nil {
+			return err
 		}
-		pubKeyPem := pem.EncodeToMemory(&pubKeyPemBlock)
-		ioutil.WriteFile(path.Join(dirKeys, user, user+".pem"), pubKeyPem, 0644)
 	}
 
-	// Construct a collective private key and save it
-	collPrivKey := ppks.CollPrivKey(privKeys)
+	if err = saveCollectiveKeyPair(dirKeys, collPrivKey, &collPrivKey.PublicKey); err != nil {
+		return err
+	}
+
+	// Save the threshold key info
+	infoBytes, err := yaml.Marshal(&info)
+	if err != nil {
+		return errors.Wrap(err, "cannot save the threshold key info")
+	}
+	ioutil.WriteFile(path.Join(dirKeys, "threshold.yaml"), infoBytes, 0644)
+
+	return nil
+}
+
+// saveKeyPair saves the private key and the public key of a user in the directory of the user.
+func saveKeyPair(dirKeys string, user string, privKey *sm2.PrivateKey) error {
+	// Create a directory for the user
+	if _, err := os.Stat(path.Join(dirKeys, user)); os.IsNotExist(err) {
+		os.Mkdir(path.Join(dirKeys, user), 0755)
+	}
+
+	// Save the private key and the public key to files
+	// Private key
+	privKeyDer, err := x509.MarshalSm2UnecryptedPrivateKey(privKey)
+	if err != nil {
+		return errors.Wrapf(err, "cannot save the private key for '%v'", user)
+	}
+	privKeyPemBlock := pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: privKeyDer,
+	}
+	privKeyPem := pem.EncodeToMemory(&privKeyPemBlock)
+	ioutil.WriteFile(path.Join(dirKeys, user, "sk"), privKeyPem, 0644)
+
+	// Public key
+	pubKeyDer, err := x509.MarshalSm2PublicKey(&privKey.PublicKey)
+	if err != nil {
+		return errors.Wrapf(err, "cannot save the public key for '%v'", user)
+	}
+	pubKeyPemBlock := pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: pubKeyDer,
+	}
+	pubKeyPem := pem.EncodeToMemory(&pubKeyPemBlock)
+	ioutil.WriteFile(path.Join(dirKeys, user, user+".pem"), pubKeyPem, 0644)
+
+	return nil
+}
+
+// saveCollectiveKeyPair saves the collective private key and the collective public key.
+func saveCollectiveKeyPair(dirKeys string, collPrivKey *sm2.PrivateKey, collPubKey *sm2.PublicKey) error {
 	collPrivKeyDer, err := x509.MarshalSm2UnecryptedPrivateKey(collPrivKey)
 	if err != nil {
 		return errors.Wrap(err, "cannot save the collective private key")
@@ -82,8 +175,6 @@ func generateKeys(dirKeys string, users []string) error {
 	collPrivKeyPem := pem.EncodeToMemory(&collPrivKeyPemBlock)
 	ioutil.WriteFile(path.Join(dirKeys, "collPrivKey.pem"), collPrivKeyPem, 0644)
 
-	// Construct a collective public key and save it
-	collPubKey := ppks.CollPubKey(pubKeys)
 	collPubKeyDer, err := x509.MarshalSm2PublicKey(collPubKey)
 	if err != nil {
 		return errors.Wrap(err, "cannot save the collective public key")
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"io/ioutil"
 	"os"
 
@@ -10,8 +12,16 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+// thresholdConfig describes the t-of-n mode, in which any `Threshold` of the `Servers` are able to perform the key switch process.
+type thresholdConfig struct {
+	Threshold int      `yaml:"threshold"` // The number of shares required to perform the key switch process
+	Servers   []string `yaml:"servers"`   // The users that serve as key switch servers
+}
+
 func main() {
-	dirKeys := "sm2keys"
+	dirKeys := flag.String("dir", "sm2keys", "the directory to save the keys in. Use a new directory to generate the keys of a new epoch when rotating keys.")
+	thresholdFilePath := flag.String("threshold", "", "the path to the threshold config file. Keys for the t-of-n mode are generated if specified.")
+	flag.Parse()
 
 	// Load the config, generate and save keys
 	filePath := "cmd/sm2keygen/users.yaml"
@@ -20,7 +30,19 @@ func main() {
 		log.Fatalln(err)
 	}
 
-	generateKeys(dirKeys, users)
+	if *thresholdFilePath == "" {
+		generateKeys(*dirKeys, users)
+		return
+	}
+
+	config, err := loadThresholdConfig(*thresholdFilePath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if err = generateThresholdKeys(*dirKeys, users, config); err != nil {
+		log.Fatalln(err)
+	}
 }
 
 func deleteDir(dirKeys string) error {
@@ -47,3 +69,21 @@ func loadConfig(filePath string) ([]string, error) {
 
 	return users, nil
 }
+
+func loadThresholdConfig(filePath string) (*thresholdConfig, error) {
+	fileBytes, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read threshold config file")
+	}
+
+	config := &thresholdConfig{}
+	if err = yaml.Unmarshal(fileBytes, config); err != nil {
+		return nil, errors.Wrap(err, "cannot load threshold config file")
+	}
+
+	if config.Threshold < 1 || config.Threshold > len(config.Servers) {
+		return nil, fmt.Errorf("the threshold should be between 1 and the number of servers")
+	}
+
+	return config, nil
+}
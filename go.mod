@@ -31,3 +31,7 @@ require gorm.io/driver/mysql v1.1.2
 require github.com/ipfs/go-ipfs-api v0.2.0
 
 require github.com/mitchellh/mapstructure v1.4.2
+
+require github.com/hyperledger/fabric-protos-go v0.0.0-20200707132912-fee30f3ccd23
+
+require github.com/golang/protobuf v1.4.2
@@ -1,14 +1,17 @@
 package appinit
 
 import (
+	"encoding/base64"
 	"fmt"
 	"io/ioutil"
 	"strings"
 
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/global"
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/utils/cipherutils"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/sm2keyutils"
 	errors "github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
 )
 
 // KeySwitchKeyLocations records the paths to the keys required to perform the key switch process.
@@ -18,6 +21,21 @@ type KeySwitchKeyLocations struct {
 	CollectivePublicKey  string `yaml:"collectivePublicKey"`  // The path to the collective public key
 	PrivateKey           string `yaml:"privateKey"`           // The path to the private key
 	PublicKey            string `yaml:"publicKey"`            // The path to the public key
+	ThresholdKeyInfo     string `yaml:"thresholdKeyInfo"`     // The path to the threshold key info. Only specified in the t-of-n mode.
+	CollectiveKeyEpoch   int    `yaml:"collectiveKeyEpoch"`   // The epoch of the collective key pair. 0 for the keys in use before any rotation.
+}
+
+// ThresholdKeyInfo records the threshold and the share holders of the collective private key in the t-of-n mode. It's generated by `cmd/sm2keygen`.
+type ThresholdKeyInfo struct {
+	Threshold    int                    `yaml:"threshold"`    // The number of shares required to perform the key switch process
+	ShareHolders []ThresholdShareHolder `yaml:"shareHolders"` // The key switch servers holding the shares of the collective private key
+}
+
+// ThresholdShareHolder records a key switch server holding a share of the collective private key.
+type ThresholdShareHolder struct {
+	Name      string `yaml:"name"`      // The name of the user
+	Index     int    `yaml:"index"`     // The share index, which starts from 1
+	PublicKey string `yaml:"publicKey"` // The public key of the share in PEM
 }
 
 // LoadKeySwitchServerKeys loads the keys required to perform the key switch process from the paths specified in `locations`. The keys will be available as singletons in `global.KeySwitchKeys`.
@@ -34,6 +52,11 @@ func LoadKeySwitchServerKeys(locations *KeySwitchKeyLocations) error {
 
 	global.KeySwitchKeys.EncryptionAlgorithm = locations.EncryptionAlgorithm
 
+	if locations.CollectiveKeyEpoch < 0 {
+		return fmt.Errorf("集合密钥的纪元不能为负数")
+	}
+	global.KeySwitchKeys.CollectiveKeyEpoch = locations.CollectiveKeyEpoch
+
 	// Load and save the collective private key as a singleton
 	if locations.CollectivePrivateKey != "" {
 		collPrivKeyPem, err := ioutil.ReadFile(locations.CollectivePrivateKey)
@@ -92,5 +115,34 @@ func LoadKeySwitchServerKeys(locations *KeySwitchKeyLocations) error {
 		global.KeySwitchKeys.PublicKey = pubKey
 	}
 
+	// Load the threshold key info in the t-of-n mode
+	if locations.ThresholdKeyInfo != "" {
+		infoBytes, err := ioutil.ReadFile(locations.ThresholdKeyInfo)
+		if err != nil {
+			return errors.Wrap(err, "无法读取门限密钥信息")
+		}
+
+		var info ThresholdKeyInfo
+		if err = yaml.Unmarshal(infoBytes, &info); err != nil {
+			return errors.Wrap(err, "无法解析门限密钥信息")
+		}
+
+		if info.Threshold < 1 || info.Threshold > len(info.ShareHolders) {
+			return fmt.Errorf("门限值应在 1 至份额持有者数量之间")
+		}
+
+		shareIndices := map[string]int{}
+		for _, shareHolder := range info.ShareHolders {
+			pubKey, err := sm2keyutils.ConvertPEMToPublicKey([]byte(shareHolder.PublicKey))
+			if err != nil {
+				return errors.Wrapf(err, "无法解析份额持有者 '%v' 的公钥", shareHolder.Name)
+			}
+
+			shareIndices[base64.StdEncoding.EncodeToString(cipherutils.SerializeSM2PublicKey(pubKey))] = shareHolder.Index
+		}
+
+		global.KeySwitchKeys.ShareIndices = shareIndices
+	}
+
 	return nil
 }
@@ -18,6 +18,8 @@ type ServerInfo struct {
 	IsRegulator       bool                   `yaml:"isRegulator"`
 	KeySwitchKeys     *KeySwitchKeyLocations `yaml:"keySwitchKeys"`
 	ShowTimingLogs    bool                   `yaml:"showTimingLogs"`
+	ShareDeliveryURL  string                 `yaml:"shareDeliveryURL"` // The URL at which the key switch servers deliver shares to this instance. Shares go onto the chain if it's empty.
+	RegulatorToken    string                 `yaml:"regulatorToken"`   // The bearer token required to manage the regulator backfill job through the API. Every caller is refused if it's empty.
 }
 
 // LoadServerInfo loads the server config file (in YAML) which contains info needed to start a server.
@@ -0,0 +1,112 @@
+package background
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/pkg/errors"
+)
+
+// extractChaincodeEventsFromBlock extracts the chaincode events set by the valid transactions in a block. The events are in the same form as the ones received from the event client so that they can be handled in the same way.
+//
+// Parameters:
+//   the block queried from the ledger
+//
+// Returns:
+//   the chaincode events in the order of the transactions
+func extractChaincodeEventsFromBlock(block *common.Block) ([]*fab.CCEvent, error) {
+	if block.Header == nil || block.Data == nil {
+		return nil, errors.New("区块不完整")
+	}
+
+	// Transactions marked invalid by the committing peer are skipped since their events were never emitted
+	var txFilter []byte
+	if block.Metadata != nil && len(block.Metadata.Metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		txFilter = block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	}
+
+	ccEvents := []*fab.CCEvent{}
+	for i, envelopeBytes := range block.Data.Data {
+		if i >= len(txFilter) || peer.TxValidationCode(txFilter[i]) != peer.TxValidationCode_VALID {
+			continue
+		}
+
+		envelope := &common.Envelope{}
+		if err := proto.Unmarshal(envelopeBytes, envelope); err != nil {
+			return nil, errors.Wrapf(err, "无法解析区块 %v 中的第 %v 个交易", block.Header.Number, i)
+		}
+
+		payload := &common.Payload{}
+		if err := proto.Unmarshal(envelope.Payload, payload); err != nil {
+			return nil, errors.Wrapf(err, "无法解析区块 %v 中的第 %v 个交易", block.Header.Number, i)
+		}
+		if payload.Header == nil {
+			continue
+		}
+
+		channelHeader := &common.ChannelHeader{}
+		if err := proto.Unmarshal(payload.Header.ChannelHeader, channelHeader); err != nil {
+			return nil, errors.Wrapf(err, "无法解析区块 %v 中的第 %v 个交易", block.Header.Number, i)
+		}
+		if common.HeaderType(channelHeader.Type) != common.HeaderType_ENDORSER_TRANSACTION {
+			continue
+		}
+
+		tx := &peer.Transaction{}
+		if err := proto.Unmarshal(payload.Data, tx); err != nil {
+			return nil, errors.Wrapf(err, "无法解析区块 %v 中的第 %v 个交易", block.Header.Number, i)
+		}
+
+		for _, action := range tx.Actions {
+			ccEvent, err := extractChaincodeEventFromTransactionAction(action)
+			if err != nil {
+				return nil, errors.Wrapf(err, "无法解析区块 %v 中的第 %v 个交易", block.Header.Number, i)
+			}
+			if ccEvent == nil {
+				continue
+			}
+
+			ccEvents = append(ccEvents, &fab.CCEvent{
+				TxID:        ccEvent.TxId,
+				ChaincodeID: ccEvent.ChaincodeId,
+				EventName:   ccEvent.EventName,
+				Payload:     ccEvent.Payload,
+				BlockNumber: block.Header.Number,
+			})
+		}
+	}
+
+	return ccEvents, nil
+}
+
+// extractChaincodeEventFromTransactionAction extracts the chaincode event set by a transaction action. It returns nil if no event is set.
+func extractChaincodeEventFromTransactionAction(action *peer.TransactionAction) (*peer.ChaincodeEvent, error) {
+	ccActionPayload := &peer.ChaincodeActionPayload{}
+	if err := proto.Unmarshal(action.Payload, ccActionPayload); err != nil {
+		return nil, err
+	}
+	if ccActionPayload.Action == nil {
+		return nil, nil
+	}
+
+	proposalResponsePayload := &peer.ProposalResponsePayload{}
+	if err := proto.Unmarshal(ccActionPayload.Action.ProposalResponsePayload, proposalResponsePayload); err != nil {
+		return nil, err
+	}
+
+	ccAction := &peer.ChaincodeAction{}
+	if err := proto.Unmarshal(proposalResponsePayload.Extension, ccAction); err != nil {
+		return nil, err
+	}
+	if len(ccAction.Events) == 0 {
+		return nil, nil
+	}
+
+	ccEvent := &peer.ChaincodeEvent{}
+	if err := proto.Unmarshal(ccAction.Events, ccEvent); err != nil {
+		return nil, err
+	}
+
+	return ccEvent, nil
+}
@@ -0,0 +1,77 @@
+package background
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractChaincodeEventsFromBlock(t *testing.T) {
+	block := &common.Block{
+		Header: &common.BlockHeader{Number: 7},
+		Data: &common.BlockData{
+			Data: [][]byte{
+				createSampleEnvelopeBytes(t, "tx1", "ks_trigger", []byte("payload1")),
+				createSampleEnvelopeBytes(t, "tx2", "ks_trigger", []byte("payload2")),
+				createSampleEnvelopeBytes(t, "tx3", "", nil),
+			},
+		},
+		Metadata: &common.BlockMetadata{
+			Metadata: [][]byte{{}, {}, {byte(peer.TxValidationCode_VALID), byte(peer.TxValidationCode_MVCC_READ_CONFLICT), byte(peer.TxValidationCode_VALID)}},
+		},
+	}
+
+	ccEvents, err := extractChaincodeEventsFromBlock(block)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	// 无效交易与未发事件的交易均被跳过
+	if isLenCorrect := assert.Len(t, ccEvents, 1); !isLenCorrect {
+		t.FailNow()
+	}
+	assert.Equal(t, "tx1", ccEvents[0].TxID)
+	assert.Equal(t, "universalCc", ccEvents[0].ChaincodeID)
+	assert.Equal(t, "ks_trigger", ccEvents[0].EventName)
+	assert.Equal(t, []byte("payload1"), ccEvents[0].Payload)
+	assert.Equal(t, uint64(7), ccEvents[0].BlockNumber)
+}
+
+// 构造一个背书交易的信封。事件名为空时交易不发事件。
+func createSampleEnvelopeBytes(t *testing.T, txID string, eventName string, eventPayload []byte) []byte {
+	var eventBytes []byte
+	if eventName != "" {
+		eventBytes = mustMarshal(t, &peer.ChaincodeEvent{ChaincodeId: "universalCc", TxId: txID, EventName: eventName, Payload: eventPayload})
+	}
+
+	ccActionPayload := &peer.ChaincodeActionPayload{
+		Action: &peer.ChaincodeEndorsedAction{
+			ProposalResponsePayload: mustMarshal(t, &peer.ProposalResponsePayload{
+				Extension: mustMarshal(t, &peer.ChaincodeAction{Events: eventBytes}),
+			}),
+		},
+	}
+	tx := &peer.Transaction{
+		Actions: []*peer.TransactionAction{{Payload: mustMarshal(t, ccActionPayload)}},
+	}
+	payload := &common.Payload{
+		Header: &common.Header{
+			ChannelHeader: mustMarshal(t, &common.ChannelHeader{Type: int32(common.HeaderType_ENDORSER_TRANSACTION), TxId: txID}),
+		},
+		Data: mustMarshal(t, tx),
+	}
+
+	return mustMarshal(t, &common.Envelope{Payload: mustMarshal(t, payload)})
+}
+
+func mustMarshal(t *testing.T, message proto.Message) []byte {
+	bytes, err := proto.Marshal(message)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	return bytes
+}
@@ -0,0 +1,90 @@
+package background
+
+import "sync"
+
+// blockCheckpointTracker works out the block from which a restarted background server must replay events. The events of a block may be processed concurrently and finish out of order, so the checkpoint is the lowest block that still has events in flight or has an event that failed. A failed event holds the checkpoint back for the rest of the run so that it's replayed on the next start. When nothing is pending, the checkpoint is the latest block that has been processed.
+type blockCheckpointTracker struct {
+	mu       sync.Mutex
+	base     uint64          // The latest block known to have been processed
+	inFlight map[uint64]int  // The number of events in flight, keyed by block number
+	failed   map[uint64]bool // The blocks that have an event failed
+}
+
+func newBlockCheckpointTracker(base uint64) *blockCheckpointTracker {
+	return &blockCheckpointTracker{
+		base:     base,
+		inFlight: map[uint64]int{},
+		failed:   map[uint64]bool{},
+	}
+}
+
+// begin records an event of the block as in flight. It must be called before the event is handed to the workers.
+func (t *blockCheckpointTracker) begin(blockNumber uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.inFlight[blockNumber]++
+}
+
+// finish records the outcome of an event of the block and returns the resulting checkpoint.
+func (t *blockCheckpointTracker) finish(blockNumber uint64, err error) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.inFlight[blockNumber] <= 1 {
+		delete(t.inFlight, blockNumber)
+	} else {
+		t.inFlight[blockNumber]--
+	}
+
+	if err != nil {
+		t.failed[blockNumber] = true
+	} else if blockNumber > t.base {
+		t.base = blockNumber
+	}
+
+	return t.checkpointLocked()
+}
+
+// observe records the block as processed without any event in it to be handled, e.g. the latest block once the catch-up is done. It returns the resulting checkpoint.
+func (t *blockCheckpointTracker) observe(blockNumber uint64) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if blockNumber > t.base {
+		t.base = blockNumber
+	}
+
+	return t.checkpointLocked()
+}
+
+// checkpoint returns the block from which the events must be replayed after a restart.
+func (t *blockCheckpointTracker) checkpoint() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.checkpointLocked()
+}
+
+func (t *blockCheckpointTracker) checkpointLocked() uint64 {
+	isPending := false
+	var lowest uint64
+	for blockNumber := range t.inFlight {
+		if !isPending || blockNumber < lowest {
+			lowest = blockNumber
+			isPending = true
+		}
+	}
+	for blockNumber := range t.failed {
+		if !isPending || blockNumber < lowest {
+			lowest = blockNumber
+			isPending = true
+		}
+	}
+
+	if isPending {
+		return lowest
+	}
+
+	return t.base
+}
@@ -0,0 +1,85 @@
+package background
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockCheckpointTrackerOutOfOrder(t *testing.T) {
+	tracker := newBlockCheckpointTracker(4)
+	assert.Equal(t, uint64(4), tracker.checkpoint())
+
+	tracker.begin(5)
+	tracker.begin(6)
+	tracker.begin(6)
+	tracker.begin(7)
+
+	// 后面的区块先完成时，检查点停在仍未完成的最早区块
+	assert.Equal(t, uint64(5), tracker.finish(7, nil))
+	assert.Equal(t, uint64(5), tracker.finish(6, nil))
+	assert.Equal(t, uint64(6), tracker.finish(5, nil))
+
+	// 失败的触发器使检查点在本次运行中不再越过其区块
+	assert.Equal(t, uint64(6), tracker.finish(6, fmt.Errorf("重试次数用尽")))
+	tracker.begin(8)
+	assert.Equal(t, uint64(6), tracker.finish(8, nil))
+	assert.Equal(t, uint64(6), tracker.observe(9))
+}
+
+func TestBlockCheckpointTrackerAllDone(t *testing.T) {
+	tracker := newBlockCheckpointTracker(0)
+
+	tracker.begin(3)
+	assert.Equal(t, uint64(3), tracker.observe(10))
+	assert.Equal(t, uint64(10), tracker.finish(3, nil))
+}
+
+func TestBlockCheckpointTrackerWithWorkerPool(t *testing.T) {
+	pool := newWorkerPool(workerPoolOptions{
+		name:           "测试工作池",
+		numWorkers:     3,
+		maxAttempts:    1,
+		initialBackoff: time.Millisecond,
+	})
+	tracker := newBlockCheckpointTracker(0)
+
+	// 区块 1 的任务最慢，区块 3 的任务最快；区块 2 的任务失败
+	chanRelease := make(chan struct{})
+	chanBlock3Done := make(chan struct{})
+	runs := map[uint64]func() error{
+		1: func() error { <-chanRelease; return nil },
+		2: func() error { <-chanBlock3Done; return newPermanentError(fmt.Errorf("无法处理")) },
+		3: func() error { return nil },
+	}
+
+	checkpoints := make(chan uint64, 3)
+	for blockNumber := uint64(1); blockNumber <= 3; blockNumber++ {
+		blockNumber := blockNumber
+		tracker.begin(blockNumber)
+		err := pool.submitWithCallback(fmt.Sprintf("区块 %v", blockNumber), func(ctx context.Context) error {
+			return runs[blockNumber]()
+		}, func(err error) {
+			checkpoints <- tracker.finish(blockNumber, err)
+			if blockNumber == 3 {
+				close(chanBlock3Done)
+			}
+		})
+		if isNoError := assert.NoError(t, err); !isNoError {
+			t.FailNow()
+		}
+	}
+
+	// 区块 3 完成、区块 2 失败时区块 1 仍在处理，检查点不越过区块 1
+	assert.Equal(t, uint64(1), <-checkpoints)
+	assert.Equal(t, uint64(1), <-checkpoints)
+
+	// 区块 1 完成后检查点停在失败的区块 2，重启后将从该区块重放
+	close(chanRelease)
+	assert.Equal(t, uint64(2), <-checkpoints)
+
+	assert.NoError(t, pool.stop(context.Background()))
+}
@@ -0,0 +1,312 @@
+package background
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/global"
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/service"
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/utils/cipherutils"
+	"github.com/XiaoYao-austin/ppks"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+// The modes in which the re-encryption job decrypts the stored resource keys.
+const (
+	// KeyReencryptionModeRegulator decrypts the keys with the collective private key of the regulator.
+	KeyReencryptionModeRegulator = "regulator"
+	// KeyReencryptionModeKeySwitch decrypts the keys through a key switch session for each resource.
+	KeyReencryptionModeKeySwitch = "keySwitch"
+)
+
+// The number of resource IDs fetched from the chain at a time
+const keyReencryptionPageSize = 50
+
+// The time limit for the key switch results of a resource to arrive
+const keyReencryptionKeySwitchTimeout = 30 * time.Second
+
+// KeyReencryptionProgress reports the state of a re-encryption job.
+type KeyReencryptionProgress struct {
+	Epoch          int               `json:"epoch"`                // The epoch the keys are moved to
+	Mode           string            `json:"mode"`                 // How the stored keys are decrypted
+	IsRunning      bool              `json:"isRunning"`            // Whether the job is still running
+	NumReencrypted int               `json:"numReencrypted"`       // The number of resources whose keys have been moved to the epoch
+	NumSkipped     int               `json:"numSkipped"`           // The number of resources whose keys were already at the epoch or later
+	Failures       map[string]string `json:"failures"`             // The errors of the resources that could not be processed, keyed by resource ID
+	Error          string            `json:"error,omitempty"`      // The error that aborted the job, if any
+	StartedAt      time.Time         `json:"startedAt"`            // When the job was started
+	FinishedAt     time.Time         `json:"finishedAt,omitempty"` // When the job finished
+}
+
+// KeyReencryptionJob moves the encrypted symmetric key of each resource to the collective public key published under a newer epoch. The stored keys are decrypted with the collective private key of the regulator if this instance has one, or otherwise through a key switch session for each resource. The job can be run again to retry the failed resources, as those already moved are skipped.
+type KeyReencryptionJob struct {
+	KeyRotationService service.KeyRotationServiceInterface
+	KeySwitchService   service.KeySwitchServiceInterface
+	NumWorkers         int // The number of Go routines that will be created to perform the job. It takes effect on the next start.
+	mu                 sync.Mutex
+	progress           KeyReencryptionProgress
+	cancel             context.CancelFunc
+	chanDone           chan struct{}
+}
+
+func NewKeyReencryptionJob(keyRotationService service.KeyRotationServiceInterface, keySwitchService service.KeySwitchServiceInterface, numWorkers int) *KeyReencryptionJob {
+	return &KeyReencryptionJob{
+		KeyRotationService: keyRotationService,
+		KeySwitchService:   keySwitchService,
+		NumWorkers:         numWorkers,
+	}
+}
+
+// Start starts moving the keys to the collective public key of `epoch` in the background. The collective public key must have been published on the chain, and `epoch` must be later than the epoch of the keys of this instance.
+func (j *KeyReencryptionJob) Start(epoch int) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.progress.IsRunning {
+		return fmt.Errorf("密钥重加密任务正在运行")
+	}
+
+	if epoch <= global.KeySwitchKeys.CollectiveKeyEpoch {
+		return fmt.Errorf("纪元应大于本实例的集合密钥的纪元 %v", global.KeySwitchKeys.CollectiveKeyEpoch)
+	}
+
+	// Decide how to decrypt the stored keys
+	var mode string
+	if global.KeySwitchKeys.CollectivePrivateKey != nil {
+		mode = KeyReencryptionModeRegulator
+	} else if global.KeySwitchKeys.PrivateKey != nil && global.KeySwitchKeys.PublicKey != nil {
+		mode = KeyReencryptionModeKeySwitch
+	} else {
+		return fmt.Errorf("未指定集合私钥或密钥置换所需的密钥，无法解密资源的密钥")
+	}
+
+	// Fetch the new collective public key from the chain
+	collectiveKey, err := j.KeyRotationService.GetCollectiveKey(epoch)
+	if err != nil {
+		return errors.Wrapf(err, "无法获取纪元 %v 的集合公钥", epoch)
+	}
+
+	collectiveKeyBytes, err := base64.StdEncoding.DecodeString(collectiveKey.PublicKey)
+	if err != nil {
+		return errors.Wrap(err, "无法解析集合公钥")
+	}
+
+	collectivePublicKey, err := cipherutils.DeserializeSM2PublicKey(collectiveKeyBytes)
+	if err != nil {
+		return errors.Wrap(err, "无法解析集合公钥")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j.cancel = cancel
+	j.chanDone = make(chan struct{})
+	j.progress = KeyReencryptionProgress{
+		Epoch:     epoch,
+		Mode:      mode,
+		IsRunning: true,
+		Failures:  map[string]string{},
+		StartedAt: time.Now(),
+	}
+
+	log.Infof("正在将资源的密钥重加密至纪元 %v，模式: %v...", epoch, mode)
+	go j.run(ctx, epoch, mode, collectivePublicKey)
+
+	return nil
+}
+
+// Progress returns a snapshot of the progress of the latest run.
+func (j *KeyReencryptionJob) Progress() KeyReencryptionProgress {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	ret := j.progress
+	ret.Failures = map[string]string{}
+	for resourceID, errMsg := range j.progress.Failures {
+		ret.Failures[resourceID] = errMsg
+	}
+
+	return ret
+}
+
+// Stop cancels the running job and waits for it to end until `ctx` is done. The resources not yet processed are left for the next run.
+func (j *KeyReencryptionJob) Stop(ctx context.Context) error {
+	j.mu.Lock()
+	if !j.progress.IsRunning {
+		j.mu.Unlock()
+		return nil
+	}
+	cancel, chanDone := j.cancel, j.chanDone
+	j.mu.Unlock()
+
+	cancel()
+	select {
+	case <-chanDone:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "无法在时限内停止密钥重加密任务")
+	}
+}
+
+// run walks through the resources with encrypted keys page by page and queues one task for each of them.
+func (j *KeyReencryptionJob) run(ctx context.Context, epoch int, mode string, collectivePublicKey *sm2.PublicKey) {
+	defer close(j.chanDone)
+
+	pool := newWorkerPool(workerPoolOptions{
+		name:       "密钥重加密任务",
+		numWorkers: j.NumWorkers,
+	})
+
+	var runErr error
+	bookmark := ""
+	for ctx.Err() == nil {
+		page, err := j.KeyRotationService.ListEncryptedResourceIDs(keyReencryptionPageSize, bookmark)
+		if err != nil {
+			runErr = errors.Wrap(err, "无法列出带有加密密钥的资源")
+			break
+		}
+
+		for _, resourceID := range page.IDs {
+			resourceID := resourceID
+			err = pool.submit(fmt.Sprintf("资源 %v", resourceID), func(taskCtx context.Context) error {
+				err := j.reencryptResourceKey(taskCtx, resourceID, epoch, mode, collectivePublicKey)
+				j.recordResult(resourceID, err)
+				return err
+			})
+			if err != nil {
+				runErr = err
+				break
+			}
+		}
+
+		if runErr != nil || len(page.IDs) < keyReencryptionPageSize {
+			break
+		}
+		bookmark = page.Bookmark
+	}
+
+	if err := ctx.Err(); err != nil && runErr == nil {
+		runErr = errors.Wrap(err, "密钥重加密任务已取消")
+	}
+
+	// Let the queued tasks finish unless the job is cancelled
+	if err := pool.stop(ctx); err != nil && runErr == nil {
+		runErr = err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.progress.IsRunning = false
+	j.progress.FinishedAt = time.Now()
+	if runErr != nil {
+		j.progress.Error = runErr.Error()
+		log.Errorln(runErr)
+	}
+
+	log.Infof("密钥重加密任务已结束。重加密 %v 个，跳过 %v 个，失败 %v 个。", j.progress.NumReencrypted, j.progress.NumSkipped, len(j.progress.Failures))
+}
+
+// recordResult records the outcome of an attempt on a resource. Only the latest error of a resource is kept, and it's cleared once a retry succeeds.
+func (j *KeyReencryptionJob) recordResult(resourceID string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err != nil {
+		j.progress.Failures[resourceID] = err.Error()
+	} else {
+		delete(j.progress.Failures, resourceID)
+	}
+}
+
+// reencryptResourceKey moves the encrypted key of a resource to the collective public key of `epoch`. Resources already at the epoch are skipped.
+func (j *KeyReencryptionJob) reencryptResourceKey(ctx context.Context, resourceID string, epoch int, mode string, collectivePublicKey *sm2.PublicKey) error {
+	resourceKeyEpoch, err := j.KeyRotationService.GetResourceKeyEpoch(resourceID)
+	if err != nil {
+		return errors.Wrap(err, "无法获取资源的密钥纪元")
+	}
+
+	if resourceKeyEpoch.Epoch >= epoch {
+		j.mu.Lock()
+		j.progress.NumSkipped++
+		j.mu.Unlock()
+		return nil
+	}
+
+	// The stored key can only be decrypted with the keys of the same epoch
+	if resourceKeyEpoch.Epoch != global.KeySwitchKeys.CollectiveKeyEpoch {
+		return newPermanentError(fmt.Errorf("资源的密钥属于纪元 %v，与本实例的集合密钥的纪元 %v 不一致", resourceKeyEpoch.Epoch, global.KeySwitchKeys.CollectiveKeyEpoch))
+	}
+
+	var key *ppks.CurvePoint
+	if mode == KeyReencryptionModeRegulator {
+		key, err = j.decryptResourceKeyAsRegulator(resourceID)
+	} else {
+		key, err = j.decryptResourceKeyWithKeySwitch(ctx, resourceID)
+	}
+	if err != nil {
+		return err
+	}
+
+	newEncryptedKey, err := ppks.PointEncrypt(collectivePublicKey, key)
+	if err != nil {
+		return newPermanentError(errors.Wrap(err, "无法以新的集合公钥加密密钥"))
+	}
+
+	// Give up before uploading if the job is being stopped
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	txID, err := j.KeyRotationService.UpdateResourceKey(resourceID, newEncryptedKey, epoch)
+	if err != nil {
+		return errors.Wrap(err, "无法将新的加密密钥上链")
+	}
+
+	j.mu.Lock()
+	j.progress.NumReencrypted++
+	j.mu.Unlock()
+	log.Debugf("已将资源的密钥重加密至纪元 %v。资源 ID: %v。交易 ID: %v。", epoch, resourceID, txID)
+
+	return nil
+}
+
+// decryptResourceKeyAsRegulator decrypts the stored key of a resource with the collective private key.
+func (j *KeyReencryptionJob) decryptResourceKeyAsRegulator(resourceID string) (*ppks.CurvePoint, error) {
+	encryptedKey, err := j.KeyRotationService.GetResourceKey(resourceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "无法获取资源的加密密钥")
+	}
+
+	key, err := ppks.PointDecrypt(encryptedKey, global.KeySwitchKeys.CollectivePrivateKey)
+	if err != nil {
+		return nil, newPermanentError(errors.Wrap(err, "无法解密加密的密钥"))
+	}
+
+	return key, nil
+}
+
+// decryptResourceKeyWithKeySwitch decrypts the stored key of a resource through a key switch session. The identity of this instance must be allowed to access the resource.
+func (j *KeyReencryptionJob) decryptResourceKeyWithKeySwitch(ctx context.Context, resourceID string) (*ppks.CurvePoint, error) {
+	keySwitchSessionID, err := j.KeySwitchService.CreateKeySwitchTrigger(resourceID, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "无法创建密钥置换会话")
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, keyReencryptionKeySwitchTimeout)
+	defer cancel()
+
+	if _, err = j.KeySwitchService.AwaitKeySwitchResultsWithContext(waitCtx, keySwitchSessionID); err != nil {
+		return nil, errors.Wrapf(err, "无法收集密钥置换会话 '%v' 的结果", keySwitchSessionID)
+	}
+
+	key, err := j.KeyRotationService.DecryptResourceKeyWithKeySwitchSession(resourceID, keySwitchSessionID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "无法以密钥置换会话 '%v' 解密资源的密钥", keySwitchSessionID)
+	}
+
+	return key, nil
+}
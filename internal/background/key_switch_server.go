@@ -1,44 +1,62 @@
 package background
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"sync"
 	"time"
 
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/db"
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/global"
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/service"
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/utils/cipherutils"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/keyswitch"
 	"github.com/XiaoYao-austin/ppks"
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"github.com/tjfoc/gmsm/sm2"
 )
 
 type KeySwitchServer struct {
-	ServiceInfo            *service.Info
-	KeySwitchService       service.KeySwitchServiceInterface
-	wg                     sync.WaitGroup
-	chanQuit               chan int
-	chanKeySwitchSessionID chan string
-	NumWorkers             int // The number of Go routines that will be created to perform the task. Don't change the value after creation or the server might not be able to stop as expected.
-	reg                    *fab.Registration
-	serviceStatus          *backgroundServerStatus
+	ServiceInfo      *service.Info
+	KeySwitchService service.KeySwitchServiceInterface
+	NumWorkers       int // The number of Go routines that will be created to perform the task. It takes effect on the next start.
+	pool             *workerPool
+	wg               sync.WaitGroup
+	cancelForwarding context.CancelFunc
+	reg              *fab.Registration
+	serviceStatus    *backgroundServerStatus
+	checkpointMu     sync.Mutex
+	checkpoint       uint64                  // The checkpoint last persisted, from which a restarted server replays the blocks
+	checkpoints      *blockCheckpointTracker // Works out the checkpoint from the triggers in flight
+	lastSessionMu    sync.Mutex
+	lastSessionID    string // The ID of the latest key switch session processed, reported in the heartbeats
 }
 
+// shareDeliveryClient is the HTTP client used to deliver shares to the requesters.
+var shareDeliveryClient = &http.Client{Timeout: 10 * time.Second}
+
+// keySwitchTriggerEventID is the ID of the chaincode event emitted on the creation of a key switch trigger.
+const keySwitchTriggerEventID = "ks_trigger"
+
 func NewKeySwitchServer(serviceInfo *service.Info, keySwitchService service.KeySwitchServiceInterface, numWorkers int) *KeySwitchServer {
 	return &KeySwitchServer{
-		ServiceInfo:            serviceInfo,
-		KeySwitchService:       keySwitchService,
-		wg:                     sync.WaitGroup{},
-		chanQuit:               make(chan int),
-		chanKeySwitchSessionID: make(chan string),
-		NumWorkers:             numWorkers,
-		reg:                    nil,
-		serviceStatus:          newBackgroundServerStatus(),
+		ServiceInfo:      serviceInfo,
+		KeySwitchService: keySwitchService,
+		NumWorkers:       numWorkers,
+		wg:               sync.WaitGroup{},
+		reg:              nil,
+		serviceStatus:    newBackgroundServerStatus(),
 	}
 }
 
@@ -54,9 +72,10 @@ func (s *KeySwitchServer) Start() error {
 	}
 
 	s.serviceStatus.setIsStarting(true)
+	defer s.serviceStatus.setIsStarting(false)
 
-	// Register the event chaincode and pass the chan object to the workers to be created.
-	eventID := "ks_trigger"
+	// Register the chaincode event. The events are forwarded to the worker pool as tasks.
+	eventID := keySwitchTriggerEventID
 	log.Debugf("正在尝试监听事件 '%v'...", eventID)
 	reg, notifier, err := service.RegisterEvent(s.ServiceInfo.EventClient, s.ServiceInfo.ChaincodeID, eventID)
 	if err != nil {
@@ -66,138 +85,444 @@ func (s *KeySwitchServer) Start() error {
 
 	s.reg = &reg
 
-	// Start #NumWorkers Go routines with each running a worker.
-	log.Debugf("正在创建 %v 个密钥置换工作单元...", s.NumWorkers)
-	for id := 0; id < s.NumWorkers; id++ {
-		s.wg.Add(1)
-		go s.createKeySwitchServerWorker(id, notifier)
+	s.pool = newWorkerPool(workerPoolOptions{
+		name:       "密钥置换服务器",
+		numWorkers: s.NumWorkers,
+	})
+	s.checkpoints = newBlockCheckpointTracker(0)
+
+	// Replay the blocks committed while the server was down before handling live events. The live events are registered beforehand so that none is missed in between. Triggers seen in both are answered only once.
+	if err = s.catchUp(); err != nil {
+		log.Errorln(errors.Wrap(err, "密钥置换服务器无法补处理停机期间的触发器"))
 	}
 
-	s.serviceStatus.setIsStarting(false)
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancelForwarding = cancel
+	s.wg.Add(2)
+	go func() {
+		defer s.wg.Done()
+		forwardChaincodeEvents(ctx, notifier, s.submitKeySwitchTrigger)
+	}()
+	go func() {
+		defer s.wg.Done()
+		s.recordHeartbeats(ctx)
+	}()
+
 	s.serviceStatus.setIsStarted(true)
 	log.Infoln("密钥置换服务器已启动。")
 
 	return nil
 }
 
-func (s *KeySwitchServer) createKeySwitchServerWorker(id int, chanKeySwitchSessionIDNotifier <-chan *fab.CCEvent) {
-	log.Debugf("密钥置换工作单元 #%v 已创建。", id)
+// submitKeySwitchTrigger queues the processing of a key switch trigger event. The block of the event holds the checkpoint back until the trigger is answered, and for the rest of the run if it fails, so that a restarted server replays it.
+func (s *KeySwitchServer) submitKeySwitchTrigger(event *fab.CCEvent) {
+	// On receiving a key switch trigger, calculate the share and invoke the service function to save the result onto the chain
+	// First parse the event payload
+	var keySwitchTriggerStored keyswitch.KeySwitchTriggerStored
+	if err := json.Unmarshal(event.Payload, &keySwitchTriggerStored); err != nil {
+		log.Errorln(errors.Wrap(err, "密钥置换服务器无法解析事件内容"))
+		return
+	}
+
+	log.Debugf("密钥置换服务器收到触发器，会话 ID: %v。", keySwitchTriggerStored.KeySwitchSessionID)
+
+	taskName := fmt.Sprintf("会话 %v", keySwitchTriggerStored.KeySwitchSessionID)
+	s.checkpoints.begin(event.BlockNumber)
+	err := s.pool.submitWithCallback(taskName, func(ctx context.Context) error {
+		if err := s.processKeySwitchTrigger(ctx, &keySwitchTriggerStored); err != nil {
+			return err
+		}
+
+		s.setLastSessionID(keySwitchTriggerStored.KeySwitchSessionID)
+		return nil
+	}, func(err error) {
+		s.saveCheckpoint(s.checkpoints.finish(event.BlockNumber, err))
+	})
+	if err != nil {
+		s.saveCheckpoint(s.checkpoints.finish(event.BlockNumber, err))
+		log.Errorln(errors.Wrapf(err, "密钥置换服务器无法处理触发器。会话 ID: %v", keySwitchTriggerStored.KeySwitchSessionID))
+	}
+}
+
+// recordHeartbeats records a heartbeat on the chain right away and then every `service.KeySwitchServerHeartbeatInterval` until `ctx` is done, so that clients can tell whether the server is alive.
+func (s *KeySwitchServer) recordHeartbeats(ctx context.Context) {
+	ticker := time.NewTicker(service.KeySwitchServerHeartbeatInterval)
+	defer ticker.Stop()
 
-workerLoop:
 	for {
+		s.recordHeartbeat()
+
 		select {
-		case event := <-chanKeySwitchSessionIDNotifier:
-			// On receiving a key switch session ID, calculate the share and invoke the service function to save the result onto the chain
-			// First parse the event payload
-			var keySwitchTriggerStored keyswitch.KeySwitchTriggerStored
-			if err := json.Unmarshal(event.Payload, &keySwitchTriggerStored); err != nil {
-				log.Errorln(errors.Wrapf(err, "密钥置换工作单元 #%v 无法解析事件内容", id))
-				continue
-			}
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
 
-			log.Debugf("密钥置换工作单元 #%v 收到触发器，会话 ID: %v。\n", id, keySwitchTriggerStored.KeySwitchSessionID)
+// recordHeartbeat records a heartbeat on the chain and logs the metrics of the worker pool. A missed heartbeat is only logged as the next one follows shortly.
+func (s *KeySwitchServer) recordHeartbeat() {
+	s.lastSessionMu.Lock()
+	lastSessionID := s.lastSessionID
+	s.lastSessionMu.Unlock()
 
-			// Check if the validation result is true. Ignore the trigger if it's false.
-			if !keySwitchTriggerStored.ValidationResult {
-				log.Debugf("密钥置换工作单元 #%v: 未通过验证，将忽略该会话。会话 ID: %v。", id, keySwitchTriggerStored.KeySwitchSessionID)
-				continue
-			}
+	if _, err := s.KeySwitchService.RecordKeySwitchServerHeartbeat(global.Version, lastSessionID, s.pool.opts.numWorkers); err != nil {
+		log.Warnln(errors.Wrap(err, "密钥置换服务器无法记录心跳"))
+	}
 
-			// Parse the target public key
-			targetPubKeyBytes, err := base64.StdEncoding.DecodeString(keySwitchTriggerStored.KeySwitchPK)
-			if err != nil {
-				log.Errorln(errors.Wrapf(err, "密钥置换工作单元 #%v 无法解析目标密钥。会话 ID: %v", id, keySwitchTriggerStored.KeySwitchSessionID))
-				continue
-			}
+	stats := s.pool.stats()
+	log.Infof("密钥置换服务器运行中。排队 %v 个，成功 %v 个，失败 %v 个，重试 %v 次，放弃 %v 个。", stats.QueueDepth, stats.NumSucceeded, stats.NumFailed, stats.NumRetries, stats.NumDiscarded)
+}
 
-			targetPubKey, err := cipherutils.DeserializeSM2PublicKey(targetPubKeyBytes)
-			if err != nil {
-				log.Errorln(errors.Wrapf(err, "密钥置换工作单元 #%v 无法解析目标密钥。会话 ID: %v", id, keySwitchTriggerStored.KeySwitchSessionID))
-				continue
-			}
+func (s *KeySwitchServer) setLastSessionID(keySwitchSessionID string) {
+	s.lastSessionMu.Lock()
+	defer s.lastSessionMu.Unlock()
 
-			// Invoke the chaincode function to retrieve the encrypted symmetric key
-			encryptedKeyBytes, err := s.getResourceKeyFromCC(keySwitchTriggerStored.ResourceID)
-			if err != nil {
-				log.Errorln(errors.Wrapf(err, "密钥置换工作单元 #%v 无法获取资源 '%v' 的加密密钥。会话 ID: %v", id, keySwitchTriggerStored.ResourceID, keySwitchTriggerStored.KeySwitchSessionID))
-				continue
-			}
+	s.lastSessionID = keySwitchSessionID
+}
 
-			curvePoints, err := cipherutils.DeserializeCipherText(encryptedKeyBytes)
-			if err != nil {
-				log.Errorln(errors.Wrapf(err, "密钥置换工作单元 #%v 无法获取资源 '%v' 的加密密钥。会话 ID: %v", id, keySwitchTriggerStored.ResourceID, keySwitchTriggerStored.KeySwitchSessionID))
-				continue
-			}
+// IsStarted tells whether the key switch server is running.
+func (s *KeySwitchServer) IsStarted() bool {
+	return s.serviceStatus.getIsStarted()
+}
 
-			// Do share calculation
-			timeBeforeShareCalc := time.Now()
-			share, zkpRi, err := ppks.ShareCal(targetPubKey, &curvePoints.K, global.KeySwitchKeys.PrivateKey) // `zkpRi` for calculating zkp
-			if err != nil {
-				log.Errorln(errors.Wrapf(err, "密钥置换工作单元 #%v 无法获取用户的密钥置换密钥。会话 ID: %v", id, keySwitchTriggerStored.KeySwitchSessionID))
+// Stats returns the metrics of the worker pool of the server.
+func (s *KeySwitchServer) Stats() WorkerPoolStats {
+	if s.pool == nil {
+		return WorkerPoolStats{}
+	}
+
+	return s.pool.stats()
+}
+
+// processKeySwitchTrigger calculates the shares for a key switch trigger along with their ZKPs and saves the result onto the chain. Failures in talking to the chain are retried by the worker pool.
+func (s *KeySwitchServer) processKeySwitchTrigger(ctx context.Context, trigger *keyswitch.KeySwitchTriggerStored) error {
+	// Check if the validation result is true. Ignore the trigger if it's false.
+	if !trigger.ValidationResult {
+		log.Debugf("密钥置换服务器: 未通过验证，将忽略该会话。会话 ID: %v。", trigger.KeySwitchSessionID)
+		return nil
+	}
+
+	// Parse the target public key
+	targetPubKeyBytes, err := base64.StdEncoding.DecodeString(trigger.KeySwitchPK)
+	if err != nil {
+		return newPermanentError(errors.Wrap(err, "无法解析目标密钥"))
+	}
+
+	targetPubKey, err := cipherutils.DeserializeSM2PublicKey(targetPubKeyBytes)
+	if err != nil {
+		return newPermanentError(errors.Wrap(err, "无法解析目标密钥"))
+	}
+
+	// Calculate a share along with its ZKP for each resource in the session
+	resourceIDs := trigger.GetResourceIDs()
+	shares := make([]*ppks.CipherText, len(resourceIDs))
+	proofs := make([]*cipherutils.ZKProof, len(resourceIDs))
+	for i, resourceID := range resourceIDs {
+		shares[i], proofs[i], err = s.calculateShare(trigger.KeySwitchSessionID, resourceID, targetPubKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Give up before uploading if the server is being stopped
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	// Invoke the service function to save the result onto the chain. The shares of a multi-resource session go in one transaction.
+	// If the session asks for off-chain delivery, the shares are sent to the requester directly and only their commitments go onto the chain.
+	timeBeforeUploading := time.Now()
+	var txID string
+	if trigger.ShareDeliveryURL != "" {
+		txID, err = s.deliverShares(ctx, trigger, shares, proofs)
+	} else if len(trigger.ResourceIDs) != 0 {
+		txID, err = s.KeySwitchService.CreateKeySwitchResultForResources(trigger.KeySwitchSessionID, resourceIDs, shares, proofs)
+	} else {
+		txID, err = s.KeySwitchService.CreateKeySwitchResult(trigger.KeySwitchSessionID, shares[0], proofs[0])
+	}
+	if err != nil {
+		return errors.Wrap(err, "无法将份额结果上链")
+	}
+	timeAfterUploading := time.Now()
+	timeDiffUploading := timeAfterUploading.Sub(timeBeforeUploading)
+	log.Debugf("密钥置换服务器完成份额结果上链，耗时 %v。会话 ID: %v。交易 ID: %v。", timeDiffUploading, trigger.KeySwitchSessionID, txID)
+
+	return nil
+}
+
+// deliverShares sends the shares of a key switch session to the requester at the share delivery URL of the trigger, signed with the key switch private key of this server, and then saves their commitments onto the chain. A failed delivery is retried by the worker pool.
+func (s *KeySwitchServer) deliverShares(ctx context.Context, trigger *keyswitch.KeySwitchTriggerStored, shares []*ppks.CipherText, proofs []*cipherutils.ZKProof) (string, error) {
+	// Only deliver to the URL that the requester registered along with the key switch public key, so that the server can't be pointed at an arbitrary address
+	registrations, err := s.KeySwitchService.ListKeySwitchPKs(trigger.Creator)
+	if err != nil {
+		return "", errors.Wrap(err, "无法获取访问申请者登记的密钥置换公钥")
+	}
+	isShareDeliveryURLRegistered := false
+	for _, registration := range registrations {
+		if registration.KeySwitchPK == trigger.KeySwitchPK && registration.ShareDeliveryURL == trigger.ShareDeliveryURL {
+			isShareDeliveryURLRegistered = true
+			break
+		}
+	}
+	if !isShareDeliveryURLRegistered {
+		return "", newPermanentError(fmt.Errorf("链下交付份额的地址 '%v' 不是访问申请者登记的地址", trigger.ShareDeliveryURL))
+	}
+
+	delivery := keyswitch.KeySwitchShareDelivery{
+		KeySwitchSessionID: trigger.KeySwitchSessionID,
+		KeySwitchPK:        base64.StdEncoding.EncodeToString(cipherutils.SerializeSM2PublicKey(global.KeySwitchKeys.PublicKey)),
+	}
+
+	var commitments []string
+	for i, resourceID := range trigger.GetResourceIDs() {
+		resourceShare := keyswitch.KeySwitchShare{
+			ResourceID: resourceID,
+			Share:      base64.StdEncoding.EncodeToString(cipherutils.SerializeCipherText(shares[i])),
+			ZKProof:    base64.StdEncoding.EncodeToString(cipherutils.SerializeZKProof(proofs[i])),
+		}
+
+		commitment, err := keyswitch.GetKeySwitchShareCommitment(resourceShare.Share, resourceShare.ZKProof)
+		if err != nil {
+			return "", newPermanentError(err)
+		}
+
+		delivery.Shares = append(delivery.Shares, resourceShare)
+		commitments = append(commitments, commitment)
+	}
+
+	message, err := keyswitch.GetKeySwitchShareDeliveryMessage(&delivery)
+	if err != nil {
+		return "", newPermanentError(err)
+	}
+
+	signature, err := global.KeySwitchKeys.PrivateKey.Sign(rand.Reader, message, nil)
+	if err != nil {
+		return "", newPermanentError(errors.Wrap(err, "无法为交付的份额签名"))
+	}
+	delivery.Signature = base64.StdEncoding.EncodeToString(signature)
+
+	deliveryBytes, err := json.Marshal(delivery)
+	if err != nil {
+		return "", newPermanentError(errors.Wrap(err, "无法序列化交付的份额"))
+	}
+
+	// The shares must reach the requester before the commitments, which the requester waits for, are saved onto the chain
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, trigger.ShareDeliveryURL, bytes.NewReader(deliveryBytes))
+	if err != nil {
+		return "", newPermanentError(errors.Wrap(err, "无法创建交付份额的请求"))
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := shareDeliveryClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "无法交付份额")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("无法交付份额，访问申请者返回 %v: %s", resp.StatusCode, respBody)
+	}
+
+	var resourceIDs []string
+	if len(trigger.ResourceIDs) != 0 {
+		resourceIDs = trigger.ResourceIDs
+	}
+
+	return s.KeySwitchService.CreateKeySwitchResultWithCommitments(trigger.KeySwitchSessionID, resourceIDs, commitments)
+}
+
+// calculateShare calculates the share of a resource in a key switch session along with its ZKP.
+func (s *KeySwitchServer) calculateShare(keySwitchSessionID string, resourceID string, targetPubKey *sm2.PublicKey) (*ppks.CipherText, *cipherutils.ZKProof, error) {
+	// Invoke the chaincode function to retrieve the encrypted symmetric key
+	encryptedKeyBytes, err := s.getResourceKeyFromCC(resourceID)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "无法获取资源 '%v' 的加密密钥", resourceID)
+	}
+
+	curvePoints, err := cipherutils.DeserializeCipherText(encryptedKeyBytes)
+	if err != nil {
+		return nil, nil, newPermanentError(errors.Wrapf(err, "无法获取资源 '%v' 的加密密钥", resourceID))
+	}
+
+	// Do share calculation
+	timeBeforeShareCalc := time.Now()
+	share, zkpRi, err := ppks.ShareCal(targetPubKey, &curvePoints.K, global.KeySwitchKeys.PrivateKey) // `zkpRi` for calculating zkp
+	if err != nil {
+		return nil, nil, newPermanentError(errors.Wrap(err, "无法获取用户的密钥置换密钥"))
+	}
+	timeAfterShareCalc := time.Now()
+	timeDiffShareCalc := timeAfterShareCalc.Sub(timeBeforeShareCalc)
+	log.Debugf("密钥置换服务器完成份额计算，耗时 %v。会话 ID: %v。资源 ID: %v。", timeDiffShareCalc, keySwitchSessionID, resourceID)
+
+	// Generate a ZKP for the share
+	timeBeforeProofGen := time.Now()
+	proof := &cipherutils.ZKProof{}
+	proof.C, proof.R1, proof.R2, err = ppks.ShareProofGenNoB(zkpRi, global.KeySwitchKeys.PrivateKey, share, targetPubKey, &curvePoints.K)
+	timeAfterProofGen := time.Now()
+	if err != nil {
+		return nil, nil, newPermanentError(errors.Wrap(err, "无法为份额生成零知识证明"))
+	}
+	timeDiffProofGen := timeAfterProofGen.Sub(timeBeforeProofGen)
+	log.Debugf("密钥置换服务器完成为份额生成零知识证明，耗时 %v。会话 ID: %v。资源 ID: %v。", timeDiffProofGen, keySwitchSessionID, resourceID)
+
+	return share, proof, nil
+}
+
+// catchUp replays the blocks since the persisted checkpoint through the ledger client and queues the key switch triggers in them that this server has not answered. The queue is FIFO, so they are picked up before the live events. On the first start there's no checkpoint and no block is replayed.
+func (s *KeySwitchServer) catchUp() error {
+	if s.ServiceInfo.DB == nil || s.ServiceInfo.LedgerClient == nil {
+		log.Warnln("未配置数据库或账本客户端，密钥置换服务器将不会补处理停机期间的触发器。")
+		return nil
+	}
+
+	bcInfo, err := s.ServiceInfo.LedgerClient.QueryInfo()
+	if err != nil {
+		return errors.Wrap(err, "无法获取账本信息")
+	}
+	height := bcInfo.BCI.Height
+
+	checkpoint, err := db.GetBackgroundServerCheckpointFromLocalDB(s.getCheckpointName(), s.ServiceInfo.DB)
+	if errors.Cause(err) == errorcode.ErrorNotFound {
+		log.Infof("密钥置换服务器首次启动，将从区块 %v 起处理触发器。", height-1)
+		s.saveCheckpoint(s.checkpoints.observe(height - 1))
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	s.checkpointMu.Lock()
+	s.checkpoint = checkpoint
+	s.checkpointMu.Unlock()
+	s.checkpoints = newBlockCheckpointTracker(checkpoint)
+
+	// The server's identity is needed to tell whether it has answered a session
+	serverPublicKey, err := s.getRegisteredServerPublicKey()
+	if err != nil {
+		return err
+	}
+
+	// The checkpoint block itself is replayed as the server might have stopped halfway through it
+	log.Infof("密钥置换服务器正在补处理区块 %v 至 %v 中的触发器...", checkpoint, height-1)
+	numSubmitted := 0
+	for blockNumber := checkpoint; blockNumber < height; blockNumber++ {
+		block, err := s.ServiceInfo.LedgerClient.QueryBlock(blockNumber)
+		if err != nil {
+			return errors.Wrapf(err, "无法获取区块 %v", blockNumber)
+		}
+
+		ccEvents, err := extractChaincodeEventsFromBlock(block)
+		if err != nil {
+			return err
+		}
+
+		for _, ccEvent := range ccEvents {
+			if ccEvent.ChaincodeID != s.ServiceInfo.ChaincodeID || ccEvent.EventName != keySwitchTriggerEventID {
 				continue
 			}
-			timeAfterShareCalc := time.Now()
-			timeDiffShareCalc := timeAfterShareCalc.Sub(timeBeforeShareCalc)
-			log.Debugf("密钥置换工作单元 #%v 完成份额计算，耗时 %v。会话 ID: %v。", id, timeDiffShareCalc, keySwitchTriggerStored.KeySwitchSessionID)
-
-			// Generate a ZKP for the share
-			timeBeforeProofGen := time.Now()
-			proof := &cipherutils.ZKProof{}
-			proof.C, proof.R1, proof.R2, err = ppks.ShareProofGenNoB(zkpRi, global.KeySwitchKeys.PrivateKey, share, targetPubKey, &curvePoints.K)
-			timeAfterProofGen := time.Now()
-			if err != nil {
-				log.Errorln(errors.Wrapf(err, "密钥置换工作单元 #%v 无法为份额生成零知识证明。会话 ID: %v", id, keySwitchTriggerStored.KeySwitchSessionID))
+
+			var keySwitchTriggerStored keyswitch.KeySwitchTriggerStored
+			if err := json.Unmarshal(ccEvent.Payload, &keySwitchTriggerStored); err != nil {
+				log.Errorln(errors.Wrapf(err, "无法解析区块 %v 中的触发器", blockNumber))
 				continue
 			}
-			timeDiffProofGen := timeAfterProofGen.Sub(timeBeforeProofGen)
-			log.Debugf("密钥置换工作单元 #%v 完成为份额生成零知识证明，耗时 %v。会话 ID: %v", id, timeDiffProofGen, keySwitchTriggerStored.KeySwitchSessionID)
-
-			// Invoke the service function to save the result onto the chain
-			timeBeforeUploading := time.Now()
-			txID, err := s.KeySwitchService.CreateKeySwitchResult(keySwitchTriggerStored.KeySwitchSessionID, share, proof)
-			if err != nil {
-				log.Errorln(errors.Wrapf(err, "密钥置换工作单元 #%v 无法将份额结果上链。会话 ID: %v", id, keySwitchTriggerStored.KeySwitchSessionID))
+
+			if s.isKeySwitchTriggerAnswered(&keySwitchTriggerStored, serverPublicKey) {
 				continue
 			}
-			timeAfterUploading := time.Now()
-			timeDiffUploading := timeAfterUploading.Sub(timeBeforeUploading)
-			log.Debugf("密钥置换工作单元 #%v 完成份额结果上链，耗时 %v。会话 ID: %v。交易 ID: %v。", id, timeDiffUploading, keySwitchTriggerStored.KeySwitchSessionID, txID)
-		case <-s.chanQuit:
-			// Break the for loop when receiving a quit signal
-			log.Debugf("密钥置换工作单元 #%v 收到退出信号。", id)
-			s.wg.Done()
-			break workerLoop
-		default:
-			time.Sleep(50 * time.Millisecond)
+
+			log.Debugf("密钥置换服务器补处理触发器，会话 ID: %v。", keySwitchTriggerStored.KeySwitchSessionID)
+			s.submitKeySwitchTrigger(ccEvent)
+			numSubmitted++
+		}
+	}
+
+	// The checkpoint moves past the replayed blocks only once all the submitted triggers in them are answered
+	s.saveCheckpoint(s.checkpoints.observe(height - 1))
+
+	log.Infof("密钥置换服务器已提交 %v 个需补处理的触发器。", numSubmitted)
+
+	return nil
+}
+
+// isKeySwitchTriggerAnswered checks whether a replayed trigger needs no more processing, i.e. its session has expired or this server has already submitted a result for it.
+func (s *KeySwitchServer) isKeySwitchTriggerAnswered(trigger *keyswitch.KeySwitchTriggerStored, serverPublicKey string) bool {
+	if !trigger.ExpiresAt.IsZero() && time.Now().After(trigger.ExpiresAt) {
+		return true
+	}
+
+	_, err := s.KeySwitchService.GetKeySwitchResult(trigger.KeySwitchSessionID, serverPublicKey)
+	if err == nil {
+		return true
+	} else if errors.Cause(err) != errorcode.ErrorNotFound {
+		// The chaincode rejects a second result anyway, so the trigger is processed when in doubt
+		log.Warnln(errors.Wrapf(err, "无法确定是否已应答会话 '%v'", trigger.KeySwitchSessionID))
+	}
+
+	return false
+}
+
+// getRegisteredServerPublicKey finds the identity public key under which this server is registered on the chain by its key switch public key.
+func (s *KeySwitchServer) getRegisteredServerPublicKey() (string, error) {
+	ksServers, err := s.KeySwitchService.ListKeySwitchServers()
+	if err != nil {
+		return "", err
+	}
+
+	keySwitchPK := base64.StdEncoding.EncodeToString(cipherutils.SerializeSM2PublicKey(global.KeySwitchKeys.PublicKey))
+	for _, ksServer := range ksServers {
+		if ksServer.KeySwitchPK == keySwitchPK {
+			return ksServer.PublicKey, nil
 		}
 	}
+
+	return "", fmt.Errorf("本服务器的密钥置换公钥未在链上登记")
 }
 
-// Stop stops the key switch server from responding to key switch triggers.
-//
-// Returns
-//   a wait group that can be used to block the caller Go routine
-func (s *KeySwitchServer) Stop() (*sync.WaitGroup, error) {
-	// Don't send stop signals again if the server has already been called to stop.
+// saveCheckpoint persists the checkpoint worked out by the tracker if it has changed. Failing to persist it only causes more blocks to be replayed next time, so the error is logged only.
+func (s *KeySwitchServer) saveCheckpoint(blockNumber uint64) {
+	s.checkpointMu.Lock()
+	defer s.checkpointMu.Unlock()
+
+	if blockNumber == s.checkpoint || s.ServiceInfo.DB == nil {
+		return
+	}
+
+	s.checkpoint = blockNumber
+	if err := db.SaveBackgroundServerCheckpointToLocalDB(s.getCheckpointName(), blockNumber, s.ServiceInfo.DB); err != nil {
+		log.Errorln(errors.Wrap(err, "密钥置换服务器无法保存检查点"))
+	}
+}
+
+func (s *KeySwitchServer) getCheckpointName() string {
+	return "keySwitchServer_" + s.ServiceInfo.ChaincodeID
+}
+
+// Stop stops the key switch server from responding to key switch triggers. The queued triggers are still processed until `ctx` is done, after which the remaining ones are abandoned.
+func (s *KeySwitchServer) Stop(ctx context.Context) error {
+	// Don't stop the server again if the server has already been called to stop.
 	if s.serviceStatus.getIsStopping() {
-		return nil, fmt.Errorf("密钥置换服务器正在停止")
+		return fmt.Errorf("密钥置换服务器正在停止")
 	} else if !s.serviceStatus.getIsStarted() {
-		return nil, fmt.Errorf("密钥置换服务器已停止")
+		return fmt.Errorf("密钥置换服务器已停止")
 	}
 
 	s.serviceStatus.setIsStopping(true)
+	defer s.serviceStatus.setIsStopping(false)
 
-	// Start sending stop signals to all the workers
-	for id := 0; id < s.NumWorkers; id++ {
-		s.chanQuit <- 0
-	}
-
-	// Unregister the chaincode event
+	// Stop receiving events. Stopping the pool also unblocks the forwarder if it's waiting on a full queue.
 	s.ServiceInfo.ChannelClient.UnregisterChaincodeEvent(*s.reg)
+	s.cancelForwarding()
+	err := s.pool.stop(ctx)
+	s.wg.Wait()
+
+	stats := s.pool.stats()
+	log.Infof("密钥置换服务器已停止。成功 %v 个，失败 %v 个，重试 %v 次，放弃 %v 个。", stats.NumSucceeded, stats.NumFailed, stats.NumRetries, stats.NumDiscarded)
 
 	s.serviceStatus.setIsStarted(false)
 
-	return &s.wg, nil
+	return err
 }
 
 func (s *KeySwitchServer) getResourceKeyFromCC(resourceID string) ([]byte, error) {
@@ -0,0 +1,381 @@
+package background
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/db"
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/global"
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/service"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/data"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/query"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// The number of resource IDs fetched from the chain at a time
+const regulatorBackfillPageSize = 50
+
+// The name under which the backfill job saves its checkpoint in the local database
+const regulatorBackfillCheckpointName = "regulator_backfill"
+
+// RegulatorBackfillProgress reports the state of a backfill job.
+type RegulatorBackfillProgress struct {
+	IsRunning      bool              `json:"isRunning"`            // Whether the job is still running
+	StartAfterID   string            `json:"startAfterID"`         // The checkpoint the run started after. Empty if it started from the first resource.
+	LastResourceID string            `json:"lastResourceID"`       // The checkpoint saved so far. All resources up to it have been processed.
+	NumBackfilled  int               `json:"numBackfilled"`        // The number of resources decrypted and saved into the local database
+	NumSkipped     int               `json:"numSkipped"`           // The number of resources already present in the local database
+	Failures       map[string]string `json:"failures"`             // The errors of the resources that could not be processed, keyed by resource ID
+	Error          string            `json:"error,omitempty"`      // The error that aborted the job, if any
+	StartedAt      time.Time         `json:"startedAt"`            // When the job was started
+	FinishedAt     time.Time         `json:"finishedAt,omitempty"` // When the job finished
+}
+
+// RegulatorBackfillJob decrypts the encrypted and offchain resources that the regulator server has missed, e.g. those created before it was enabled or while it was down, and saves them into the local database. Resources already in the local database are skipped. The job saves a checkpoint after each page, so that the next run resumes after it. Once a resource fails, the checkpoint stays right before it and the next run goes through it again.
+type RegulatorBackfillJob struct {
+	ServiceInfo     *service.Info
+	RegulatorServer *RegulatorServer
+	NumWorkers      int // The number of Go routines that will be created to perform the job. It takes effect on the next start.
+	mu              sync.Mutex
+	progress        RegulatorBackfillProgress
+	cancel          context.CancelFunc
+	chanDone        chan struct{}
+
+	// The steps that talk to the chain and the local database. They're replaced in tests.
+	listResourceIDsFunc   func(lastResourceID string) ([]string, error)
+	isResourcePresentFunc func(resourceID string) (bool, error)
+	processResourceFunc   func(ctx context.Context, resourceID string) error
+	loadCheckpointFunc    func() (string, error)
+	saveCheckpointFunc    func(lastResourceID string) error
+}
+
+func NewRegulatorBackfillJob(serviceInfo *service.Info, regulatorServer *RegulatorServer, numWorkers int) *RegulatorBackfillJob {
+	j := &RegulatorBackfillJob{
+		ServiceInfo:     serviceInfo,
+		RegulatorServer: regulatorServer,
+		NumWorkers:      numWorkers,
+	}
+
+	j.listResourceIDsFunc = j.listEncryptedResourceIDs
+	j.isResourcePresentFunc = j.isResourceInLocalDB
+	j.processResourceFunc = regulatorServer.processEncryptedResourceCreation
+	j.loadCheckpointFunc = func() (string, error) {
+		return db.GetBackfillCheckpointFromLocalDB(regulatorBackfillCheckpointName, j.ServiceInfo.DB)
+	}
+	j.saveCheckpointFunc = func(lastResourceID string) error {
+		return db.SaveBackfillCheckpointToLocalDB(regulatorBackfillCheckpointName, lastResourceID, j.ServiceInfo.DB)
+	}
+
+	return j
+}
+
+// Start starts the backfill in the background, resuming after the saved checkpoint if there is one. The collective private key must have been loaded.
+func (j *RegulatorBackfillJob) Start() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.progress.IsRunning {
+		return fmt.Errorf("监管者补处理任务正在运行")
+	}
+
+	if global.KeySwitchKeys.CollectivePrivateKey == nil {
+		return fmt.Errorf("未指定集合私钥，无法解密资源")
+	}
+
+	// Resume after the checkpoint of the previous runs
+	startAfterID, err := j.loadCheckpointFunc()
+	if err != nil && errors.Cause(err) != errorcode.ErrorNotFound {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j.cancel = cancel
+	j.chanDone = make(chan struct{})
+	j.progress = RegulatorBackfillProgress{
+		IsRunning:      true,
+		StartAfterID:   startAfterID,
+		LastResourceID: startAfterID,
+		Failures:       map[string]string{},
+		StartedAt:      time.Now(),
+	}
+
+	if startAfterID == "" {
+		log.Infoln("正在为监管者补处理加密资源...")
+	} else {
+		log.Infof("正在为监管者补处理加密资源，从资源 %v 之后继续...", startAfterID)
+	}
+	go j.run(ctx, startAfterID)
+
+	return nil
+}
+
+// Progress returns a snapshot of the progress of the latest run.
+func (j *RegulatorBackfillJob) Progress() RegulatorBackfillProgress {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	ret := j.progress
+	ret.Failures = map[string]string{}
+	for resourceID, errMsg := range j.progress.Failures {
+		ret.Failures[resourceID] = errMsg
+	}
+
+	return ret
+}
+
+// Done returns a channel that is closed when the latest run ends. It returns nil if the job has never been started.
+func (j *RegulatorBackfillJob) Done() <-chan struct{} {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.chanDone
+}
+
+// Stop cancels the running job and waits for it to end until `ctx` is done. The resources not yet processed are left for the next run.
+func (j *RegulatorBackfillJob) Stop(ctx context.Context) error {
+	j.mu.Lock()
+	if !j.progress.IsRunning {
+		j.mu.Unlock()
+		return nil
+	}
+	cancel, chanDone := j.cancel, j.chanDone
+	j.mu.Unlock()
+
+	cancel()
+	select {
+	case <-chanDone:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "无法在时限内停止监管者补处理任务")
+	}
+}
+
+// run walks through the encrypted and offchain resources page by page. Each page is processed by a worker pool of its own so that the checkpoint is saved only after all resources of the page have been processed.
+func (j *RegulatorBackfillJob) run(ctx context.Context, startAfterID string) {
+	defer close(j.chanDone)
+
+	var runErr error
+	lastResourceID := startAfterID
+	isCheckpointAdvancing := true
+	for ctx.Err() == nil {
+		resourceIDs, err := j.listResourceIDsFunc(lastResourceID)
+		if err != nil {
+			runErr = errors.Wrap(err, "无法列出加密资源")
+			break
+		}
+
+		if len(resourceIDs) == 0 {
+			break
+		}
+
+		idxFirstFailure, err := j.processPage(ctx, resourceIDs)
+		if err != nil {
+			runErr = err
+			break
+		}
+
+		// Keep the checkpoint right before the first failed resource so that the next run tries it again. The later pages are still processed but the checkpoint no longer moves.
+		if isCheckpointAdvancing {
+			checkpoint := resourceIDs[len(resourceIDs)-1]
+			if idxFirstFailure >= 0 {
+				isCheckpointAdvancing = false
+				if idxFirstFailure > 0 {
+					checkpoint = resourceIDs[idxFirstFailure-1]
+				} else {
+					checkpoint = ""
+				}
+			}
+
+			if checkpoint != "" {
+				if err = j.saveCheckpointFunc(checkpoint); err != nil {
+					runErr = err
+					break
+				}
+
+				j.mu.Lock()
+				j.progress.LastResourceID = checkpoint
+				j.mu.Unlock()
+			}
+		}
+
+		lastResourceID = resourceIDs[len(resourceIDs)-1]
+
+		if len(resourceIDs) < regulatorBackfillPageSize {
+			break
+		}
+	}
+
+	if err := ctx.Err(); err != nil && runErr == nil {
+		runErr = errors.Wrap(err, "监管者补处理任务已取消")
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.progress.IsRunning = false
+	j.progress.FinishedAt = time.Now()
+	if runErr != nil {
+		j.progress.Error = runErr.Error()
+		log.Errorln(runErr)
+	}
+
+	log.Infof("监管者补处理任务已结束。补处理 %v 个，跳过 %v 个，失败 %v 个。", j.progress.NumBackfilled, j.progress.NumSkipped, len(j.progress.Failures))
+}
+
+// processPage processes the resources of a page and waits for all of them to end. It returns the index of the first resource that failed, or -1 if none failed.
+func (j *RegulatorBackfillJob) processPage(ctx context.Context, resourceIDs []string) (int, error) {
+	pool := newWorkerPool(workerPoolOptions{
+		name:       "监管者补处理任务",
+		numWorkers: j.NumWorkers,
+	})
+
+	var submitErr error
+	for _, resourceID := range resourceIDs {
+		resourceID := resourceID
+		err := pool.submit(fmt.Sprintf("资源 %v", resourceID), func(taskCtx context.Context) error {
+			err := j.backfillResource(taskCtx, resourceID)
+			j.recordResult(resourceID, err)
+			return err
+		})
+		if err != nil {
+			submitErr = err
+			break
+		}
+	}
+
+	// Let the queued tasks finish unless the job is cancelled
+	if err := pool.stop(ctx); err != nil && submitErr == nil {
+		submitErr = err
+	}
+	if submitErr != nil {
+		return -1, submitErr
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for i, resourceID := range resourceIDs {
+		if _, ok := j.progress.Failures[resourceID]; ok {
+			return i, nil
+		}
+	}
+
+	return -1, nil
+}
+
+// recordResult records the outcome of an attempt on a resource. Only the latest error of a resource is kept, and it's cleared once a retry succeeds.
+func (j *RegulatorBackfillJob) recordResult(resourceID string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err != nil {
+		j.progress.Failures[resourceID] = err.Error()
+	} else {
+		delete(j.progress.Failures, resourceID)
+	}
+}
+
+// backfillResource decrypts a resource and saves it into the local database the same way the regulator server does on a creation event. Resources already in the local database are skipped.
+func (j *RegulatorBackfillJob) backfillResource(ctx context.Context, resourceID string) error {
+	isPresent, err := j.isResourcePresentFunc(resourceID)
+	if err != nil {
+		return err
+	}
+
+	if isPresent {
+		j.mu.Lock()
+		j.progress.NumSkipped++
+		j.mu.Unlock()
+		return nil
+	}
+
+	if err = j.processResourceFunc(ctx, resourceID); err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	j.progress.NumBackfilled++
+	j.mu.Unlock()
+	log.Debugf("监管者已补处理资源。资源 ID: %v。", resourceID)
+
+	return nil
+}
+
+// isResourceInLocalDB checks whether a resource has been saved into `document_properties` or `entity_assets`.
+func (j *RegulatorBackfillJob) isResourceInLocalDB(resourceID string) (bool, error) {
+	_, err := db.GetDecryptedDocumentPropertiesFromLocalDB(resourceID, j.ServiceInfo.DB)
+	if err == nil {
+		return true, nil
+	} else if errors.Cause(err) != errorcode.ErrorNotFound {
+		return false, err
+	}
+
+	_, err = db.GetDecryptedEntityAssetFromLocalDB(resourceID, j.ServiceInfo.DB)
+	if err == nil {
+		return true, nil
+	} else if errors.Cause(err) != errorcode.ErrorNotFound {
+		return false, err
+	}
+
+	return false, nil
+}
+
+// listEncryptedResourceIDs fetches the IDs of the next page of encrypted and offchain resources after `lastResourceID` in ascending order. All resources are included if `lastResourceID` is empty.
+func (j *RegulatorBackfillJob) listEncryptedResourceIDs(lastResourceID string) ([]string, error) {
+	couchDBConditionsBytes, err := json.Marshal(getRegulatorBackfillCouchDBConditions(lastResourceID))
+	if err != nil {
+		return nil, errors.Wrap(err, "无法序列化查询条件")
+	}
+
+	chaincodeFcn := "listResourceIDsByConditions"
+	channelReq := channel.Request{
+		ChaincodeID: j.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		// The pages are delimited by the resource ID in the conditions, so the bookmark is left empty.
+		Args: [][]byte{couchDBConditionsBytes, []byte(strconv.Itoa(regulatorBackfillPageSize)), {}},
+	}
+
+	resp, err := j.ServiceInfo.ChannelClient.Query(channelReq)
+	err = service.GetClassifiedError(chaincodeFcn, err)
+	if err != nil {
+		return nil, err
+	}
+
+	var resourceIDs query.IDsWithPagination
+	if err = json.Unmarshal(resp.Payload, &resourceIDs); err != nil {
+		return nil, errors.Wrap(err, "无法解析结果列表")
+	}
+
+	return resourceIDs.IDs, nil
+}
+
+// getRegulatorBackfillCouchDBConditions generates the CouchDB query conditions that select the encrypted and offchain resources after `lastResourceID` in ascending order of resource ID.
+func getRegulatorBackfillCouchDBConditions(lastResourceID string) map[string]interface{} {
+	selector := map[string]interface{}{
+		"resourceType": map[string]interface{}{
+			"$in": []data.ResourceType{data.Encrypted, data.Offchain},
+		},
+	}
+
+	if lastResourceID != "" {
+		selector["resourceID"] = map[string]interface{}{
+			"$gt": lastResourceID,
+		}
+	}
+
+	return map[string]interface{}{
+		"selector": selector,
+		"sort": []interface{}{
+			map[string]string{
+				"resourceID": "asc",
+			},
+		},
+	}
+}
@@ -0,0 +1,249 @@
+package background
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/global"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"github.com/stretchr/testify/assert"
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+// 模拟的链与本地数据库。资源 ID 按升序分页列出，处理成功的资源被存入本地数据库。
+type fakeRegulatorBackfillStore struct {
+	mu           sync.Mutex
+	resourceIDs  []string
+	present      map[string]bool // 已存在于本地数据库的资源
+	failing      map[string]bool // 处理时失败的资源
+	processedIDs []string        // 实际被解密处理的资源
+	checkpoint   string
+}
+
+func newFakeRegulatorBackfillStore(numResources int) *fakeRegulatorBackfillStore {
+	store := &fakeRegulatorBackfillStore{
+		present: map[string]bool{},
+		failing: map[string]bool{},
+	}
+	for i := 1; i <= numResources; i++ {
+		store.resourceIDs = append(store.resourceIDs, fmt.Sprintf("r%03d", i))
+	}
+
+	return store
+}
+
+func (st *fakeRegulatorBackfillStore) newJob() *RegulatorBackfillJob {
+	j := NewRegulatorBackfillJob(nil, nil, 4)
+	j.listResourceIDsFunc = st.listResourceIDs
+	j.isResourcePresentFunc = st.isResourcePresent
+	j.processResourceFunc = st.processResource
+	j.loadCheckpointFunc = st.loadCheckpoint
+	j.saveCheckpointFunc = st.saveCheckpoint
+	return j
+}
+
+func (st *fakeRegulatorBackfillStore) listResourceIDs(lastResourceID string) ([]string, error) {
+	var ret []string
+	for _, resourceID := range st.resourceIDs {
+		if resourceID > lastResourceID && len(ret) < regulatorBackfillPageSize {
+			ret = append(ret, resourceID)
+		}
+	}
+
+	return ret, nil
+}
+
+func (st *fakeRegulatorBackfillStore) isResourcePresent(resourceID string) (bool, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	return st.present[resourceID], nil
+}
+
+func (st *fakeRegulatorBackfillStore) processResource(ctx context.Context, resourceID string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.failing[resourceID] {
+		return newPermanentError(fmt.Errorf("无法解密资源 %v", resourceID))
+	}
+
+	st.processedIDs = append(st.processedIDs, resourceID)
+	st.present[resourceID] = true
+	return nil
+}
+
+func (st *fakeRegulatorBackfillStore) loadCheckpoint() (string, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.checkpoint == "" {
+		return "", errorcode.ErrorNotFound
+	}
+
+	return st.checkpoint, nil
+}
+
+func (st *fakeRegulatorBackfillStore) saveCheckpoint(lastResourceID string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.checkpoint = lastResourceID
+	return nil
+}
+
+// 取走并清空已处理的资源，按资源 ID 排序。
+func (st *fakeRegulatorBackfillStore) takeProcessedIDs() []string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	ret := st.processedIDs
+	st.processedIDs = nil
+	sort.Strings(ret)
+	return ret
+}
+
+// 运行补处理任务直至结束，返回其进度。
+func runRegulatorBackfillJob(t *testing.T, j *RegulatorBackfillJob) RegulatorBackfillProgress {
+	if isNoError := assert.NoError(t, j.Start()); !isNoError {
+		t.FailNow()
+	}
+
+	select {
+	case <-j.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("补处理任务未在时限内结束")
+	}
+
+	return j.Progress()
+}
+
+// 补处理任务需要集合私钥才能启动。测试中的资源不真正解密，设置一个占位的私钥即可。
+func setDummyCollectivePrivateKey(t *testing.T) {
+	collectivePrivateKey := global.KeySwitchKeys.CollectivePrivateKey
+	global.KeySwitchKeys.CollectivePrivateKey = &sm2.PrivateKey{}
+	t.Cleanup(func() {
+		global.KeySwitchKeys.CollectivePrivateKey = collectivePrivateKey
+	})
+}
+
+func resourceIDRange(first int, last int) []string {
+	var ret []string
+	for i := first; i <= last; i++ {
+		ret = append(ret, fmt.Sprintf("r%03d", i))
+	}
+
+	return ret
+}
+
+func TestRegulatorBackfillJobResume(t *testing.T) {
+	setDummyCollectivePrivateKey(t)
+
+	// 之前的运行已处理到 r050
+	store := newFakeRegulatorBackfillStore(120)
+	store.checkpoint = "r050"
+
+	progress := runRegulatorBackfillJob(t, store.newJob())
+	assert.Empty(t, progress.Error)
+	assert.Equal(t, "r050", progress.StartAfterID)
+	assert.Equal(t, "r120", progress.LastResourceID)
+	assert.Equal(t, 70, progress.NumBackfilled)
+	assert.Equal(t, 0, progress.NumSkipped)
+	assert.Equal(t, resourceIDRange(51, 120), store.takeProcessedIDs())
+	assert.Equal(t, "r120", store.checkpoint)
+
+	// 没有新资源时再次运行不处理任何资源
+	progress = runRegulatorBackfillJob(t, store.newJob())
+	assert.Empty(t, progress.Error)
+	assert.Equal(t, 0, progress.NumBackfilled)
+	assert.Empty(t, store.takeProcessedIDs())
+}
+
+func TestRegulatorBackfillJobSkipPresent(t *testing.T) {
+	setDummyCollectivePrivateKey(t)
+
+	// 监管者服务器已处理过其中的一些资源
+	store := newFakeRegulatorBackfillStore(60)
+	store.present["r002"] = true
+	store.present["r051"] = true
+	store.present["r060"] = true
+
+	progress := runRegulatorBackfillJob(t, store.newJob())
+	assert.Empty(t, progress.Error)
+	assert.Equal(t, 57, progress.NumBackfilled)
+	assert.Equal(t, 3, progress.NumSkipped)
+	assert.Empty(t, progress.Failures)
+
+	processedIDs := store.takeProcessedIDs()
+	assert.Len(t, processedIDs, 57)
+	assert.NotContains(t, processedIDs, "r002")
+	assert.NotContains(t, processedIDs, "r051")
+	assert.NotContains(t, processedIDs, "r060")
+	assert.Equal(t, "r060", store.checkpoint)
+}
+
+func TestRegulatorBackfillJobCheckpointBeforeFailure(t *testing.T) {
+	setDummyCollectivePrivateKey(t)
+
+	testCases := []struct {
+		name               string
+		failing            []string
+		expectedCheckpoint string
+	}{
+		{"失败的资源位于页中", []string{"r075", "r110"}, "r074"},
+		{"失败的资源位于页首", []string{"r051", "r110"}, "r050"},
+		{"第一个资源即失败", []string{"r001"}, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newFakeRegulatorBackfillStore(120)
+			for _, resourceID := range tc.failing {
+				store.failing[resourceID] = true
+			}
+
+			// 失败的资源之后的资源仍被处理，但检查点停在第一个失败的资源之前
+			progress := runRegulatorBackfillJob(t, store.newJob())
+			assert.Empty(t, progress.Error)
+			assert.Equal(t, 120-len(tc.failing), progress.NumBackfilled)
+			assert.Len(t, progress.Failures, len(tc.failing))
+			for _, resourceID := range tc.failing {
+				assert.Contains(t, progress.Failures, resourceID)
+			}
+			assert.Equal(t, tc.expectedCheckpoint, progress.LastResourceID)
+			assert.Equal(t, tc.expectedCheckpoint, store.checkpoint)
+			store.takeProcessedIDs()
+
+			// 下次运行从检查点之后继续，重试失败的资源并跳过已处理的资源
+			store.failing = map[string]bool{}
+			progress = runRegulatorBackfillJob(t, store.newJob())
+			assert.Empty(t, progress.Error)
+			assert.Equal(t, tc.expectedCheckpoint, progress.StartAfterID)
+			assert.Equal(t, len(tc.failing), progress.NumBackfilled)
+			assert.Empty(t, progress.Failures)
+			assert.Equal(t, tc.failing, store.takeProcessedIDs())
+			assert.Equal(t, "r120", store.checkpoint)
+		})
+	}
+}
+
+func TestGetRegulatorBackfillCouchDBConditions(t *testing.T) {
+	// 首次运行从第一个资源开始
+	conditionsBytes, err := json.Marshal(getRegulatorBackfillCouchDBConditions(""))
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	assert.JSONEq(t, `{"selector":{"resourceType":{"$in":[1,2]}},"sort":[{"resourceID":"asc"}]}`, string(conditionsBytes))
+
+	// 继续的运行从检查点之后开始
+	conditionsBytes, err = json.Marshal(getRegulatorBackfillCouchDBConditions("1001"))
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	assert.JSONEq(t, `{"selector":{"resourceType":{"$in":[1,2]},"resourceID":{"$gt":"1001"}},"sort":[{"resourceID":"asc"}]}`, string(conditionsBytes))
+}
@@ -1,6 +1,7 @@
 package background
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -23,9 +24,10 @@ type RegulatorServer struct {
 	ServiceInfo        *service.Info
 	DocumentService    service.DocumentServiceInterface
 	EntityAssetService service.EntityAssetServiceInterface
+	NumWorkers         int // The number of Go routines that will be created to perform the task. It takes effect on the next start.
+	pool               *workerPool
 	wg                 sync.WaitGroup
-	chanQuit           chan int
-	chanResourceID     chan string
+	cancelForwarding   context.CancelFunc
 	reg                *fab.Registration
 	serverStatus       *backgroundServerStatus
 }
@@ -35,9 +37,8 @@ func NewRegulatorServer(serviceInfo *service.Info, documentService service.Docum
 		ServiceInfo:        serviceInfo,
 		DocumentService:    documentService,
 		EntityAssetService: entityAssetService,
+		NumWorkers:         1,
 		wg:                 sync.WaitGroup{},
-		chanQuit:           make(chan int),
-		chanResourceID:     make(chan string),
 		reg:                nil,
 		serverStatus:       newBackgroundServerStatus(),
 	}
@@ -55,8 +56,9 @@ func (s *RegulatorServer) Start() error {
 	}
 
 	s.serverStatus.setIsStarting(true)
+	defer s.serverStatus.setIsStarting(false)
 
-	// Register the event chaincode and pass the chan object to the workers to be created.
+	// Register the chaincode event. The events are forwarded to the worker pool as tasks.
 	eventID := "enc_res_creation"
 	log.Debugf("正在尝试监听事件 '%v'...", eventID)
 	reg, notifier, err := service.RegisterEvent(s.ServiceInfo.EventClient, s.ServiceInfo.ChaincodeID, eventID)
@@ -67,139 +69,182 @@ func (s *RegulatorServer) Start() error {
 
 	s.reg = &reg
 
-	// Start #NumWorkers Go routines with each running a worker.
-	log.Debugf("正在创建监管者服务工作单元...")
+	s.pool = newWorkerPool(workerPoolOptions{
+		name:       "监管者服务器",
+		numWorkers: s.NumWorkers,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancelForwarding = cancel
 	s.wg.Add(1)
-	go s.createRegulatorServerWorker(notifier)
+	go func() {
+		defer s.wg.Done()
+		forwardChaincodeEvents(ctx, notifier, s.submitEncryptedResourceCreation)
+	}()
 
-	s.serverStatus.setIsStarting(false)
 	s.serverStatus.setIsStarted(true)
 	log.Infoln("监管者服务器已启动。")
 
 	return nil
 }
 
-func (s *RegulatorServer) createRegulatorServerWorker(chanResourceIDNotifier <-chan *fab.CCEvent) {
-	log.Debugf("监管者服务工作单元已创建。")
-
-workerLoop:
-	for {
-		select {
-		case event := <-chanResourceIDNotifier:
-			timeDiffBefore := time.Now()
-			// On receiving a resource ID, fetch the resource metadata and act according to the data type
-			// First parse the event payload
-			resourceID := string(event.Payload)
-			if resourceID == "" {
-				log.Errorln("监管者服务工作单元无法解析事件内容")
-				continue
-			}
-
-			log.Debugf("监管者服务工作单元收到加密资源创建事件，资源 ID: %v。", resourceID)
-
-			// Fetch the resource metadata with the service function
-			resourceMetadata, err := s.DocumentService.GetDocumentMetadata(resourceID)
-			if err != nil {
-				log.Errorln(errors.Wrapf(err, "监管者服务工作单元无法获取资源元数据，资源 ID: %v", resourceID))
-				continue
-			}
-
-			// Fetch the encrypted key of the resource
-			chaincodeFcn := "getKey"
-			channelReq := channel.Request{
-				ChaincodeID: s.ServiceInfo.ChaincodeID,
-				Fcn:         chaincodeFcn,
-				Args:        [][]byte{[]byte(resourceID)},
-			}
-
-			resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
-			err = service.GetClassifiedError(chaincodeFcn, err)
-			if err != nil {
-				log.Errorln(errors.Wrapf(err, "监管者服务工作单元无法获取资源的加密密钥，资源 ID: %v", resourceID))
-				continue
-			}
-
-			encryptedKey := resp.Payload
-
-			// Decrypt the encrypted resource key
-			symmetricKeyBytes, err := s.decryptResourceKey(encryptedKey)
-			if err != nil {
-				log.Errorln(err)
-				continue
-			}
-
-			// Act according to the data type
-			dataType, ok := resourceMetadata.Extensions["dataType"]
-			if !ok {
-				log.Errorf("监管者服务工作单元无法获取资源的数据类型，资源 ID: %v", resourceID)
-			}
-
-			switch dataType {
-			case "document":
-				// Decrypt only the document properties in the metadata
-				encryptedDocumentPropertiesBytes, err := base64.StdEncoding.DecodeString(resourceMetadata.Extensions["encrypted"].(string))
-				if err != nil {
-					log.Errorln(errors.Wrapf(err, "监管者服务工作单元无法获取资源的加密属性，资源 ID: %v", resourceID))
-					continue
-				}
-
-				documentProperties, err := s.decryptDocumentProperties(encryptedDocumentPropertiesBytes, symmetricKeyBytes)
-				if err != nil {
-					log.Errorln(err)
-					continue
-				}
-
-				// Save the decrypted document properties
-				err = db.SaveDecryptedDocumentPropertiesToLocalDB(documentProperties, resourceMetadata.Timestamp, s.ServiceInfo.DB)
-				if err != nil {
-					log.Errorln(err)
-					continue
-				}
-			case "entityAsset":
-				// Fetch the encrypted entity asset from the chaincode function
-				chaincodeFcn := "getData"
-				channelReq := channel.Request{
-					ChaincodeID: s.ServiceInfo.ChaincodeID,
-					Fcn:         chaincodeFcn,
-					Args:        [][]byte{[]byte(resourceID)},
-				}
-
-				resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
-				err = service.GetClassifiedError(chaincodeFcn, err)
-				if err != nil {
-					log.Errorln(errors.Wrapf(err, "监管者服务工作单元无法获取资源，资源 ID: %v", resourceID))
-					continue
-				}
-
-				encryptedEntityAssetBytes := resp.Payload
-
-				// Decrypt the entity asset
-				entityAsset, err := s.decryptEntityAsset(encryptedEntityAssetBytes, symmetricKeyBytes)
-				if err != nil {
-					log.Errorln(err)
-					continue
-				}
-
-				// Save the decrypted entity asset
-				err = db.SaveDecryptedEntityAssetToLocalDB(entityAsset, resourceMetadata.Timestamp, s.ServiceInfo.DB)
-				if err != nil {
-					log.Errorln(err)
-					continue
-				}
-			}
-
-			timeDiffAfter := time.Now()
-			timeDiff := timeDiffAfter.Sub(timeDiffBefore)
-			log.Debugf("密钥置换工作单元完成事件处理，耗时 %v。资源 ID: %v。", timeDiff, resourceID)
-		case <-s.chanQuit:
-			// Break the for loop when receiving a quit signal
-			log.Debug("密钥置换工作单元收到退出信号。")
-			s.wg.Done()
-			break workerLoop
-		default:
-			time.Sleep(50 * time.Millisecond)
+// submitEncryptedResourceCreation queues the processing of an encrypted resource creation event.
+func (s *RegulatorServer) submitEncryptedResourceCreation(event *fab.CCEvent) {
+	// On receiving a resource ID, fetch the resource metadata and act according to the data type
+	// First parse the event payload
+	resourceID := string(event.Payload)
+	if resourceID == "" {
+		log.Errorln("监管者服务器无法解析事件内容")
+		return
+	}
+
+	log.Debugf("监管者服务器收到加密资源创建事件，资源 ID: %v。", resourceID)
+
+	taskName := fmt.Sprintf("资源 %v", resourceID)
+	err := s.pool.submit(taskName, func(ctx context.Context) error {
+		return s.processEncryptedResourceCreation(ctx, resourceID)
+	})
+	if err != nil {
+		log.Errorln(errors.Wrapf(err, "监管者服务器无法处理加密资源创建事件，资源 ID: %v", resourceID))
+	}
+}
+
+// processEncryptedResourceCreation decrypts the newly created resource and saves the decrypted content into the local database. Failures in talking to the chain are retried by the worker pool.
+func (s *RegulatorServer) processEncryptedResourceCreation(ctx context.Context, resourceID string) error {
+	timeDiffBefore := time.Now()
+
+	// Fetch the resource metadata with the service function
+	resourceMetadata, err := s.DocumentService.GetDocumentMetadata(resourceID)
+	if err != nil {
+		return errors.Wrap(err, "无法获取资源元数据")
+	}
+
+	// Fetch the encrypted key of the resource
+	chaincodeFcn := "getKey"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{[]byte(resourceID)},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+	err = service.GetClassifiedError(chaincodeFcn, err)
+	if err != nil {
+		return errors.Wrap(err, "无法获取资源的加密密钥")
+	}
+
+	encryptedKey := resp.Payload
+
+	// Decrypt the encrypted resource key
+	symmetricKeyBytes, err := s.decryptResourceKey(encryptedKey)
+	if err != nil {
+		return newPermanentError(err)
+	}
+
+	// Act according to the data type
+	dataType, ok := resourceMetadata.Extensions["dataType"]
+	if !ok {
+		return newPermanentError(fmt.Errorf("无法获取资源的数据类型"))
+	}
+
+	switch dataType {
+	case "document":
+		// Decrypt only the document properties in the metadata
+		encryptedDocumentPropertiesBytes, err := base64.StdEncoding.DecodeString(resourceMetadata.Extensions["encrypted"].(string))
+		if err != nil {
+			return newPermanentError(errors.Wrap(err, "无法获取资源的加密属性"))
+		}
+
+		documentProperties, err := s.decryptDocumentProperties(encryptedDocumentPropertiesBytes, symmetricKeyBytes)
+		if err != nil {
+			return newPermanentError(err)
+		}
+
+		// Save the decrypted document properties
+		err = db.SaveDecryptedDocumentPropertiesToLocalDB(documentProperties, resourceMetadata.Timestamp, s.ServiceInfo.DB)
+		if err != nil {
+			return err
+		}
+	case "entityAsset":
+		// Give up before fetching the data if the server is being stopped
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		// Fetch the encrypted entity asset from the chaincode function
+		chaincodeFcn := "getData"
+		channelReq := channel.Request{
+			ChaincodeID: s.ServiceInfo.ChaincodeID,
+			Fcn:         chaincodeFcn,
+			Args:        [][]byte{[]byte(resourceID)},
+		}
+
+		resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+		err = service.GetClassifiedError(chaincodeFcn, err)
+		if err != nil {
+			return errors.Wrap(err, "无法获取资源")
+		}
+
+		encryptedEntityAssetBytes := resp.Payload
+
+		// Decrypt the entity asset
+		entityAsset, err := s.decryptEntityAsset(encryptedEntityAssetBytes, symmetricKeyBytes)
+		if err != nil {
+			return newPermanentError(err)
+		}
+
+		// Save the decrypted entity asset
+		err = db.SaveDecryptedEntityAssetToLocalDB(entityAsset, resourceMetadata.Timestamp, s.ServiceInfo.DB)
+		if err != nil {
+			return err
 		}
 	}
+
+	timeDiffAfter := time.Now()
+	timeDiff := timeDiffAfter.Sub(timeDiffBefore)
+	log.Debugf("监管者服务器完成事件处理，耗时 %v。资源 ID: %v。", timeDiff, resourceID)
+
+	return nil
+}
+
+// Stop stops the regulator server from responding to resource creation events. The queued events are still processed until `ctx` is done, after which the remaining ones are abandoned.
+func (s *RegulatorServer) Stop(ctx context.Context) error {
+	// Don't stop the server again if the server has already been called to stop.
+	if s.serverStatus.getIsStopping() {
+		return fmt.Errorf("监管者服务器正在停止")
+	} else if !s.serverStatus.getIsStarted() {
+		return fmt.Errorf("监管者服务器已停止")
+	}
+
+	s.serverStatus.setIsStopping(true)
+	defer s.serverStatus.setIsStopping(false)
+
+	// Stop receiving events. Stopping the pool also unblocks the forwarder if it's waiting on a full queue.
+	s.ServiceInfo.ChannelClient.UnregisterChaincodeEvent(*s.reg)
+	s.cancelForwarding()
+	err := s.pool.stop(ctx)
+	s.wg.Wait()
+
+	stats := s.pool.stats()
+	log.Infof("监管者服务器已停止。成功 %v 个，失败 %v 个，重试 %v 次，放弃 %v 个。", stats.NumSucceeded, stats.NumFailed, stats.NumRetries, stats.NumDiscarded)
+
+	s.serverStatus.setIsStarted(false)
+
+	return err
+}
+
+// IsStarted tells whether the regulator server is running.
+func (s *RegulatorServer) IsStarted() bool {
+	return s.serverStatus.getIsStarted()
+}
+
+// Stats returns the metrics of the worker pool of the server.
+func (s *RegulatorServer) Stats() WorkerPoolStats {
+	if s.pool == nil {
+		return WorkerPoolStats{}
+	}
+
+	return s.pool.stats()
 }
 
 func (s *RegulatorServer) decryptResourceKey(encryptedKeyBytes []byte) (symmetricKeyBytes []byte, err error) {
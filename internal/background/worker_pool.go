@@ -0,0 +1,251 @@
+package background
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultQueueSize      = 256
+	defaultMaxAttempts    = 3
+	defaultInitialBackoff = 500 * time.Millisecond
+	defaultMaxBackoff     = 10 * time.Second
+)
+
+// task is a unit of work run by a worker pool. A task should return early when `ctx` is cancelled.
+type task struct {
+	name   string
+	run    func(ctx context.Context) error
+	onDone func(err error) // Called once with the final outcome of the task, including when it's discarded. Optional.
+}
+
+// permanentError marks a task error that retrying won't fix, e.g. a malformed event payload.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Cause() error {
+	return e.err
+}
+
+// newPermanentError wraps `err` so that the task failing with it is not retried.
+func newPermanentError(err error) error {
+	return &permanentError{err: err}
+}
+
+// WorkerPoolStats contains the metrics of a worker pool.
+type WorkerPoolStats struct {
+	QueueDepth   int    `json:"queueDepth"`   // The number of tasks waiting in the queue
+	NumSucceeded uint64 `json:"numSucceeded"` // The number of tasks that have succeeded
+	NumFailed    uint64 `json:"numFailed"`    // The number of tasks that have failed after all attempts or with a permanent error
+	NumRetries   uint64 `json:"numRetries"`   // The number of retries over all tasks
+	NumDiscarded uint64 `json:"numDiscarded"` // The number of queued tasks discarded as the pool was stopped before running them
+}
+
+// workerPoolOptions configures a worker pool. Zero values are replaced by the defaults.
+type workerPoolOptions struct {
+	name           string        // The name of the pool shown in logs
+	numWorkers     int           // The number of Go routines running the tasks
+	queueSize      int           // The capacity of the task queue. Submitting to a full queue blocks.
+	maxAttempts    int           // The maximum number of times a task is run
+	initialBackoff time.Duration // The wait before the first retry. It doubles on each further retry.
+	maxBackoff     time.Duration // The upper limit of the wait between retries
+}
+
+// workerPool runs tasks from a bounded queue on a fixed number of workers, retrying failed tasks with exponential backoff.
+type workerPool struct {
+	opts         workerPoolOptions
+	queue        chan *task
+	ctx          context.Context
+	cancel       context.CancelFunc
+	chanStopping chan struct{}
+	wg           sync.WaitGroup
+	mu           sync.RWMutex
+	stopOnce     sync.Once
+	isStopped    bool
+	numSucceeded uint64
+	numFailed    uint64
+	numRetries   uint64
+	numDiscarded uint64
+}
+
+// newWorkerPool creates a worker pool and starts its workers.
+func newWorkerPool(opts workerPoolOptions) *workerPool {
+	if opts.numWorkers <= 0 {
+		opts.numWorkers = 1
+	}
+	if opts.queueSize <= 0 {
+		opts.queueSize = defaultQueueSize
+	}
+	if opts.maxAttempts <= 0 {
+		opts.maxAttempts = defaultMaxAttempts
+	}
+	if opts.initialBackoff <= 0 {
+		opts.initialBackoff = defaultInitialBackoff
+	}
+	if opts.maxBackoff <= 0 {
+		opts.maxBackoff = defaultMaxBackoff
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &workerPool{
+		opts:         opts,
+		queue:        make(chan *task, opts.queueSize),
+		ctx:          ctx,
+		cancel:       cancel,
+		chanStopping: make(chan struct{}),
+	}
+
+	log.Debugf("正在为%v创建 %v 个工作单元...", opts.name, opts.numWorkers)
+	for id := 0; id < opts.numWorkers; id++ {
+		p.wg.Add(1)
+		go p.runWorker(id)
+	}
+
+	return p
+}
+
+// submit queues a task. It blocks while the queue is full and fails once the pool is stopped.
+func (p *workerPool) submit(name string, run func(ctx context.Context) error) error {
+	return p.submitWithCallback(name, run, nil)
+}
+
+// submitWithCallback queues a task like `submit()` and calls `onDone` with its final outcome once it's done, after all retries, or discarded. `onDone` is not called if the task can't be queued.
+func (p *workerPool) submitWithCallback(name string, run func(ctx context.Context) error, onDone func(err error)) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.isStopped {
+		return fmt.Errorf("%v已停止", p.opts.name)
+	}
+
+	select {
+	case p.queue <- &task{name: name, run: run, onDone: onDone}:
+		return nil
+	case <-p.chanStopping:
+		return fmt.Errorf("%v正在停止", p.opts.name)
+	}
+}
+
+// stop stops accepting tasks and lets the workers finish the queued ones. When `ctx` is done before that, the running tasks are cancelled, the rest of the queue is discarded and an error is returned.
+func (p *workerPool) stop(ctx context.Context) error {
+	// Unblock the submitters waiting on a full queue first so that the lock can be acquired
+	p.stopOnce.Do(func() { close(p.chanStopping) })
+
+	p.mu.Lock()
+	if p.isStopped {
+		p.mu.Unlock()
+		return fmt.Errorf("%v已停止", p.opts.name)
+	}
+	p.isStopped = true
+	close(p.queue)
+	p.mu.Unlock()
+
+	chanDone := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(chanDone)
+	}()
+
+	select {
+	case <-chanDone:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		return errors.Wrapf(ctx.Err(), "%v未能在时限内处理完所有任务", p.opts.name)
+	}
+}
+
+// stats returns the current metrics of the pool.
+func (p *workerPool) stats() WorkerPoolStats {
+	return WorkerPoolStats{
+		QueueDepth:   len(p.queue),
+		NumSucceeded: atomic.LoadUint64(&p.numSucceeded),
+		NumFailed:    atomic.LoadUint64(&p.numFailed),
+		NumRetries:   atomic.LoadUint64(&p.numRetries),
+		NumDiscarded: atomic.LoadUint64(&p.numDiscarded),
+	}
+}
+
+func (p *workerPool) runWorker(id int) {
+	defer p.wg.Done()
+	log.Debugf("%v工作单元 #%v 已创建。", p.opts.name, id)
+
+	// The loop ends when the queue is closed and drained
+	for t := range p.queue {
+		if p.ctx.Err() != nil {
+			atomic.AddUint64(&p.numDiscarded, 1)
+			if t.onDone != nil {
+				t.onDone(errors.Wrap(p.ctx.Err(), "任务已被放弃"))
+			}
+			continue
+		}
+
+		err := p.runTask(t)
+		if err != nil {
+			atomic.AddUint64(&p.numFailed, 1)
+			log.Errorln(errors.Wrapf(err, "%v工作单元 #%v 无法完成任务 '%v'", p.opts.name, id, t.name))
+		} else {
+			atomic.AddUint64(&p.numSucceeded, 1)
+		}
+		if t.onDone != nil {
+			t.onDone(err)
+		}
+	}
+
+	log.Debugf("%v工作单元 #%v 已退出。", p.opts.name, id)
+}
+
+// runTask runs a task until it succeeds, fails with a permanent error, uses up its attempts or the pool is cancelled.
+func (p *workerPool) runTask(t *task) error {
+	backoff := p.opts.initialBackoff
+	for attempt := 1; ; attempt++ {
+		err := t.run(p.ctx)
+		if err == nil {
+			return nil
+		}
+		if _, ok := err.(*permanentError); ok || attempt >= p.opts.maxAttempts {
+			return err
+		}
+
+		log.Debugf("%v的任务 '%v' 第 %v 次尝试失败，将在 %v 后重试: %v", p.opts.name, t.name, attempt, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-p.ctx.Done():
+			return errors.Wrap(err, "任务已取消")
+		}
+
+		atomic.AddUint64(&p.numRetries, 1)
+		backoff *= 2
+		if backoff > p.opts.maxBackoff {
+			backoff = p.opts.maxBackoff
+		}
+	}
+}
+
+// forwardChaincodeEvents passes the events from `notifier` to `handle` one by one until `ctx` is done or the notifier is closed.
+func forwardChaincodeEvents(ctx context.Context, notifier <-chan *fab.CCEvent, handle func(event *fab.CCEvent)) {
+	for {
+		select {
+		case event, ok := <-notifier:
+			if !ok {
+				return
+			}
+			handle(event)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
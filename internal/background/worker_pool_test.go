@@ -0,0 +1,105 @@
+package background
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerPoolRetry(t *testing.T) {
+	pool := newWorkerPool(workerPoolOptions{
+		name:           "测试工作池",
+		numWorkers:     2,
+		maxAttempts:    3,
+		initialBackoff: time.Millisecond,
+		maxBackoff:     2 * time.Millisecond,
+	})
+
+	// 前两次失败、第三次成功的任务
+	var numFlakyRuns int32
+	err := pool.submit("flaky", func(ctx context.Context) error {
+		if atomic.AddInt32(&numFlakyRuns, 1) < 3 {
+			return fmt.Errorf("暂时失败")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// 始终失败的任务，在用尽尝试次数后放弃
+	var numFailingRuns int32
+	err = pool.submit("failing", func(ctx context.Context) error {
+		atomic.AddInt32(&numFailingRuns, 1)
+		return fmt.Errorf("始终失败")
+	})
+	assert.NoError(t, err)
+
+	// 永久错误不重试
+	var numPermanentRuns int32
+	err = pool.submit("permanent", func(ctx context.Context) error {
+		atomic.AddInt32(&numPermanentRuns, 1)
+		return newPermanentError(fmt.Errorf("无法解析"))
+	})
+	assert.NoError(t, err)
+
+	err = pool.stop(context.Background())
+	assert.NoError(t, err)
+
+	assert.Equal(t, int32(3), atomic.LoadInt32(&numFlakyRuns))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&numFailingRuns))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&numPermanentRuns))
+
+	stats := pool.stats()
+	assert.Equal(t, 0, stats.QueueDepth)
+	assert.Equal(t, uint64(1), stats.NumSucceeded)
+	assert.Equal(t, uint64(2), stats.NumFailed)
+	assert.Equal(t, uint64(4), stats.NumRetries)
+	assert.Equal(t, uint64(0), stats.NumDiscarded)
+
+	// 停止后不再接受任务
+	err = pool.submit("late", func(ctx context.Context) error { return nil })
+	assert.Error(t, err)
+}
+
+func TestWorkerPoolStopWithDeadline(t *testing.T) {
+	pool := newWorkerPool(workerPoolOptions{
+		name:       "测试工作池",
+		numWorkers: 1,
+	})
+
+	// 第一个任务阻塞至被取消，其余任务排队等待
+	chanStarted := make(chan struct{})
+	err := pool.submit("blocking", func(ctx context.Context) error {
+		close(chanStarted)
+		<-ctx.Done()
+		return newPermanentError(ctx.Err())
+	})
+	assert.NoError(t, err)
+	<-chanStarted
+
+	for i := 0; i < 3; i++ {
+		err = pool.submit(fmt.Sprintf("queued%v", i), func(ctx context.Context) error { return nil })
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 3, pool.stats().QueueDepth)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	timeBeforeStop := time.Now()
+	err = pool.stop(ctx)
+	assert.Error(t, err)
+	assert.Less(t, int64(time.Since(timeBeforeStop)), int64(time.Second))
+
+	// 超时后运行中的任务被取消，排队中的任务被放弃
+	assert.Eventually(t, func() bool {
+		stats := pool.stats()
+		return stats.NumFailed == 1 && stats.NumDiscarded == 3
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, uint64(0), pool.stats().NumSucceeded)
+
+	// 重复停止返回错误
+	assert.Error(t, pool.stop(context.Background()))
+}
@@ -88,7 +88,7 @@ func (c *AuthController) handleCreateAuthResponse(ctx *gin.Context) {
 	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
 		ctx.Writer.WriteHeader(http.StatusNotImplemented)
 	} else if errors.Cause(err) == errorcode.ErrorForbidden {
-		ctx.Writer.WriteHeader(http.StatusForbidden)
+		writeForbidden(ctx, err)
 	} else {
 		ctx.String(http.StatusInternalServerError, err.Error())
 	}
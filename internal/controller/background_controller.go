@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"net/http"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/background"
+	"github.com/gin-gonic/gin"
+)
+
+// A BackgroundController contains a group name and the background servers of this instance. It also implements the interface `Controller`.
+type BackgroundController struct {
+	GroupName       string
+	KeySwitchServer *background.KeySwitchServer
+	RegulatorServer *background.RegulatorServer
+}
+
+// backgroundServerStatus is the running state of a background server and the metrics of its worker pool.
+type backgroundServerStatus struct {
+	IsStarted bool                       `json:"isStarted"`
+	Stats     background.WorkerPoolStats `json:"stats"`
+}
+
+// GetGroupName returns the group name.
+func (bc *BackgroundController) GetGroupName() string {
+	return bc.GroupName
+}
+
+// GetEndpointMap implements part of the interface `Controller`. It returns the API endpoints and handlers which are defined and managed by BackgroundController.
+func (bc *BackgroundController) GetEndpointMap() EndpointMap {
+	return EndpointMap{
+		urlMethodPair{"status", "GET"}: []gin.HandlerFunc{bc.handleGetStatus},
+	}
+}
+
+func (bc *BackgroundController) handleGetStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"keySwitchServer": backgroundServerStatus{
+			IsStarted: bc.KeySwitchServer.IsStarted(),
+			Stats:     bc.KeySwitchServer.Stats(),
+		},
+		"regulatorServer": backgroundServerStatus{
+			IsStarted: bc.RegulatorServer.IsStarted(),
+			Stats:     bc.RegulatorServer.Stats(),
+		},
+	})
+}
@@ -12,6 +12,7 @@ import (
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/models/common"
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/service"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/accesspolicy"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/data"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/sm2keyutils"
 	"github.com/XiaoYao-austin/ppks"
@@ -37,6 +38,7 @@ func (c *DocumentController) GetEndpointMap() EndpointMap {
 	return EndpointMap{
 		urlMethodPair{"document", "POST"}:               []gin.HandlerFunc{c.handleCreateDocument},
 		urlMethodPair{"documents/list", "GET"}:          []gin.HandlerFunc{c.handleListDocumentIDs},
+		urlMethodPair{"documents/decrypt", "GET"}:       []gin.HandlerFunc{c.handleGetEncryptedDocuments},
 		urlMethodPair{"document/:id/metadata", "GET"}:   []gin.HandlerFunc{c.handleGetDocumentMetadata},
 		urlMethodPair{"document/:id/properties", "GET"}: []gin.HandlerFunc{c.handleGetDocumentProperties},
 		urlMethodPair{"document/:id", "GET"}:            []gin.HandlerFunc{c.handleGetDocument},
@@ -120,12 +122,10 @@ func (c *DocumentController) handleCreateDocument(ctx *gin.Context) {
 	}
 
 	// Check policy if it's not a plain resource
-	policy := ctx.PostForm("policy")
-
+	var policy string
+	var policyTemplate *accesspolicy.PolicyTemplateReference
 	if resourceType != data.Plain {
-		if len(policy) == 0 {
-			*pel = append(*pel, "策略不能为空。")
-		}
+		policy, policyTemplate = extractResourcePolicy(ctx, pel)
 	}
 
 	// Early return after extracting common parameters if the error list is not empty
@@ -197,9 +197,9 @@ func (c *DocumentController) handleCreateDocument(ctx *gin.Context) {
 	case data.Plain:
 		txID, err = c.DocumentSvc.CreateDocument(document)
 	case data.Encrypted:
-		txID, err = c.DocumentSvc.CreateEncryptedDocument(document, key, policy)
+		txID, err = c.DocumentSvc.CreateEncryptedDocument(document, key, policy, policyTemplate)
 	case data.Offchain:
-		txID, err = c.DocumentSvc.CreateOffchainDocument(document, key, policy)
+		txID, err = c.DocumentSvc.CreateOffchainDocument(document, key, policy, policyTemplate)
 	}
 
 	// Check error type and generate the corresponding response
@@ -211,6 +211,9 @@ func (c *DocumentController) handleCreateDocument(ctx *gin.Context) {
 			SymmetricKeyMaterial: string(keyPEM),
 		}
 		ctx.JSON(http.StatusOK, info)
+	} else if reflect.TypeOf(err) == reflect.TypeOf(&service.ErrorBadRequest{}) {
+		*pel = append(*pel, err.Error())
+		ctx.JSON(http.StatusBadRequest, pel)
 	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
 		ctx.Writer.WriteHeader(http.StatusNotImplemented)
 	} else {
@@ -253,7 +256,6 @@ func (c *DocumentController) handleGetDocumentProperties(ctx *gin.Context) {
 
 	// Extract conditional parameters
 	var keySwitchSessionID string
-	var numSharesExpected int
 
 	// Early return if the error list is not empty
 	if len(*pel) > 0 {
@@ -286,9 +288,6 @@ func (c *DocumentController) handleGetDocumentProperties(ctx *gin.Context) {
 		keySwitchSessionID = ctx.Query("keySwitchSessionID")
 		keySwitchSessionID = pel.AppendIfEmptyOrBlankSpaces(keySwitchSessionID, "该数字文档解密记录不可用，密钥置换会话 ID 不能为空。")
 
-		numSharesExpectedString := ctx.Query("numSharesExpected")
-		numSharesExpected = pel.AppendIfNotInt(numSharesExpectedString, "该数字文档解密记录不可用，期待的份额数量应为正整数。")
-
 		// Early return if the error list is not empty
 		if len(*pel) > 0 {
 			ctx.AbortWithStatusJSON(http.StatusBadRequest, pel)
@@ -296,7 +295,7 @@ func (c *DocumentController) handleGetDocumentProperties(ctx *gin.Context) {
 		}
 
 		// Invoke the service function to perform the full process
-		documentProperties, err = c.DocumentSvc.GetEncryptedDocumentProperties(id, keySwitchSessionID, numSharesExpected, resDataMetadata)
+		documentProperties, err = c.DocumentSvc.GetEncryptedDocumentProperties(id, keySwitchSessionID, resDataMetadata)
 	}
 
 	// Check error type and generate the corresponding response
@@ -307,6 +306,8 @@ func (c *DocumentController) handleGetDocumentProperties(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, pel)
 	} else if errors.Cause(err) == errorcode.ErrorNotFound {
 		ctx.Writer.WriteHeader(http.StatusNotFound)
+	} else if errors.Cause(err) == errorcode.ErrorServiceUnavailable {
+		ctx.String(http.StatusServiceUnavailable, err.Error())
 	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
 		ctx.Writer.WriteHeader(http.StatusNotImplemented)
 	} else {
@@ -336,7 +337,6 @@ func (c *DocumentController) handleGetDocument(ctx *gin.Context) {
 
 	// Extract conditional parameters
 	var keySwitchSessionID string
-	var numSharesExpected int
 
 	// Early return if the error list is not empty
 	if len(*pel) > 0 {
@@ -374,9 +374,6 @@ func (c *DocumentController) handleGetDocument(ctx *gin.Context) {
 			keySwitchSessionID = ctx.Query("keySwitchSessionID")
 			keySwitchSessionID = pel.AppendIfEmptyOrBlankSpaces(keySwitchSessionID, "该数字文档解密记录不可用，密钥置换会话 ID 不能为空。")
 
-			numSharesExpectedString := ctx.Query("numSharesExpected")
-			numSharesExpected = pel.AppendIfNotInt(numSharesExpectedString, "该数字文档解密记录不可用，期待的份额数量应为正整数。")
-
 			// Early return if the error list is not empty
 			if len(*pel) > 0 {
 				ctx.AbortWithStatusJSON(http.StatusBadRequest, pel)
@@ -385,9 +382,9 @@ func (c *DocumentController) handleGetDocument(ctx *gin.Context) {
 
 			// Invoke the service function to perform the full process
 			if resourceType == data.Encrypted {
-				document, err = c.DocumentSvc.GetEncryptedDocument(id, keySwitchSessionID, numSharesExpected, resDataMetadata)
+				document, err = c.DocumentSvc.GetEncryptedDocument(id, keySwitchSessionID, resDataMetadata)
 			} else {
-				document, err = c.DocumentSvc.GetOffchainDocument(id, keySwitchSessionID, numSharesExpected, resDataMetadata)
+				document, err = c.DocumentSvc.GetOffchainDocument(id, keySwitchSessionID, resDataMetadata)
 			}
 		}
 	}
@@ -400,6 +397,46 @@ func (c *DocumentController) handleGetDocument(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, pel)
 	} else if errors.Cause(err) == errorcode.ErrorNotFound {
 		ctx.Writer.WriteHeader(http.StatusNotFound)
+	} else if errors.Cause(err) == errorcode.ErrorServiceUnavailable {
+		ctx.String(http.StatusServiceUnavailable, err.Error())
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		ctx.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		ctx.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (c *DocumentController) handleGetEncryptedDocuments(ctx *gin.Context) {
+	// Extract and check parameters
+	pel := &ParameterErrorList{}
+
+	ids := ctx.QueryArray("id")
+	if len(ids) == 0 {
+		*pel = append(*pel, "文档 ID 列表不能为空。")
+	}
+	for i := range ids {
+		ids[i] = pel.AppendIfEmptyOrBlankSpaces(ids[i], "文档 ID 不能为空。")
+	}
+
+	keySwitchSessionID := pel.AppendIfEmptyOrBlankSpaces(ctx.Query("keySwitchSessionID"), "密钥置换会话 ID 不能为空。")
+
+	if len(*pel) > 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
+	documents, err := c.DocumentSvc.GetEncryptedDocuments(ids, keySwitchSessionID)
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		ctx.JSON(http.StatusOK, documents)
+	} else if reflect.TypeOf(err) == reflect.TypeOf(&service.ErrorBadRequest{}) {
+		*pel = append(*pel, err.Error())
+		ctx.JSON(http.StatusBadRequest, pel)
+	} else if errors.Cause(err) == errorcode.ErrorNotFound {
+		ctx.Writer.WriteHeader(http.StatusNotFound)
+	} else if errors.Cause(err) == errorcode.ErrorServiceUnavailable {
+		ctx.String(http.StatusServiceUnavailable, err.Error())
 	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
 		ctx.Writer.WriteHeader(http.StatusNotImplemented)
 	} else {
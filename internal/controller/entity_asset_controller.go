@@ -11,6 +11,7 @@ import (
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/models/common"
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/service"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/accesspolicy"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/data"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/sm2keyutils"
 	"github.com/XiaoYao-austin/ppks"
@@ -82,11 +83,10 @@ func (c *EntityAssetController) handleCreateAsset(ctx *gin.Context) {
 	}
 
 	// Check policy if it's not a plain resource
-	policy := ctx.PostForm("policy")
+	var policy string
+	var policyTemplate *accesspolicy.PolicyTemplateReference
 	if resourceType != data.Plain {
-		if len(policy) == 0 {
-			*pel = append(*pel, "策略不能为空。")
-		}
+		policy, policyTemplate = extractResourcePolicy(ctx, pel)
 	}
 
 	// Whether the properties are public should be specified if it's not a plain asset
@@ -148,7 +148,7 @@ func (c *EntityAssetController) handleCreateAsset(ctx *gin.Context) {
 	case data.Plain:
 		txID, err = c.EntityAssetSvc.CreateEntityAsset(asset)
 	case data.Encrypted:
-		txID, err = c.EntityAssetSvc.CreateEncryptedEntityAsset(asset, key, policy)
+		txID, err = c.EntityAssetSvc.CreateEncryptedEntityAsset(asset, key, policy, policyTemplate)
 	}
 
 	// Check error type and generate the corresponding response
@@ -160,6 +160,9 @@ func (c *EntityAssetController) handleCreateAsset(ctx *gin.Context) {
 			SymmetricKeyMaterial: string(keyPEM),
 		}
 		ctx.JSON(http.StatusOK, info)
+	} else if reflect.TypeOf(err) == reflect.TypeOf(&service.ErrorBadRequest{}) {
+		*pel = append(*pel, err.Error())
+		ctx.JSON(http.StatusBadRequest, pel)
 	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
 		ctx.Writer.WriteHeader(http.StatusNotImplemented)
 	} else {
@@ -219,7 +222,6 @@ func (c *EntityAssetController) handleGetAsset(ctx *gin.Context) {
 
 	// Extract conditional parameters
 	var keySwitchSessionID string
-	var numSharesExpected int
 
 	// Early return if the error list is not empty
 	if len(*pel) > 0 {
@@ -256,9 +258,6 @@ func (c *EntityAssetController) handleGetAsset(ctx *gin.Context) {
 			keySwitchSessionID = ctx.Query("keySwitchSessionID")
 			keySwitchSessionID = pel.AppendIfEmptyOrBlankSpaces(keySwitchSessionID, "该实体资产解密记录不可用，密钥置换会话 ID 不能为空。")
 
-			numSharesExpectedString := ctx.Query("numSharesExpected")
-			numSharesExpected = pel.AppendIfNotInt(numSharesExpectedString, "该实体资产解密记录不可用，期待的份额数量应为正整数。")
-
 			// Early return if the error list is not empty
 			if len(*pel) > 0 {
 				ctx.AbortWithStatusJSON(http.StatusBadRequest, pel)
@@ -266,7 +265,7 @@ func (c *EntityAssetController) handleGetAsset(ctx *gin.Context) {
 			}
 
 			// Invoke the service function to perform the full process
-			entityAsset, err = c.EntityAssetSvc.GetEncryptedEntityAsset(id, keySwitchSessionID, numSharesExpected, resDataMetadata)
+			entityAsset, err = c.EntityAssetSvc.GetEncryptedEntityAsset(id, keySwitchSessionID, resDataMetadata)
 		}
 	}
 
@@ -278,6 +277,8 @@ func (c *EntityAssetController) handleGetAsset(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, pel)
 	} else if errors.Cause(err) == errorcode.ErrorNotFound {
 		ctx.Writer.WriteHeader(http.StatusNotFound)
+	} else if errors.Cause(err) == errorcode.ErrorServiceUnavailable {
+		ctx.String(http.StatusServiceUnavailable, err.Error())
 	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
 		ctx.Writer.WriteHeader(http.StatusNotImplemented)
 	} else {
@@ -2,10 +2,12 @@ package controller
 
 import (
 	"net/http"
+	"reflect"
 	"strings"
 
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/service"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/identity"
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
 )
@@ -31,6 +33,9 @@ func (c *IdentityController) GetEndpointMap() EndpointMap {
 		urlMethodPair{"assets/list", "GET"}:        []gin.HandlerFunc{c.handleGetEntityAssetList},
 		urlMethodPair{"auths/pending-list", "GET"}: []gin.HandlerFunc{c.handleGetAuthPendingList},
 		urlMethodPair{"auths/request-list", "GET"}: []gin.HandlerFunc{c.handleGetAuthRequestList},
+		urlMethodPair{"registry", "GET"}:           []gin.HandlerFunc{c.handleGetRegisteredAttributes},
+		urlMethodPair{"registry", "POST"}:          []gin.HandlerFunc{c.handleUpdateRegisteredAttributes},
+		urlMethodPair{"registry/history", "GET"}:   []gin.HandlerFunc{c.handleGetRegisteredAttributesHistory},
 	}
 }
 
@@ -181,3 +186,113 @@ func (c *IdentityController) handleGetAuthRequestList(ctx *gin.Context) {
 		ctx.String(http.StatusInternalServerError, err.Error())
 	}
 }
+
+func (c *IdentityController) handleUpdateRegisteredAttributes(ctx *gin.Context) {
+	// Extract and check parameters
+	pel := &ParameterErrorList{}
+
+	publicKey := ctx.PostForm("publicKey")
+	publicKey = pel.AppendIfEmptyOrBlankSpaces(publicKey, "公钥不能为空。")
+
+	// Only the attributes specified are registered. They replace all the attributes registered before.
+	attributes := map[string]string{}
+	formFields := map[string]string{
+		"deptType":      "DeptType",
+		"deptLevel":     "DeptLevel",
+		"deptName":      "DeptName",
+		"superDeptName": "SuperDeptName",
+	}
+	for field, attributeName := range formFields {
+		if value := strings.TrimSpace(ctx.PostForm(field)); value != "" {
+			attributes[attributeName] = value
+		}
+	}
+	if deptLevelStr, ok := attributes["DeptLevel"]; ok {
+		_ = pel.AppendIfNotInt(deptLevelStr, "部门级别必须为整数。")
+	}
+
+	reason := strings.TrimSpace(ctx.PostForm("reason"))
+
+	// Early return if the error list is not empty
+	if len(*pel) > 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
+	update := &identity.RegisteredAttributesUpdate{
+		PublicKey:  publicKey,
+		Attributes: attributes,
+		Reason:     reason,
+	}
+	version, txID, err := c.IdentitySvc.UpdateRegisteredAttributes(update)
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		info := RegisteredAttributesUpdateInfo{
+			Version:       version,
+			TransactionID: txID,
+		}
+		ctx.JSON(http.StatusOK, info)
+	} else if reflect.TypeOf(err) == reflect.TypeOf(&service.ErrorBadRequest{}) {
+		*pel = append(*pel, err.Error())
+		ctx.JSON(http.StatusBadRequest, pel)
+	} else if errors.Cause(err) == errorcode.ErrorForbidden {
+		writeForbidden(ctx, err)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		ctx.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		ctx.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (c *IdentityController) handleGetRegisteredAttributes(ctx *gin.Context) {
+	// Extract and check parameters
+	pel := &ParameterErrorList{}
+
+	publicKey := processBase64FromURLQuery(ctx.Query("publicKey"))
+	publicKey = pel.AppendIfEmptyOrBlankSpaces(publicKey, "公钥不能为空。")
+
+	// Early return if the error list is not empty
+	if len(*pel) > 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
+	registered, err := c.IdentitySvc.GetRegisteredAttributes(publicKey)
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		ctx.JSON(http.StatusOK, registered)
+	} else if errors.Cause(err) == errorcode.ErrorNotFound {
+		ctx.Writer.WriteHeader(http.StatusNotFound)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		ctx.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		ctx.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (c *IdentityController) handleGetRegisteredAttributesHistory(ctx *gin.Context) {
+	// Extract and check parameters
+	pel := &ParameterErrorList{}
+
+	publicKey := processBase64FromURLQuery(ctx.Query("publicKey"))
+	publicKey = pel.AppendIfEmptyOrBlankSpaces(publicKey, "公钥不能为空。")
+
+	// Early return if the error list is not empty
+	if len(*pel) > 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
+	history, err := c.IdentitySvc.ListRegisteredAttributesHistory(publicKey)
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		ctx.JSON(http.StatusOK, history)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		ctx.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		ctx.String(http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/background"
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/service"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/sm2keyutils"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// A KeyRotationController contains a group name, a `KeyRotationService` instance and the re-encryption job of this instance. It also implements the interface `Controller`.
+type KeyRotationController struct {
+	GroupName       string
+	KeyRotationSvc  service.KeyRotationServiceInterface
+	ReencryptionJob *background.KeyReencryptionJob
+}
+
+// GetGroupName returns the group name.
+func (kc *KeyRotationController) GetGroupName() string {
+	return kc.GroupName
+}
+
+// GetEndpointMap implements part of the interface `Controller`. It returns the API endpoints and handlers which are defined and managed by KeyRotationController.
+func (kc *KeyRotationController) GetEndpointMap() EndpointMap {
+	return EndpointMap{
+		urlMethodPair{"collective-keys", "GET"}:           []gin.HandlerFunc{kc.handleGetCollectiveKey},
+		urlMethodPair{"collective-keys", "POST"}:          []gin.HandlerFunc{kc.handlePublishCollectiveKey},
+		urlMethodPair{"resources/:id/key-epoch", "GET"}:   []gin.HandlerFunc{kc.handleGetResourceKeyEpoch},
+		urlMethodPair{"resources/:id/key-revert", "POST"}: []gin.HandlerFunc{kc.handleRevertResourceKey},
+		urlMethodPair{"reencryption", "GET"}:              []gin.HandlerFunc{kc.handleGetReencryptionProgress},
+		urlMethodPair{"reencryption", "POST"}:             []gin.HandlerFunc{kc.handleStartReencryption},
+		urlMethodPair{"reencryption", "DELETE"}:           []gin.HandlerFunc{kc.handleStopReencryption},
+	}
+}
+
+func (kc *KeyRotationController) handlePublishCollectiveKey(c *gin.Context) {
+	// Extract and check parameters
+	pel := &ParameterErrorList{}
+
+	epoch := pel.AppendIfNotPositiveInt(c.PostForm("epoch"), "纪元应为正整数。")
+	publicKeyPEM := pel.AppendIfEmptyOrBlankSpaces(c.PostForm("publicKey"), "集合公钥不能为空。")
+
+	if len(*pel) > 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
+	publicKey, err := sm2keyutils.ConvertPEMToPublicKey([]byte(publicKeyPEM))
+	if err != nil {
+		*pel = append(*pel, "无法解析集合公钥。")
+		c.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
+	txID, err := kc.KeyRotationSvc.PublishCollectiveKey(epoch, publicKey)
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		info := TransactionIDInfo{
+			TransactionID: txID,
+		}
+		c.JSON(http.StatusOK, info)
+	} else if _, ok := err.(*service.ErrorBadRequest); ok {
+		*pel = append(*pel, err.Error())
+		c.JSON(http.StatusBadRequest, pel)
+	} else if errors.Cause(err) == errorcode.ErrorForbidden {
+		writeForbidden(c, err)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		c.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		c.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (kc *KeyRotationController) handleGetCollectiveKey(c *gin.Context) {
+	// Extract and check parameters. The latest collective key is returned if the epoch is not specified.
+	pel := &ParameterErrorList{}
+
+	epochStr := c.Query("epoch")
+	epoch := 0
+	if epochStr != "" {
+		epoch = pel.AppendIfNotInt(epochStr, "纪元应为整数。")
+	}
+
+	if len(*pel) > 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
+	var err error
+	var collectiveKey interface{}
+	if epochStr == "" {
+		collectiveKey, err = kc.KeyRotationSvc.GetLatestCollectiveKey()
+	} else {
+		collectiveKey, err = kc.KeyRotationSvc.GetCollectiveKey(epoch)
+	}
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		c.JSON(http.StatusOK, collectiveKey)
+	} else if errors.Cause(err) == errorcode.ErrorNotFound {
+		c.Writer.WriteHeader(http.StatusNotFound)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		c.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		c.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (kc *KeyRotationController) handleGetResourceKeyEpoch(c *gin.Context) {
+	// Extract and check parameters
+	pel := &ParameterErrorList{}
+
+	resourceID := pel.AppendIfEmptyOrBlankSpaces(c.Param("id"), "资源 ID 不能为空。")
+
+	if len(*pel) > 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
+	resourceKeyEpoch, err := kc.KeyRotationSvc.GetResourceKeyEpoch(resourceID)
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		c.JSON(http.StatusOK, resourceKeyEpoch)
+	} else if errors.Cause(err) == errorcode.ErrorNotFound {
+		c.Writer.WriteHeader(http.StatusNotFound)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		c.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		c.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (kc *KeyRotationController) handleRevertResourceKey(c *gin.Context) {
+	// Extract and check parameters
+	pel := &ParameterErrorList{}
+
+	resourceID := pel.AppendIfEmptyOrBlankSpaces(c.Param("id"), "资源 ID 不能为空。")
+
+	if len(*pel) > 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
+	txID, err := kc.KeyRotationSvc.RevertResourceKey(resourceID)
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		info := TransactionIDInfo{
+			TransactionID: txID,
+		}
+		c.JSON(http.StatusOK, info)
+	} else if _, ok := err.(*service.ErrorBadRequest); ok {
+		*pel = append(*pel, err.Error())
+		c.JSON(http.StatusBadRequest, pel)
+	} else if errors.Cause(err) == errorcode.ErrorForbidden {
+		writeForbidden(c, err)
+	} else if errors.Cause(err) == errorcode.ErrorNotFound {
+		c.Writer.WriteHeader(http.StatusNotFound)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		c.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		c.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (kc *KeyRotationController) handleStartReencryption(c *gin.Context) {
+	// Extract and check parameters
+	pel := &ParameterErrorList{}
+
+	epoch := pel.AppendIfNotPositiveInt(c.PostForm("epoch"), "纪元应为正整数。")
+
+	if len(*pel) > 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
+	err := kc.ReencryptionJob.Start(epoch)
+
+	// Check error type and generate the corresponding response. The job runs in the background so its progress is returned right away.
+	if err == nil {
+		c.JSON(http.StatusAccepted, kc.ReencryptionJob.Progress())
+	} else if errors.Cause(err) == errorcode.ErrorNotFound {
+		c.String(http.StatusNotFound, err.Error())
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		c.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		*pel = append(*pel, err.Error())
+		c.JSON(http.StatusBadRequest, pel)
+	}
+}
+
+func (kc *KeyRotationController) handleGetReencryptionProgress(c *gin.Context) {
+	c.JSON(http.StatusOK, kc.ReencryptionJob.Progress())
+}
+
+func (kc *KeyRotationController) handleStopReencryption(c *gin.Context) {
+	// Wait for the tasks in progress to end for no more than 10 seconds
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := kc.ReencryptionJob.Stop(ctx); err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, kc.ReencryptionJob.Progress())
+}
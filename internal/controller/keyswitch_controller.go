@@ -1,13 +1,20 @@
 package controller
 
 import (
+	"context"
 	"encoding/base64"
 	"net/http"
+	"reflect"
+	"strings"
+	"time"
 
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/service"
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/utils/cipherutils"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/keyswitch"
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
+	"github.com/tjfoc/gmsm/sm2"
 )
 
 // A DocumentController contains a group name and a `DocumentService` instance. It also implements the interface `Controller`.
@@ -25,7 +32,20 @@ func (kc *KeySwitchController) GetGroupName() string {
 func (kc *KeySwitchController) GetEndpointMap() EndpointMap {
 	return EndpointMap{
 		urlMethodPair{"trigger", "POST"}:               []gin.HandlerFunc{kc.handleCreateKeySwitchTrigger},
+		urlMethodPair{"trigger/bulk", "POST"}:          []gin.HandlerFunc{kc.handleCreateMultiResourceKeySwitchTrigger},
 		urlMethodPair{":id/results/list-await", "GET"}: []gin.HandlerFunc{kc.handleAwaitListKeySwitchResults},
+		urlMethodPair{"servers", "GET"}:                []gin.HandlerFunc{kc.handleListKeySwitchServers},
+		urlMethodPair{"servers", "POST"}:               []gin.HandlerFunc{kc.handleRegisterKeySwitchServer},
+		urlMethodPair{"servers", "DELETE"}:             []gin.HandlerFunc{kc.handleDeregisterKeySwitchServer},
+		urlMethodPair{"shares", "POST"}:                []gin.HandlerFunc{kc.handleReceiveKeySwitchShares},
+		urlMethodPair{"pks", "GET"}:                    []gin.HandlerFunc{kc.handleListKeySwitchPKs},
+		urlMethodPair{"pks", "POST"}:                   []gin.HandlerFunc{kc.handleRegisterKeySwitchPK},
+		urlMethodPair{"pks", "DELETE"}:                 []gin.HandlerFunc{kc.handleRevokeKeySwitchPK},
+		urlMethodPair{"pks/owner", "GET"}:              []gin.HandlerFunc{kc.handleGetKeySwitchPKOwner},
+		urlMethodPair{"sessions/:id", "GET"}:           []gin.HandlerFunc{kc.handleGetKeySwitchSession},
+		urlMethodPair{"sessions/:id/materials", "GET"}: []gin.HandlerFunc{kc.handleGetClientDecryptionMaterials},
+		urlMethodPair{"session-config", "GET"}:         []gin.HandlerFunc{kc.handleGetKeySwitchSessionConfig},
+		urlMethodPair{"session-config", "POST"}:        []gin.HandlerFunc{kc.handleSetKeySwitchSessionConfig},
 	}
 }
 
@@ -37,10 +57,24 @@ func (kc *KeySwitchController) handleCreateKeySwitchTrigger(c *gin.Context) {
 
 	resourceID = pel.AppendIfEmptyOrBlankSpaces(resourceID, "资源 ID 不能为空。")
 
+	// The caller may supply its own key switch public key to decrypt the resource locally
+	keySwitchPK := parseOptionalKeySwitchPK(c.PostForm("keySwitchPK"), pel)
+
+	if len(*pel) > 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
 	// Extract and check common parameters
 	authSessionID := c.PostForm("authSessionID")
 
-	txID, err := kc.KeySwitchSvc.CreateKeySwitchTrigger(resourceID, authSessionID)
+	var txID string
+	var err error
+	if keySwitchPK == nil {
+		txID, err = kc.KeySwitchSvc.CreateKeySwitchTrigger(resourceID, authSessionID)
+	} else {
+		txID, err = kc.KeySwitchSvc.CreateKeySwitchTriggerWithPublicKey(resourceID, authSessionID, keySwitchPK)
+	}
 
 	// Check error type and generate the corresponding response
 	// The symmetric key will be included if it's not empty
@@ -49,8 +83,70 @@ func (kc *KeySwitchController) handleCreateKeySwitchTrigger(c *gin.Context) {
 			TransactionID: txID,
 		}
 		c.JSON(http.StatusOK, info)
+	} else if _, ok := err.(*service.ErrorBadRequest); ok {
+		*pel = append(*pel, err.Error())
+		c.JSON(http.StatusBadRequest, pel)
+	} else if errors.Cause(err) == errorcode.ErrorForbidden {
+		writeForbidden(c, err)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		c.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		c.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (kc *KeySwitchController) handleCreateMultiResourceKeySwitchTrigger(c *gin.Context) {
+	resourceIDs := c.PostFormArray("resourceIDs")
+	authSessionIDs := c.PostFormArray("authSessionIDs")
+
+	// Validity check
+	pel := &ParameterErrorList{}
+
+	if len(resourceIDs) == 0 {
+		*pel = append(*pel, "资源 ID 列表不能为空。")
+	}
+	for i := range resourceIDs {
+		resourceIDs[i] = pel.AppendIfEmptyOrBlankSpaces(resourceIDs[i], "资源 ID 不能为空。")
+	}
+
+	// The auth session IDs, if specified, pair up with the resource IDs. An empty one means the resource is checked against its policy.
+	if len(authSessionIDs) != 0 && len(authSessionIDs) != len(resourceIDs) {
+		*pel = append(*pel, "授权会话 ID 的数量应与资源 ID 的数量一致。")
+	}
+
+	keySwitchPK := parseOptionalKeySwitchPK(c.PostForm("keySwitchPK"), pel)
+
+	if len(*pel) > 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
+	authSessionIDMap := map[string]string{}
+	for i, authSessionID := range authSessionIDs {
+		if authSessionID != "" {
+			authSessionIDMap[resourceIDs[i]] = authSessionID
+		}
+	}
+
+	var txID string
+	var err error
+	if keySwitchPK == nil {
+		txID, err = kc.KeySwitchSvc.CreateKeySwitchTriggerForResources(resourceIDs, authSessionIDMap)
+	} else {
+		txID, err = kc.KeySwitchSvc.CreateKeySwitchTriggerForResourcesWithPublicKey(resourceIDs, authSessionIDMap, keySwitchPK)
+	}
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		info := TransactionIDInfo{
+			TransactionID: txID,
+		}
+		c.JSON(http.StatusOK, info)
+	} else if reflect.TypeOf(err) == reflect.TypeOf(&service.ErrorBadRequest{}) {
+		*pel = append(*pel, err.Error())
+		c.JSON(http.StatusBadRequest, pel)
 	} else if errors.Cause(err) == errorcode.ErrorForbidden {
-		c.Writer.WriteHeader(http.StatusForbidden)
+		writeForbidden(c, err)
 	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
 		c.Writer.WriteHeader(http.StatusNotImplemented)
 	} else {
@@ -67,9 +163,6 @@ func (kc *KeySwitchController) handleAwaitListKeySwitchResults(c *gin.Context) {
 
 	keySwitchSessionID = pel.AppendIfEmptyOrBlankSpaces(keySwitchSessionID, "密钥置换会话 ID 不能为空。")
 
-	numExpected := c.Query("numExpected")
-	numExpectedInt := pel.AppendIfNotPositiveInt(numExpected, "预期的份额数量必须为正整数。")
-
 	timeout := c.Query("timeout")
 	timeoutInt := 0
 	if timeout != "" {
@@ -81,13 +174,14 @@ func (kc *KeySwitchController) handleAwaitListKeySwitchResults(c *gin.Context) {
 		return
 	}
 
-	var shares [][]byte
-	var err error
+	// Wait within the timeout (20 seconds by default). Waiting is also cancelled if the client goes away.
 	if timeout == "" {
-		shares, err = kc.KeySwitchSvc.AwaitKeySwitchResults(keySwitchSessionID, numExpectedInt)
-	} else {
-		shares, err = kc.KeySwitchSvc.AwaitKeySwitchResults(keySwitchSessionID, numExpectedInt, timeoutInt)
+		timeoutInt = 20
 	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(timeoutInt)*time.Second)
+	defer cancel()
+
+	shares, err := kc.KeySwitchSvc.AwaitKeySwitchResultsWithContext(ctx, keySwitchSessionID)
 
 	// Check error type and generate the corresponding response
 	if err == nil {
@@ -102,7 +196,332 @@ func (kc *KeySwitchController) handleAwaitListKeySwitchResults(c *gin.Context) {
 		c.Writer.WriteHeader(http.StatusNotImplemented)
 	} else if errors.Cause(err) == errorcode.ErrorGatewayTimeout {
 		c.Writer.WriteHeader(http.StatusGatewayTimeout)
+	} else if errors.Cause(err) == errorcode.ErrorServiceUnavailable {
+		c.String(http.StatusServiceUnavailable, err.Error())
+	} else {
+		c.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (kc *KeySwitchController) handleRegisterKeySwitchServer(c *gin.Context) {
+	// Extract and check parameters
+	pel := &ParameterErrorList{}
+
+	publicKey := pel.AppendIfEmptyOrBlankSpaces(c.PostForm("publicKey"), "服务器身份的公钥不能为空。")
+	name := pel.AppendIfEmptyOrBlankSpaces(c.PostForm("name"), "服务器名称不能为空。")
+	keySwitchPK := pel.AppendIfEmptyOrBlankSpaces(c.PostForm("keySwitchPK"), "密钥置换公钥不能为空。")
+
+	if len(*pel) > 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
+	txID, err := kc.KeySwitchSvc.RegisterKeySwitchServer(publicKey, name, keySwitchPK)
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		info := TransactionIDInfo{
+			TransactionID: txID,
+		}
+		c.JSON(http.StatusOK, info)
+	} else if _, ok := err.(*service.ErrorBadRequest); ok {
+		*pel = append(*pel, err.Error())
+		c.JSON(http.StatusBadRequest, pel)
+	} else if errors.Cause(err) == errorcode.ErrorForbidden {
+		writeForbidden(c, err)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		c.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		c.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (kc *KeySwitchController) handleDeregisterKeySwitchServer(c *gin.Context) {
+	// Extract and check parameters
+	pel := &ParameterErrorList{}
+
+	publicKey := processBase64FromURLQuery(c.Query("publicKey"))
+	publicKey = pel.AppendIfEmptyOrBlankSpaces(publicKey, "服务器身份的公钥不能为空。")
+
+	if len(*pel) > 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
+	txID, err := kc.KeySwitchSvc.DeregisterKeySwitchServer(publicKey)
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		info := TransactionIDInfo{
+			TransactionID: txID,
+		}
+		c.JSON(http.StatusOK, info)
+	} else if errors.Cause(err) == errorcode.ErrorForbidden {
+		writeForbidden(c, err)
+	} else if errors.Cause(err) == errorcode.ErrorNotFound {
+		c.Writer.WriteHeader(http.StatusNotFound)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		c.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		c.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (kc *KeySwitchController) handleListKeySwitchServers(c *gin.Context) {
+	// The servers are listed along with their liveness told by their heartbeats
+	ksServerStatuses, err := kc.KeySwitchSvc.ListKeySwitchServerStatuses()
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		c.JSON(http.StatusOK, ksServerStatuses)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		c.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		c.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (kc *KeySwitchController) handleReceiveKeySwitchShares(c *gin.Context) {
+	// The shares are delivered by the key switch servers in JSON. The signature in it authenticates the server.
+	pel := &ParameterErrorList{}
+
+	var delivery keyswitch.KeySwitchShareDelivery
+	if err := c.ShouldBindJSON(&delivery); err != nil {
+		*pel = append(*pel, "无法解析交付的份额。")
+		c.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
+	err := kc.KeySwitchSvc.ReceiveKeySwitchShares(&delivery)
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		c.Writer.WriteHeader(http.StatusNoContent)
+	} else if _, ok := err.(*service.ErrorBadRequest); ok {
+		*pel = append(*pel, err.Error())
+		c.JSON(http.StatusBadRequest, pel)
+	} else if errors.Cause(err) == errorcode.ErrorForbidden {
+		writeForbidden(c, err)
+	} else if errors.Cause(err) == errorcode.ErrorNotFound {
+		c.Writer.WriteHeader(http.StatusNotFound)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		c.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		c.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (kc *KeySwitchController) handleRegisterKeySwitchPK(c *gin.Context) {
+	// Extract and check parameters
+	pel := &ParameterErrorList{}
+
+	keySwitchPK := pel.AppendIfEmptyOrBlankSpaces(c.PostForm("keySwitchPK"), "密钥置换公钥不能为空。")
+	signature := pel.AppendIfEmptyOrBlankSpaces(c.PostForm("signature"), "签名不能为空。")
+	shareDeliveryURL := strings.TrimSpace(c.PostForm("shareDeliveryURL"))
+
+	if len(*pel) > 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
+	txID, err := kc.KeySwitchSvc.RegisterKeySwitchPK(keySwitchPK, signature, shareDeliveryURL)
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		info := TransactionIDInfo{
+			TransactionID: txID,
+		}
+		c.JSON(http.StatusOK, info)
+	} else if _, ok := err.(*service.ErrorBadRequest); ok {
+		*pel = append(*pel, err.Error())
+		c.JSON(http.StatusBadRequest, pel)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		c.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		c.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (kc *KeySwitchController) handleRevokeKeySwitchPK(c *gin.Context) {
+	// Extract and check parameters
+	pel := &ParameterErrorList{}
+
+	keySwitchPK := processBase64FromURLQuery(c.Query("keySwitchPK"))
+	keySwitchPK = pel.AppendIfEmptyOrBlankSpaces(keySwitchPK, "密钥置换公钥不能为空。")
+
+	if len(*pel) > 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
+	txID, err := kc.KeySwitchSvc.RevokeKeySwitchPK(keySwitchPK)
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		info := TransactionIDInfo{
+			TransactionID: txID,
+		}
+		c.JSON(http.StatusOK, info)
+	} else if errors.Cause(err) == errorcode.ErrorNotFound {
+		c.Writer.WriteHeader(http.StatusNotFound)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		c.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		c.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (kc *KeySwitchController) handleListKeySwitchPKs(c *gin.Context) {
+	// The key switch public keys of the caller are listed if the owner is not specified
+	owner := processBase64FromURLQuery(c.Query("owner"))
+
+	registrations, err := kc.KeySwitchSvc.ListKeySwitchPKs(owner)
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		c.JSON(http.StatusOK, registrations)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		c.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		c.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (kc *KeySwitchController) handleGetKeySwitchPKOwner(c *gin.Context) {
+	// The identity a key switch public key will be bound to. Clients sign it along with their key switch public keys.
+	owner, err := kc.KeySwitchSvc.GetCallerPublicKey()
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		c.String(http.StatusOK, owner)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		c.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		c.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (kc *KeySwitchController) handleGetKeySwitchSession(c *gin.Context) {
+	// Extract and check parameters
+	pel := &ParameterErrorList{}
+
+	keySwitchSessionID := pel.AppendIfEmptyOrBlankSpaces(c.Param("id"), "密钥置换会话 ID 不能为空。")
+
+	if len(*pel) > 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
+	ksSession, err := kc.KeySwitchSvc.GetKeySwitchSession(keySwitchSessionID)
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		c.JSON(http.StatusOK, ksSession)
+	} else if errors.Cause(err) == errorcode.ErrorNotFound {
+		c.Writer.WriteHeader(http.StatusNotFound)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		c.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		c.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (kc *KeySwitchController) handleGetClientDecryptionMaterials(c *gin.Context) {
+	// Extract and check parameters
+	pel := &ParameterErrorList{}
+
+	keySwitchSessionID := pel.AppendIfEmptyOrBlankSpaces(c.Param("id"), "密钥置换会话 ID 不能为空。")
+	resourceID := pel.AppendIfEmptyOrBlankSpaces(c.Query("resourceID"), "资源 ID 不能为空。")
+
+	if len(*pel) > 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
+	materials, err := kc.KeySwitchSvc.GetClientDecryptionMaterials(keySwitchSessionID, resourceID)
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		c.JSON(http.StatusOK, materials)
+	} else if _, ok := err.(*service.ErrorBadRequest); ok {
+		*pel = append(*pel, err.Error())
+		c.JSON(http.StatusBadRequest, pel)
+	} else if errors.Cause(err) == errorcode.ErrorNotFound {
+		c.Writer.WriteHeader(http.StatusNotFound)
+	} else if errors.Cause(err) == errorcode.ErrorServiceUnavailable {
+		c.String(http.StatusServiceUnavailable, err.Error())
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		c.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		c.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (kc *KeySwitchController) handleSetKeySwitchSessionConfig(c *gin.Context) {
+	// Extract and check parameters
+	pel := &ParameterErrorList{}
+
+	sessionTTL := pel.AppendIfNotPositiveInt(c.PostForm("sessionTTL"), "会话的有效期应为正整数。")
+	threshold := 0
+	if thresholdStr := c.PostForm("threshold"); thresholdStr != "" {
+		threshold = pel.AppendIfNotPositiveInt(thresholdStr, "门限值应为非负整数。")
+	}
+
+	if len(*pel) > 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
+	txID, err := kc.KeySwitchSvc.SetKeySwitchSessionConfig(sessionTTL, threshold)
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		info := TransactionIDInfo{
+			TransactionID: txID,
+		}
+		c.JSON(http.StatusOK, info)
+	} else if _, ok := err.(*service.ErrorBadRequest); ok {
+		*pel = append(*pel, err.Error())
+		c.JSON(http.StatusBadRequest, pel)
+	} else if errors.Cause(err) == errorcode.ErrorForbidden {
+		writeForbidden(c, err)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		c.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		c.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (kc *KeySwitchController) handleGetKeySwitchSessionConfig(c *gin.Context) {
+	ksSessionConfig, err := kc.KeySwitchSvc.GetKeySwitchSessionConfig()
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		c.JSON(http.StatusOK, ksSessionConfig)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		c.Writer.WriteHeader(http.StatusNotImplemented)
 	} else {
 		c.String(http.StatusInternalServerError, err.Error())
 	}
 }
+
+// parseOptionalKeySwitchPK parses a key switch public key given as the Base64 encoding of its 64-byte form. It returns nil if the key is not specified.
+func parseOptionalKeySwitchPK(keySwitchPKAsBase64 string, pel *ParameterErrorList) *sm2.PublicKey {
+	if keySwitchPKAsBase64 == "" {
+		return nil
+	}
+
+	keySwitchPKBytes, err := base64.StdEncoding.DecodeString(keySwitchPKAsBase64)
+	if err != nil {
+		*pel = append(*pel, "无法解析密钥置换公钥。")
+		return nil
+	}
+
+	keySwitchPK, err := cipherutils.DeserializeSM2PublicKey(keySwitchPKBytes)
+	if err != nil {
+		*pel = append(*pel, "无法解析密钥置换公钥。")
+		return nil
+	}
+
+	return keySwitchPK
+}
@@ -10,3 +10,16 @@ type ResourceCreationInfo struct {
 type TransactionIDInfo struct {
 	TransactionID string `json:"transactionID"` // 交易 ID
 }
+
+// PolicyTemplateCreationInfo 包含访问策略模板成功创建时该返回给客户端的信息
+type PolicyTemplateCreationInfo struct {
+	TemplateID    string `json:"templateID"`    // 模板 ID
+	Version       int    `json:"version"`       // 新创建的模板版本
+	TransactionID string `json:"transactionID"` // 交易 ID
+}
+
+// RegisteredAttributesUpdateInfo 包含登记属性成功更新时该返回给客户端的信息
+type RegisteredAttributesUpdateInfo struct {
+	Version       int    `json:"version"`       // 新的登记版本
+	TransactionID string `json:"transactionID"` // 交易 ID
+}
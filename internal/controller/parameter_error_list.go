@@ -1,9 +1,12 @@
 package controller
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/policy"
 )
 
 // ParameterErrorList contains a list of human-readable errors about parameters.
@@ -113,3 +116,19 @@ func (pel *ParameterErrorList) AppendIfNotTime(str string, errMsg string) time.T
 
 	return timeResult
 }
+
+// AppendIfInvalidPolicy appends the error message specified along with the validation error if `str` is not a valid access policy.
+//
+// Parameters:
+//   the policy to be checked
+//   the error message to append
+//
+// Returns:
+//   the policy
+func (pel *ParameterErrorList) AppendIfInvalidPolicy(str string, errMsg string) string {
+	if err := policy.Validate(str, policy.SubjectNames); err != nil {
+		*pel = append(*pel, fmt.Sprintf("%v%v。", errMsg, err))
+	}
+
+	return str
+}
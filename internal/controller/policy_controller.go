@@ -0,0 +1,362 @@
+package controller
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/service"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/accesspolicy"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/identity"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// A PolicyController contains a group name and a `PolicyService` instance. It also implements the interface `Controller`.
+type PolicyController struct {
+	GroupName string
+	PolicySvc service.PolicyServiceInterface
+}
+
+// GetGroupName returns the group name.
+func (c *PolicyController) GetGroupName() string {
+	return c.GroupName
+}
+
+// GetEndpointMap implements part of the interface `Controller`. It returns the API endpoints and handlers which are defined and managed by PolicyController.
+func (c *PolicyController) GetEndpointMap() EndpointMap {
+	return EndpointMap{
+		urlMethodPair{"policy/evaluate", "POST"}:            []gin.HandlerFunc{c.handleEvaluatePolicy},
+		urlMethodPair{"policy/time-zone", "GET"}:            []gin.HandlerFunc{c.handleGetPolicyTimeZone},
+		urlMethodPair{"policy/time-zone", "POST"}:           []gin.HandlerFunc{c.handleSetPolicyTimeZone},
+		urlMethodPair{"policy/redacted-attributes", "GET"}:  []gin.HandlerFunc{c.handleGetPolicyRedactedAttributes},
+		urlMethodPair{"policy/redacted-attributes", "POST"}: []gin.HandlerFunc{c.handleSetPolicyRedactedAttributes},
+		urlMethodPair{"policies", "GET"}:                    []gin.HandlerFunc{c.handleListPolicyTemplates},
+		urlMethodPair{"policies", "POST"}:                   []gin.HandlerFunc{c.handleCreatePolicyTemplate},
+		urlMethodPair{"policies/:id", "GET"}:                []gin.HandlerFunc{c.handleGetPolicyTemplate},
+		urlMethodPair{"org-units", "GET"}:                   []gin.HandlerFunc{c.handleListOrgUnits},
+		urlMethodPair{"org-units", "POST"}:                  []gin.HandlerFunc{c.handlePutOrgUnit},
+		urlMethodPair{"org-units/:name", "DELETE"}:          []gin.HandlerFunc{c.handleRemoveOrgUnit},
+	}
+}
+
+func (c *PolicyController) handleEvaluatePolicy(ctx *gin.Context) {
+	// Extract and check parameters
+	pel := &ParameterErrorList{}
+
+	policy := ctx.PostForm("policy")
+	policy = pel.AppendIfEmptyOrBlankSpaces(policy, "策略不能为空。")
+
+	// The department identity is optional. The caller's own identity is used if none of the attributes is specified.
+	deptType := strings.TrimSpace(ctx.PostForm("deptType"))
+	deptLevelStr := strings.TrimSpace(ctx.PostForm("deptLevel"))
+	deptName := strings.TrimSpace(ctx.PostForm("deptName"))
+	superDeptName := strings.TrimSpace(ctx.PostForm("superDeptName"))
+
+	var deptIdentity *identity.DepartmentIdentityStored
+	if deptType != "" || deptLevelStr != "" || deptName != "" || superDeptName != "" {
+		deptIdentity = &identity.DepartmentIdentityStored{
+			DeptType:      deptType,
+			DeptName:      deptName,
+			SuperDeptName: superDeptName,
+		}
+
+		if deptLevelStr != "" {
+			deptIdentity.DeptLevel = pel.AppendIfNotInt(deptLevelStr, "部门级别必须为整数。")
+		}
+	}
+
+	// The resource is optional. It provides the resource attributes referenced by the policy.
+	resourceID := strings.TrimSpace(ctx.PostForm("resourceID"))
+
+	// Early return if the error list is not empty
+	if len(*pel) > 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
+	result, err := c.PolicySvc.EvaluatePolicy(policy, deptIdentity, resourceID)
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		ctx.JSON(http.StatusOK, result)
+	} else if reflect.TypeOf(err) == reflect.TypeOf(&service.ErrorBadRequest{}) {
+		*pel = append(*pel, err.Error())
+		ctx.JSON(http.StatusBadRequest, pel)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		ctx.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		ctx.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (c *PolicyController) handleSetPolicyTimeZone(ctx *gin.Context) {
+	// Extract and check parameters
+	pel := &ParameterErrorList{}
+
+	timeZone := ctx.PostForm("timeZone")
+	timeZone = pel.AppendIfEmptyOrBlankSpaces(timeZone, "时区不能为空。")
+
+	// Early return if the error list is not empty
+	if len(*pel) > 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
+	txID, err := c.PolicySvc.SetPolicyTimeZone(timeZone)
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		info := TransactionIDInfo{
+			TransactionID: txID,
+		}
+		ctx.JSON(http.StatusOK, info)
+	} else if reflect.TypeOf(err) == reflect.TypeOf(&service.ErrorBadRequest{}) {
+		*pel = append(*pel, err.Error())
+		ctx.JSON(http.StatusBadRequest, pel)
+	} else if errors.Cause(err) == errorcode.ErrorForbidden {
+		writeForbidden(ctx, err)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		ctx.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		ctx.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (c *PolicyController) handleGetPolicyTimeZone(ctx *gin.Context) {
+	timeZone, err := c.PolicySvc.GetPolicyTimeZone()
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		ctx.JSON(http.StatusOK, timeZone)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		ctx.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		ctx.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (c *PolicyController) handleSetPolicyRedactedAttributes(ctx *gin.Context) {
+	// Extract parameters. An empty list means no attribute is redacted.
+	attributeNames := []string{}
+	for _, name := range ctx.PostFormArray("attributes") {
+		if name = strings.TrimSpace(name); name != "" {
+			attributeNames = append(attributeNames, name)
+		}
+	}
+
+	txID, err := c.PolicySvc.SetPolicyRedactedAttributes(attributeNames)
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		info := TransactionIDInfo{
+			TransactionID: txID,
+		}
+		ctx.JSON(http.StatusOK, info)
+	} else if errors.Cause(err) == errorcode.ErrorForbidden {
+		writeForbidden(ctx, err)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		ctx.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		ctx.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (c *PolicyController) handleGetPolicyRedactedAttributes(ctx *gin.Context) {
+	attributeNames, err := c.PolicySvc.GetPolicyRedactedAttributes()
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		ctx.JSON(http.StatusOK, attributeNames)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		ctx.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		ctx.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (c *PolicyController) handleCreatePolicyTemplate(ctx *gin.Context) {
+	// Extract and check parameters
+	pel := &ParameterErrorList{}
+
+	templateID := ctx.PostForm("id")
+	templateID = pel.AppendIfEmptyOrBlankSpaces(templateID, "模板 ID 不能为空。")
+
+	description := strings.TrimSpace(ctx.PostForm("description"))
+
+	policy := ctx.PostForm("policy")
+	if strings.TrimSpace(policy) == "" {
+		*pel = append(*pel, "策略不能为空。")
+	} else {
+		policy = pel.AppendIfInvalidPolicy(policy, "策略不合法：")
+	}
+
+	// Early return if the error list is not empty
+	if len(*pel) > 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
+	template := &accesspolicy.PolicyTemplate{
+		TemplateID:  templateID,
+		Description: description,
+		Policy:      policy,
+	}
+	version, txID, err := c.PolicySvc.CreatePolicyTemplate(template)
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		info := PolicyTemplateCreationInfo{
+			TemplateID:    templateID,
+			Version:       version,
+			TransactionID: txID,
+		}
+		ctx.JSON(http.StatusOK, info)
+	} else if reflect.TypeOf(err) == reflect.TypeOf(&service.ErrorBadRequest{}) {
+		*pel = append(*pel, err.Error())
+		ctx.JSON(http.StatusBadRequest, pel)
+	} else if errors.Cause(err) == errorcode.ErrorForbidden {
+		writeForbidden(ctx, err)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		ctx.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		ctx.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (c *PolicyController) handleGetPolicyTemplate(ctx *gin.Context) {
+	// Extract and check parameters
+	pel := &ParameterErrorList{}
+
+	templateID := ctx.Param("id")
+	templateID = pel.AppendIfEmptyOrBlankSpaces(templateID, "模板 ID 不能为空。")
+
+	// The latest version is returned if the version is not specified
+	version := 0
+	if versionStr := strings.TrimSpace(ctx.Query("version")); versionStr != "" {
+		if v, err := strconv.Atoi(versionStr); err != nil || v <= 0 {
+			*pel = append(*pel, "模板版本应为正整数。")
+		} else {
+			version = v
+		}
+	}
+
+	// Early return if the error list is not empty
+	if len(*pel) > 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
+	template, err := c.PolicySvc.GetPolicyTemplate(templateID, version)
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		ctx.JSON(http.StatusOK, template)
+	} else if errors.Cause(err) == errorcode.ErrorNotFound {
+		ctx.Writer.WriteHeader(http.StatusNotFound)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		ctx.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		ctx.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (c *PolicyController) handleListPolicyTemplates(ctx *gin.Context) {
+	templates, err := c.PolicySvc.ListPolicyTemplates()
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		ctx.JSON(http.StatusOK, templates)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		ctx.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		ctx.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (c *PolicyController) handlePutOrgUnit(ctx *gin.Context) {
+	// Extract and check parameters
+	pel := &ParameterErrorList{}
+
+	deptName := ctx.PostForm("deptName")
+	deptName = pel.AppendIfEmptyOrBlankSpaces(deptName, "部门名称不能为空。")
+
+	// An empty super department name makes the department a root
+	superDeptName := strings.TrimSpace(ctx.PostForm("superDeptName"))
+
+	// Early return if the error list is not empty
+	if len(*pel) > 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
+	orgUnit := &identity.OrgUnit{
+		DeptName:      deptName,
+		SuperDeptName: superDeptName,
+	}
+	txID, err := c.PolicySvc.PutOrgUnit(orgUnit)
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		info := TransactionIDInfo{
+			TransactionID: txID,
+		}
+		ctx.JSON(http.StatusOK, info)
+	} else if reflect.TypeOf(err) == reflect.TypeOf(&service.ErrorBadRequest{}) {
+		*pel = append(*pel, err.Error())
+		ctx.JSON(http.StatusBadRequest, pel)
+	} else if errors.Cause(err) == errorcode.ErrorForbidden {
+		writeForbidden(ctx, err)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		ctx.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		ctx.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (c *PolicyController) handleRemoveOrgUnit(ctx *gin.Context) {
+	// Extract and check parameters
+	pel := &ParameterErrorList{}
+
+	deptName := ctx.Param("name")
+	deptName = pel.AppendIfEmptyOrBlankSpaces(deptName, "部门名称不能为空。")
+
+	// Early return if the error list is not empty
+	if len(*pel) > 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, pel)
+		return
+	}
+
+	txID, err := c.PolicySvc.RemoveOrgUnit(deptName)
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		info := TransactionIDInfo{
+			TransactionID: txID,
+		}
+		ctx.JSON(http.StatusOK, info)
+	} else if errors.Cause(err) == errorcode.ErrorForbidden {
+		writeForbidden(ctx, err)
+	} else if errors.Cause(err) == errorcode.ErrorNotFound {
+		ctx.Writer.WriteHeader(http.StatusNotFound)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		ctx.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		ctx.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (c *PolicyController) handleListOrgUnits(ctx *gin.Context) {
+	orgUnits, err := c.PolicySvc.ListOrgUnits()
+
+	// Check error type and generate the corresponding response
+	if err == nil {
+		ctx.JSON(http.StatusOK, orgUnits)
+	} else if errors.Cause(err) == errorcode.ErrorNotImplemented {
+		ctx.Writer.WriteHeader(http.StatusNotImplemented)
+	} else {
+		ctx.String(http.StatusInternalServerError, err.Error())
+	}
+}
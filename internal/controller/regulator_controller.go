@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/background"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"github.com/gin-gonic/gin"
+)
+
+// A RegulatorController contains a group name, the backfill job of this instance and the token its callers must present. It also implements the interface `Controller`.
+type RegulatorController struct {
+	GroupName   string
+	BackfillJob *background.RegulatorBackfillJob
+	Token       string // The bearer token the callers must present. Every caller is refused if it's empty.
+}
+
+// GetGroupName returns the group name.
+func (rc *RegulatorController) GetGroupName() string {
+	return rc.GroupName
+}
+
+// GetEndpointMap implements part of the interface `Controller`. It returns the API endpoints and handlers which are defined and managed by RegulatorController.
+func (rc *RegulatorController) GetEndpointMap() EndpointMap {
+	return EndpointMap{
+		urlMethodPair{"backfill", "GET"}:    []gin.HandlerFunc{rc.authorize, rc.handleGetBackfillProgress},
+		urlMethodPair{"backfill", "POST"}:   []gin.HandlerFunc{rc.authorize, rc.handleStartBackfill},
+		urlMethodPair{"backfill", "DELETE"}: []gin.HandlerFunc{rc.authorize, rc.handleStopBackfill},
+	}
+}
+
+// authorize lets the request through only if it carries the configured token as "Authorization: Bearer <token>".
+func (rc *RegulatorController) authorize(c *gin.Context) {
+	header := c.GetHeader("Authorization")
+	token := strings.TrimPrefix(header, "Bearer ")
+	if rc.Token == "" || token == header || subtle.ConstantTimeCompare([]byte(token), []byte(rc.Token)) != 1 {
+		writeForbidden(c, errorcode.ErrorForbidden)
+		c.Abort()
+		return
+	}
+
+	c.Next()
+}
+
+func (rc *RegulatorController) handleStartBackfill(c *gin.Context) {
+	pel := &ParameterErrorList{}
+
+	err := rc.BackfillJob.Start()
+
+	// The job runs in the background so its progress is returned right away.
+	if err == nil {
+		c.JSON(http.StatusAccepted, rc.BackfillJob.Progress())
+	} else {
+		*pel = append(*pel, err.Error())
+		c.JSON(http.StatusBadRequest, pel)
+	}
+}
+
+func (rc *RegulatorController) handleGetBackfillProgress(c *gin.Context) {
+	c.JSON(http.StatusOK, rc.BackfillJob.Progress())
+}
+
+func (rc *RegulatorController) handleStopBackfill(c *gin.Context) {
+	// Wait for the tasks in progress to end for no more than 10 seconds
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := rc.BackfillJob.Stop(ctx); err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, rc.BackfillJob.Progress())
+}
@@ -1,8 +1,60 @@
 package controller
 
-import "strings"
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/service"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/accesspolicy"
+	"github.com/gin-gonic/gin"
+)
 
 // "+" sign in URL should be kept unchanged (instead of being changed into a " ") for Base64 encoded strings.
 func processBase64FromURLQuery(parameterValue string) string {
 	return strings.ReplaceAll(parameterValue, " ", "+")
 }
+
+// extractResourcePolicy extracts the access policy of a non-plain resource from the form.
+// Either a literal policy (`policy`) or a policy template (`policyTemplateID` with an optional `policyTemplateVersion`) should be specified.
+// The template reference returned is nil if a literal policy is specified.
+func extractResourcePolicy(ctx *gin.Context, pel *ParameterErrorList) (string, *accesspolicy.PolicyTemplateReference) {
+	policy := ctx.PostForm("policy")
+	templateID := strings.TrimSpace(ctx.PostForm("policyTemplateID"))
+
+	if templateID == "" {
+		if len(policy) == 0 {
+			*pel = append(*pel, "策略不能为空。")
+		} else {
+			policy = pel.AppendIfInvalidPolicy(policy, "策略不合法：")
+		}
+
+		return policy, nil
+	}
+
+	if len(policy) != 0 {
+		*pel = append(*pel, "不能同时指定策略与策略模板。")
+	}
+
+	// The latest version of the template is referred to if the version is not specified
+	ref := &accesspolicy.PolicyTemplateReference{TemplateID: templateID}
+	if versionStr := strings.TrimSpace(ctx.PostForm("policyTemplateVersion")); versionStr != "" {
+		if version, err := strconv.Atoi(versionStr); err != nil || version <= 0 {
+			*pel = append(*pel, "策略模板版本应为正整数。")
+		} else {
+			ref.Version = version
+		}
+	}
+
+	return policy, ref
+}
+
+// writeForbidden writes a 403 response. The reason of the denial is written as the JSON body if the error carries one.
+func writeForbidden(ctx *gin.Context, err error) {
+	if errWithReason, ok := err.(*service.ErrorForbiddenWithReason); ok && errWithReason.Reason != nil {
+		ctx.JSON(http.StatusForbidden, errWithReason.Reason)
+		return
+	}
+
+	ctx.Writer.WriteHeader(http.StatusForbidden)
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/models/sqlmodel"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetBackgroundServerCheckpointFromLocalDB 从指定的数据库中获取后台服务器已处理到的区块号。若不存在则返回 `errorcode.ErrorNotFound`。
+func GetBackgroundServerCheckpointFromLocalDB(name string, db *gorm.DB) (uint64, error) {
+	var checkpoint sqlmodel.BackgroundServerCheckpoint
+	dbResult := db.Where("name = ?", name).Take(&checkpoint)
+	if dbResult.Error != nil {
+		if errors.Cause(dbResult.Error) == gorm.ErrRecordNotFound {
+			return 0, errorcode.ErrorNotFound
+		} else {
+			return 0, errors.Wrap(dbResult.Error, "无法从数据库中获取检查点")
+		}
+	}
+
+	return checkpoint.BlockNumber, nil
+}
+
+// SaveBackgroundServerCheckpointToLocalDB 将后台服务器已处理到的区块号保存到指定的数据库中（若已存在则覆盖）。
+func SaveBackgroundServerCheckpointToLocalDB(name string, blockNumber uint64, db *gorm.DB) error {
+	checkpoint := &sqlmodel.BackgroundServerCheckpoint{
+		Name:        name,
+		BlockNumber: blockNumber,
+	}
+
+	dbResult := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		UpdateAll: true,
+	}).Create(checkpoint)
+	if dbResult.Error != nil {
+		return errors.Wrap(dbResult.Error, "无法将检查点存入数据库")
+	}
+
+	return nil
+}
+
+// GetBackfillCheckpointFromLocalDB 从指定的数据库中获取补处理任务已处理完毕的最后一个资源 ID。若不存在则返回 `errorcode.ErrorNotFound`。
+func GetBackfillCheckpointFromLocalDB(name string, db *gorm.DB) (string, error) {
+	var checkpoint sqlmodel.BackfillCheckpoint
+	dbResult := db.Where("name = ?", name).Take(&checkpoint)
+	if dbResult.Error != nil {
+		if errors.Cause(dbResult.Error) == gorm.ErrRecordNotFound {
+			return "", errorcode.ErrorNotFound
+		} else {
+			return "", errors.Wrap(dbResult.Error, "无法从数据库中获取检查点")
+		}
+	}
+
+	return checkpoint.LastResourceID, nil
+}
+
+// SaveBackfillCheckpointToLocalDB 将补处理任务已处理完毕的最后一个资源 ID 保存到指定的数据库中（若已存在则覆盖）。
+func SaveBackfillCheckpointToLocalDB(name string, lastResourceID string, db *gorm.DB) error {
+	checkpoint := &sqlmodel.BackfillCheckpoint{
+		Name:           name,
+		LastResourceID: lastResourceID,
+	}
+
+	dbResult := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		UpdateAll: true,
+	}).Create(checkpoint)
+	if dbResult.Error != nil {
+		return errors.Wrap(dbResult.Error, "无法将检查点存入数据库")
+	}
+
+	return nil
+}
@@ -16,6 +16,8 @@ type keySwitchKeys struct {
 	CollectivePublicKey  *sm2.PublicKey  // The collective public key to be used in the key switch process
 	PrivateKey           *sm2.PrivateKey // The private key to be used in the key switch process
 	PublicKey            *sm2.PublicKey  // The public key to be used in the key switch process
+	ShareIndices         map[string]int  // The share indices of the key switch servers in the t-of-n mode. A lookup takes the serialized public key of a server in Base64. Empty means the n-of-n mode. The number of shares required is recorded in each key switch session.
+	CollectiveKeyEpoch   int             // The epoch of the collective key pair. It's raised on each key rotation.
 }
 
 var SDKInstance *fabsdk.FabricSDK
@@ -26,3 +28,4 @@ var EventClientInstances map[string]map[string]map[string]*event.Client     // A
 var LedgerClientInstances map[string]map[string]map[string]*ledger.Client   // A lookup takes `channelID` followed by `orgName` and `username`.
 var KeySwitchKeys keySwitchKeys                                             // The keys to be used in the key switch process
 var ShowTimingLogs bool                                                     // Whehter timers in several modules should be enabled and time consumption logged
+var Version = "dev"                                                         // The version of the app. Set at build time with `-ldflags "-X gitee.com/czyczk/fabric-sdk-tutorial/internal/global.Version=<version>"`.
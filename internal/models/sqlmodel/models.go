@@ -53,6 +53,20 @@ type Component struct {
 	EntityAssetID int64 `gorm:"not null"`
 }
 
+// BackgroundServerCheckpoint 定义了数据库表 background_server_checkpoints，用于记录后台服务器已处理到的区块，以便重启后从该区块起补处理停机期间的事件。
+type BackgroundServerCheckpoint struct {
+	Name        string    `gorm:"type:VARCHAR(255);primaryKey"`
+	BlockNumber uint64    `gorm:"not null"`
+	UpdatedAt   time.Time `gorm:"not null"`
+}
+
+// BackfillCheckpoint 定义了数据库表 backfill_checkpoints，用于记录补处理任务已处理完毕的最后一个资源 ID，以便中断后从该资源之后继续。
+type BackfillCheckpoint struct {
+	Name           string    `gorm:"type:VARCHAR(255);primaryKey"`
+	LastResourceID string    `gorm:"type:VARCHAR(255) NOT NULL"`
+	UpdatedAt      time.Time `gorm:"not null"`
+}
+
 // 自定义 DocumentProperties 的表名。
 func (DocumentProperties) TableName() string {
 	return "document_properties"
@@ -2,16 +2,52 @@ package service
 
 import (
 	"bytes"
+	"fmt"
+	"strings"
 	"time"
 
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/utils/cipherutils"
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/utils/timingutils"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/accesspolicy"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/policy"
 	"github.com/XiaoYao-austin/ppks"
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
 	shell "github.com/ipfs/go-ipfs-api"
 	"github.com/pkg/errors"
 )
 
+// 检查访问策略的语法及其引用的属性。策略不合法时返回 `*ErrorBadRequest`。
+func validatePolicy(policyText string) error {
+	if err := policy.Validate(policyText, policy.SubjectNames); err != nil {
+		return &ErrorBadRequest{
+			errMsg: fmt.Sprintf("访问策略不合法：%v。", err),
+		}
+	}
+
+	return nil
+}
+
+// 检查资源的访问策略。策略与策略模板只能指定其一；指定策略时检查策略本身。不合法时返回 `*ErrorBadRequest`。
+func validateResourcePolicy(policyText string, policyTemplate *accesspolicy.PolicyTemplateReference) error {
+	if policyTemplate == nil {
+		return validatePolicy(policyText)
+	}
+
+	if policyText != "" {
+		return &ErrorBadRequest{
+			errMsg: "不能同时指定访问策略与策略模板。",
+		}
+	}
+
+	if strings.TrimSpace(policyTemplate.TemplateID) == "" {
+		return &ErrorBadRequest{
+			errMsg: "策略模板 ID 不能为空。",
+		}
+	}
+
+	return nil
+}
+
 func encryptDataWithTimer(bytes []byte, key *ppks.CurvePoint, errMsg string, timerMsg string) (encryptedBytes []byte, err error) {
 	defer timingutils.GetDeferrableTimingLogger(timerMsg)()
 
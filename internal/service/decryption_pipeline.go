@@ -0,0 +1,269 @@
+package service
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/global"
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/utils/cipherutils"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/keyswitch"
+	"github.com/XiaoYao-austin/ppks"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/pkg/errors"
+)
+
+// keySwitchDecryptionPipeline 以密钥置换结果解密资源的对称密钥，依次为：获取资源的加密密钥、获取会话的密钥置换结果、验证份额、解密。
+// 登记的密钥置换服务器与各会话的触发器及密钥置换结果只查询一次，解密出的对称密钥按会话与资源只解密一次。一个流水线只服务一批请求，用完即弃，以免缓存过时的结果。
+// 解密成功的对称密钥另存于跨请求共享的缓存中，直至会话过期，使逐个获取资源时也不必重复收集与验证份额。
+type keySwitchDecryptionPipeline struct {
+	serviceInfo       *Info
+	keySwitchService  KeySwitchServiceInterface
+	decryptedKeyCache *keySwitchDecryptedKeyCache // 跨请求共享的解密出的对称密钥。为 nil 时不共享。
+	mu                sync.Mutex                  // 只在读写 calls 时持有，查询链码与解密时不持有
+	calls             map[string]*pipelineCall    // 按步骤与其参数索引的各步骤的结果
+}
+
+// pipelineCall 表示流水线中的一个步骤，如查询某一会话的密钥置换结果。同一步骤只执行一次，并发的调用者等待其结果。失败的结果同样被保留，直至流水线被丢弃。
+type pipelineCall struct {
+	once  sync.Once
+	value interface{}
+	err   error
+}
+
+// 创建一个解密流水线。
+//
+// 参数：
+//   服务信息
+//   密钥置换服务
+//   跨请求共享的解密出的对称密钥的缓存。可为 nil。
+//
+// 返回：
+//   解密流水线
+func newKeySwitchDecryptionPipeline(serviceInfo *Info, keySwitchService KeySwitchServiceInterface, decryptedKeyCache *keySwitchDecryptedKeyCache) *keySwitchDecryptionPipeline {
+	return &keySwitchDecryptionPipeline{
+		serviceInfo:       serviceInfo,
+		keySwitchService:  keySwitchService,
+		decryptedKeyCache: decryptedKeyCache,
+		calls:             map[string]*pipelineCall{},
+	}
+}
+
+// 执行流水线中的一个步骤。同一步骤只执行一次，此后直接返回其结果。
+//
+// 参数：
+//   步骤的键
+//   执行步骤的函数
+//
+// 返回：
+//   步骤的结果
+func (p *keySwitchDecryptionPipeline) do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	p.mu.Lock()
+	call, ok := p.calls[key]
+	if !ok {
+		call = &pipelineCall{}
+		p.calls[key] = call
+	}
+	p.mu.Unlock()
+
+	call.once.Do(func() {
+		call.value, call.err = fn()
+	})
+
+	return call.value, call.err
+}
+
+// 以密钥置换会话的结果解密资源的对称密钥。同一会话中同一资源的密钥只解密一次。
+//
+// 参数：
+//   资源 ID
+//   密钥置换会话 ID
+//
+// 返回：
+//   解密出的对称密钥材料
+func (p *keySwitchDecryptionPipeline) decryptKey(resourceID string, keySwitchSessionID string) (*ppks.CurvePoint, error) {
+	cacheKey := keySwitchSessionID + "_" + resourceID
+	if p.decryptedKeyCache != nil {
+		if decryptedKey, ok := p.decryptedKeyCache.get(cacheKey); ok {
+			return decryptedKey, nil
+		}
+	}
+
+	value, err := p.do("key_"+cacheKey, func() (interface{}, error) {
+		return p.decryptKeyWithSharesCollected(resourceID, keySwitchSessionID, cacheKey)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.(*ppks.CurvePoint), nil
+}
+
+// 收集并验证资源的份额，再解密资源的对称密钥，并将其存入跨请求共享的缓存。
+func (p *keySwitchDecryptionPipeline) decryptKeyWithSharesCollected(resourceID string, keySwitchSessionID string, cacheKey string) (*ppks.CurvePoint, error) {
+	// 调用链码 getKey 获取该资源的加密后的密钥
+	encryptedKey, err := p.getEncryptedKey(resourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	ksResults, err := p.listKeySwitchResults(keySwitchSessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 所需的份额数量以会话的触发器为准
+	ksTrigger, err := p.getKeySwitchSession(keySwitchSessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	numSharesExpected, err := getNumSharesExpected(ksTrigger)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按链上登记的密钥置换服务器收集并验证份额。门限模式下收集到所需数量的通过验证的份额即可。
+	ksServers, err := p.listKeySwitchServers()
+	if err != nil {
+		return nil, err
+	}
+
+	shares, shareIndices, err := collectSharesForResource(resourceID, ksResults, ksServers, numSharesExpected, global.KeySwitchKeys.PublicKey, encryptedKey, p.keySwitchService)
+	if err != nil {
+		return nil, err
+	}
+
+	// 调用 KeySwitchService 中的 GetDecryptedKey 得到解密的对称密钥材料
+	decryptedKey, err := p.keySwitchService.GetDecryptedKey(shares, shareIndices, encryptedKey, global.KeySwitchKeys.PrivateKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "无法解密对称密钥")
+	}
+
+	if p.decryptedKeyCache != nil {
+		p.decryptedKeyCache.put(cacheKey, decryptedKey, ksTrigger.ExpiresAt)
+	}
+
+	return decryptedKey, nil
+}
+
+// 调用链码 getKey 获取资源的加密后的密钥。
+func (p *keySwitchDecryptionPipeline) getEncryptedKey(resourceID string) (*ppks.CipherText, error) {
+	chaincodeFcn := "getKey"
+	channelReq := channel.Request{
+		ChaincodeID: p.serviceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{[]byte(resourceID)},
+	}
+
+	resp, err := p.serviceInfo.ChannelClient.Query(channelReq)
+	if err != nil {
+		return nil, GetClassifiedError(chaincodeFcn, err)
+	}
+
+	return cipherutils.DeserializeCipherText(resp.Payload)
+}
+
+// 获取密钥置换会话的触发器。每个会话只查询一次。
+func (p *keySwitchDecryptionPipeline) getKeySwitchSession(keySwitchSessionID string) (*keyswitch.KeySwitchTriggerStored, error) {
+	value, err := p.do("trigger_"+keySwitchSessionID, func() (interface{}, error) {
+		return p.keySwitchService.GetKeySwitchSession(keySwitchSessionID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.(*keyswitch.KeySwitchTriggerStored), nil
+}
+
+// 获取登记的密钥置换服务器。只查询一次。
+func (p *keySwitchDecryptionPipeline) listKeySwitchServers() ([]keyswitch.KeySwitchServerStored, error) {
+	value, err := p.do("servers", func() (interface{}, error) {
+		return p.keySwitchService.ListKeySwitchServers()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.([]keyswitch.KeySwitchServerStored), nil
+}
+
+// 调用链码 listKeySwitchResultsByID 获取密钥置换会话的结果。每个会话只查询一次。
+func (p *keySwitchDecryptionPipeline) listKeySwitchResults(keySwitchSessionID string) ([]*keyswitch.KeySwitchResultStored, error) {
+	value, err := p.do("results_"+keySwitchSessionID, func() (interface{}, error) {
+		chaincodeFcn := "listKeySwitchResultsByID"
+		channelReq := channel.Request{
+			ChaincodeID: p.serviceInfo.ChaincodeID,
+			Fcn:         chaincodeFcn,
+			Args:        [][]byte{[]byte(keySwitchSessionID)},
+		}
+
+		resp, err := p.serviceInfo.ChannelClient.Query(channelReq)
+		if err != nil {
+			return nil, GetClassifiedError(chaincodeFcn, err)
+		}
+
+		var ksResults []*keyswitch.KeySwitchResultStored
+		if err = json.Unmarshal(resp.Payload, &ksResults); err != nil {
+			return nil, errors.Wrap(err, "无法解析密钥置换结果列表")
+		}
+
+		return ksResults, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.([]*keyswitch.KeySwitchResultStored), nil
+}
+
+// keySwitchDecryptedKeyCache 在请求之间保存解密出的对称密钥，按密钥置换会话 ID 与资源 ID 索引。只保存解密成功的结果，保存至会话过期为止。
+type keySwitchDecryptedKeyCache struct {
+	mu   sync.Mutex
+	keys map[string]*cachedDecryptedKey
+	now  func() time.Time
+}
+
+// cachedDecryptedKey 表示一个缓存的解密出的对称密钥
+type cachedDecryptedKey struct {
+	key       *ppks.CurvePoint
+	expiresAt time.Time
+}
+
+// 创建一个解密出的对称密钥的缓存。
+func newKeySwitchDecryptedKeyCache() *keySwitchDecryptedKeyCache {
+	return &keySwitchDecryptedKeyCache{
+		keys: map[string]*cachedDecryptedKey{},
+		now:  time.Now,
+	}
+}
+
+// 取出未过期的对称密钥。
+func (c *keySwitchDecryptedKeyCache) get(cacheKey string) (*ppks.CurvePoint, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.keys[cacheKey]
+	if !ok || !c.now().Before(cached.expiresAt) {
+		return nil, false
+	}
+
+	return cached.key, true
+}
+
+// 保存对称密钥直至会话过期，并移除已过期的对称密钥。已过期的会话（包括未设置过期时间的会话）的对称密钥不保存。
+func (c *keySwitchDecryptedKeyCache) put(cacheKey string, key *ppks.CurvePoint, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for k, cached := range c.keys {
+		if !now.Before(cached.expiresAt) {
+			delete(c.keys, k)
+		}
+	}
+
+	if now.Before(expiresAt) {
+		c.keys[cacheKey] = &cachedDecryptedKey{key: key, expiresAt: expiresAt}
+	}
+}
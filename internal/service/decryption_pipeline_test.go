@@ -0,0 +1,93 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/XiaoYao-austin/ppks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeySwitchDecryptionPipelineDo(t *testing.T) {
+	pipeline := newKeySwitchDecryptionPipeline(nil, nil, nil)
+
+	// 同一步骤并发调用时只执行一次
+	var numCalls int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	values := make([]interface{}, 8)
+	for i := range values {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			values[i], _ = pipeline.do("results_session1", func() (interface{}, error) {
+				atomic.AddInt32(&numCalls, 1)
+				<-release
+				return "results", nil
+			})
+		}(i)
+	}
+
+	// 执行中的步骤不阻塞其他步骤。步骤中还可以执行其他步骤。
+	value, err := pipeline.do("trigger_session1", func() (interface{}, error) {
+		return pipeline.do("servers", func() (interface{}, error) {
+			return "servers", nil
+		})
+	})
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	assert.Equal(t, "servers", value)
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), numCalls)
+	for _, value := range values {
+		assert.Equal(t, "results", value)
+	}
+
+	// 失败的结果同样被保留
+	numCalls = 0
+	for i := 0; i < 2; i++ {
+		_, err = pipeline.do("key_session1_101", func() (interface{}, error) {
+			atomic.AddInt32(&numCalls, 1)
+			return nil, fmt.Errorf("份额数量不足")
+		})
+		assert.EqualError(t, err, "份额数量不足")
+	}
+	assert.Equal(t, int32(1), numCalls)
+}
+
+func TestKeySwitchDecryptedKeyCache(t *testing.T) {
+	now := time.Now()
+	cache := newKeySwitchDecryptedKeyCache()
+	cache.now = func() time.Time { return now }
+
+	key := ppks.GenPoint()
+	cache.put("session1_101", key, now.Add(time.Minute))
+	cachedKey, ok := cache.get("session1_101")
+	assert.True(t, ok)
+	assert.Same(t, key, cachedKey)
+
+	_, ok = cache.get("session2_101")
+	assert.False(t, ok)
+
+	// 已过期的会话的对称密钥不保存
+	cache.put("session2_101", key, now)
+	_, ok = cache.get("session2_101")
+	assert.False(t, ok)
+	cache.put("session3_101", key, time.Time{})
+	_, ok = cache.get("session3_101")
+	assert.False(t, ok)
+
+	// 会话过期后对称密钥不再取出，并在下次保存时被移除
+	now = now.Add(time.Minute)
+	_, ok = cache.get("session1_101")
+	assert.False(t, ok)
+
+	cache.put("session4_101", key, now.Add(time.Minute))
+	assert.Equal(t, 1, len(cache.keys))
+}
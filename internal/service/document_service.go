@@ -9,14 +9,15 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/db"
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/global"
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/models/common"
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/utils/cipherutils"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/accesspolicy"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/data"
-	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/keyswitch"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/query"
 	"github.com/XiaoYao-austin/ppks"
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
@@ -28,8 +29,10 @@ import (
 
 // DocumentService 用于管理数字文档。
 type DocumentService struct {
-	ServiceInfo      *Info
-	KeySwitchService KeySwitchServiceInterface
+	ServiceInfo           *Info
+	KeySwitchService      KeySwitchServiceInterface
+	decryptedKeyCache     *keySwitchDecryptedKeyCache
+	decryptedKeyCacheOnce sync.Once
 }
 
 // 用于放置在元数据的 extensions.dataType 中的值
@@ -110,11 +113,12 @@ func (s *DocumentService) CreateDocument(document *common.Document) (string, err
 // 参数：
 //   数字文档
 //   对称密钥（SM2 曲线上的点）
-//   访问策略
+//   访问策略。引用策略模板时为空。
+//   引用的策略模板。不引用时为 nil。
 //
 // 返回：
 //   交易 ID
-func (s *DocumentService) CreateEncryptedDocument(document *common.Document, key *ppks.CurvePoint, policy string) (string, error) {
+func (s *DocumentService) CreateEncryptedDocument(document *common.Document, key *ppks.CurvePoint, policy string, policyTemplate *accesspolicy.PolicyTemplateReference) (string, error) {
 	if document == nil {
 		return "", fmt.Errorf("文档对象不能为 nil")
 	}
@@ -123,6 +127,11 @@ func (s *DocumentService) CreateEncryptedDocument(document *common.Document, key
 		return "", fmt.Errorf("文档 ID 不能为空")
 	}
 
+	// 在开始加密前检查访问策略，以免不合法的策略到链码层才被发现
+	if err := validateResourcePolicy(policy, policyTemplate); err != nil {
+		return "", err
+	}
+
 	documentBytes, err := json.Marshal(document)
 	if err != nil {
 		return "", errors.Wrap(err, "无法序列化文档")
@@ -179,10 +188,12 @@ func (s *DocumentService) CreateEncryptedDocument(document *common.Document, key
 
 	// 组装要传入链码的参数，其中密文本体和对称密钥的密文转换为 Base64 编码
 	encryptedData := data.EncryptedData{
-		Metadata: metadata,
-		Data:     base64.StdEncoding.EncodeToString(encryptedDocumentBytes),
-		Key:      base64.StdEncoding.EncodeToString(encryptedKeyBytes),
-		Policy:   policy,
+		Metadata:       metadata,
+		Data:           base64.StdEncoding.EncodeToString(encryptedDocumentBytes),
+		Key:            base64.StdEncoding.EncodeToString(encryptedKeyBytes),
+		Policy:         policy,
+		PolicyTemplate: policyTemplate,
+		KeyEpoch:       global.KeySwitchKeys.CollectiveKeyEpoch,
 	}
 	encryptedDataBytes, err := json.Marshal(encryptedData)
 	if err != nil {
@@ -211,11 +222,12 @@ func (s *DocumentService) CreateEncryptedDocument(document *common.Document, key
 // 参数：
 //   数字文档
 //   对称密钥（SM2 曲线上的点）
-//   访问策略
+//   访问策略。引用策略模板时为空。
+//   引用的策略模板。不引用时为 nil。
 //
 // 返回：
 //   交易 ID
-func (s *DocumentService) CreateOffchainDocument(document *common.Document, key *ppks.CurvePoint, policy string) (string, error) {
+func (s *DocumentService) CreateOffchainDocument(document *common.Document, key *ppks.CurvePoint, policy string, policyTemplate *accesspolicy.PolicyTemplateReference) (string, error) {
 	if document == nil {
 		return "", fmt.Errorf("文档对象不能为 nil")
 	}
@@ -225,6 +237,11 @@ func (s *DocumentService) CreateOffchainDocument(document *common.Document, key
 		return "", fmt.Errorf("文档 ID 不能为空")
 	}
 
+	// 在开始加密前检查访问策略，以免不合法的策略到链码层才被发现
+	if err := validateResourcePolicy(policy, policyTemplate); err != nil {
+		return "", err
+	}
+
 	documentPropertiesBytes, err := json.Marshal(document.DocumentProperties)
 	if err != nil {
 		return "", errors.Wrap(err, "无法序列化文档属性")
@@ -294,10 +311,12 @@ func (s *DocumentService) CreateOffchainDocument(document *common.Document, key
 
 	// 在传给链码的参数中传入 IPFS CID
 	offchainData := data.OffchainData{
-		Metadata: metadata,
-		CID:      cid,
-		Key:      base64.StdEncoding.EncodeToString(encryptedKeyBytes),
-		Policy:   policy,
+		Metadata:       metadata,
+		CID:            cid,
+		Key:            base64.StdEncoding.EncodeToString(encryptedKeyBytes),
+		Policy:         policy,
+		PolicyTemplate: policyTemplate,
+		KeyEpoch:       global.KeySwitchKeys.CollectiveKeyEpoch,
 	}
 	offchainDataBytes, err := json.Marshal(offchainData)
 	if err != nil {
@@ -380,12 +399,16 @@ func (s *DocumentService) GetDocument(id string, metadata *data.ResMetadataStore
 // 参数：
 //   文档 ID
 //   密钥置换会话 ID
-//   预期的份额数量
 //   文档元数据
 //
 // 返回：
 //   解密后的文档
-func (s *DocumentService) GetEncryptedDocument(id string, keySwitchSessionID string, numSharesExpected int, metadata *data.ResMetadataStored) (*common.Document, error) {
+func (s *DocumentService) GetEncryptedDocument(id string, keySwitchSessionID string, metadata *data.ResMetadataStored) (*common.Document, error) {
+	return s.getEncryptedDocument(id, keySwitchSessionID, metadata, s.newDecryptionPipeline())
+}
+
+// 同 `GetEncryptedDocument()`，但以给定的解密流水线解密对称密钥。批量获取时各资源共用同一流水线。
+func (s *DocumentService) getEncryptedDocument(id string, keySwitchSessionID string, metadata *data.ResMetadataStored, pipeline *keySwitchDecryptionPipeline) (*common.Document, error) {
 	// 检查元数据中该资源类型是否为密文资源
 	if metadata.ResourceType != data.Encrypted {
 		return nil, &ErrorBadRequest{
@@ -409,69 +432,18 @@ func (s *DocumentService) GetEncryptedDocument(id string, keySwitchSessionID str
 
 	encryptedDocumentBytes := resp.Payload
 
-	// 调用链码 getKey 获取该资源的加密后的密钥
-	chaincodeFcn = "getKey"
-	channelReq = channel.Request{
-		ChaincodeID: s.ServiceInfo.ChaincodeID,
-		Fcn:         chaincodeFcn,
-		Args:        [][]byte{[]byte(id)},
-	}
-
-	resp, err = s.ServiceInfo.ChannelClient.Query(channelReq)
-	err = GetClassifiedError(chaincodeFcn, err)
-	if err != nil {
-		return nil, err
-	}
-
-	// 解析加密后的密钥材料
-	encryptedKeyBytes := resp.Payload
-	encryptedKeyAsCipherText, err := cipherutils.DeserializeCipherText(encryptedKeyBytes)
-	if err != nil {
-		return nil, err
-	}
-
 	// 检查加密的内容的大小和哈希是否匹配
 	err = checkSizeAndHashForEncryptedData(encryptedDocumentBytes, metadata).toError(metadata.ResourceType)
 	if err != nil {
 		return nil, err
 	}
 
-	// 调用链码 listKeySwitchResultsByID 看是否有 numSharesExpected 份。若不足则报错。
-	chaincodeFcn = "listKeySwitchResultsByID"
-	channelReq = channel.Request{
-		ChaincodeID: s.ServiceInfo.ChaincodeID,
-		Fcn:         chaincodeFcn,
-		Args:        [][]byte{[]byte(keySwitchSessionID)},
-	}
-
-	resp, err = s.ServiceInfo.ChannelClient.Query(channelReq)
-	err = GetClassifiedError(chaincodeFcn, err)
+	// 以密钥置换结果解密该资源的对称密钥材料
+	decryptedKey, err := pipeline.decryptKey(id, keySwitchSessionID)
 	if err != nil {
 		return nil, err
 	}
 
-	var ksResults []*keyswitch.KeySwitchResultStored
-	err = json.Unmarshal(resp.Payload, &ksResults)
-	if err != nil {
-		return nil, errors.Wrap(err, "无法解析密钥置换结果列表")
-	}
-
-	if len(ksResults) != numSharesExpected {
-		return nil, fmt.Errorf("密钥置换结果只有 %v 份，不足 %v 份", len(ksResults), numSharesExpected)
-	}
-
-	// 解析并验证份额
-	shares, err := parseAndVerifySharesFromKeySwitchResults(ksResults, global.KeySwitchKeys.PublicKey, encryptedKeyAsCipherText, s.KeySwitchService)
-	if err != nil {
-		return nil, err
-	}
-
-	// 调用 KeySwitchService 中的 GetDecryptedKey 得到解密的对称密钥材料
-	decryptedKey, err := s.KeySwitchService.GetDecryptedKey(shares, encryptedKeyAsCipherText, global.KeySwitchKeys.PrivateKey)
-	if err != nil {
-		return nil, errors.Wrap(err, "无法解密对称密钥")
-	}
-
 	// 用对称密钥解密 encryptedDocumentBytes
 	documentBytes, err := cipherutils.DecryptBytesUsingAESKey(encryptedDocumentBytes, cipherutils.DeriveSymmetricKeyBytesFromCurvePoint(decryptedKey))
 	if err != nil {
@@ -500,17 +472,63 @@ func (s *DocumentService) GetEncryptedDocument(id string, keySwitchSessionID str
 	return &document, nil
 }
 
+// 批量获取加密或链下加密数字文档。文档须均在同一个多资源的密钥置换会话中。函数逐个获取元数据，并按资源类型解密。
+//
+// 参数：
+//   文档 ID 列表
+//   密钥置换会话 ID
+//
+// 返回：
+//   解密后的文档列表（与文档 ID 列表的顺序一致）
+func (s *DocumentService) GetEncryptedDocuments(ids []string, keySwitchSessionID string) ([]*common.Document, error) {
+	if len(ids) == 0 {
+		return nil, &ErrorBadRequest{errMsg: "文档 ID 列表不能为空。"}
+	}
+
+	// 同一会话的密钥置换结果与登记的密钥置换服务器在整批中只查询一次
+	pipeline := s.newDecryptionPipeline()
+
+	var documents []*common.Document
+	for _, id := range ids {
+		metadata, err := s.GetDocumentMetadata(id)
+		if err != nil {
+			return nil, errors.Wrapf(err, "无法获取文档 '%v' 的元数据", id)
+		}
+
+		var document *common.Document
+		switch metadata.ResourceType {
+		case data.Encrypted:
+			document, err = s.getEncryptedDocument(id, keySwitchSessionID, metadata, pipeline)
+		case data.Offchain:
+			document, err = s.getOffchainDocument(id, keySwitchSessionID, metadata, pipeline)
+		default:
+			return nil, &ErrorBadRequest{errMsg: fmt.Sprintf("文档 '%v' 不是加密资源。", id)}
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "无法获取文档 '%v'", id)
+		}
+
+		documents = append(documents, document)
+	}
+
+	return documents, nil
+}
+
 // 获取链下加密数字文档。提供密钥置换会话，函数将从 IPFS 网络获得密文，使用密钥置换结果尝试进行解密后，返回明文。调用前应先获取元数据。
 //
 // 参数：
 //   文档 ID
 //   密钥置换会话 ID
-//   预期的份额数量
 //   文档元数据
 //
 // 返回：
 //   解密后的文档
-func (s *DocumentService) GetOffchainDocument(id string, keySwitchSessionID string, numSharesExpected int, metadata *data.ResMetadataStored) (*common.Document, error) {
+func (s *DocumentService) GetOffchainDocument(id string, keySwitchSessionID string, metadata *data.ResMetadataStored) (*common.Document, error) {
+	return s.getOffchainDocument(id, keySwitchSessionID, metadata, s.newDecryptionPipeline())
+}
+
+// 同 `GetOffchainDocument()`，但以给定的解密流水线解密对称密钥。批量获取时各资源共用同一流水线。
+func (s *DocumentService) getOffchainDocument(id string, keySwitchSessionID string, metadata *data.ResMetadataStored, pipeline *keySwitchDecryptionPipeline) (*common.Document, error) {
 	// 检查元数据中该资源类型是否为链下加密资源
 	if metadata.ResourceType != data.Offchain {
 		return nil, &ErrorBadRequest{
@@ -551,63 +569,12 @@ func (s *DocumentService) GetOffchainDocument(id string, keySwitchSessionID stri
 		return nil, errors.Wrap(err, "无法从 IPFS 网络获取数字文档")
 	}
 
-	// 调用链码 getKey 获取该资源的加密后的密钥
-	chaincodeFcn = "getKey"
-	channelReq = channel.Request{
-		ChaincodeID: s.ServiceInfo.ChaincodeID,
-		Fcn:         chaincodeFcn,
-		Args:        [][]byte{[]byte(id)},
-	}
-
-	resp, err = s.ServiceInfo.ChannelClient.Query(channelReq)
-	err = GetClassifiedError(chaincodeFcn, err)
-	if err != nil {
-		return nil, err
-	}
-
-	// 解析加密后的密钥材料
-	encryptedKeyBytes := resp.Payload
-	encryptedKeyAsCipherText, err := cipherutils.DeserializeCipherText(encryptedKeyBytes)
-	if err != nil {
-		return nil, err
-	}
-
-	// 调用链码 listKeySwitchResultsByID 看是否有 numSharesExpected 份。若不足则报错。
-	chaincodeFcn = "listKeySwitchResultsByID"
-	channelReq = channel.Request{
-		ChaincodeID: s.ServiceInfo.ChaincodeID,
-		Fcn:         chaincodeFcn,
-		Args:        [][]byte{[]byte(keySwitchSessionID)},
-	}
-
-	resp, err = s.ServiceInfo.ChannelClient.Query(channelReq)
-	err = GetClassifiedError(chaincodeFcn, err)
-	if err != nil {
-		return nil, err
-	}
-
-	var ksResults []*keyswitch.KeySwitchResultStored
-	err = json.Unmarshal(resp.Payload, &ksResults)
-	if err != nil {
-		return nil, errors.Wrap(err, "无法解析密钥置换结果列表")
-	}
-
-	if len(ksResults) != numSharesExpected {
-		return nil, fmt.Errorf("密钥置换结果只有 %v 份，不足 %v 份", len(ksResults), numSharesExpected)
-	}
-
-	// 解析并验证份额
-	shares, err := parseAndVerifySharesFromKeySwitchResults(ksResults, global.KeySwitchKeys.PublicKey, encryptedKeyAsCipherText, s.KeySwitchService)
+	// 以密钥置换结果解密该资源的对称密钥材料
+	decryptedKey, err := pipeline.decryptKey(id, keySwitchSessionID)
 	if err != nil {
 		return nil, err
 	}
 
-	// 调用 KeySwitchService 中的 GetDecryptedKey 得到解密的对称密钥材料
-	decryptedKey, err := s.KeySwitchService.GetDecryptedKey(shares, encryptedKeyAsCipherText, global.KeySwitchKeys.PrivateKey)
-	if err != nil {
-		return nil, errors.Wrap(err, "无法解密对称密钥")
-	}
-
 	// 用对称密钥解密 encryptedDocumentBytes
 	documentBytes, err := cipherutils.DecryptBytesUsingAESKey(encryptedDocumentBytes, cipherutils.DeriveSymmetricKeyBytesFromCurvePoint(decryptedKey))
 	if err != nil {
@@ -641,12 +608,16 @@ func (s *DocumentService) GetOffchainDocument(id string, keySwitchSessionID stri
 // 参数：
 //   文档 ID
 //   密钥置换会话 ID
-//   预期的份额数量
 //   文档元数据
 //
 // 返回：
 //   解密后的文档属性
-func (s *DocumentService) GetEncryptedDocumentProperties(id string, keySwitchSessionID string, numSharesExpected int, metadata *data.ResMetadataStored) (*common.DocumentProperties, error) {
+func (s *DocumentService) GetEncryptedDocumentProperties(id string, keySwitchSessionID string, metadata *data.ResMetadataStored) (*common.DocumentProperties, error) {
+	return s.getEncryptedDocumentProperties(id, keySwitchSessionID, metadata, s.newDecryptionPipeline())
+}
+
+// 同 `GetEncryptedDocumentProperties()`，但以给定的解密流水线解密对称密钥。批量获取时各资源共用同一流水线。
+func (s *DocumentService) getEncryptedDocumentProperties(id string, keySwitchSessionID string, metadata *data.ResMetadataStored, pipeline *keySwitchDecryptionPipeline) (*common.DocumentProperties, error) {
 	// 检查该文档是否为 Encrypted 或 Offchain 资源
 	if metadata.ResourceType != data.Encrypted && metadata.ResourceType != data.Offchain {
 		return nil, &ErrorBadRequest{
@@ -654,63 +625,12 @@ func (s *DocumentService) GetEncryptedDocumentProperties(id string, keySwitchSes
 		}
 	}
 
-	// 调用链码 getKey 获取该资源的加密后的密钥
-	chaincodeFcn := "getKey"
-	channelReq := channel.Request{
-		ChaincodeID: s.ServiceInfo.ChaincodeID,
-		Fcn:         chaincodeFcn,
-		Args:        [][]byte{[]byte(id)},
-	}
-
-	resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
-	err = GetClassifiedError(chaincodeFcn, err)
-	if err != nil {
-		return nil, err
-	}
-
-	// 解析加密后的密钥材料
-	encryptedKeyBytes := resp.Payload
-	encryptedKeyAsCipherText, err := cipherutils.DeserializeCipherText(encryptedKeyBytes)
-	if err != nil {
-		return nil, err
-	}
-
-	// 调用链码 listKeySwitchResultsByID 看是否有 numSharesExpected 份。若不足则报错。
-	chaincodeFcn = "listKeySwitchResultsByID"
-	channelReq = channel.Request{
-		ChaincodeID: s.ServiceInfo.ChaincodeID,
-		Fcn:         chaincodeFcn,
-		Args:        [][]byte{[]byte(keySwitchSessionID)},
-	}
-
-	resp, err = s.ServiceInfo.ChannelClient.Query(channelReq)
-	err = GetClassifiedError(chaincodeFcn, err)
-	if err != nil {
-		return nil, err
-	}
-
-	var ksResults []*keyswitch.KeySwitchResultStored
-	err = json.Unmarshal(resp.Payload, &ksResults)
-	if err != nil {
-		return nil, errors.Wrap(err, "无法解析密钥置换结果列表")
-	}
-
-	if len(ksResults) != numSharesExpected {
-		return nil, fmt.Errorf("密钥置换结果只有 %v 份，不足 %v 份", len(ksResults), numSharesExpected)
-	}
-
-	// 解析并验证份额
-	shares, err := parseAndVerifySharesFromKeySwitchResults(ksResults, global.KeySwitchKeys.PublicKey, encryptedKeyAsCipherText, s.KeySwitchService)
+	// 以密钥置换结果解密该资源的对称密钥材料
+	decryptedKey, err := pipeline.decryptKey(id, keySwitchSessionID)
 	if err != nil {
 		return nil, err
 	}
 
-	// 调用 KeySwitchService 中的 GetDecryptedKey 得到解密的对称密钥材料
-	decryptedKey, err := s.KeySwitchService.GetDecryptedKey(shares, encryptedKeyAsCipherText, global.KeySwitchKeys.PrivateKey)
-	if err != nil {
-		return nil, errors.Wrap(err, "无法解密对称密钥")
-	}
-
 	// 获取文档的加密属性部分
 	encryptedDocumentPropertiesBytes, err := base64.StdEncoding.DecodeString(metadata.Extensions["encrypted"].(string))
 	if err != nil {
@@ -995,3 +915,12 @@ func deriveExtensionsMapFromDocumentProperties(publicProperties *common.Document
 
 	return extensions
 }
+
+// 创建一个解密流水线。各流水线共用本服务的解密出的对称密钥的缓存，该缓存在首次调用时创建。
+func (s *DocumentService) newDecryptionPipeline() *keySwitchDecryptionPipeline {
+	s.decryptedKeyCacheOnce.Do(func() {
+		s.decryptedKeyCache = newKeySwitchDecryptedKeyCache()
+	})
+
+	return newKeySwitchDecryptionPipeline(s.ServiceInfo, s.KeySwitchService, s.decryptedKeyCache)
+}
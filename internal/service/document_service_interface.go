@@ -2,6 +2,7 @@ package service
 
 import (
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/models/common"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/accesspolicy"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/data"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/query"
 	"github.com/XiaoYao-austin/ppks"
@@ -23,22 +24,24 @@ type DocumentServiceInterface interface {
 	// 参数：
 	//   数字文档
 	//   对称密钥（SM2 曲线上的点）
-	//   访问策略
+	//   访问策略。引用策略模板时为空。
+	//   引用的策略模板。不引用时为 nil。
 	//
 	// 返回：
 	//   交易 ID
-	CreateEncryptedDocument(document *common.Document, key *ppks.CurvePoint, policy string) (string, error)
+	CreateEncryptedDocument(document *common.Document, key *ppks.CurvePoint, policy string, policyTemplate *accesspolicy.PolicyTemplateReference) (string, error)
 
 	// 创建链下加密数字文档
 	//
 	// 参数：
 	//   数字文档
 	//   对称密钥（SM2 曲线上的点）
-	//   访问策略
+	//   访问策略。引用策略模板时为空。
+	//   引用的策略模板。不引用时为 nil。
 	//
 	// 返回：
 	//   交易 ID
-	CreateOffchainDocument(document *common.Document, key *ppks.CurvePoint, policy string) (string, error)
+	CreateOffchainDocument(document *common.Document, key *ppks.CurvePoint, policy string, policyTemplate *accesspolicy.PolicyTemplateReference) (string, error)
 
 	// 获取数字文档的元数据
 	//
@@ -64,36 +67,43 @@ type DocumentServiceInterface interface {
 	// 参数：
 	//   文档 ID
 	//   密钥置换会话 ID
-	//   预期的份额数量
 	//   文档元数据
 	//
 	// 返回：
 	//   解密后的文档
-	GetEncryptedDocument(id string, keySwitchSessionID string, numSharesExpected int, metadata *data.ResMetadataStored) (*common.Document, error)
+	GetEncryptedDocument(id string, keySwitchSessionID string, metadata *data.ResMetadataStored) (*common.Document, error)
+
+	// 批量获取加密或链下加密数字文档。文档须均在同一个多资源的密钥置换会话中。函数逐个获取元数据，并按资源类型解密。
+	//
+	// 参数：
+	//   文档 ID 列表
+	//   密钥置换会话 ID
+	//
+	// 返回：
+	//   解密后的文档列表（与文档 ID 列表的顺序一致）
+	GetEncryptedDocuments(ids []string, keySwitchSessionID string) ([]*common.Document, error)
 
 	// 获取链下加密数字文档。提供密钥置换会话，函数将从 IPFS 网络获得密文，使用密钥置换结果尝试进行解密后，返回明文。调用前应先获取元数据。
 	//
 	// 参数：
 	//   文档 ID
 	//   密钥置换会话 ID
-	//   预期的份额数量
 	//   文档元数据
 	//
 	// 返回：
 	//   解密后的文档
-	GetOffchainDocument(id string, keySwitchSessionID string, numSharesExpected int, metadata *data.ResMetadataStored) (*common.Document, error)
+	GetOffchainDocument(id string, keySwitchSessionID string, metadata *data.ResMetadataStored) (*common.Document, error)
 
 	// GetEncryptedDocumentProperties 获取加密与链下加密数字文档的加密属性部分，并使用密钥置换结果尝试进行解密。调用前应先获取元数据。
 	//
 	// 参数：
 	//   文档 ID
 	//   密钥置换会话 ID
-	//   预期的份额数量
 	//   文档元数据
 	//
 	// 返回：
 	//   解密后的文档属性
-	GetEncryptedDocumentProperties(id string, keySwitchSessionID string, numSharesExpected int, metadata *data.ResMetadataStored) (*common.DocumentProperties, error)
+	GetEncryptedDocumentProperties(id string, keySwitchSessionID string, metadata *data.ResMetadataStored) (*common.DocumentProperties, error)
 
 	// GetDecryptedDocumentFromDB 从数据库中获取经解密的数字文档。返回解密后的明文。调用前应先获取元数据。
 	//
@@ -7,13 +7,14 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/db"
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/global"
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/models/common"
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/utils/cipherutils"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/accesspolicy"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/data"
-	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/keyswitch"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/query"
 	"github.com/XiaoYao-austin/ppks"
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
@@ -25,8 +26,10 @@ import (
 
 // EntityAssetService 用于管理实体资产。
 type EntityAssetService struct {
-	ServiceInfo      *Info
-	KeySwitchService KeySwitchServiceInterface
+	ServiceInfo           *Info
+	KeySwitchService      KeySwitchServiceInterface
+	decryptedKeyCache     *keySwitchDecryptedKeyCache
+	decryptedKeyCacheOnce sync.Once
 }
 
 // 用于放置在元数据的 extensions.dataType 中的值
@@ -108,11 +111,12 @@ func (s *EntityAssetService) CreateEntityAsset(asset *common.EntityAsset) (strin
 // 参数：
 //   实体资产
 //   加密后的对称密钥
-//   访问策略
+//   访问策略。引用策略模板时为空。
+//   引用的策略模板。不引用时为 nil。
 //
 // 返回：
 //   交易 ID
-func (s *EntityAssetService) CreateEncryptedEntityAsset(asset *common.EntityAsset, key *ppks.CurvePoint, policy string) (string, error) {
+func (s *EntityAssetService) CreateEncryptedEntityAsset(asset *common.EntityAsset, key *ppks.CurvePoint, policy string, policyTemplate *accesspolicy.PolicyTemplateReference) (string, error) {
 	if asset == nil {
 		return "", fmt.Errorf("资产不能为 nil")
 	}
@@ -122,6 +126,11 @@ func (s *EntityAssetService) CreateEncryptedEntityAsset(asset *common.EntityAsse
 		return "", fmt.Errorf("资产 ID 不能为空")
 	}
 
+	// 在开始加密前检查访问策略，以免不合法的策略到链码层才被发现
+	if err := validateResourcePolicy(policy, policyTemplate); err != nil {
+		return "", err
+	}
+
 	assetBytes, err := json.Marshal(asset)
 	if err != nil {
 		return "", errors.Wrap(err, "无法序列化资产")
@@ -165,10 +174,12 @@ func (s *EntityAssetService) CreateEncryptedEntityAsset(asset *common.EntityAsse
 
 	// 组装要传入链码的参数，其中密文本体和对称密钥的密文转换为 Base64 编码
 	encryptedData := data.EncryptedData{
-		Metadata: metadata,
-		Data:     base64.StdEncoding.EncodeToString(encryptedAssetBytes),
-		Key:      base64.StdEncoding.EncodeToString(encryptedKeyBytes),
-		Policy:   policy,
+		Metadata:       metadata,
+		Data:           base64.StdEncoding.EncodeToString(encryptedAssetBytes),
+		Key:            base64.StdEncoding.EncodeToString(encryptedKeyBytes),
+		Policy:         policy,
+		PolicyTemplate: policyTemplate,
+		KeyEpoch:       global.KeySwitchKeys.CollectiveKeyEpoch,
 	}
 
 	encryptedDataBytes, err := json.Marshal(encryptedData)
@@ -252,12 +263,11 @@ func (s *EntityAssetService) GetEntityAsset(id string, metadata *data.ResMetadat
 // 参数：
 //   资产 ID
 //   密钥置换会话 ID
-//   预期的份额数量
 //   资产元数据
 //
 // 返回：
 //   解密后的实体资产条目
-func (s *EntityAssetService) GetEncryptedEntityAsset(id string, keySwitchSessionID string, numSharesExpected int, metadata *data.ResMetadataStored) (*common.EntityAsset, error) {
+func (s *EntityAssetService) GetEncryptedEntityAsset(id string, keySwitchSessionID string, metadata *data.ResMetadataStored) (*common.EntityAsset, error) {
 	// 检查元数据中该资源类型是否为密文资源
 	if metadata.ResourceType != data.Encrypted {
 		return nil, &ErrorBadRequest{
@@ -265,6 +275,7 @@ func (s *EntityAssetService) GetEncryptedEntityAsset(id string, keySwitchSession
 		}
 	}
 
+	// 调用链码 getData 获取该资源的密文本体
 	chaincodeFcn := "getData"
 	channelReq := channel.Request{
 		ChaincodeID: s.ServiceInfo.ChaincodeID,
@@ -278,41 +289,6 @@ func (s *EntityAssetService) GetEncryptedEntityAsset(id string, keySwitchSession
 		return nil, err
 	}
 
-	// 调用链码 getKey 获取该资源的加密后的密钥
-	chaincodeFcn = "getKey"
-	channelReq = channel.Request{
-		ChaincodeID: s.ServiceInfo.ChaincodeID,
-		Fcn:         chaincodeFcn,
-		Args:        [][]byte{[]byte(id)},
-	}
-
-	resp, err = s.ServiceInfo.ChannelClient.Query(channelReq)
-	err = GetClassifiedError(chaincodeFcn, err)
-	if err != nil {
-		return nil, err
-	}
-
-	// 解析加密后的密钥材料
-	encryptedKeyBytes := resp.Payload
-	encryptedKeyAsCipherText, err := cipherutils.DeserializeCipherText(encryptedKeyBytes)
-	if err != nil {
-		return nil, err
-	}
-
-	// 调用链码 getData 获取该资源的密文本体
-	chaincodeFcn = "getData"
-	channelReq = channel.Request{
-		ChaincodeID: s.ServiceInfo.ChaincodeID,
-		Fcn:         chaincodeFcn,
-		Args:        [][]byte{[]byte(id)},
-	}
-
-	resp, err = s.ServiceInfo.ChannelClient.Query(channelReq)
-	err = GetClassifiedError(chaincodeFcn, err)
-	if err != nil {
-		return nil, err
-	}
-
 	encryptedAssetBytes := resp.Payload
 
 	// 检查加密的内容的大小和哈希是否匹配
@@ -321,42 +297,12 @@ func (s *EntityAssetService) GetEncryptedEntityAsset(id string, keySwitchSession
 		return nil, err
 	}
 
-	// 调用链码 listKeySwitchResultsByID 看是否有 numSharesExpected 份。若不足则报错。
-	chaincodeFcn = "listKeySwitchResultsByID"
-	channelReq = channel.Request{
-		ChaincodeID: s.ServiceInfo.ChaincodeID,
-		Fcn:         chaincodeFcn,
-		Args:        [][]byte{[]byte(keySwitchSessionID)},
-	}
-
-	resp, err = s.ServiceInfo.ChannelClient.Query(channelReq)
-	err = GetClassifiedError(chaincodeFcn, err)
+	// 以密钥置换结果解密该资源的对称密钥材料
+	decryptedKey, err := s.newDecryptionPipeline().decryptKey(id, keySwitchSessionID)
 	if err != nil {
 		return nil, err
 	}
 
-	var ksResults []*keyswitch.KeySwitchResultStored
-	err = json.Unmarshal(resp.Payload, &ksResults)
-	if err != nil {
-		return nil, errors.Wrap(err, "无法解析密钥置换结果列表")
-	}
-
-	if len(ksResults) != numSharesExpected {
-		return nil, fmt.Errorf("密钥置换结果只有 %v 份，不足 %v 份", len(ksResults), numSharesExpected)
-	}
-
-	// 解析并验证份额
-	shares, err := parseAndVerifySharesFromKeySwitchResults(ksResults, global.KeySwitchKeys.PublicKey, encryptedKeyAsCipherText, s.KeySwitchService)
-	if err != nil {
-		return nil, err
-	}
-
-	// 调用 KeySwitchService 中的 GetDecryptedKey 得到解密的对称密钥材料
-	decryptedKey, err := s.KeySwitchService.GetDecryptedKey(shares, encryptedKeyAsCipherText, global.KeySwitchKeys.PrivateKey)
-	if err != nil {
-		return nil, errors.Wrap(err, "无法解密对称密钥")
-	}
-
 	// 用对称密钥解密 encryptedAssetBytes
 	assetBytes, err := cipherutils.DecryptBytesUsingAESKey(encryptedAssetBytes, cipherutils.DeriveSymmetricKeyBytesFromCurvePoint(decryptedKey))
 	if err != nil {
@@ -585,3 +531,12 @@ func deriveExtensionsMapFromAsset(asset *common.EntityAsset) map[string]interfac
 
 	return extensions
 }
+
+// 创建一个解密流水线。各流水线共用本服务的解密出的对称密钥的缓存，该缓存在首次调用时创建。
+func (s *EntityAssetService) newDecryptionPipeline() *keySwitchDecryptionPipeline {
+	s.decryptedKeyCacheOnce.Do(func() {
+		s.decryptedKeyCache = newKeySwitchDecryptedKeyCache()
+	})
+
+	return newKeySwitchDecryptionPipeline(s.ServiceInfo, s.KeySwitchService, s.decryptedKeyCache)
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/models/common"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/accesspolicy"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/data"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/query"
 	"github.com/XiaoYao-austin/ppks"
@@ -23,11 +24,12 @@ type EntityAssetServiceInterface interface {
 	// 参数：
 	//   实体资产
 	//   加密后的对称密钥
-	//   访问策略
+	//   访问策略。引用策略模板时为空。
+	//   引用的策略模板。不引用时为 nil。
 	//
 	// 返回：
 	//   交易 ID
-	CreateEncryptedEntityAsset(asset *common.EntityAsset, key *ppks.CurvePoint, policy string) (string, error)
+	CreateEncryptedEntityAsset(asset *common.EntityAsset, key *ppks.CurvePoint, policy string, policyTemplate *accesspolicy.PolicyTemplateReference) (string, error)
 
 	// 获取实体资产的元数据。
 	//
@@ -53,12 +55,11 @@ type EntityAssetServiceInterface interface {
 	// 参数：
 	//   资产 ID
 	//   密钥置换会话 ID
-	//   预期的份额数量
 	//   资产元数据
 	//
 	// 返回：
 	//   解密后的实体资产条目
-	GetEncryptedEntityAsset(id string, keySwitchSessionID string, numSharesExpected int, metadata *data.ResMetadataStored) (*common.EntityAsset, error)
+	GetEncryptedEntityAsset(id string, keySwitchSessionID string, metadata *data.ResMetadataStored) (*common.EntityAsset, error)
 
 	// GetDecryptedEntityAssetFromDB 从数据库中获取经解密的实体资产。返回解密后的明文。调用前应先获取元数据。
 	//
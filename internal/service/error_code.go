@@ -1,9 +1,12 @@
 package service
 
 import (
+	"encoding/json"
+	"fmt"
 	"strings"
 
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/accesspolicy"
 	"github.com/pkg/errors"
 )
 
@@ -23,11 +26,49 @@ func (e *ErrorCorruptedDatabaseResult) Error() string {
 	return e.errMsg
 }
 
+// ErrorForbiddenWithReason is an `errorcode.ErrorForbidden` that carries the reason why the access policy denied the request.
+// `errors.Cause` returns `errorcode.ErrorForbidden` for it, so it's handled wherever `errorcode.ErrorForbidden` is.
+type ErrorForbiddenWithReason struct {
+	Reason *accesspolicy.PolicyDenialReason
+}
+
+func (e *ErrorForbiddenWithReason) Error() string {
+	return errorcode.CodeForbidden
+}
+
+// Cause returns `errorcode.ErrorForbidden`.
+func (e *ErrorForbiddenWithReason) Cause() error {
+	return errorcode.ErrorForbidden
+}
+
+// ErrorKeySwitchServersUnavailable is an `errorcode.ErrorServiceUnavailable` telling that too few key switch servers are alive to provide the shares needed.
+// `errors.Cause` returns `errorcode.ErrorServiceUnavailable` for it.
+type ErrorKeySwitchServersUnavailable struct {
+	NumAvailable int // The number of servers that are alive or have already submitted their results
+	NumNeeded    int // The number of shares needed
+}
+
+func (e *ErrorKeySwitchServersUnavailable) Error() string {
+	return fmt.Sprintf("可用的密钥置换服务器只有 %v 个，不足所需的 %v 个。请确认密钥置换服务器正在运行", e.NumAvailable, e.NumNeeded)
+}
+
+// Cause returns `errorcode.ErrorServiceUnavailable`.
+func (e *ErrorKeySwitchServersUnavailable) Cause() error {
+	return errorcode.ErrorServiceUnavailable
+}
+
 // GetClassifiedError is a general error handler that converts some errors returned from the chaincode to the predefined errors.
 func GetClassifiedError(chaincodeFcn string, err error) error {
 	if err == nil {
 		return nil
 	} else if strings.HasSuffix(err.Error(), errorcode.CodeForbidden) {
+		// Carry the denial reason through if the chaincode attached one
+		if detail, ok := errorcode.ExtractDetail(err.Error(), errorcode.CodeForbidden); ok {
+			var reason accesspolicy.PolicyDenialReason
+			if json.Unmarshal([]byte(detail), &reason) == nil {
+				return &ErrorForbiddenWithReason{Reason: &reason}
+			}
+		}
 		return errorcode.ErrorForbidden
 	} else if strings.HasSuffix(err.Error(), errorcode.CodeNotFound) {
 		return errorcode.ErrorNotFound
@@ -1,7 +1,11 @@
 package service
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/appinit"
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/models/common"
@@ -50,3 +54,111 @@ func (s *IdentityService) GetIdentityInfo() (*common.UserIdentity, error) {
 
 	return &userIdentity, nil
 }
+
+// 更新属性登记簿中某一身份的登记属性。登记的属性将整体替换之前登记的属性，并优先于该身份证书上的同名属性。只有管理员可以更新。
+//
+// 参数：
+//   登记属性的更新
+//
+// 返回：
+//   登记版本
+//   交易 ID
+func (s *IdentityService) UpdateRegisteredAttributes(update *identity.RegisteredAttributesUpdate) (int, string, error) {
+	if update == nil {
+		return 0, "", fmt.Errorf("登记属性的更新不能为 nil")
+	}
+
+	if _, err := base64.StdEncoding.DecodeString(update.PublicKey); err != nil || strings.TrimSpace(update.PublicKey) == "" {
+		return 0, "", &ErrorBadRequest{
+			errMsg: "公钥应为 Base64 编码的 DER。",
+		}
+	}
+
+	if deptLevelStr, ok := update.Attributes["DeptLevel"]; ok {
+		if _, err := strconv.Atoi(deptLevelStr); err != nil {
+			return 0, "", &ErrorBadRequest{
+				errMsg: "部门级别必须为整数。",
+			}
+		}
+	}
+
+	updateBytes, err := json.Marshal(update)
+	if err != nil {
+		return 0, "", errors.Wrap(err, "无法序列化链码参数")
+	}
+
+	chaincodeFcn := "updateRegisteredAttributes"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{updateBytes},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Execute(channelReq)
+	if err != nil {
+		return 0, "", GetClassifiedError(chaincodeFcn, err)
+	}
+
+	version, err := strconv.Atoi(string(resp.Payload))
+	if err != nil {
+		return 0, "", errors.Wrap(err, "无法解析登记版本")
+	}
+
+	return version, string(resp.TransactionID), nil
+}
+
+// 获取属性登记簿中某一身份最新的登记属性。
+//
+// 参数：
+//   身份的公钥（Base64 编码的 DER）
+//
+// 返回：
+//   登记属性
+func (s *IdentityService) GetRegisteredAttributes(publicKey string) (*identity.RegisteredAttributesStored, error) {
+	chaincodeFcn := "getRegisteredAttributes"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{[]byte(publicKey)},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+	if err != nil {
+		return nil, GetClassifiedError(chaincodeFcn, err)
+	}
+
+	var registered identity.RegisteredAttributesStored
+	if err = json.Unmarshal(resp.Payload, &registered); err != nil {
+		return nil, errors.Wrap(err, "无法解析登记属性")
+	}
+
+	return &registered, nil
+}
+
+// 列出属性登记簿中某一身份的登记属性的所有版本，按版本从旧到新排列。
+//
+// 参数：
+//   身份的公钥（Base64 编码的 DER）
+//
+// 返回：
+//   登记属性的历史版本
+func (s *IdentityService) ListRegisteredAttributesHistory(publicKey string) ([]identity.RegisteredAttributesStored, error) {
+	chaincodeFcn := "listRegisteredAttributesHistory"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{[]byte(publicKey)},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+	if err != nil {
+		return nil, GetClassifiedError(chaincodeFcn, err)
+	}
+
+	var history []identity.RegisteredAttributesStored
+	if err = json.Unmarshal(resp.Payload, &history); err != nil {
+		return nil, errors.Wrap(err, "无法解析登记属性的历史")
+	}
+
+	return history, nil
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/models/common"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/identity"
 )
 
 // IdentityServiceInterface 定义了有关于使用者身份的服务的接口。
@@ -11,4 +12,32 @@ type IdentityServiceInterface interface {
 	// 返回：
 	//   用户身份信息
 	GetIdentityInfo() (*common.UserIdentity, error)
+
+	// 更新属性登记簿中某一身份的登记属性。登记的属性将整体替换之前登记的属性，并优先于该身份证书上的同名属性。只有管理员可以更新。
+	//
+	// 参数：
+	//   登记属性的更新
+	//
+	// 返回：
+	//   登记版本
+	//   交易 ID
+	UpdateRegisteredAttributes(update *identity.RegisteredAttributesUpdate) (int, string, error)
+
+	// 获取属性登记簿中某一身份最新的登记属性。
+	//
+	// 参数：
+	//   身份的公钥（Base64 编码的 DER）
+	//
+	// 返回：
+	//   登记属性
+	GetRegisteredAttributes(publicKey string) (*identity.RegisteredAttributesStored, error)
+
+	// 列出属性登记簿中某一身份的登记属性的所有版本，按版本从旧到新排列。
+	//
+	// 参数：
+	//   身份的公钥（Base64 编码的 DER）
+	//
+	// 返回：
+	//   登记属性的历史版本
+	ListRegisteredAttributesHistory(publicKey string) ([]identity.RegisteredAttributesStored, error)
 }
@@ -0,0 +1,320 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/global"
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/utils/cipherutils"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/keyswitch"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/query"
+	"github.com/XiaoYao-austin/ppks"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/pkg/errors"
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+// KeyRotationService 实现了 `KeyRotationServiceInterface` 接口，提供有关于密钥轮换的服务
+type KeyRotationService struct {
+	ServiceInfo      *Info
+	KeySwitchService KeySwitchServiceInterface
+}
+
+// 以新的纪元发布集合公钥。只有管理员可以发布。纪元须为最新纪元加 1。
+//
+// 参数：
+//   纪元
+//   集合公钥
+//
+// 返回：
+//   交易 ID
+func (s *KeyRotationService) PublishCollectiveKey(epoch int, publicKey *sm2.PublicKey) (string, error) {
+	if epoch <= 0 {
+		return "", &ErrorBadRequest{errMsg: "纪元应为正整数。"}
+	}
+	if publicKey == nil {
+		return "", &ErrorBadRequest{errMsg: "集合公钥不能为空。"}
+	}
+
+	collectiveKey := keyswitch.CollectiveKey{
+		Epoch:     epoch,
+		PublicKey: base64.StdEncoding.EncodeToString(cipherutils.SerializeSM2PublicKey(publicKey)),
+	}
+
+	collectiveKeyBytes, err := json.Marshal(collectiveKey)
+	if err != nil {
+		return "", errors.Wrap(err, "无法序列化链码参数")
+	}
+
+	chaincodeFcn := "publishCollectiveKey"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{collectiveKeyBytes},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Execute(channelReq)
+	if err != nil {
+		return "", GetClassifiedError(chaincodeFcn, err)
+	}
+
+	return string(resp.TransactionID), nil
+}
+
+// 获取某一纪元发布的集合公钥。
+//
+// 参数：
+//   纪元
+//
+// 返回：
+//   集合公钥
+func (s *KeyRotationService) GetCollectiveKey(epoch int) (*keyswitch.CollectiveKeyStored, error) {
+	return s.getCollectiveKey([][]byte{[]byte(strconv.Itoa(epoch))})
+}
+
+// 获取最新发布的集合公钥。
+//
+// 返回：
+//   集合公钥
+func (s *KeyRotationService) GetLatestCollectiveKey() (*keyswitch.CollectiveKeyStored, error) {
+	return s.getCollectiveKey([][]byte{})
+}
+
+func (s *KeyRotationService) getCollectiveKey(args [][]byte) (*keyswitch.CollectiveKeyStored, error) {
+	chaincodeFcn := "getCollectiveKey"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        args,
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+	if err != nil {
+		return nil, GetClassifiedError(chaincodeFcn, err)
+	}
+
+	var collectiveKeyStored keyswitch.CollectiveKeyStored
+	if err = json.Unmarshal(resp.Payload, &collectiveKeyStored); err != nil {
+		return nil, errors.Wrap(err, "无法解析集合公钥")
+	}
+
+	return &collectiveKeyStored, nil
+}
+
+// 分页列出带有加密的对称密钥的资源（加密资源与链下资源）的 ID。
+//
+// 参数：
+//   分页大小
+//   分页书签
+//
+// 返回：
+//   带分页的资源 ID 列表
+func (s *KeyRotationService) ListEncryptedResourceIDs(pageSize int, bookmark string) (*query.IDsWithPagination, error) {
+	if pageSize <= 0 {
+		return nil, &ErrorBadRequest{errMsg: "分页大小应为正整数。"}
+	}
+
+	chaincodeFcn := "listEncryptedResourceIDs"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{[]byte(strconv.Itoa(pageSize)), []byte(bookmark)},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+	if err != nil {
+		return nil, GetClassifiedError(chaincodeFcn, err)
+	}
+
+	var resourceIDs query.IDsWithPagination
+	if err = json.Unmarshal(resp.Payload, &resourceIDs); err != nil {
+		return nil, errors.Wrap(err, "无法解析结果列表")
+	}
+
+	return &resourceIDs, nil
+}
+
+// 获取资源的加密密钥所属的纪元。
+//
+// 参数：
+//   资源 ID
+//
+// 返回：
+//   资源的密钥纪元
+func (s *KeyRotationService) GetResourceKeyEpoch(resourceID string) (*keyswitch.ResourceKeyEpochStored, error) {
+	if strings.TrimSpace(resourceID) == "" {
+		return nil, &ErrorBadRequest{errMsg: "资源 ID 不能为空。"}
+	}
+
+	chaincodeFcn := "getResourceKeyEpoch"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{[]byte(resourceID)},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+	if err != nil {
+		return nil, GetClassifiedError(chaincodeFcn, err)
+	}
+
+	var resourceKeyEpoch keyswitch.ResourceKeyEpochStored
+	if err = json.Unmarshal(resp.Payload, &resourceKeyEpoch); err != nil {
+		return nil, errors.Wrap(err, "无法解析资源的密钥纪元")
+	}
+
+	return &resourceKeyEpoch, nil
+}
+
+// 获取资源的加密密钥。
+//
+// 参数：
+//   资源 ID
+//
+// 返回：
+//   加密密钥
+func (s *KeyRotationService) GetResourceKey(resourceID string) (*ppks.CipherText, error) {
+	chaincodeFcn := "getKey"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{[]byte(resourceID)},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+	if err != nil {
+		return nil, GetClassifiedError(chaincodeFcn, err)
+	}
+
+	encryptedKey, err := cipherutils.DeserializeCipherText(resp.Payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "无法解析加密密钥")
+	}
+
+	return encryptedKey, nil
+}
+
+// 以密钥置换会话的结果解密资源的加密密钥。会话须已收集到所需的份额。
+//
+// 参数：
+//   资源 ID
+//   密钥置换会话 ID
+//
+// 返回：
+//   解密出的密钥材料
+func (s *KeyRotationService) DecryptResourceKeyWithKeySwitchSession(resourceID string, keySwitchSessionID string) (*ppks.CurvePoint, error) {
+	encryptedKey, err := s.GetResourceKey(resourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 调用链码 listKeySwitchResultsByID 获取密钥置换结果
+	chaincodeFcn := "listKeySwitchResultsByID"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{[]byte(keySwitchSessionID)},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+	if err != nil {
+		return nil, GetClassifiedError(chaincodeFcn, err)
+	}
+
+	var ksResults []*keyswitch.KeySwitchResultStored
+	if err = json.Unmarshal(resp.Payload, &ksResults); err != nil {
+		return nil, errors.Wrap(err, "无法解析密钥置换结果列表")
+	}
+
+	ksServers, err := s.KeySwitchService.ListKeySwitchServers()
+	if err != nil {
+		return nil, err
+	}
+
+	ksTrigger, err := s.KeySwitchService.GetKeySwitchSession(keySwitchSessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	numSharesExpected, err := getNumSharesExpected(ksTrigger)
+	if err != nil {
+		return nil, err
+	}
+
+	shares, shareIndices, err := collectSharesForResource(resourceID, ksResults, ksServers, numSharesExpected, global.KeySwitchKeys.PublicKey, encryptedKey, s.KeySwitchService)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := s.KeySwitchService.GetDecryptedKey(shares, shareIndices, encryptedKey, global.KeySwitchKeys.PrivateKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "无法解密对称密钥")
+	}
+
+	return key, nil
+}
+
+// 将资源的加密密钥更新为以新纪元的集合公钥加密的密钥。只有管理员可以更新。纪元须为最新发布的纪元。
+//
+// 参数：
+//   资源 ID
+//   以新纪元的集合公钥加密的密钥
+//   纪元
+//
+// 返回：
+//   交易 ID
+func (s *KeyRotationService) UpdateResourceKey(resourceID string, encryptedKey *ppks.CipherText, epoch int) (string, error) {
+	resourceKeyUpdate := keyswitch.ResourceKeyUpdate{
+		ResourceID: resourceID,
+		Key:        base64.StdEncoding.EncodeToString(cipherutils.SerializeCipherText(encryptedKey)),
+		Epoch:      epoch,
+	}
+
+	resourceKeyUpdateBytes, err := json.Marshal(resourceKeyUpdate)
+	if err != nil {
+		return "", errors.Wrap(err, "无法序列化链码参数")
+	}
+
+	chaincodeFcn := "updateResourceKey"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{resourceKeyUpdateBytes},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Execute(channelReq)
+	if err != nil {
+		return "", GetClassifiedError(chaincodeFcn, err)
+	}
+
+	return string(resp.TransactionID), nil
+}
+
+// 撤销资源加密密钥的最近一次更新，恢复为更新前所保留的纪元最近的旧密钥。只有管理员可以撤销。
+//
+// 参数：
+//   资源 ID
+//
+// 返回：
+//   交易 ID
+func (s *KeyRotationService) RevertResourceKey(resourceID string) (string, error) {
+	if strings.TrimSpace(resourceID) == "" {
+		return "", &ErrorBadRequest{errMsg: "资源 ID 不能为空。"}
+	}
+
+	chaincodeFcn := "revertResourceKey"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{[]byte(resourceID)},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Execute(channelReq)
+	if err != nil {
+		return "", GetClassifiedError(chaincodeFcn, err)
+	}
+
+	return string(resp.TransactionID), nil
+}
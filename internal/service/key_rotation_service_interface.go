@@ -0,0 +1,94 @@
+package service
+
+import (
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/keyswitch"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/query"
+	"github.com/XiaoYao-austin/ppks"
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+// KeyRotationServiceInterface 定义了有关于密钥轮换的服务的接口。
+type KeyRotationServiceInterface interface {
+	// 以新的纪元发布集合公钥。只有管理员可以发布。纪元须为最新纪元加 1。
+	//
+	// 参数：
+	//   纪元
+	//   集合公钥
+	//
+	// 返回：
+	//   交易 ID
+	PublishCollectiveKey(epoch int, publicKey *sm2.PublicKey) (string, error)
+
+	// 获取某一纪元发布的集合公钥。
+	//
+	// 参数：
+	//   纪元
+	//
+	// 返回：
+	//   集合公钥
+	GetCollectiveKey(epoch int) (*keyswitch.CollectiveKeyStored, error)
+
+	// 获取最新发布的集合公钥。
+	//
+	// 返回：
+	//   集合公钥
+	GetLatestCollectiveKey() (*keyswitch.CollectiveKeyStored, error)
+
+	// 分页列出带有加密的对称密钥的资源（加密资源与链下资源）的 ID。
+	//
+	// 参数：
+	//   分页大小
+	//   分页书签
+	//
+	// 返回：
+	//   带分页的资源 ID 列表
+	ListEncryptedResourceIDs(pageSize int, bookmark string) (*query.IDsWithPagination, error)
+
+	// 获取资源的加密密钥所属的纪元。
+	//
+	// 参数：
+	//   资源 ID
+	//
+	// 返回：
+	//   资源的密钥纪元
+	GetResourceKeyEpoch(resourceID string) (*keyswitch.ResourceKeyEpochStored, error)
+
+	// 获取资源的加密密钥。
+	//
+	// 参数：
+	//   资源 ID
+	//
+	// 返回：
+	//   加密密钥
+	GetResourceKey(resourceID string) (*ppks.CipherText, error)
+
+	// 以密钥置换会话的结果解密资源的加密密钥。会话须已收集到所需的份额。
+	//
+	// 参数：
+	//   资源 ID
+	//   密钥置换会话 ID
+	//
+	// 返回：
+	//   解密出的密钥材料
+	DecryptResourceKeyWithKeySwitchSession(resourceID string, keySwitchSessionID string) (*ppks.CurvePoint, error)
+
+	// 将资源的加密密钥更新为以新纪元的集合公钥加密的密钥。只有管理员可以更新。纪元须为最新发布的纪元。
+	//
+	// 参数：
+	//   资源 ID
+	//   以新纪元的集合公钥加密的密钥
+	//   纪元
+	//
+	// 返回：
+	//   交易 ID
+	UpdateResourceKey(resourceID string, encryptedKey *ppks.CipherText, epoch int) (string, error)
+
+	// 撤销资源加密密钥的最近一次更新，恢复为更新前所保留的纪元最近的旧密钥。只有管理员可以撤销。
+	//
+	// 参数：
+	//   资源 ID
+	//
+	// 返回：
+	//   交易 ID
+	RevertResourceKey(resourceID string) (string, error)
+}
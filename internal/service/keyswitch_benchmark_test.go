@@ -0,0 +1,92 @@
+package service
+
+import (
+	"math/big"
+	"testing"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/utils/cipherutils"
+	"github.com/XiaoYao-austin/ppks"
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+// 基准测试的输入：一个密钥置换服务器对目标用户计算的份额及其零知识证明。
+type keySwitchBenchmarkInput struct {
+	serverKey     *sm2.PrivateKey
+	targetPrivKey *sm2.PrivateKey
+	encryptedKey  *ppks.CipherText
+	share         *ppks.CipherText
+	zkpRi         *big.Int
+	proof         *cipherutils.ZKProof
+}
+
+func newKeySwitchBenchmarkInput(b *testing.B) *keySwitchBenchmarkInput {
+	serverKey, err := ppks.GenPrivKey()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	targetPrivKey, err := ppks.GenPrivKey()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	encryptedKey, err := ppks.PointEncrypt(&serverKey.PublicKey, ppks.GenPoint())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	share, zkpRi, err := ppks.ShareCal(&targetPrivKey.PublicKey, &encryptedKey.K, serverKey)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	proof := &cipherutils.ZKProof{}
+	proof.C, proof.R1, proof.R2, err = ppks.ShareProofGenNoB(zkpRi, serverKey, share, &targetPrivKey.PublicKey, &encryptedKey.K)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return &keySwitchBenchmarkInput{
+		serverKey:     serverKey,
+		targetPrivKey: targetPrivKey,
+		encryptedKey:  encryptedKey,
+		share:         share,
+		zkpRi:         zkpRi,
+		proof:         proof,
+	}
+}
+
+func BenchmarkShareCal(b *testing.B) {
+	input := newKeySwitchBenchmarkInput(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := ppks.ShareCal(&input.targetPrivKey.PublicKey, &input.encryptedKey.K, input.serverKey); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkShareProofGenNoB(b *testing.B) {
+	input := newKeySwitchBenchmarkInput(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, _, err := ppks.ShareProofGenNoB(input.zkpRi, input.serverKey, input.share, &input.targetPrivKey.PublicKey, &input.encryptedKey.K); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkVerifyShare(b *testing.B) {
+	input := newKeySwitchBenchmarkInput(b)
+	svc := &KeySwitchService{}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		isVerified, err := svc.VerifyShare(input.share, input.proof, &input.serverKey.PublicKey, &input.targetPrivKey.PublicKey, input.encryptedKey)
+		if err != nil || !isVerified {
+			b.Fatalf("份额未通过验证: %v", err)
+		}
+	}
+}
@@ -1,9 +1,14 @@
 package service
 
 import (
+	"encoding/base64"
+	"fmt"
 	"testing"
+	"time"
 
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/global"
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/utils/cipherutils"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/keyswitch"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/sm2keyutils"
 
 	"github.com/XiaoYao-austin/ppks"
@@ -167,3 +172,399 @@ func TestKeySwitchProcess(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestThresholdKeySwitchProcess(t *testing.T) {
+	// 将集合私钥拆分给 3 个密钥置换服务器，任意 2 份即可完成密钥置换
+	collPrivKey, err := ppks.GenPrivKey()
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	serverKeys, err := cipherutils.SplitSM2PrivateKey(collPrivKey, 2, 3)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	targetPrivKey, err := ppks.GenPrivKey()
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	key := ppks.GenPoint()
+	encryptedKey, err := ppks.PointEncrypt(&collPrivKey.PublicKey, key)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	// 各服务器计算份额并生成 ZKP，份额以各服务器自己的公钥验证
+	svc := &KeySwitchService{}
+	var shares []*ppks.CipherText
+	for _, serverKey := range serverKeys {
+		share, zkpRi, err := ppks.ShareCal(&targetPrivKey.PublicKey, &encryptedKey.K, serverKey)
+		if isNoError := assert.NoError(t, err); !isNoError {
+			t.FailNow()
+		}
+
+		proof := &cipherutils.ZKProof{}
+		proof.C, proof.R1, proof.R2, err = ppks.ShareProofGenNoB(zkpRi, serverKey, share, &targetPrivKey.PublicKey, &encryptedKey.K)
+		if isNoError := assert.NoError(t, err); !isNoError {
+			t.FailNow()
+		}
+
+		isShareVerified, err := svc.VerifyShare(share, proof, &serverKey.PublicKey, &targetPrivKey.PublicKey, encryptedKey)
+		if isNoError := assert.NoError(t, err); !isNoError {
+			t.FailNow()
+		}
+		if !isShareVerified {
+			t.FailNow()
+		}
+
+		shares = append(shares, share)
+	}
+
+	// 任意 2 份均可解密
+	for _, indices := range [][]int{{1, 2}, {2, 3}, {3, 1}} {
+		selectedShares := []*ppks.CipherText{shares[indices[0]-1], shares[indices[1]-1]}
+		decryptedKey, err := svc.GetDecryptedKey(selectedShares, indices, encryptedKey, targetPrivKey)
+		if isNoError := assert.NoError(t, err, indices); !isNoError {
+			t.FailNow()
+		}
+		assert.Equal(t, 0, key.X.Cmp(decryptedKey.X), indices)
+		assert.Equal(t, 0, key.Y.Cmp(decryptedKey.Y), indices)
+	}
+
+	// 份额不足门限值时无法解密
+	decryptedKey, err := svc.GetDecryptedKey(shares[:1], []int{1}, encryptedKey, targetPrivKey)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	assert.NotEqual(t, 0, key.X.Cmp(decryptedKey.X))
+}
+
+func TestCollectSharesWithNumSharesExpectedOfSession(t *testing.T) {
+	// 将集合私钥拆分给 3 个密钥置换服务器，门限值为 2
+	collPrivKey, err := ppks.GenPrivKey()
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	serverKeys, err := cipherutils.SplitSM2PrivateKey(collPrivKey, 2, 3)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	targetPrivKey, err := ppks.GenPrivKey()
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	key := ppks.GenPoint()
+	encryptedKey, err := ppks.PointEncrypt(&collPrivKey.PublicKey, key)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	shareIndices := map[string]int{}
+	var ksServers []keyswitch.KeySwitchServerStored
+	var ksResults []*keyswitch.KeySwitchResultStored
+	for i, serverKey := range serverKeys {
+		share, zkpRi, err := ppks.ShareCal(&targetPrivKey.PublicKey, &encryptedKey.K, serverKey)
+		if isNoError := assert.NoError(t, err); !isNoError {
+			t.FailNow()
+		}
+
+		proof := &cipherutils.ZKProof{}
+		proof.C, proof.R1, proof.R2, err = ppks.ShareProofGenNoB(zkpRi, serverKey, share, &targetPrivKey.PublicKey, &encryptedKey.K)
+		if isNoError := assert.NoError(t, err); !isNoError {
+			t.FailNow()
+		}
+
+		ksPK := base64.StdEncoding.EncodeToString(cipherutils.SerializeSM2PublicKey(&serverKey.PublicKey))
+		creator := fmt.Sprintf("server%v", i+1)
+		shareIndices[ksPK] = i + 1
+		ksServers = append(ksServers, keyswitch.KeySwitchServerStored{PublicKey: creator, KeySwitchPK: ksPK})
+		ksResults = append(ksResults, &keyswitch.KeySwitchResultStored{
+			KeySwitchSessionID: "session1",
+			KeySwitchPK:        ksPK,
+			Creator:            creator,
+			Share:              base64.StdEncoding.EncodeToString(cipherutils.SerializeCipherText(share)),
+			ZKProof:            base64.StdEncoding.EncodeToString(cipherutils.SerializeZKProof(proof)),
+		})
+	}
+
+	originalShareIndices := global.KeySwitchKeys.ShareIndices
+	global.KeySwitchKeys.ShareIndices = shareIndices
+	defer func() { global.KeySwitchKeys.ShareIndices = originalShareIndices }()
+
+	// 所需的份额数量取自会话的触发器，而非登记的服务器数量
+	svc := &KeySwitchService{}
+	for _, numSharesExpected := range []int{2, 3} {
+		numShares, err := getNumSharesExpected(&keyswitch.KeySwitchTriggerStored{KeySwitchSessionID: "session1", NumSharesExpected: numSharesExpected})
+		if isNoError := assert.NoError(t, err); !isNoError {
+			t.FailNow()
+		}
+
+		shares, indices, err := collectSharesFromKeySwitchResults("", ksResults, ksServers, numShares, &targetPrivKey.PublicKey, encryptedKey, svc)
+		if isNoError := assert.NoError(t, err, numSharesExpected); !isNoError {
+			t.FailNow()
+		}
+		assert.Equal(t, numSharesExpected, len(shares))
+
+		decryptedKey, err := svc.GetDecryptedKey(shares, indices, encryptedKey, targetPrivKey)
+		if isNoError := assert.NoError(t, err, numSharesExpected); !isNoError {
+			t.FailNow()
+		}
+		assert.Equal(t, 0, key.X.Cmp(decryptedKey.X), numSharesExpected)
+	}
+
+	// 结果不足会话所需的数量
+	_, _, err = collectSharesFromKeySwitchResults("", ksResults[:1], ksServers, 2, &targetPrivKey.PublicKey, encryptedKey, svc)
+	assert.Error(t, err)
+
+	// 没有记录所需份额数量的会话无法收集
+	_, err = getNumSharesExpected(&keyswitch.KeySwitchTriggerStored{KeySwitchSessionID: "session1"})
+	assert.Error(t, err)
+}
+
+func TestCollectSharesForResourceInMultiResourceSession(t *testing.T) {
+	serverKey, err := ppks.GenPrivKey()
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	targetPrivKey, err := ppks.GenPrivKey()
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	// 一个服务器为两个资源各计算一份份额，放在同一个密钥置换结果中
+	svc := &KeySwitchService{}
+	resourceIDs := []string{"101", "102"}
+	keys := map[string]*ppks.CurvePoint{}
+	encryptedKeys := map[string]*ppks.CipherText{}
+	ksResult := &keyswitch.KeySwitchResultStored{
+		Creator:     "server1",
+		KeySwitchPK: base64.StdEncoding.EncodeToString(cipherutils.SerializeSM2PublicKey(&serverKey.PublicKey)),
+	}
+	for _, resourceID := range resourceIDs {
+		keys[resourceID] = ppks.GenPoint()
+		encryptedKeys[resourceID], err = ppks.PointEncrypt(&serverKey.PublicKey, keys[resourceID])
+		if isNoError := assert.NoError(t, err); !isNoError {
+			t.FailNow()
+		}
+
+		share, zkpRi, err := ppks.ShareCal(&targetPrivKey.PublicKey, &encryptedKeys[resourceID].K, serverKey)
+		if isNoError := assert.NoError(t, err); !isNoError {
+			t.FailNow()
+		}
+
+		proof := &cipherutils.ZKProof{}
+		proof.C, proof.R1, proof.R2, err = ppks.ShareProofGenNoB(zkpRi, serverKey, share, &targetPrivKey.PublicKey, &encryptedKeys[resourceID].K)
+		if isNoError := assert.NoError(t, err); !isNoError {
+			t.FailNow()
+		}
+
+		ksResult.Shares = append(ksResult.Shares, keyswitch.KeySwitchShare{
+			ResourceID: resourceID,
+			Share:      base64.StdEncoding.EncodeToString(cipherutils.SerializeCipherText(share)),
+			ZKProof:    base64.StdEncoding.EncodeToString(cipherutils.SerializeZKProof(proof)),
+		})
+	}
+
+	ksServers := []keyswitch.KeySwitchServerStored{{PublicKey: "server1", KeySwitchPK: ksResult.KeySwitchPK}}
+
+	// 每个资源只取其自己的份额解密
+	for _, resourceID := range resourceIDs {
+		shares, shareIndices, err := collectSharesFromKeySwitchResults(resourceID, []*keyswitch.KeySwitchResultStored{ksResult}, ksServers, 1, &targetPrivKey.PublicKey, encryptedKeys[resourceID], svc)
+		if isNoError := assert.NoError(t, err, resourceID); !isNoError {
+			t.FailNow()
+		}
+
+		decryptedKey, err := svc.GetDecryptedKey(shares, shareIndices, encryptedKeys[resourceID], targetPrivKey)
+		if isNoError := assert.NoError(t, err, resourceID); !isNoError {
+			t.FailNow()
+		}
+		assert.Equal(t, 0, keys[resourceID].X.Cmp(decryptedKey.X), resourceID)
+	}
+
+	// 结果中没有的资源收集不到份额
+	_, _, err = collectSharesFromKeySwitchResults("103", []*keyswitch.KeySwitchResultStored{ksResult}, ksServers, 1, &targetPrivKey.PublicKey, encryptedKeys["101"], svc)
+	assert.Error(t, err)
+
+	// 等待结果时须通过会话中所有资源的验证
+	collector := newKeySwitchShareCollector(ksServers, 1, &targetPrivKey.PublicKey, encryptedKeys, svc)
+	assert.NoError(t, collector.add(ksResult))
+	assert.True(t, collector.isComplete())
+
+	swappedEncryptedKeys := map[string]*ppks.CipherText{"101": encryptedKeys["102"], "102": encryptedKeys["101"]}
+	collector = newKeySwitchShareCollector(ksServers, 1, &targetPrivKey.PublicKey, swappedEncryptedKeys, svc)
+	assert.Error(t, collector.add(ksResult))
+	assert.False(t, collector.isComplete())
+}
+
+func TestCollectSharesFromCommittedKeySwitchResult(t *testing.T) {
+	serverKey, err := ppks.GenPrivKey()
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	targetPrivKey, err := ppks.GenPrivKey()
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	key := ppks.GenPoint()
+	encryptedKey, err := ppks.PointEncrypt(&serverKey.PublicKey, key)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	share, zkpRi, err := ppks.ShareCal(&targetPrivKey.PublicKey, &encryptedKey.K, serverKey)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	proof := &cipherutils.ZKProof{}
+	proof.C, proof.R1, proof.R2, err = ppks.ShareProofGenNoB(zkpRi, serverKey, share, &targetPrivKey.PublicKey, &encryptedKey.K)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	// 链上只有份额的承诺
+	resourceShare := &keyswitch.KeySwitchShare{
+		ResourceID: "101",
+		Share:      base64.StdEncoding.EncodeToString(cipherutils.SerializeCipherText(share)),
+		ZKProof:    base64.StdEncoding.EncodeToString(cipherutils.SerializeZKProof(proof)),
+	}
+	commitment, err := keyswitch.GetKeySwitchShareCommitment(resourceShare.Share, resourceShare.ZKProof)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	ksResult := &keyswitch.KeySwitchResultStored{
+		KeySwitchSessionID: "session1",
+		KeySwitchPK:        base64.StdEncoding.EncodeToString(cipherutils.SerializeSM2PublicKey(&serverKey.PublicKey)),
+		Creator:            "server1",
+		Commitment:         commitment,
+	}
+	ksServers := []keyswitch.KeySwitchServerStored{{PublicKey: "server1", KeySwitchPK: ksResult.KeySwitchPK}}
+	ksResults := []*keyswitch.KeySwitchResultStored{ksResult}
+
+	// 未收到交付的份额时无法验证
+	svc := &KeySwitchService{}
+	_, _, err = collectSharesFromKeySwitchResults("101", ksResults, ksServers, 1, &targetPrivKey.PublicKey, encryptedKey, svc)
+	assert.Error(t, err)
+
+	if isNoError := assert.NoError(t, svc.getShareStore().put("session1", resourceShare)); !isNoError {
+		t.FailNow()
+	}
+
+	shares, shareIndices, err := collectSharesFromKeySwitchResults("101", ksResults, ksServers, 1, &targetPrivKey.PublicKey, encryptedKey, svc)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	decryptedKey, err := svc.GetDecryptedKey(shares, shareIndices, encryptedKey, targetPrivKey)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	assert.Equal(t, 0, key.X.Cmp(decryptedKey.X))
+
+	// 与链上承诺不符的份额不被采用
+	ksResult.Commitment = base64.StdEncoding.EncodeToString(make([]byte, 32))
+	_, _, err = collectSharesFromKeySwitchResults("101", ksResults, ksServers, 1, &targetPrivKey.PublicKey, encryptedKey, svc)
+	assert.Error(t, err)
+}
+
+func TestVerifySharesFromKeySwitchResultsConcurrently(t *testing.T) {
+	targetPrivKey, err := ppks.GenPrivKey()
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	// 每个服务器的份额以各自的密钥置换公钥验证，因此加密密钥以任意公钥加密均可
+	encryptedKey, err := ppks.PointEncrypt(&targetPrivKey.PublicKey, ppks.GenPoint())
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	var ksResults []*keyswitch.KeySwitchResultStored
+	for i := 0; i < 4; i++ {
+		serverKey, err := ppks.GenPrivKey()
+		if isNoError := assert.NoError(t, err); !isNoError {
+			t.FailNow()
+		}
+
+		share, zkpRi, err := ppks.ShareCal(&targetPrivKey.PublicKey, &encryptedKey.K, serverKey)
+		if isNoError := assert.NoError(t, err); !isNoError {
+			t.FailNow()
+		}
+
+		proof := &cipherutils.ZKProof{}
+		proof.C, proof.R1, proof.R2, err = ppks.ShareProofGenNoB(zkpRi, serverKey, share, &targetPrivKey.PublicKey, &encryptedKey.K)
+		if isNoError := assert.NoError(t, err); !isNoError {
+			t.FailNow()
+		}
+
+		ksResults = append(ksResults, &keyswitch.KeySwitchResultStored{
+			KeySwitchSessionID: "session1",
+			Share:              base64.StdEncoding.EncodeToString(cipherutils.SerializeCipherText(share)),
+			ZKProof:            base64.StdEncoding.EncodeToString(cipherutils.SerializeZKProof(proof)),
+			KeySwitchPK:        base64.StdEncoding.EncodeToString(cipherutils.SerializeSM2PublicKey(&serverKey.PublicKey)),
+		})
+	}
+
+	// 第 2 份结果附上其他服务器的证明，无法通过验证
+	ksResults[2].ZKProof = ksResults[0].ZKProof
+
+	svc := &KeySwitchService{}
+	shares, errs := verifySharesFromKeySwitchResultsConcurrently(ksResults, &targetPrivKey.PublicKey, encryptedKey, svc)
+	if isEqual := assert.Len(t, shares, len(ksResults)); !isEqual {
+		t.FailNow()
+	}
+	for i := range ksResults {
+		if i == 2 {
+			assert.Nil(t, shares[i])
+			assert.Error(t, errs[i])
+			continue
+		}
+
+		assert.NotNil(t, shares[i])
+		assert.NoError(t, errs[i])
+	}
+
+	// n-of-n 模式下任一份额未通过验证即失败
+	_, err = parseAndVerifySharesFromKeySwitchResults(ksResults, &targetPrivKey.PublicKey, encryptedKey, svc)
+	assert.Error(t, err)
+
+	shares, err = parseAndVerifySharesFromKeySwitchResults(ksResults[:2], &targetPrivKey.PublicKey, encryptedKey, svc)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	assert.Len(t, shares, 2)
+}
+
+func TestGetKeySwitchServerStatuses(t *testing.T) {
+	ksServers := []keyswitch.KeySwitchServerStored{
+		{PublicKey: "server1"},
+		{PublicKey: "server2"},
+		{PublicKey: "server3"},
+	}
+
+	now := time.Now()
+	heartbeats := []keyswitch.KeySwitchServerHeartbeatStored{
+		{PublicKey: "server1", Version: "1.0.0", Timestamp: now.Add(-KeySwitchServerHeartbeatInterval)},
+		{PublicKey: "server2", Version: "1.0.0", Timestamp: now.Add(-keySwitchServerStaleAfter - time.Second)},
+		{PublicKey: "deregistered", Timestamp: now},
+	}
+
+	// 已移除登记的服务器的心跳不计入
+	statuses := getKeySwitchServerStatuses(ksServers, heartbeats, now)
+	if isEqual := assert.Len(t, statuses, 3); !isEqual {
+		t.FailNow()
+	}
+
+	assert.Equal(t, keyswitch.Alive, statuses[0].Liveness)
+	assert.Equal(t, "1.0.0", statuses[0].Heartbeat.Version)
+	assert.Equal(t, keyswitch.Stale, statuses[1].Liveness)
+	assert.Equal(t, keyswitch.Missing, statuses[2].Liveness)
+	assert.Nil(t, statuses[2].Heartbeat)
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// 密钥置换结果事件的事件 ID 模式，匹配所有会话的 "ks_${keySwitchSessionID}_result" 与 "ks_${keySwitchSessionID}_complete"。
+// 会话因最后一份份额完成时链码发出后者。两者内容均为 "ks_${keySwitchSessionID}_result_${creator}"。
+const keySwitchResultEventIDPattern = "^ks_.+_(result|complete)$"
+
+// keySwitchResultAggregator 以一个长期的事件订阅接收一个链码的所有密钥置换结果事件，并将其分发给等待对应会话的调用者。
+// 订阅在第一个调用者等待时建立，断开后由下一个调用者重新建立。
+type keySwitchResultAggregator struct {
+	registerFunc   func() (fab.Registration, <-chan *fab.CCEvent, error)
+	unregisterFunc func(reg fab.Registration)
+	mu             sync.Mutex
+	reg            fab.Registration
+	isSubscribed   bool
+	waiters        map[string]map[*keySwitchResultWaiter]struct{} // 按密钥置换会话 ID 索引的等待者
+}
+
+// keySwitchResultWaiter 表示一个等待某一密钥置换会话的结果的调用者。收到的结果创建者暂存于其中，由调用者取走。
+type keySwitchResultWaiter struct {
+	keySwitchSessionID string
+	mu                 sync.Mutex
+	resultCreators     []string
+	err                error
+	chanNotify         chan struct{} // 有新的结果或出错时收到通知
+}
+
+// 创建一个密钥置换结果聚合器。
+//
+// 参数：
+//   用于订阅结果事件的函数
+//   用于取消订阅的函数
+//
+// 返回：
+//   密钥置换结果聚合器
+func newKeySwitchResultAggregator(registerFunc func() (fab.Registration, <-chan *fab.CCEvent, error), unregisterFunc func(reg fab.Registration)) *keySwitchResultAggregator {
+	return &keySwitchResultAggregator{
+		registerFunc:   registerFunc,
+		unregisterFunc: unregisterFunc,
+		waiters:        map[string]map[*keySwitchResultWaiter]struct{}{},
+	}
+}
+
+// 开始等待某一密钥置换会话的结果。若尚未订阅结果事件则先订阅。等待结束后须调用 `unsubscribe()`。
+//
+// 参数：
+//   密钥置换会话 ID
+//
+// 返回：
+//   等待者
+func (a *keySwitchResultAggregator) subscribe(keySwitchSessionID string) (*keySwitchResultWaiter, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.isSubscribed {
+		reg, notifier, err := a.registerFunc()
+		if err != nil {
+			return nil, errors.Wrap(err, "无法监听密钥置换结果事件")
+		}
+
+		a.reg = reg
+		a.isSubscribed = true
+		go a.dispatch(reg, notifier)
+	}
+
+	w := &keySwitchResultWaiter{
+		keySwitchSessionID: keySwitchSessionID,
+		chanNotify:         make(chan struct{}, 1),
+	}
+
+	if _, ok := a.waiters[keySwitchSessionID]; !ok {
+		a.waiters[keySwitchSessionID] = map[*keySwitchResultWaiter]struct{}{}
+	}
+	a.waiters[keySwitchSessionID][w] = struct{}{}
+
+	return w, nil
+}
+
+// 结束等待。
+func (a *keySwitchResultAggregator) unsubscribe(w *keySwitchResultWaiter) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	sessionWaiters, ok := a.waiters[w.keySwitchSessionID]
+	if !ok {
+		return
+	}
+
+	delete(sessionWaiters, w)
+	if len(sessionWaiters) == 0 {
+		delete(a.waiters, w.keySwitchSessionID)
+	}
+}
+
+// 取消结果事件的订阅。仍在等待的调用者将收到错误。
+func (a *keySwitchResultAggregator) close() {
+	a.mu.Lock()
+	isSubscribed, reg := a.isSubscribed, a.reg
+	a.isSubscribed = false
+	a.mu.Unlock()
+
+	// 取消订阅会关闭事件 channel，由 dispatch 通知等待者
+	if isSubscribed {
+		a.unregisterFunc(reg)
+	}
+}
+
+// 将收到的事件分发给等待对应会话的调用者，直至事件 channel 被关闭。
+func (a *keySwitchResultAggregator) dispatch(reg fab.Registration, notifier <-chan *fab.CCEvent) {
+	for event := range notifier {
+		log.Debugf("收到事件 {'%v': '%s'}", event.EventName, event.Payload)
+		keySwitchSessionID, resultCreator, err := parseKeySwitchResultEventPayload(event.Payload)
+		if err != nil {
+			log.Errorln(err)
+			continue
+		}
+
+		a.mu.Lock()
+		for w := range a.waiters[keySwitchSessionID] {
+			w.notify(resultCreator)
+		}
+		a.mu.Unlock()
+	}
+
+	// 事件 channel 被关闭，订阅已失效。通知所有等待者，并由下一个调用者重新订阅。
+	// 若此时已重新订阅，等待者由新的订阅服务，不应因旧订阅的断开而收到错误。
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.reg != reg {
+		return
+	}
+	a.isSubscribed = false
+
+	for _, sessionWaiters := range a.waiters {
+		for w := range sessionWaiters {
+			w.fail(fmt.Errorf("密钥置换结果事件的订阅已断开"))
+		}
+	}
+}
+
+// 解析密钥置换结果事件的内容 "ks_${keySwitchSessionID}_result_${creator}"。
+func parseKeySwitchResultEventPayload(payload []byte) (keySwitchSessionID string, resultCreator string, err error) {
+	dbKeyParts := strings.Split(string(payload), "_")
+	if len(dbKeyParts) != 4 || dbKeyParts[0] != "ks" || dbKeyParts[2] != "result" {
+		err = fmt.Errorf("不合法的事件内容: %s", payload)
+		return
+	}
+
+	keySwitchSessionID, resultCreator = dbKeyParts[1], dbKeyParts[3]
+	return
+}
+
+func (w *keySwitchResultWaiter) notify(resultCreator string) {
+	w.mu.Lock()
+	w.resultCreators = append(w.resultCreators, resultCreator)
+	w.mu.Unlock()
+
+	select {
+	case w.chanNotify <- struct{}{}:
+	default:
+	}
+}
+
+func (w *keySwitchResultWaiter) fail(err error) {
+	w.mu.Lock()
+	w.err = err
+	w.mu.Unlock()
+
+	select {
+	case w.chanNotify <- struct{}{}:
+	default:
+	}
+}
+
+// 取走暂存的结果创建者。
+//
+// 返回：
+//   自上次取走后收到的结果创建者
+//   订阅出错时的错误
+func (w *keySwitchResultWaiter) take() ([]string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	resultCreators := w.resultCreators
+	w.resultCreators = nil
+	return resultCreators, w.err
+}
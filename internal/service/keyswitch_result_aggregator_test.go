@@ -0,0 +1,173 @@
+package service
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/stretchr/testify/assert"
+)
+
+// 模拟的事件订阅，记录订阅次数并允许测试发送事件。
+type mockKeySwitchResultSubscription struct {
+	mu            sync.Mutex
+	numRegistered int
+	notifier      chan *fab.CCEvent
+}
+
+func (m *mockKeySwitchResultSubscription) register() (fab.Registration, <-chan *fab.CCEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.numRegistered++
+	m.notifier = make(chan *fab.CCEvent)
+	return m.numRegistered, m.notifier, nil
+}
+
+func (m *mockKeySwitchResultSubscription) unregister(reg fab.Registration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	close(m.notifier)
+}
+
+func (m *mockKeySwitchResultSubscription) send(payload string) {
+	m.mu.Lock()
+	notifier := m.notifier
+	m.mu.Unlock()
+
+	notifier <- &fab.CCEvent{EventName: "ks_result", Payload: []byte(payload)}
+}
+
+func awaitResultCreators(t *testing.T, w *keySwitchResultWaiter, numExpected int) []string {
+	var ret []string
+	for len(ret) < numExpected {
+		select {
+		case <-w.chanNotify:
+			resultCreators, err := w.take()
+			if isNoError := assert.NoError(t, err); !isNoError {
+				t.FailNow()
+			}
+			ret = append(ret, resultCreators...)
+		case <-time.After(time.Second):
+			t.Fatalf("等待结果超时，已收到 %v", ret)
+		}
+	}
+
+	return ret
+}
+
+func TestKeySwitchResultAggregatorDispatch(t *testing.T) {
+	subscription := &mockKeySwitchResultSubscription{}
+	aggregator := newKeySwitchResultAggregator(subscription.register, subscription.unregister)
+
+	// 两个调用者等待同一会话，另一个调用者等待另一会话，共用一个订阅
+	w1, err := aggregator.subscribe("s1")
+	assert.NoError(t, err)
+	w2, err := aggregator.subscribe("s1")
+	assert.NoError(t, err)
+	w3, err := aggregator.subscribe("s2")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, subscription.numRegistered)
+
+	subscription.send("ks_s1_result_creator1")
+	subscription.send("invalid")
+	subscription.send("ks_s2_result_creator2")
+	subscription.send("ks_s3_result_creator3")
+	subscription.send("ks_s1_result_creator2")
+
+	assert.Equal(t, []string{"creator1", "creator2"}, awaitResultCreators(t, w1, 2))
+	assert.Equal(t, []string{"creator1", "creator2"}, awaitResultCreators(t, w2, 2))
+	assert.Equal(t, []string{"creator2"}, awaitResultCreators(t, w3, 1))
+
+	// 结束等待后不再收到事件
+	aggregator.unsubscribe(w1)
+	subscription.send("ks_s1_result_creator3")
+	assert.Equal(t, []string{"creator3"}, awaitResultCreators(t, w2, 1))
+	resultCreators, err := w1.take()
+	assert.NoError(t, err)
+	assert.Empty(t, resultCreators)
+
+	// 订阅断开时通知仍在等待的调用者，下一个调用者重新订阅
+	aggregator.close()
+	select {
+	case <-w3.chanNotify:
+		_, err = w3.take()
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("未收到订阅断开的通知")
+	}
+
+	aggregator.unsubscribe(w2)
+	aggregator.unsubscribe(w3)
+	assert.Eventually(t, func() bool {
+		aggregator.mu.Lock()
+		defer aggregator.mu.Unlock()
+		return !aggregator.isSubscribed
+	}, time.Second, 5*time.Millisecond)
+
+	w4, err := aggregator.subscribe("s4")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, subscription.numRegistered)
+	subscription.send("ks_s4_result_creator1")
+	assert.Equal(t, []string{"creator1"}, awaitResultCreators(t, w4, 1))
+}
+
+func TestKeySwitchResultAggregatorResubscribe(t *testing.T) {
+	// 取消订阅后事件 channel 不立即关闭，由测试决定何时关闭
+	var notifiers []chan *fab.CCEvent
+	register := func() (fab.Registration, <-chan *fab.CCEvent, error) {
+		notifier := make(chan *fab.CCEvent)
+		notifiers = append(notifiers, notifier)
+		return len(notifiers), notifier, nil
+	}
+	aggregator := newKeySwitchResultAggregator(register, func(reg fab.Registration) {})
+
+	w1, err := aggregator.subscribe("s1")
+	assert.NoError(t, err)
+
+	// 取消订阅后、旧的事件 channel 关闭前重新订阅
+	aggregator.close()
+	w2, err := aggregator.subscribe("s2")
+	assert.NoError(t, err)
+	if isEqual := assert.Len(t, notifiers, 2); !isEqual {
+		t.FailNow()
+	}
+
+	// 旧的事件 channel 关闭不影响由新订阅服务的等待者
+	close(notifiers[0])
+	assert.Never(t, func() bool {
+		_, err1 := w1.take()
+		_, err2 := w2.take()
+		return err1 != nil || err2 != nil
+	}, 100*time.Millisecond, 5*time.Millisecond)
+	notifiers[1] <- &fab.CCEvent{EventName: "ks_result", Payload: []byte("ks_s2_result_creator1")}
+	notifiers[1] <- &fab.CCEvent{EventName: "ks_result", Payload: []byte("ks_s1_result_creator2")}
+	assert.Equal(t, []string{"creator1"}, awaitResultCreators(t, w2, 1))
+	assert.Equal(t, []string{"creator2"}, awaitResultCreators(t, w1, 1))
+
+	aggregator.mu.Lock()
+	assert.True(t, aggregator.isSubscribed)
+	aggregator.mu.Unlock()
+
+	// 新的事件 channel 关闭时通知仍在等待的调用者
+	close(notifiers[1])
+	select {
+	case <-w2.chanNotify:
+		_, err = w2.take()
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("未收到订阅断开的通知")
+	}
+}
+
+func TestParseKeySwitchResultEventPayload(t *testing.T) {
+	keySwitchSessionID, resultCreator, err := parseKeySwitchResultEventPayload([]byte("ks_abc_result_MFkw+/="))
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", keySwitchSessionID)
+	assert.Equal(t, "MFkw+/=", resultCreator)
+
+	_, _, err = parseKeySwitchResultEventPayload([]byte("ks_abc_complete"))
+	assert.Error(t, err)
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"crypto"
 	"encoding/base64"
 	"encoding/json"
@@ -12,17 +13,31 @@ import (
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/global"
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/utils/cipherutils"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/ksclient"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/data"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/keyswitch"
 	"github.com/XiaoYao-austin/ppks"
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/tjfoc/gmsm/sm2"
 )
 
+// KeySwitchServerHeartbeatInterval 为密钥置换服务器记录心跳的间隔
+const KeySwitchServerHeartbeatInterval = 30 * time.Second
+
+// 超过该时长未记录心跳的密钥置换服务器视为失联
+const keySwitchServerStaleAfter = 3 * KeySwitchServerHeartbeatInterval
+
 // KeySwitchService 实现了 `KeySwitchServiceInterface` 接口，提供有关于密钥置换的服务
 type KeySwitchService struct {
-	ServiceInfo *Info
+	ServiceInfo          *Info
+	ShareDeliveryURL     string // 链下交付份额的地址。非空时本实例创建的密钥置换会话启用链下份额交付。
+	resultAggregator     *keySwitchResultAggregator
+	resultAggregatorOnce sync.Once
+	shareStore           *keySwitchShareStore
+	shareStoreOnce       sync.Once
 }
 
 // 创建密文访问申请/密钥置换触发器。
@@ -34,20 +49,81 @@ type KeySwitchService struct {
 // 返回：
 //   交易 ID（亦即密钥置换会话 ID）
 func (s *KeySwitchService) CreateKeySwitchTrigger(resourceID string, authSessionID string) (string, error) {
+	return s.CreateKeySwitchTriggerWithPublicKey(resourceID, authSessionID, global.KeySwitchKeys.PublicKey)
+}
+
+// 以访问申请者自己的密钥置换公钥创建密文访问申请/密钥置换触发器。份额将以该公钥为目标计算，由持有对应私钥的访问申请者自行解密。
+//
+// 参数：
+//   资源 ID
+//   授权会话 ID
+//   访问申请者的密钥置换公钥
+//
+// 返回：
+//   交易 ID（亦即密钥置换会话 ID）
+func (s *KeySwitchService) CreateKeySwitchTriggerWithPublicKey(resourceID string, authSessionID string, keySwitchPK *sm2.PublicKey) (string, error) {
 	if strings.TrimSpace(resourceID) == "" {
 		return "", fmt.Errorf("资源 ID 不能为空")
 	}
 
-	// 将公钥序列化为定长字节切片
-	ksPubKey := cipherutils.SerializeSM2PublicKey(global.KeySwitchKeys.PublicKey)
-
-	// 组装一个 KeySwitchTrigger 对象，并调用链码
 	ksTrigger := keyswitch.KeySwitchTrigger{
 		ResourceID:    resourceID,
 		AuthSessionID: authSessionID,
-		KeySwitchPK:   base64.StdEncoding.EncodeToString(ksPubKey),
 	}
 
+	return s.createKeySwitchTrigger(&ksTrigger, keySwitchPK)
+}
+
+// 创建涵盖多个资源的密文访问申请/密钥置换触发器。链码对每个资源分别进行授权或访问策略检查，任一资源未通过即拒绝整个申请。
+//
+// 参数：
+//   资源 ID 列表
+//   按资源 ID 索引的授权会话 ID。未指定的资源依据其访问策略检查。
+//
+// 返回：
+//   交易 ID（亦即密钥置换会话 ID）
+func (s *KeySwitchService) CreateKeySwitchTriggerForResources(resourceIDs []string, authSessionIDs map[string]string) (string, error) {
+	return s.CreateKeySwitchTriggerForResourcesWithPublicKey(resourceIDs, authSessionIDs, global.KeySwitchKeys.PublicKey)
+}
+
+// 以访问申请者自己的密钥置换公钥创建涵盖多个资源的密文访问申请/密钥置换触发器。
+//
+// 参数：
+//   资源 ID 列表
+//   按资源 ID 索引的授权会话 ID。未指定的资源依据其访问策略检查。
+//   访问申请者的密钥置换公钥
+//
+// 返回：
+//   交易 ID（亦即密钥置换会话 ID）
+func (s *KeySwitchService) CreateKeySwitchTriggerForResourcesWithPublicKey(resourceIDs []string, authSessionIDs map[string]string, keySwitchPK *sm2.PublicKey) (string, error) {
+	if len(resourceIDs) == 0 {
+		return "", &ErrorBadRequest{errMsg: "资源 ID 列表不能为空。"}
+	}
+	for _, resourceID := range resourceIDs {
+		if strings.TrimSpace(resourceID) == "" {
+			return "", &ErrorBadRequest{errMsg: "资源 ID 不能为空。"}
+		}
+	}
+
+	ksTrigger := keyswitch.KeySwitchTrigger{
+		ResourceIDs:    resourceIDs,
+		AuthSessionIDs: authSessionIDs,
+	}
+
+	return s.createKeySwitchTrigger(&ksTrigger, keySwitchPK)
+}
+
+// 填入访问申请者的密钥置换公钥并调用链码创建密钥置换触发器。
+func (s *KeySwitchService) createKeySwitchTrigger(ksTrigger *keyswitch.KeySwitchTrigger, keySwitchPK *sm2.PublicKey) (string, error) {
+	if keySwitchPK == nil {
+		return "", &ErrorBadRequest{errMsg: "访问申请者的密钥置换公钥不能为空。"}
+	}
+
+	// 将公钥序列化为定长字节切片
+	ksPubKey := cipherutils.SerializeSM2PublicKey(keySwitchPK)
+	ksTrigger.KeySwitchPK = base64.StdEncoding.EncodeToString(ksPubKey)
+	ksTrigger.ShareDeliveryURL = s.ShareDeliveryURL
+
 	ksTriggerBytes, err := json.Marshal(ksTrigger)
 	if err != nil {
 		return "", errors.Wrap(err, "无法序列化链码参数")
@@ -64,9 +140,9 @@ func (s *KeySwitchService) CreateKeySwitchTrigger(resourceID string, authSession
 	resp, err := s.ServiceInfo.ChannelClient.Execute(channelReq)
 	if err != nil {
 		return "", GetClassifiedError(chaincodeFcn, err)
-	} else {
-		return string(resp.TransactionID), nil
 	}
+
+	return string(resp.TransactionID), nil
 }
 
 // 创建密钥置换结果。
@@ -122,6 +198,209 @@ func (s *KeySwitchService) CreateKeySwitchResult(keySwitchSessionID string, shar
 	}
 }
 
+// 为多资源的密钥置换会话创建密钥置换结果。各资源的份额在一笔交易中提交。
+//
+// 参数：
+//   密钥置换会话 ID
+//   会话中的资源 ID 列表（与触发器中的顺序一致）
+//   各资源的个人份额
+//   关于各份额的零知识证明
+//
+// 返回：
+//   交易 ID
+func (s *KeySwitchService) CreateKeySwitchResultForResources(keySwitchSessionID string, resourceIDs []string, shares []*ppks.CipherText, proofs []*cipherutils.ZKProof) (string, error) {
+	if strings.TrimSpace(keySwitchSessionID) == "" {
+		return "", fmt.Errorf("密钥置换会话 ID 不能为空")
+	}
+	if len(shares) != len(resourceIDs) || len(proofs) != len(resourceIDs) {
+		return "", fmt.Errorf("份额与零知识证明的数量应与资源数量一致")
+	}
+
+	var resourceShares []keyswitch.KeySwitchShare
+	for i, resourceID := range resourceIDs {
+		resourceShares = append(resourceShares, keyswitch.KeySwitchShare{
+			ResourceID: resourceID,
+			Share:      base64.StdEncoding.EncodeToString(cipherutils.SerializeCipherText(shares[i])),
+			ZKProof:    base64.StdEncoding.EncodeToString(cipherutils.SerializeZKProof(proofs[i])),
+		})
+	}
+
+	ksPubKeyBytes := cipherutils.SerializeSM2PublicKey(global.KeySwitchKeys.PublicKey)
+
+	keySwitchResult := keyswitch.KeySwitchResult{
+		KeySwitchSessionID: keySwitchSessionID,
+		Shares:             resourceShares,
+		KeySwitchPK:        base64.StdEncoding.EncodeToString(ksPubKeyBytes),
+	}
+
+	keySwitchResultBytes, err := json.Marshal(keySwitchResult)
+	if err != nil {
+		return "", errors.Wrap(err, "无法序列化链码参数")
+	}
+
+	chaincodeFcn := "createKeySwitchResult"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{keySwitchResultBytes},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Execute(channelReq)
+	if err != nil {
+		return "", GetClassifiedError(chaincodeFcn, err)
+	}
+
+	return string(resp.TransactionID), nil
+}
+
+// 为启用了链下份额交付的密钥置换会话创建密钥置换结果。份额已直接交付给访问申请者，链上只记录各份额的承诺。
+//
+// 参数：
+//   密钥置换会话 ID
+//   多资源会话中的资源 ID 列表（与触发器中的顺序一致）。单资源会话为 nil。
+//   各份额的承诺。单资源会话只有一份。
+//
+// 返回：
+//   交易 ID
+func (s *KeySwitchService) CreateKeySwitchResultWithCommitments(keySwitchSessionID string, resourceIDs []string, commitments []string) (string, error) {
+	if strings.TrimSpace(keySwitchSessionID) == "" {
+		return "", fmt.Errorf("密钥置换会话 ID 不能为空")
+	}
+
+	ksPubKeyBytes := cipherutils.SerializeSM2PublicKey(global.KeySwitchKeys.PublicKey)
+	keySwitchResult := keyswitch.KeySwitchResult{
+		KeySwitchSessionID: keySwitchSessionID,
+		KeySwitchPK:        base64.StdEncoding.EncodeToString(ksPubKeyBytes),
+	}
+
+	if resourceIDs == nil {
+		if len(commitments) != 1 {
+			return "", fmt.Errorf("单资源会话应只有 1 份承诺")
+		}
+		keySwitchResult.Commitment = commitments[0]
+	} else {
+		if len(commitments) != len(resourceIDs) {
+			return "", fmt.Errorf("承诺的数量应与资源数量一致")
+		}
+		for i, resourceID := range resourceIDs {
+			keySwitchResult.Shares = append(keySwitchResult.Shares, keyswitch.KeySwitchShare{
+				ResourceID: resourceID,
+				Commitment: commitments[i],
+			})
+		}
+	}
+
+	keySwitchResultBytes, err := json.Marshal(keySwitchResult)
+	if err != nil {
+		return "", errors.Wrap(err, "无法序列化链码参数")
+	}
+
+	chaincodeFcn := "createKeySwitchResult"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{keySwitchResultBytes},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Execute(channelReq)
+	if err != nil {
+		return "", GetClassifiedError(chaincodeFcn, err)
+	}
+
+	return string(resp.TransactionID), nil
+}
+
+// 接收密钥置换服务器链下交付的份额。交付者须为登记的密钥置换服务器，并以其密钥置换私钥签名。份额暂存于内存，待链上的承诺到达后核对。
+//
+// 参数：
+//   交付的份额
+func (s *KeySwitchService) ReceiveKeySwitchShares(delivery *keyswitch.KeySwitchShareDelivery) error {
+	if strings.TrimSpace(delivery.KeySwitchSessionID) == "" {
+		return &ErrorBadRequest{errMsg: "密钥置换会话 ID 不能为空。"}
+	}
+
+	ksTrigger, err := s.GetKeySwitchSession(delivery.KeySwitchSessionID)
+	if err != nil {
+		return err
+	}
+	if ksTrigger.ShareDeliveryURL == "" {
+		return &ErrorBadRequest{errMsg: "该密钥置换会话未启用链下份额交付。"}
+	}
+
+	resourceIDs := ksTrigger.GetResourceIDs()
+	if len(delivery.Shares) != len(resourceIDs) {
+		return &ErrorBadRequest{errMsg: fmt.Sprintf("份额数量不正确。应为 %v 份。", len(resourceIDs))}
+	}
+	for i, resourceShare := range delivery.Shares {
+		if resourceShare.ResourceID != resourceIDs[i] {
+			return &ErrorBadRequest{errMsg: fmt.Sprintf("第 %v 份份额的资源 ID 应为 '%v'。", i, resourceIDs[i])}
+		}
+	}
+
+	// 只接受登记的密钥置换服务器以其密钥置换私钥签名的交付
+	ksServers, err := s.ListKeySwitchServers()
+	if err != nil {
+		return err
+	}
+
+	isRegistered := false
+	for _, ksServer := range ksServers {
+		isRegistered = isRegistered || ksServer.KeySwitchPK == delivery.KeySwitchPK
+	}
+	if !isRegistered {
+		return errors.Wrap(errorcode.ErrorForbidden, "交付者不是登记的密钥置换服务器")
+	}
+
+	message, err := keyswitch.GetKeySwitchShareDeliveryMessage(delivery)
+	if err != nil {
+		return &ErrorBadRequest{errMsg: err.Error() + "。"}
+	}
+
+	ksPKBytes, err := base64.StdEncoding.DecodeString(delivery.KeySwitchPK)
+	if err != nil {
+		return &ErrorBadRequest{errMsg: "密钥置换公钥应为 64 字节的 Base64 编码。"}
+	}
+	ksPK, err := cipherutils.DeserializeSM2PublicKey(ksPKBytes)
+	if err != nil {
+		return &ErrorBadRequest{errMsg: "密钥置换公钥应为 64 字节的 Base64 编码。"}
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(delivery.Signature)
+	if err != nil || !ksPK.Verify(message, signature) {
+		return errors.Wrap(errorcode.ErrorForbidden, "交付的份额未通过签名验证")
+	}
+
+	for i := range delivery.Shares {
+		if err = s.getShareStore().put(delivery.KeySwitchSessionID, &delivery.Shares[i]); err != nil {
+			return &ErrorBadRequest{errMsg: err.Error() + "。"}
+		}
+	}
+
+	return nil
+}
+
+// 取出链下交付的、与链上的承诺对应的份额，并以承诺核对。未收到时返回 `errorcode.ErrorNotFound`。
+//
+// 参数：
+//   密钥置换会话 ID
+//   链上记录的份额的承诺
+//
+// 返回：
+//   份额（Base64 编码）
+//   零知识证明（Base64 编码）
+func (s *KeySwitchService) GetDeliveredShare(keySwitchSessionID string, commitment string) (string, string, error) {
+	return s.getShareStore().get(keySwitchSessionID, commitment)
+}
+
+// 获取链下交付份额的存储，首次调用时创建。
+func (s *KeySwitchService) getShareStore() *keySwitchShareStore {
+	s.shareStoreOnce.Do(func() {
+		s.shareStore = newKeySwitchShareStore()
+	})
+
+	return s.shareStore
+}
+
 // 验证所获得的份额。
 //
 // 参数：
@@ -146,139 +425,827 @@ func (s *KeySwitchService) VerifyShare(share *ppks.CipherText, proof *cipherutil
 //
 // 参数：
 //   经零知识证明验证的份额
+//   各份额的份额序号。为 nil 时各份额直接相加（n-of-n）；否则各份额按其拉格朗日系数加权后相加（t-of-n），此时只需门限值个份额。
 //   加密后的对称密钥材料
 //   目标用户用于密钥置换的私钥
 //
 // 返回：
 //   解密后的对称密钥材料
-func (s *KeySwitchService) GetDecryptedKey(shares []*ppks.CipherText, encryptedKey *ppks.CipherText, targetPrivateKey *sm2.PrivateKey) (*ppks.CurvePoint, error) {
-	// 组建一个 CipherVector，将每个 CipherText 放入 CipherVector。
-	var cipherVector ppks.CipherVector
-	for _, share := range shares {
-		cipherVector = append(cipherVector, *share)
-	}
+func (s *KeySwitchService) GetDecryptedKey(shares []*ppks.CipherText, shareIndices []int, encryptedKey *ppks.CipherText, targetPrivateKey *sm2.PrivateKey) (*ppks.CurvePoint, error) {
+	return ksclient.DecryptKeyWithShares(shares, shareIndices, encryptedKey, targetPrivateKey)
+}
 
-	// 密钥置换
-	shareReplacedCipherText, err := ppks.ShareReplace(&cipherVector, encryptedKey)
-	if err != nil {
-		return nil, errors.Wrap(err, "无法进行密钥置换")
+// 等待并收集密钥置换结果。只收集链上登记的密钥置换服务器的结果，所需的份额个数由登记的服务器数量（n-of-n）或门限值（t-of-n）决定。
+//
+// 参数：
+//   密钥置换会话 ID
+//   超时时限（可选）
+//
+// 返回：
+//   所需个数的份额列表
+func (s *KeySwitchService) AwaitKeySwitchResults(keySwitchSessionID string, timeout ...int) ([][]byte, error) {
+	// 解析超时时限参数，只允许指定 1 个，为空时默认 20 秒。
+	timeoutInSec := 20
+	if len(timeout) > 1 {
+		return nil, fmt.Errorf("只可指定 1 个超时时限")
+	} else if len(timeout) == 1 {
+		timeoutInSec = timeout[0]
 	}
 
-	// 用用户的私钥解密 CipherText
-	decryptedKey, err := ppks.PointDecrypt(shareReplacedCipherText, targetPrivateKey)
-	if err != nil {
-		return nil, errors.Wrap(err, "无法解密对称密钥材料")
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutInSec)*time.Second)
+	defer cancel()
 
-	return decryptedKey, nil
+	return s.AwaitKeySwitchResultsWithContext(ctx, keySwitchSessionID)
 }
 
-// 等待并收集密钥置换结果。
+// 等待并收集密钥置换结果，直至收集到所需个数的份额或 `ctx` 结束。份额在到达时即以零知识证明验证，未通过验证的份额不计入。
+// 超时返回 `errorcode.ErrorGatewayTimeout`。
 //
 // 参数：
+//   用于超时与取消的上下文
 //   密钥置换会话 ID
-//   预期的份额个数
-//   超时时限（可选）
 //
 // 返回：
-//   预期个数的份额列表
-func (s *KeySwitchService) AwaitKeySwitchResults(keySwitchSessionID string, numExpected int, timeout ...int) ([][]byte, error) {
+//   所需个数的份额列表
+func (s *KeySwitchService) AwaitKeySwitchResultsWithContext(ctx context.Context, keySwitchSessionID string) ([][]byte, error) {
 	// keySwitchSessionID 不能为空
 	if strings.TrimSpace(keySwitchSessionID) == "" {
 		return nil, fmt.Errorf("密钥转换会话 ID 不能为空")
 	}
 
-	// 解析超时时限参数，只允许指定 1 个，为空时默认 20 秒。
-	timeoutInSec := 20
-	if len(timeout) > 1 {
-		return nil, fmt.Errorf("只可指定 1 个超时时限")
-	} else if len(timeout) == 1 {
-		timeoutInSec = timeout[0]
+	// 先开始等待再查询链上已有的结果，以免漏掉两者之间到达的结果
+	waiter, err := s.getResultAggregator().subscribe(keySwitchSessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer s.getResultAggregator().unsubscribe(waiter)
+
+	// 从链上的登记获取密钥置换服务器，只接受其提交的结果
+	ksServers, err := s.ListKeySwitchServers()
+	if err != nil {
+		return nil, err
+	}
+	if len(ksServers) == 0 {
+		return nil, fmt.Errorf("没有登记的密钥置换服务器")
 	}
 
-	// 尝试监听事件 "ks_${keySwitchSessionID}_result"。事件内容为 "ks_${keySwitchSessionID}_result_${creator}"。若失败则提前返回。
-	eventID := "ks_" + keySwitchSessionID + "_result"
-	reg, notifier, err := RegisterEvent(s.ServiceInfo.EventClient, s.ServiceInfo.ChaincodeID, eventID)
-	defer s.ServiceInfo.ChannelClient.UnregisterChaincodeEvent(reg)
+	// 获取所需的份额个数，以及验证份额所需的目标公钥与资源的加密密钥
+	ksTrigger, err := s.GetKeySwitchSession(keySwitchSessionID)
+	if err != nil {
+		return nil, err
+	}
 
+	numSharesExpected, err := getNumSharesExpected(ksTrigger)
 	if err != nil {
-		return nil, errors.Wrap(err, "无法监听密钥置换结果事件")
+		return nil, err
 	}
 
-	// 接收 channel 内容（一个密钥置换会话 ID），对每个 ID 新开一个 Go routine 调用链码获取一次置换份额，并将结果放入列表。若在时限内未能接收到预期数量的 ID，则等待已发送的 Go routine 结束后，放弃此次结果，并返回超时错误。
-	receivedIDs := []string{}
-	ret := [][]byte{}
-	var wg sync.WaitGroup
-	chanError := make(chan error)
+	targetPublicKey, encryptedKeys, err := s.getKeySwitchVerificationMaterials(ksTrigger)
+	if err != nil {
+		return nil, err
+	}
 
-eventHandler:
-	for {
-		select {
-		case eventVal := <-notifier:
-			log.Debugf("收到事件 {'%v': '%s'}", eventID, eventVal.Payload)
-			dbKeyParts := strings.Split(string(eventVal.Payload), "_")
-			if len(dbKeyParts) != 4 {
-				wg.Wait()
-				return nil, fmt.Errorf("不合法的事件内容: %v", eventVal)
-			}
-			receivedIDs = append(receivedIDs, dbKeyParts[1])
+	collector := newKeySwitchShareCollector(ksServers, numSharesExpected, targetPublicKey, encryptedKeys, s)
 
-			wg.Add(1)
-			go func(chanErr chan error) {
-				defer wg.Done()
+	// 收集链上已有的结果
+	existingKSResults, err := s.listKeySwitchResults(keySwitchSessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ksResult := range existingKSResults {
+		if err = collector.add(ksResult); err != nil {
+			return nil, err
+		}
+	}
+
+	// 剩余的份额须由存活的服务器提供，不足时不必等待
+	if !collector.isComplete() {
+		if err = checkKeySwitchServerAvailability(s, collector.numExpected, collector.hasResult); err != nil {
+			return nil, err
+		}
+	}
 
-				chaincodeFcn := "getKeySwitchResult"
+	// 收集此后到达的结果
+	for !collector.isComplete() {
+		select {
+		case <-waiter.chanNotify:
+			resultCreators, err := waiter.take()
+			if err != nil {
+				return nil, err
+			}
 
-				query := keyswitch.KeySwitchResultQuery{
-					KeySwitchSessionID: dbKeyParts[1],
-					ResultCreator:      dbKeyParts[3],
+			for _, resultCreator := range resultCreators {
+				if !collector.isWanted(resultCreator) {
+					continue
 				}
 
-				queryBytes, err := json.Marshal(query)
+				ksResult, err := s.GetKeySwitchResult(keySwitchSessionID, resultCreator)
 				if err != nil {
-					chanError <- errors.Wrap(err, "无法序列化链码参数")
-					return
+					return nil, err
 				}
 
-				channelReq := channel.Request{
-					ChaincodeID: s.ServiceInfo.ChaincodeID,
-					Fcn:         chaincodeFcn,
-					Args:        [][]byte{queryBytes},
+				if err = collector.add(ksResult); err != nil {
+					return nil, err
 				}
+			}
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, errorcode.ErrorGatewayTimeout
+			}
+			return nil, errors.Wrap(ctx.Err(), "已取消等待密钥置换结果")
+		}
+	}
 
-				resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+	return collector.results, nil
+}
 
-				if err != nil {
-					chanError <- GetClassifiedError(chaincodeFcn, err)
-					return
-				}
+// 获取密钥置换结果聚合器，首次调用时创建。
+func (s *KeySwitchService) getResultAggregator() *keySwitchResultAggregator {
+	s.resultAggregatorOnce.Do(func() {
+		s.resultAggregator = newKeySwitchResultAggregator(
+			func() (fab.Registration, <-chan *fab.CCEvent, error) {
+				return RegisterEvent(s.ServiceInfo.EventClient, s.ServiceInfo.ChaincodeID, keySwitchResultEventIDPattern)
+			},
+			func(reg fab.Registration) {
+				s.ServiceInfo.EventClient.Unregister(reg)
+			},
+		)
+	})
 
-				ret = append(ret, resp.Payload)
-			}(chanError)
+	return s.resultAggregator
+}
 
-			err := <-chanError
-			if err != nil {
-				wg.Wait()
-				return nil, err
-			}
+// 获取验证密钥置换会话的份额所需的目标用户的密钥置换公钥与会话中各资源的加密密钥。
+func (s *KeySwitchService) getKeySwitchVerificationMaterials(ksTrigger *keyswitch.KeySwitchTriggerStored) (*sm2.PublicKey, map[string]*ppks.CipherText, error) {
+	targetPublicKeyBytes, err := base64.StdEncoding.DecodeString(ksTrigger.KeySwitchPK)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "无法解析目标用户的密钥置换公钥")
+	}
 
-			// 收集到足够的结果便可停止接收事件
-			if len(ret) == numExpected {
-				break eventHandler
-			}
-		case <-time.After(time.Duration(timeoutInSec) * time.Second):
-			// 只有收到的事件数量小于预期值才报超时错误，否则只是还有查询未完成，过一会自然会完成。
-			if len(receivedIDs) < numExpected {
-				wg.Wait()
-				return nil, errorcode.ErrorGatewayTimeout
-			}
-		default:
-			time.Sleep(50 * time.Millisecond)
+	targetPublicKey, err := cipherutils.DeserializeSM2PublicKey(targetPublicKeyBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encryptedKeys := map[string]*ppks.CipherText{}
+	for _, resourceID := range ksTrigger.GetResourceIDs() {
+		chaincodeFcn := "getKey"
+		channelReq := channel.Request{
+			ChaincodeID: s.ServiceInfo.ChaincodeID,
+			Fcn:         chaincodeFcn,
+			Args:        [][]byte{[]byte(resourceID)},
+		}
+
+		resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+		if err != nil {
+			return nil, nil, GetClassifiedError(chaincodeFcn, err)
+		}
+
+		encryptedKeys[resourceID], err = cipherutils.DeserializeCipherText(resp.Payload)
+		if err != nil {
+			return nil, nil, err
 		}
 	}
 
-	wg.Wait()
-	return ret, nil
+	return targetPublicKey, encryptedKeys, nil
+}
+
+// 列出密钥置换会话中已有的密钥置换结果。
+func (s *KeySwitchService) listKeySwitchResults(keySwitchSessionID string) ([]*keyswitch.KeySwitchResultStored, error) {
+	chaincodeFcn := "listKeySwitchResultsByID"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{[]byte(keySwitchSessionID)},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+	if err != nil {
+		return nil, GetClassifiedError(chaincodeFcn, err)
+	}
+
+	var ksResults []*keyswitch.KeySwitchResultStored
+	if err = json.Unmarshal(resp.Payload, &ksResults); err != nil {
+		return nil, errors.Wrap(err, "无法解析密钥置换结果列表")
+	}
+
+	return ksResults, nil
+}
+
+// 获取某一密钥置换服务器在会话中提交的密钥置换结果。未提交时返回 `errorcode.ErrorNotFound`。
+//
+// 参数：
+//   密钥置换会话 ID
+//   结果创建者的公钥（Base64 编码的 DER）
+//
+// 返回：
+//   密钥置换结果
+func (s *KeySwitchService) GetKeySwitchResult(keySwitchSessionID string, resultCreator string) (*keyswitch.KeySwitchResultStored, error) {
+	query := keyswitch.KeySwitchResultQuery{
+		KeySwitchSessionID: keySwitchSessionID,
+		ResultCreator:      resultCreator,
+	}
+
+	queryBytes, err := json.Marshal(query)
+	if err != nil {
+		return nil, errors.Wrap(err, "无法序列化链码参数")
+	}
+
+	chaincodeFcn := "getKeySwitchResult"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{queryBytes},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+	if err != nil {
+		return nil, GetClassifiedError(chaincodeFcn, err)
+	}
+
+	var ksResultStored keyswitch.KeySwitchResultStored
+	if err = json.Unmarshal(resp.Payload, &ksResultStored); err != nil {
+		return nil, errors.Wrap(err, "无法解析密钥置换结果")
+	}
+
+	return &ksResultStored, nil
+}
+
+// 登记密钥置换服务器。只有管理员可以登记。已登记的服务器将被更新。
+//
+// 参数：
+//   服务器身份的公钥（Base64 编码的 DER）
+//   服务器名称
+//   服务器的密钥置换公钥（[64]byte 的 Base64 编码）
+//
+// 返回：
+//   交易 ID
+func (s *KeySwitchService) RegisterKeySwitchServer(publicKey string, name string, keySwitchPK string) (string, error) {
+	if strings.TrimSpace(publicKey) == "" {
+		return "", &ErrorBadRequest{errMsg: "服务器身份的公钥不能为空。"}
+	}
+	if strings.TrimSpace(name) == "" {
+		return "", &ErrorBadRequest{errMsg: "服务器名称不能为空。"}
+	}
+	if ksPKBytes, err := base64.StdEncoding.DecodeString(keySwitchPK); err != nil || len(ksPKBytes) != 64 {
+		return "", &ErrorBadRequest{errMsg: "密钥置换公钥应为 64 字节的 Base64 编码。"}
+	}
+
+	server := keyswitch.KeySwitchServer{
+		PublicKey:   publicKey,
+		Name:        name,
+		KeySwitchPK: keySwitchPK,
+	}
+
+	serverBytes, err := json.Marshal(server)
+	if err != nil {
+		return "", errors.Wrap(err, "无法序列化链码参数")
+	}
+
+	chaincodeFcn := "registerKeySwitchServer"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{serverBytes},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Execute(channelReq)
+	if err != nil {
+		return "", GetClassifiedError(chaincodeFcn, err)
+	}
+
+	return string(resp.TransactionID), nil
+}
+
+// 移除密钥置换服务器的登记。只有管理员可以移除。
+//
+// 参数：
+//   服务器身份的公钥（Base64 编码的 DER）
+//
+// 返回：
+//   交易 ID
+func (s *KeySwitchService) DeregisterKeySwitchServer(publicKey string) (string, error) {
+	chaincodeFcn := "deregisterKeySwitchServer"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{[]byte(publicKey)},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Execute(channelReq)
+	if err != nil {
+		return "", GetClassifiedError(chaincodeFcn, err)
+	}
+
+	return string(resp.TransactionID), nil
+}
+
+// 列出链上登记的密钥置换服务器。
+//
+// 返回：
+//   登记的密钥置换服务器列表
+func (s *KeySwitchService) ListKeySwitchServers() ([]keyswitch.KeySwitchServerStored, error) {
+	chaincodeFcn := "listKeySwitchServers"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+	if err != nil {
+		return nil, GetClassifiedError(chaincodeFcn, err)
+	}
+
+	var ksServers []keyswitch.KeySwitchServerStored
+	if err = json.Unmarshal(resp.Payload, &ksServers); err != nil {
+		return nil, errors.Wrap(err, "无法解析密钥置换服务器列表")
+	}
+
+	return ksServers, nil
+}
+
+// 登记调用者的密钥置换公钥，将其绑定到调用者的身份。只有登记过的密钥置换公钥可用于创建密钥置换触发器。
+//
+// 参数：
+//   密钥置换公钥（[64]byte 的 Base64 编码）
+//   以对应的密钥置换私钥对登记消息的签名（Base64 编码）
+//   （可选）链下交付份额的地址。以该公钥创建的密钥置换会话只能将份额交付到此地址。
+//
+// 返回：
+//   交易 ID
+func (s *KeySwitchService) RegisterKeySwitchPK(keySwitchPK string, signature string, shareDeliveryURL string) (string, error) {
+	if ksPKBytes, err := base64.StdEncoding.DecodeString(keySwitchPK); err != nil || len(ksPKBytes) != 64 {
+		return "", &ErrorBadRequest{errMsg: "密钥置换公钥应为 64 字节的 Base64 编码。"}
+	}
+	if sigBytes, err := base64.StdEncoding.DecodeString(signature); err != nil || len(sigBytes) == 0 {
+		return "", &ErrorBadRequest{errMsg: "签名应为 Base64 编码。"}
+	}
+	if shareDeliveryURL != "" && !strings.HasPrefix(shareDeliveryURL, "http://") && !strings.HasPrefix(shareDeliveryURL, "https://") {
+		return "", &ErrorBadRequest{errMsg: "链下交付份额的地址应为 HTTP 或 HTTPS 地址。"}
+	}
+
+	registration := keyswitch.KeySwitchPKRegistration{
+		KeySwitchPK:      keySwitchPK,
+		Signature:        signature,
+		ShareDeliveryURL: shareDeliveryURL,
+	}
+
+	registrationBytes, err := json.Marshal(registration)
+	if err != nil {
+		return "", errors.Wrap(err, "无法序列化链码参数")
+	}
+
+	chaincodeFcn := "registerKeySwitchPK"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{registrationBytes},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Execute(channelReq)
+	if err != nil {
+		return "", GetClassifiedError(chaincodeFcn, err)
+	}
+
+	return string(resp.TransactionID), nil
+}
+
+// 确保密钥置换私钥对应的公钥已连同本实例链下交付份额的地址登记到调用者的身份下。未登记或登记的地址不同时以该私钥签名并（重新）登记。
+//
+// 参数：
+//   密钥置换私钥
+//
+// 返回：
+//   交易 ID。已登记时为空。
+func (s *KeySwitchService) EnsureKeySwitchPKRegistered(privateKey *sm2.PrivateKey) (string, error) {
+	if privateKey == nil {
+		return "", &ErrorBadRequest{errMsg: "密钥置换私钥不能为空。"}
+	}
+
+	keySwitchPK := ksclient.EncodePublicKey(&privateKey.PublicKey)
+	registrations, err := s.ListKeySwitchPKs("")
+	if err != nil {
+		return "", err
+	}
+	for _, registration := range registrations {
+		if registration.KeySwitchPK == keySwitchPK && registration.ShareDeliveryURL == s.ShareDeliveryURL {
+			return "", nil
+		}
+	}
+
+	owner, err := s.GetCallerPublicKey()
+	if err != nil {
+		return "", err
+	}
+
+	registration, err := ksclient.SignKeySwitchPKRegistration(privateKey, owner)
+	if err != nil {
+		return "", err
+	}
+
+	return s.RegisterKeySwitchPK(registration.KeySwitchPK, registration.Signature, s.ShareDeliveryURL)
+}
+
+// 撤销调用者对密钥置换公钥的登记。此后该公钥不能再用于创建密钥置换触发器。
+//
+// 参数：
+//   密钥置换公钥（[64]byte 的 Base64 编码）
+//
+// 返回：
+//   交易 ID
+func (s *KeySwitchService) RevokeKeySwitchPK(keySwitchPK string) (string, error) {
+	chaincodeFcn := "revokeKeySwitchPK"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{[]byte(keySwitchPK)},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Execute(channelReq)
+	if err != nil {
+		return "", GetClassifiedError(chaincodeFcn, err)
+	}
+
+	return string(resp.TransactionID), nil
+}
+
+// 列出某一身份登记的密钥置换公钥。
+//
+// 参数：
+//   身份的公钥（Base64 编码的 DER）。为空时为调用者本人。
+//
+// 返回：
+//   密钥置换公钥登记列表
+func (s *KeySwitchService) ListKeySwitchPKs(owner string) ([]keyswitch.KeySwitchPKRegistrationStored, error) {
+	args := [][]byte{}
+	if owner != "" {
+		args = append(args, []byte(owner))
+	}
+
+	chaincodeFcn := "listKeySwitchPKs"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        args,
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+	if err != nil {
+		return nil, GetClassifiedError(chaincodeFcn, err)
+	}
+
+	var registrations []keyswitch.KeySwitchPKRegistrationStored
+	if err = json.Unmarshal(resp.Payload, &registrations); err != nil {
+		return nil, errors.Wrap(err, "无法解析密钥置换公钥登记列表")
+	}
+
+	return registrations, nil
+}
+
+// 获取调用者身份的公钥。登记密钥置换公钥时须以此签名。
+//
+// 返回：
+//   调用者身份的公钥（Base64 编码的 DER）
+func (s *KeySwitchService) GetCallerPublicKey() (string, error) {
+	chaincodeFcn := "getCallerPublicKey"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+	if err != nil {
+		return "", GetClassifiedError(chaincodeFcn, err)
+	}
+
+	return string(resp.Payload), nil
+}
+
+// 记录调用者（登记的密钥置换服务器）的心跳。
+//
+// 参数：
+//   服务器的程序版本
+//   最近处理完的密钥置换会话 ID
+//   服务器的工作单元数量
+//
+// 返回：
+//   交易 ID
+func (s *KeySwitchService) RecordKeySwitchServerHeartbeat(version string, lastSessionID string, numWorkers int) (string, error) {
+	heartbeat := keyswitch.KeySwitchServerHeartbeat{
+		Version:       version,
+		LastSessionID: lastSessionID,
+		NumWorkers:    numWorkers,
+	}
+
+	heartbeatBytes, err := json.Marshal(heartbeat)
+	if err != nil {
+		return "", errors.Wrap(err, "无法序列化链码参数")
+	}
+
+	chaincodeFcn := "recordKeySwitchServerHeartbeat"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{heartbeatBytes},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Execute(channelReq)
+	if err != nil {
+		return "", GetClassifiedError(chaincodeFcn, err)
+	}
+
+	return string(resp.TransactionID), nil
+}
+
+// 列出链上登记的密钥置换服务器及其存活状态。存活状态按查询时的时间给出。
+//
+// 返回：
+//   登记的密钥置换服务器及其存活状态的列表
+func (s *KeySwitchService) ListKeySwitchServerStatuses() ([]keyswitch.KeySwitchServerStatus, error) {
+	ksServers, err := s.ListKeySwitchServers()
+	if err != nil {
+		return nil, err
+	}
+
+	chaincodeFcn := "listKeySwitchServerHeartbeats"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+	if err != nil {
+		return nil, GetClassifiedError(chaincodeFcn, err)
+	}
+
+	var heartbeats []keyswitch.KeySwitchServerHeartbeatStored
+	if err = json.Unmarshal(resp.Payload, &heartbeats); err != nil {
+		return nil, errors.Wrap(err, "无法解析密钥置换服务器的心跳列表")
+	}
+
+	return getKeySwitchServerStatuses(ksServers, heartbeats, time.Now()), nil
+}
+
+// 按心跳判断登记的密钥置换服务器的存活状态。没有心跳的服务器为 `Missing`，心跳超过 `keySwitchServerStaleAfter` 的为 `Stale`。
+func getKeySwitchServerStatuses(ksServers []keyswitch.KeySwitchServerStored, heartbeats []keyswitch.KeySwitchServerHeartbeatStored, now time.Time) []keyswitch.KeySwitchServerStatus {
+	heartbeatsByServer := map[string]*keyswitch.KeySwitchServerHeartbeatStored{}
+	for i := range heartbeats {
+		heartbeatsByServer[heartbeats[i].PublicKey] = &heartbeats[i]
+	}
+
+	statuses := []keyswitch.KeySwitchServerStatus{}
+	for _, ksServer := range ksServers {
+		status := keyswitch.KeySwitchServerStatus{
+			KeySwitchServerStored: ksServer,
+			Liveness:              keyswitch.Missing,
+		}
+
+		if heartbeat, ok := heartbeatsByServer[ksServer.PublicKey]; ok {
+			status.Heartbeat = heartbeat
+			if now.Sub(heartbeat.Timestamp) > keySwitchServerStaleAfter {
+				status.Liveness = keyswitch.Stale
+			} else {
+				status.Liveness = keyswitch.Alive
+			}
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+// 检查存活的密钥置换服务器是否足以提供所需个数的份额。已提交结果的服务器无论是否存活都计入。
+// 不足时返回 `*ErrorKeySwitchServersUnavailable`。无法获取服务器状态时不作判断。
+//
+// 参数：
+//   密钥置换服务
+//   所需的份额个数
+//   判断服务器是否已提交结果的函数，参数为服务器身份的公钥
+func checkKeySwitchServerAvailability(keySwitchService KeySwitchServiceInterface, numNeeded int, hasResult func(publicKey string) bool) error {
+	statuses, err := keySwitchService.ListKeySwitchServerStatuses()
+	if err != nil {
+		log.Debugf("无法获取密钥置换服务器的存活状态: %v", err)
+		return nil
+	}
+
+	numAvailable := 0
+	for _, status := range statuses {
+		if status.Liveness == keyswitch.Alive || hasResult(status.PublicKey) {
+			numAvailable++
+		}
+	}
+
+	if numAvailable < numNeeded {
+		return &ErrorKeySwitchServersUnavailable{NumAvailable: numAvailable, NumNeeded: numNeeded}
+	}
+
+	return nil
+}
+
+// 获取密钥置换会话。会话状态按查询时的时间给出。
+//
+// 参数：
+//   密钥置换会话 ID
+//
+// 返回：
+//   密钥置换触发器（含会话状态）
+func (s *KeySwitchService) GetKeySwitchSession(keySwitchSessionID string) (*keyswitch.KeySwitchTriggerStored, error) {
+	if strings.TrimSpace(keySwitchSessionID) == "" {
+		return nil, &ErrorBadRequest{errMsg: "密钥置换会话 ID 不能为空。"}
+	}
+
+	chaincodeFcn := "getKeySwitchTrigger"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{[]byte(keySwitchSessionID)},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+	if err != nil {
+		return nil, GetClassifiedError(chaincodeFcn, err)
+	}
+
+	var ksTriggerStored keyswitch.KeySwitchTriggerStored
+	if err = json.Unmarshal(resp.Payload, &ksTriggerStored); err != nil {
+		return nil, errors.Wrap(err, "无法解析密钥置换触发器")
+	}
+
+	return &ksTriggerStored, nil
+}
+
+// 获取访问申请者自行解密资源所需的材料，包括资源的加密密钥、以触发器中的密钥置换公钥验证过的份额，以及密文（加密资源）或 IPFS CID（链下资源）。
+//
+// 参数：
+//   密钥置换会话 ID
+//   资源 ID
+//
+// 返回：
+//   解密材料
+func (s *KeySwitchService) GetClientDecryptionMaterials(keySwitchSessionID string, resourceID string) (*keyswitch.ClientDecryptionMaterials, error) {
+	if strings.TrimSpace(resourceID) == "" {
+		return nil, &ErrorBadRequest{errMsg: "资源 ID 不能为空。"}
+	}
+
+	// 检查资源是否在会话中
+	ksTrigger, err := s.GetKeySwitchSession(keySwitchSessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	isInSession := false
+	for _, id := range ksTrigger.GetResourceIDs() {
+		if id == resourceID {
+			isInSession = true
+			break
+		}
+	}
+	if !isInSession {
+		return nil, &ErrorBadRequest{errMsg: "该资源不在密钥置换会话中。"}
+	}
+
+	metadata, err := getResourceMetadata(resourceID, s.ServiceInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	if metadata.ResourceType != data.Encrypted && metadata.ResourceType != data.Offchain {
+		return nil, &ErrorBadRequest{errMsg: "该资源不是加密资源。"}
+	}
+
+	// 调用链码 getData 获取该资源的密文本体或 CID，并检查其大小和哈希
+	chaincodeFcn := "getData"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{[]byte(resourceID)},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+	if err != nil {
+		return nil, GetClassifiedError(chaincodeFcn, err)
+	}
+
+	dataBytes := resp.Payload
+	if err = checkSizeAndHashForEncryptedData(dataBytes, metadata).toError(metadata.ResourceType); err != nil {
+		return nil, err
+	}
+
+	// 份额以触发器中访问申请者的密钥置换公钥为目标验证
+	targetPublicKey, encryptedKeys, err := s.getKeySwitchVerificationMaterials(ksTrigger)
+	if err != nil {
+		return nil, err
+	}
+	encryptedKey := encryptedKeys[resourceID]
+
+	ksResults, err := s.listKeySwitchResults(keySwitchSessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	ksServers, err := s.ListKeySwitchServers()
+	if err != nil {
+		return nil, err
+	}
+
+	numSharesExpected, err := getNumSharesExpected(ksTrigger)
+	if err != nil {
+		return nil, err
+	}
+
+	shares, shareIndices, err := collectSharesForResource(resourceID, ksResults, ksServers, numSharesExpected, targetPublicKey, encryptedKey, s)
+	if err != nil {
+		return nil, err
+	}
+
+	materials := &keyswitch.ClientDecryptionMaterials{
+		KeySwitchSessionID: keySwitchSessionID,
+		Metadata:           metadata,
+		EncryptedKey:       base64.StdEncoding.EncodeToString(cipherutils.SerializeCipherText(encryptedKey)),
+		ShareIndices:       shareIndices,
+	}
+	for _, share := range shares {
+		materials.Shares = append(materials.Shares, base64.StdEncoding.EncodeToString(cipherutils.SerializeCipherText(share)))
+	}
+
+	if metadata.ResourceType == data.Encrypted {
+		materials.Ciphertext = base64.StdEncoding.EncodeToString(dataBytes)
+	} else {
+		materials.CID = string(dataBytes)
+	}
+
+	return materials, nil
+}
+
+// 配置密钥置换会话。只有管理员可以配置。只影响此后创建的会话。
+//
+// 参数：
+//   会话的有效期（秒）
+//   门限值。为 0 时会话需要所有登记的服务器的份额。
+//
+// 返回：
+//   交易 ID
+func (s *KeySwitchService) SetKeySwitchSessionConfig(sessionTTL int, threshold int) (string, error) {
+	if sessionTTL <= 0 {
+		return "", &ErrorBadRequest{errMsg: "会话的有效期应为正整数。"}
+	}
+	if threshold < 0 {
+		return "", &ErrorBadRequest{errMsg: "门限值不能为负数。"}
+	}
+
+	ksSessionConfig := keyswitch.KeySwitchSessionConfig{
+		SessionTTL: sessionTTL,
+		Threshold:  threshold,
+	}
+
+	ksSessionConfigBytes, err := json.Marshal(ksSessionConfig)
+	if err != nil {
+		return "", errors.Wrap(err, "无法序列化链码参数")
+	}
+
+	chaincodeFcn := "setKeySwitchSessionConfig"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{ksSessionConfigBytes},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Execute(channelReq)
+	if err != nil {
+		return "", GetClassifiedError(chaincodeFcn, err)
+	}
+
+	return string(resp.TransactionID), nil
+}
+
+// 获取链上的密钥置换会话配置。
+//
+// 返回：
+//   密钥置换会话配置
+func (s *KeySwitchService) GetKeySwitchSessionConfig() (*keyswitch.KeySwitchSessionConfig, error) {
+	chaincodeFcn := "getKeySwitchSessionConfig"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+	if err != nil {
+		return nil, GetClassifiedError(chaincodeFcn, err)
+	}
+
+	var ksSessionConfig keyswitch.KeySwitchSessionConfig
+	if err = json.Unmarshal(resp.Payload, &ksSessionConfig); err != nil {
+		return nil, errors.Wrap(err, "无法解析密钥置换会话配置")
+	}
+
+	return &ksSessionConfig, nil
 }
 
 // 获取集合权威公钥。
@@ -1,9 +1,11 @@
 package service
 
 import (
+	"context"
 	"crypto"
 
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/utils/cipherutils"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/keyswitch"
 	"github.com/XiaoYao-austin/ppks"
 	"github.com/tjfoc/gmsm/sm2"
 )
@@ -20,6 +22,38 @@ type KeySwitchServiceInterface interface {
 	//   交易 ID
 	CreateKeySwitchTrigger(resourceID string, authSessionID string) (string, error)
 
+	// 创建涵盖多个资源的密文访问申请/密钥置换触发器。链码对每个资源分别进行授权或访问策略检查，任一资源未通过即拒绝整个申请。
+	//
+	// 参数：
+	//   资源 ID 列表
+	//   按资源 ID 索引的授权会话 ID。未指定的资源依据其访问策略检查。
+	//
+	// 返回：
+	//   交易 ID（亦即密钥置换会话 ID）
+	CreateKeySwitchTriggerForResources(resourceIDs []string, authSessionIDs map[string]string) (string, error)
+
+	// 以访问申请者自己的密钥置换公钥创建密文访问申请/密钥置换触发器。份额将以该公钥为目标计算，由持有对应私钥的访问申请者自行解密。
+	//
+	// 参数：
+	//   资源 ID
+	//   授权会话 ID
+	//   访问申请者的密钥置换公钥
+	//
+	// 返回：
+	//   交易 ID（亦即密钥置换会话 ID）
+	CreateKeySwitchTriggerWithPublicKey(resourceID string, authSessionID string, keySwitchPK *sm2.PublicKey) (string, error)
+
+	// 以访问申请者自己的密钥置换公钥创建涵盖多个资源的密文访问申请/密钥置换触发器。
+	//
+	// 参数：
+	//   资源 ID 列表
+	//   按资源 ID 索引的授权会话 ID。未指定的资源依据其访问策略检查。
+	//   访问申请者的密钥置换公钥
+	//
+	// 返回：
+	//   交易 ID（亦即密钥置换会话 ID）
+	CreateKeySwitchTriggerForResourcesWithPublicKey(resourceIDs []string, authSessionIDs map[string]string, keySwitchPK *sm2.PublicKey) (string, error)
+
 	// 创建密钥置换结果。
 	//
 	// 参数：
@@ -31,6 +65,46 @@ type KeySwitchServiceInterface interface {
 	//   交易 ID
 	CreateKeySwitchResult(keySwitchSessionID string, share *ppks.CipherText, proof *cipherutils.ZKProof) (string, error)
 
+	// 为多资源的密钥置换会话创建密钥置换结果。各资源的份额在一笔交易中提交。
+	//
+	// 参数：
+	//   密钥置换会话 ID
+	//   会话中的资源 ID 列表（与触发器中的顺序一致）
+	//   各资源的个人份额
+	//   关于各份额的零知识证明
+	//
+	// 返回：
+	//   交易 ID
+	CreateKeySwitchResultForResources(keySwitchSessionID string, resourceIDs []string, shares []*ppks.CipherText, proofs []*cipherutils.ZKProof) (string, error)
+
+	// 为启用了链下份额交付的密钥置换会话创建密钥置换结果。份额已直接交付给访问申请者，链上只记录各份额的承诺。
+	//
+	// 参数：
+	//   密钥置换会话 ID
+	//   多资源会话中的资源 ID 列表（与触发器中的顺序一致）。单资源会话为 nil。
+	//   各份额的承诺。单资源会话只有一份。
+	//
+	// 返回：
+	//   交易 ID
+	CreateKeySwitchResultWithCommitments(keySwitchSessionID string, resourceIDs []string, commitments []string) (string, error)
+
+	// 接收密钥置换服务器链下交付的份额。交付者须为登记的密钥置换服务器，并以其密钥置换私钥签名。份额暂存于内存，待链上的承诺到达后核对。
+	//
+	// 参数：
+	//   交付的份额
+	ReceiveKeySwitchShares(delivery *keyswitch.KeySwitchShareDelivery) error
+
+	// 取出链下交付的、与链上的承诺对应的份额，并以承诺核对。未收到时返回 `errorcode.ErrorNotFound`。
+	//
+	// 参数：
+	//   密钥置换会话 ID
+	//   链上记录的份额的承诺
+	//
+	// 返回：
+	//   份额（Base64 编码）
+	//   零知识证明（Base64 编码）
+	GetDeliveredShare(keySwitchSessionID string, commitment string) (string, string, error)
+
 	// 验证所获得的份额。
 	//
 	// 参数：
@@ -48,23 +122,166 @@ type KeySwitchServiceInterface interface {
 	//
 	// 参数：
 	//   所获的份额
+	//   各份额的份额序号。为 nil 时各份额直接相加（n-of-n）；否则各份额按其拉格朗日系数加权后相加（t-of-n），此时只需门限值个份额。
 	//   加密后的对称密钥材料
 	//   目标用户用于密钥置换的私钥
 	//
 	// 返回：
 	//   解密后的对称密钥材料
-	GetDecryptedKey(shares []*ppks.CipherText, encryptedKey *ppks.CipherText, targetPrivateKey *sm2.PrivateKey) (*ppks.CurvePoint, error)
+	GetDecryptedKey(shares []*ppks.CipherText, shareIndices []int, encryptedKey *ppks.CipherText, targetPrivateKey *sm2.PrivateKey) (*ppks.CurvePoint, error)
 
-	// 等待并收集密钥置换结果。
+	// 等待并收集密钥置换结果。只收集链上登记的密钥置换服务器的结果，所需的份额个数由登记的服务器数量（n-of-n）或门限值（t-of-n）决定。
 	//
 	// 参数：
 	//   密钥置换会话 ID
-	//   预期的份额个数
 	//   超时时限（可选）
 	//
 	// 返回：
-	//   预期个数的份额列表
-	AwaitKeySwitchResults(keySwitchSessionID string, numExpected int, timeout ...int) ([][]byte, error)
+	//   所需个数的份额列表
+	AwaitKeySwitchResults(keySwitchSessionID string, timeout ...int) ([][]byte, error)
+
+	// 等待并收集密钥置换结果，直至收集到所需个数的份额或 `ctx` 结束。份额在到达时即以零知识证明验证，未通过验证的份额不计入。
+	// 超时返回 `errorcode.ErrorGatewayTimeout`。
+	//
+	// 参数：
+	//   用于超时与取消的上下文
+	//   密钥置换会话 ID
+	//
+	// 返回：
+	//   所需个数的份额列表
+	AwaitKeySwitchResultsWithContext(ctx context.Context, keySwitchSessionID string) ([][]byte, error)
+
+	// 获取某一密钥置换服务器在会话中提交的密钥置换结果。未提交时返回 `errorcode.ErrorNotFound`。
+	//
+	// 参数：
+	//   密钥置换会话 ID
+	//   结果创建者的公钥（Base64 编码的 DER）
+	//
+	// 返回：
+	//   密钥置换结果
+	GetKeySwitchResult(keySwitchSessionID string, resultCreator string) (*keyswitch.KeySwitchResultStored, error)
+
+	// 登记密钥置换服务器。只有管理员可以登记。已登记的服务器将被更新。
+	//
+	// 参数：
+	//   服务器身份的公钥（Base64 编码的 DER）
+	//   服务器名称
+	//   服务器的密钥置换公钥（[64]byte 的 Base64 编码）
+	//
+	// 返回：
+	//   交易 ID
+	RegisterKeySwitchServer(publicKey string, name string, keySwitchPK string) (string, error)
+
+	// 移除密钥置换服务器的登记。只有管理员可以移除。
+	//
+	// 参数：
+	//   服务器身份的公钥（Base64 编码的 DER）
+	//
+	// 返回：
+	//   交易 ID
+	DeregisterKeySwitchServer(publicKey string) (string, error)
+
+	// 列出链上登记的密钥置换服务器。
+	//
+	// 返回：
+	//   登记的密钥置换服务器列表
+	ListKeySwitchServers() ([]keyswitch.KeySwitchServerStored, error)
+
+	// 登记调用者的密钥置换公钥，将其绑定到调用者的身份。只有登记过的密钥置换公钥可用于创建密钥置换触发器。
+	//
+	// 参数：
+	//   密钥置换公钥（[64]byte 的 Base64 编码）
+	//   以对应的密钥置换私钥对登记消息的签名（Base64 编码）
+	//   （可选）链下交付份额的地址。以该公钥创建的密钥置换会话只能将份额交付到此地址。
+	//
+	// 返回：
+	//   交易 ID
+	RegisterKeySwitchPK(keySwitchPK string, signature string, shareDeliveryURL string) (string, error)
+
+	// 确保密钥置换私钥对应的公钥已连同本实例链下交付份额的地址登记到调用者的身份下。未登记或登记的地址不同时以该私钥签名并（重新）登记。
+	//
+	// 参数：
+	//   密钥置换私钥
+	//
+	// 返回：
+	//   交易 ID。已登记时为空。
+	EnsureKeySwitchPKRegistered(privateKey *sm2.PrivateKey) (string, error)
+
+	// 撤销调用者对密钥置换公钥的登记。此后该公钥不能再用于创建密钥置换触发器。
+	//
+	// 参数：
+	//   密钥置换公钥（[64]byte 的 Base64 编码）
+	//
+	// 返回：
+	//   交易 ID
+	RevokeKeySwitchPK(keySwitchPK string) (string, error)
+
+	// 列出某一身份登记的密钥置换公钥。
+	//
+	// 参数：
+	//   身份的公钥（Base64 编码的 DER）。为空时为调用者本人。
+	//
+	// 返回：
+	//   密钥置换公钥登记列表
+	ListKeySwitchPKs(owner string) ([]keyswitch.KeySwitchPKRegistrationStored, error)
+
+	// 获取调用者身份的公钥。登记密钥置换公钥时须以此签名。
+	//
+	// 返回：
+	//   调用者身份的公钥（Base64 编码的 DER）
+	GetCallerPublicKey() (string, error)
+
+	// 记录调用者（登记的密钥置换服务器）的心跳。
+	//
+	// 参数：
+	//   服务器的程序版本
+	//   最近处理完的密钥置换会话 ID
+	//   服务器的工作单元数量
+	//
+	// 返回：
+	//   交易 ID
+	RecordKeySwitchServerHeartbeat(version string, lastSessionID string, numWorkers int) (string, error)
+
+	// 列出链上登记的密钥置换服务器及其存活状态。存活状态按查询时的时间给出。
+	//
+	// 返回：
+	//   登记的密钥置换服务器及其存活状态的列表
+	ListKeySwitchServerStatuses() ([]keyswitch.KeySwitchServerStatus, error)
+
+	// 获取密钥置换会话。会话状态按查询时的时间给出。
+	//
+	// 参数：
+	//   密钥置换会话 ID
+	//
+	// 返回：
+	//   密钥置换触发器（含会话状态）
+	GetKeySwitchSession(keySwitchSessionID string) (*keyswitch.KeySwitchTriggerStored, error)
+
+	// 获取访问申请者自行解密资源所需的材料，包括资源的加密密钥、以触发器中的密钥置换公钥验证过的份额，以及密文（加密资源）或 IPFS CID（链下资源）。
+	//
+	// 参数：
+	//   密钥置换会话 ID
+	//   资源 ID
+	//
+	// 返回：
+	//   解密材料
+	GetClientDecryptionMaterials(keySwitchSessionID string, resourceID string) (*keyswitch.ClientDecryptionMaterials, error)
+
+	// 配置密钥置换会话。只有管理员可以配置。只影响此后创建的会话。
+	//
+	// 参数：
+	//   会话的有效期（秒）
+	//   门限值。为 0 时会话需要所有登记的服务器的份额。
+	//
+	// 返回：
+	//   交易 ID
+	SetKeySwitchSessionConfig(sessionTTL int, threshold int) (string, error)
+
+	// 获取链上的密钥置换会话配置。
+	//
+	// 返回：
+	//   密钥置换会话配置
+	GetKeySwitchSessionConfig() (*keyswitch.KeySwitchSessionConfig, error)
 
 	// 获取集合权威公钥。
 	//
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/keyswitch"
+	"github.com/pkg/errors"
+)
+
+// 链下交付的份额在内存中保存的时长。份额不上链，超过该时长或实例重启后须重新发起密钥置换。
+const deliveredKeySwitchShareRetention = 24 * time.Hour
+
+// keySwitchShareStore 在内存中保存密钥置换服务器链下交付的份额，按会话 ID 与份额的承诺索引，供验证链上只记录了承诺的密钥置换结果时取用。
+type keySwitchShareStore struct {
+	mu     sync.Mutex
+	shares map[string]*deliveredKeySwitchShare
+	now    func() time.Time
+}
+
+// deliveredKeySwitchShare 表示一份链下交付的份额
+type deliveredKeySwitchShare struct {
+	share      string
+	zkProof    string
+	receivedAt time.Time
+}
+
+// 创建一个链下交付份额的存储。
+func newKeySwitchShareStore() *keySwitchShareStore {
+	return &keySwitchShareStore{
+		shares: map[string]*deliveredKeySwitchShare{},
+		now:    time.Now,
+	}
+}
+
+// 保存一份链下交付的份额，并移除超过保存时长的份额。
+//
+// 参数：
+//   密钥置换会话 ID
+//   交付的份额
+func (st *keySwitchShareStore) put(keySwitchSessionID string, resourceShare *keyswitch.KeySwitchShare) error {
+	commitment, err := keyswitch.GetKeySwitchShareCommitment(resourceShare.Share, resourceShare.ZKProof)
+	if err != nil {
+		return err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	now := st.now()
+	for key, deliveredShare := range st.shares {
+		if now.Sub(deliveredShare.receivedAt) > deliveredKeySwitchShareRetention {
+			delete(st.shares, key)
+		}
+	}
+
+	st.shares[getKeyForDeliveredKeySwitchShare(keySwitchSessionID, commitment)] = &deliveredKeySwitchShare{
+		share:      resourceShare.Share,
+		zkProof:    resourceShare.ZKProof,
+		receivedAt: now,
+	}
+
+	return nil
+}
+
+// 取出与链上的承诺对应的份额，并以承诺核对。未收到时返回 `errorcode.ErrorNotFound`。
+//
+// 参数：
+//   密钥置换会话 ID
+//   链上记录的份额的承诺
+//
+// 返回：
+//   份额（Base64 编码）
+//   零知识证明（Base64 编码）
+func (st *keySwitchShareStore) get(keySwitchSessionID string, commitment string) (string, string, error) {
+	st.mu.Lock()
+	deliveredShare, ok := st.shares[getKeyForDeliveredKeySwitchShare(keySwitchSessionID, commitment)]
+	st.mu.Unlock()
+
+	if !ok || st.now().Sub(deliveredShare.receivedAt) > deliveredKeySwitchShareRetention {
+		return "", "", errors.Wrap(errorcode.ErrorNotFound, "未收到与承诺对应的份额")
+	}
+
+	actualCommitment, err := keyswitch.GetKeySwitchShareCommitment(deliveredShare.share, deliveredShare.zkProof)
+	if err != nil {
+		return "", "", err
+	}
+	if actualCommitment != commitment {
+		return "", "", fmt.Errorf("交付的份额与链上的承诺不符")
+	}
+
+	return deliveredShare.share, deliveredShare.zkProof, nil
+}
+
+func getKeyForDeliveredKeySwitchShare(keySwitchSessionID string, commitment string) string {
+	return keySwitchSessionID + "_" + commitment
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/errorcode"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/keyswitch"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeySwitchShareStore(t *testing.T) {
+	now := time.Now()
+	store := newKeySwitchShareStore()
+	store.now = func() time.Time { return now }
+
+	resourceShare := &keyswitch.KeySwitchShare{
+		ResourceID: "101",
+		Share:      base64.StdEncoding.EncodeToString([]byte("share")),
+		ZKProof:    base64.StdEncoding.EncodeToString([]byte("proof")),
+	}
+	commitment, err := keyswitch.GetKeySwitchShareCommitment(resourceShare.Share, resourceShare.ZKProof)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	if isNoError := assert.NoError(t, store.put("session1", resourceShare)); !isNoError {
+		t.FailNow()
+	}
+
+	share, zkProof, err := store.get("session1", commitment)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	assert.Equal(t, resourceShare.Share, share)
+	assert.Equal(t, resourceShare.ZKProof, zkProof)
+
+	// 份额按会话与承诺取出
+	_, _, err = store.get("session2", commitment)
+	assert.Equal(t, errorcode.ErrorNotFound, errors.Cause(err))
+
+	otherCommitment, err := keyswitch.GetKeySwitchShareCommitment(resourceShare.Share, resourceShare.Share)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	_, _, err = store.get("session1", otherCommitment)
+	assert.Equal(t, errorcode.ErrorNotFound, errors.Cause(err))
+
+	// 交付的份额被篡改后与承诺不符
+	store.shares[getKeyForDeliveredKeySwitchShare("session1", commitment)].zkProof = resourceShare.Share
+	_, _, err = store.get("session1", commitment)
+	assert.Error(t, err)
+	assert.NotEqual(t, errorcode.ErrorNotFound, errors.Cause(err))
+
+	// 超过保存时长的份额被移除
+	now = now.Add(deliveredKeySwitchShareRetention + time.Second)
+	_, _, err = store.get("session1", commitment)
+	assert.Equal(t, errorcode.ErrorNotFound, errors.Cause(err))
+	if isNoError := assert.NoError(t, store.put("session3", resourceShare)); !isNoError {
+		t.FailNow()
+	}
+	assert.Len(t, store.shares, 1)
+}
@@ -0,0 +1,364 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/accesspolicy"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/identity"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/pkg/errors"
+)
+
+// PolicyService 实现了 `PolicyServiceInterface` 接口，提供有关于访问策略的服务
+type PolicyService struct {
+	ServiceInfo *Info
+}
+
+// 试算访问策略，得到部门身份是否满足策略及各条件的求值结果。不会产生交易。
+//
+// 参数：
+//   访问策略
+//   部门身份信息。为 nil 时使用当前使用者的部门身份信息。
+//   用于提供资源属性的资源 ID。为空时策略不能引用资源属性。
+//
+// 返回：
+//   试算结果
+func (s *PolicyService) EvaluatePolicy(policyText string, deptIdentity *identity.DepartmentIdentityStored, resourceID string) (*accesspolicy.PolicyEvaluationResult, error) {
+	if err := validatePolicy(policyText); err != nil {
+		return nil, err
+	}
+
+	req := accesspolicy.PolicyEvaluationRequest{
+		Policy:             policyText,
+		DepartmentIdentity: deptIdentity,
+		ResourceID:         resourceID,
+	}
+	reqBytes, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "无法序列化链码参数")
+	}
+
+	chaincodeFcn := "evaluatePolicy"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{reqBytes},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+	if err != nil {
+		return nil, GetClassifiedError(chaincodeFcn, err)
+	}
+
+	var result accesspolicy.PolicyEvaluationResult
+	if err = json.Unmarshal(resp.Payload, &result); err != nil {
+		return nil, errors.Wrap(err, "无法解析试算结果")
+	}
+
+	return &result, nil
+}
+
+// 配置访问策略中时间属性所用的时区。只有管理员可以配置。
+//
+// 参数：
+//   IANA 时区名，如 "Asia/Shanghai"
+//
+// 返回：
+//   交易 ID
+func (s *PolicyService) SetPolicyTimeZone(timeZone string) (string, error) {
+	if _, err := time.LoadLocation(timeZone); err != nil || strings.TrimSpace(timeZone) == "" {
+		return "", &ErrorBadRequest{
+			errMsg: fmt.Sprintf("未知的时区 '%v'。", timeZone),
+		}
+	}
+
+	chaincodeFcn := "setPolicyTimeZone"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{[]byte(timeZone)},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Execute(channelReq)
+	if err != nil {
+		return "", GetClassifiedError(chaincodeFcn, err)
+	}
+
+	return string(resp.TransactionID), nil
+}
+
+// 获取访问策略中时间属性所用的时区。
+//
+// 返回：
+//   IANA 时区名。未配置时为 "UTC"。
+func (s *PolicyService) GetPolicyTimeZone() (string, error) {
+	chaincodeFcn := "getPolicyTimeZone"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+	if err != nil {
+		return "", GetClassifiedError(chaincodeFcn, err)
+	}
+
+	return string(resp.Payload), nil
+}
+
+// 配置密钥置换被拒绝时，拒绝原因中需要脱敏的属性。只有管理员可以配置。
+//
+// 参数：
+//   属性名列表。以 "." 结尾的为属性名前缀。将整体替换之前的配置。
+//
+// 返回：
+//   交易 ID
+func (s *PolicyService) SetPolicyRedactedAttributes(attributeNames []string) (string, error) {
+	namesBytes, err := json.Marshal(attributeNames)
+	if err != nil {
+		return "", errors.Wrap(err, "无法序列化链码参数")
+	}
+
+	chaincodeFcn := "setPolicyRedactedAttributes"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{namesBytes},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Execute(channelReq)
+	if err != nil {
+		return "", GetClassifiedError(chaincodeFcn, err)
+	}
+
+	return string(resp.TransactionID), nil
+}
+
+// 获取拒绝原因中需要脱敏的属性。
+//
+// 返回：
+//   属性名列表。以 "." 结尾的为属性名前缀。
+func (s *PolicyService) GetPolicyRedactedAttributes() ([]string, error) {
+	chaincodeFcn := "getPolicyRedactedAttributes"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+	if err != nil {
+		return nil, GetClassifiedError(chaincodeFcn, err)
+	}
+
+	var attributeNames []string
+	if err = json.Unmarshal(resp.Payload, &attributeNames); err != nil {
+		return nil, errors.Wrap(err, "无法解析属性名列表")
+	}
+
+	return attributeNames, nil
+}
+
+// 创建访问策略模板。以已有的模板 ID 创建时将产生该模板的新版本。只有管理员可以创建。
+//
+// 参数：
+//   访问策略模板
+//
+// 返回：
+//   模板版本
+//   交易 ID
+func (s *PolicyService) CreatePolicyTemplate(template *accesspolicy.PolicyTemplate) (int, string, error) {
+	if template == nil {
+		return 0, "", fmt.Errorf("策略模板不能为 nil")
+	}
+
+	if strings.TrimSpace(template.TemplateID) == "" {
+		return 0, "", &ErrorBadRequest{
+			errMsg: "模板 ID 不能为空。",
+		}
+	}
+
+	if err := validatePolicy(template.Policy); err != nil {
+		return 0, "", err
+	}
+
+	templateBytes, err := json.Marshal(template)
+	if err != nil {
+		return 0, "", errors.Wrap(err, "无法序列化链码参数")
+	}
+
+	chaincodeFcn := "createPolicyTemplate"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{templateBytes},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Execute(channelReq)
+	if err != nil {
+		return 0, "", GetClassifiedError(chaincodeFcn, err)
+	}
+
+	version, err := strconv.Atoi(string(resp.Payload))
+	if err != nil {
+		return 0, "", errors.Wrap(err, "无法解析模板版本")
+	}
+
+	return version, string(resp.TransactionID), nil
+}
+
+// 获取访问策略模板。
+//
+// 参数：
+//   模板 ID
+//   模板版本。为 0 时获取最新版本。
+//
+// 返回：
+//   访问策略模板
+func (s *PolicyService) GetPolicyTemplate(templateID string, version int) (*accesspolicy.PolicyTemplateStored, error) {
+	args := [][]byte{[]byte(templateID)}
+	if version != 0 {
+		args = append(args, []byte(strconv.Itoa(version)))
+	}
+
+	chaincodeFcn := "getPolicyTemplate"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        args,
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+	if err != nil {
+		return nil, GetClassifiedError(chaincodeFcn, err)
+	}
+
+	var templateStored accesspolicy.PolicyTemplateStored
+	if err = json.Unmarshal(resp.Payload, &templateStored); err != nil {
+		return nil, errors.Wrap(err, "无法解析策略模板")
+	}
+
+	return &templateStored, nil
+}
+
+// 列出所有访问策略模板的最新版本。
+//
+// 返回：
+//   访问策略模板列表
+func (s *PolicyService) ListPolicyTemplates() ([]accesspolicy.PolicyTemplateStored, error) {
+	chaincodeFcn := "listPolicyTemplates"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+	if err != nil {
+		return nil, GetClassifiedError(chaincodeFcn, err)
+	}
+
+	var templates []accesspolicy.PolicyTemplateStored
+	if err = json.Unmarshal(resp.Payload, &templates); err != nil {
+		return nil, errors.Wrap(err, "无法解析策略模板列表")
+	}
+
+	return templates, nil
+}
+
+// 在组织树中创建或更新部门。上级部门须已在组织树中，且不能使组织树成环。只有管理员可以维护组织树。
+//
+// 参数：
+//   部门
+//
+// 返回：
+//   交易 ID
+func (s *PolicyService) PutOrgUnit(orgUnit *identity.OrgUnit) (string, error) {
+	if orgUnit == nil {
+		return "", fmt.Errorf("部门不能为 nil")
+	}
+
+	if strings.TrimSpace(orgUnit.DeptName) == "" {
+		return "", &ErrorBadRequest{
+			errMsg: "部门名称不能为空。",
+		}
+	}
+
+	if orgUnit.DeptName == orgUnit.SuperDeptName {
+		return "", &ErrorBadRequest{
+			errMsg: "上级部门不能是该部门自身。",
+		}
+	}
+
+	orgUnitBytes, err := json.Marshal(orgUnit)
+	if err != nil {
+		return "", errors.Wrap(err, "无法序列化链码参数")
+	}
+
+	chaincodeFcn := "putOrgUnit"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{orgUnitBytes},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Execute(channelReq)
+	if err != nil {
+		return "", GetClassifiedError(chaincodeFcn, err)
+	}
+
+	return string(resp.TransactionID), nil
+}
+
+// 从组织树中移除部门。仍有下级部门的部门不能移除。只有管理员可以维护组织树。
+//
+// 参数：
+//   部门名称
+//
+// 返回：
+//   交易 ID
+func (s *PolicyService) RemoveOrgUnit(deptName string) (string, error) {
+	chaincodeFcn := "removeOrgUnit"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{[]byte(deptName)},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Execute(channelReq)
+	if err != nil {
+		return "", GetClassifiedError(chaincodeFcn, err)
+	}
+
+	return string(resp.TransactionID), nil
+}
+
+// 列出组织树中的所有部门。
+//
+// 返回：
+//   部门列表
+func (s *PolicyService) ListOrgUnits() ([]identity.OrgUnitStored, error) {
+	chaincodeFcn := "listOrgUnits"
+	channelReq := channel.Request{
+		ChaincodeID: s.ServiceInfo.ChaincodeID,
+		Fcn:         chaincodeFcn,
+		Args:        [][]byte{},
+	}
+
+	resp, err := s.ServiceInfo.ChannelClient.Query(channelReq)
+	if err != nil {
+		return nil, GetClassifiedError(chaincodeFcn, err)
+	}
+
+	var orgUnits []identity.OrgUnitStored
+	if err = json.Unmarshal(resp.Payload, &orgUnits); err != nil {
+		return nil, errors.Wrap(err, "无法解析部门列表")
+	}
+
+	return orgUnits, nil
+}
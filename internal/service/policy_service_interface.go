@@ -0,0 +1,100 @@
+package service
+
+import (
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/accesspolicy"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/identity"
+)
+
+// PolicyServiceInterface 定义了有关于访问策略的服务的接口。
+type PolicyServiceInterface interface {
+	// 试算访问策略，得到部门身份是否满足策略及各条件的求值结果。不会产生交易。
+	//
+	// 参数：
+	//   访问策略
+	//   部门身份信息。为 nil 时使用当前使用者的部门身份信息。
+	//   用于提供资源属性的资源 ID。为空时策略不能引用资源属性。
+	//
+	// 返回：
+	//   试算结果
+	EvaluatePolicy(policyText string, deptIdentity *identity.DepartmentIdentityStored, resourceID string) (*accesspolicy.PolicyEvaluationResult, error)
+
+	// 配置访问策略中时间属性所用的时区。只有管理员可以配置。
+	//
+	// 参数：
+	//   IANA 时区名，如 "Asia/Shanghai"
+	//
+	// 返回：
+	//   交易 ID
+	SetPolicyTimeZone(timeZone string) (string, error)
+
+	// 获取访问策略中时间属性所用的时区。
+	//
+	// 返回：
+	//   IANA 时区名。未配置时为 "UTC"。
+	GetPolicyTimeZone() (string, error)
+
+	// 配置密钥置换被拒绝时，拒绝原因中需要脱敏的属性。只有管理员可以配置。
+	//
+	// 参数：
+	//   属性名列表。以 "." 结尾的为属性名前缀。将整体替换之前的配置。
+	//
+	// 返回：
+	//   交易 ID
+	SetPolicyRedactedAttributes(attributeNames []string) (string, error)
+
+	// 获取拒绝原因中需要脱敏的属性。
+	//
+	// 返回：
+	//   属性名列表。以 "." 结尾的为属性名前缀。
+	GetPolicyRedactedAttributes() ([]string, error)
+
+	// 创建访问策略模板。以已有的模板 ID 创建时将产生该模板的新版本。只有管理员可以创建。
+	//
+	// 参数：
+	//   访问策略模板
+	//
+	// 返回：
+	//   模板版本
+	//   交易 ID
+	CreatePolicyTemplate(template *accesspolicy.PolicyTemplate) (int, string, error)
+
+	// 获取访问策略模板。
+	//
+	// 参数：
+	//   模板 ID
+	//   模板版本。为 0 时获取最新版本。
+	//
+	// 返回：
+	//   访问策略模板
+	GetPolicyTemplate(templateID string, version int) (*accesspolicy.PolicyTemplateStored, error)
+
+	// 列出所有访问策略模板的最新版本。
+	//
+	// 返回：
+	//   访问策略模板列表
+	ListPolicyTemplates() ([]accesspolicy.PolicyTemplateStored, error)
+
+	// 在组织树中创建或更新部门。上级部门须已在组织树中，且不能使组织树成环。只有管理员可以维护组织树。
+	//
+	// 参数：
+	//   部门
+	//
+	// 返回：
+	//   交易 ID
+	PutOrgUnit(orgUnit *identity.OrgUnit) (string, error)
+
+	// 从组织树中移除部门。仍有下级部门的部门不能移除。只有管理员可以维护组织树。
+	//
+	// 参数：
+	//   部门名称
+	//
+	// 返回：
+	//   交易 ID
+	RemoveOrgUnit(deptName string) (string, error)
+
+	// 列出组织树中的所有部门。
+	//
+	// 返回：
+	//   部门列表
+	ListOrgUnits() ([]identity.OrgUnitStored, error)
+}
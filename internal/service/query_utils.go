@@ -5,13 +5,16 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"sync"
 
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/global"
 	"gitee.com/czyczk/fabric-sdk-tutorial/internal/utils/cipherutils"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/data"
 	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/keyswitch"
 	"github.com/XiaoYao-austin/ppks"
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 	"github.com/tjfoc/gmsm/sm2"
 )
 
@@ -170,52 +173,291 @@ func checkSizeAndHashForDecryptedData(dataBytes []byte, metadata *data.ResMetada
 	return matched
 }
 
-// 解析并验证份额，若过程出现无法解析、无法验证或验证不通过的份额则返回错误，全部通过后解析的份额将通过列表返回。
-func parseAndVerifySharesFromKeySwitchResults(ksResults []*keyswitch.KeySwitchResultStored, targetPublicKey *sm2.PublicKey, encryptedKey *ppks.CipherText, keySwitchService KeySwitchServiceInterface) ([]*ppks.CipherText, error) {
-	var shares []*ppks.CipherText // 这里记录着通过了验证的份额
+// 从密钥置换结果中收集用于解密某一资源的份额。多资源会话的结果中只取该资源的份额。只接受链上登记的密钥置换服务器以其登记的密钥置换公钥提交的结果。所需的份额数量取自会话的触发器。
+// n-of-n 模式下要求所需数量的结果均来自登记的服务器且全部通过验证。
+// t-of-n 模式下（见 `isThresholdMode()`）跳过无法验证或不来自已知份额持有者的结果，收集到所需数量的通过验证的份额即返回。
+//
+// 返回：
+//   通过验证的份额
+//   各份额的份额序号。n-of-n 模式下为 nil。
+func collectSharesFromKeySwitchResults(resourceID string, ksResults []*keyswitch.KeySwitchResultStored, ksServers []keyswitch.KeySwitchServerStored, numSharesExpected int, targetPublicKey *sm2.PublicKey, encryptedKey *ppks.CipherText, keySwitchService KeySwitchServiceInterface) ([]*ppks.CipherText, []int, error) {
+	if len(ksServers) == 0 {
+		return nil, nil, fmt.Errorf("没有登记的密钥置换服务器")
+	}
+
+	// 筛选出登记的服务器提交的结果
+	ksPKsByCreator := map[string]string{}
+	for _, ksServer := range ksServers {
+		ksPKsByCreator[ksServer.PublicKey] = ksServer.KeySwitchPK
+	}
+
+	var registeredKSResults []*keyswitch.KeySwitchResultStored
 	for _, ksResult := range ksResults {
-		shareBytes, err := base64.StdEncoding.DecodeString(ksResult.Share)
-		if err != nil {
-			return nil, errors.Wrap(err, "无法解析份额")
+		if ksPK, ok := ksPKsByCreator[ksResult.Creator]; ok && ksPK == ksResult.KeySwitchPK {
+			if ksResultForResource := ksResult.GetResultForResource(resourceID); ksResultForResource != nil {
+				registeredKSResults = append(registeredKSResults, ksResultForResource)
+			}
 		}
+	}
 
-		// 将每份 share 解析为一个 share *ppks.CipherText，并用对应的证明验证它。
-		share, err := cipherutils.DeserializeCipherText(shareBytes)
-		if err != nil {
-			return nil, err
+	if !isThresholdMode() {
+		if len(registeredKSResults) != numSharesExpected {
+			return nil, nil, fmt.Errorf("密钥置换结果有 %v 份，应为 %v 份", len(registeredKSResults), numSharesExpected)
 		}
 
-		proofBytes, err := base64.StdEncoding.DecodeString(ksResult.ZKProof)
+		shares, err := parseAndVerifySharesFromKeySwitchResults(registeredKSResults, targetPublicKey, encryptedKey, keySwitchService)
 		if err != nil {
-			return nil, errors.Wrap(err, "无法解析零知识证明")
+			return nil, nil, err
 		}
 
-		proof, err := cipherutils.DeserializeZKProof(proofBytes)
-		if err != nil {
-			return nil, err
+		return shares, nil, nil
+	}
+
+	// 每个份额序号只取第一份来自已知份额持有者的结果，并发验证后按结果顺序取所需数量的通过验证的份额
+	var candidateKSResults []*keyswitch.KeySwitchResultStored
+	var candidateIndices []int
+	isIndexCandidate := map[int]bool{}
+	for _, ksResult := range registeredKSResults {
+		index, ok := global.KeySwitchKeys.ShareIndices[ksResult.KeySwitchPK]
+		if !ok || isIndexCandidate[index] {
+			continue
 		}
 
-		shareCreatorPublicKeyBytes, err := base64.StdEncoding.DecodeString(ksResult.KeySwitchPK)
+		candidateKSResults = append(candidateKSResults, ksResult)
+		candidateIndices = append(candidateIndices, index)
+		isIndexCandidate[index] = true
+	}
+
+	candidateShares, errs := verifySharesFromKeySwitchResultsConcurrently(candidateKSResults, targetPublicKey, encryptedKey, keySwitchService)
+
+	var shares []*ppks.CipherText
+	var shareIndices []int
+	for i, share := range candidateShares {
+		if errs[i] != nil {
+			log.Debugf("跳过未通过验证的密钥置换结果: %v", errs[i])
+			continue
+		}
+
+		shares = append(shares, share)
+		shareIndices = append(shareIndices, candidateIndices[i])
+		if len(shares) == numSharesExpected {
+			return shares, shareIndices, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("通过验证的密钥置换结果只有 %v 份，不足 %v 份", len(shares), numSharesExpected)
+}
+
+// 以 `collectSharesFromKeySwitchResults()` 收集用于解密某一资源的份额。份额不足且存活的密钥置换服务器也不足时，返回 `*ErrorKeySwitchServersUnavailable` 以说明原因。
+func collectSharesForResource(resourceID string, ksResults []*keyswitch.KeySwitchResultStored, ksServers []keyswitch.KeySwitchServerStored, numSharesExpected int, targetPublicKey *sm2.PublicKey, encryptedKey *ppks.CipherText, keySwitchService KeySwitchServiceInterface) ([]*ppks.CipherText, []int, error) {
+	shares, shareIndices, err := collectSharesFromKeySwitchResults(resourceID, ksResults, ksServers, numSharesExpected, targetPublicKey, encryptedKey, keySwitchService)
+	if err == nil || len(ksServers) == 0 {
+		return shares, shareIndices, err
+	}
+
+	isResultSubmitted := map[string]bool{}
+	for _, ksResult := range ksResults {
+		isResultSubmitted[ksResult.Creator] = true
+	}
+
+	hasResult := func(publicKey string) bool { return isResultSubmitted[publicKey] }
+	if availabilityErr := checkKeySwitchServerAvailability(keySwitchService, numSharesExpected, hasResult); availabilityErr != nil {
+		return nil, nil, availabilityErr
+	}
+
+	return nil, nil, err
+}
+
+// keySwitchShareCollector 在密钥置换结果逐份到达时收集并验证份额，接受结果的规则与 `collectSharesFromKeySwitchResults()` 一致。
+type keySwitchShareCollector struct {
+	ksPKsByCreator     map[string]string
+	numExpected        int
+	targetPublicKey    *sm2.PublicKey
+	encryptedKeys      map[string]*ppks.CipherText // 按资源 ID 索引的资源的加密密钥。多资源会话的结果须通过其中每个资源的验证。
+	keySwitchService   KeySwitchServiceInterface
+	isCreatorCollected map[string]bool
+	isIndexCollected   map[int]bool
+	results            [][]byte // 通过验证的密钥置换结果（序列化后）
+}
+
+func newKeySwitchShareCollector(ksServers []keyswitch.KeySwitchServerStored, numSharesExpected int, targetPublicKey *sm2.PublicKey, encryptedKeys map[string]*ppks.CipherText, keySwitchService KeySwitchServiceInterface) *keySwitchShareCollector {
+	ksPKsByCreator := map[string]string{}
+	for _, ksServer := range ksServers {
+		ksPKsByCreator[ksServer.PublicKey] = ksServer.KeySwitchPK
+	}
+
+	return &keySwitchShareCollector{
+		ksPKsByCreator:     ksPKsByCreator,
+		numExpected:        numSharesExpected,
+		targetPublicKey:    targetPublicKey,
+		encryptedKeys:      encryptedKeys,
+		keySwitchService:   keySwitchService,
+		isCreatorCollected: map[string]bool{},
+		isIndexCollected:   map[int]bool{},
+	}
+}
+
+// 是否仍需要该结果创建者的结果。只需要尚未收集过的登记的服务器的结果。
+func (c *keySwitchShareCollector) isWanted(resultCreator string) bool {
+	_, ok := c.ksPKsByCreator[resultCreator]
+	return ok && !c.isCreatorCollected[resultCreator] && !c.isComplete()
+}
+
+// 是否已收集到该结果创建者的结果。
+func (c *keySwitchShareCollector) hasResult(resultCreator string) bool {
+	return c.isCreatorCollected[resultCreator]
+}
+
+// 是否已收集到所需个数的份额。
+func (c *keySwitchShareCollector) isComplete() bool {
+	return len(c.results) >= c.numExpected
+}
+
+// 验证并收集一份密钥置换结果。不需要的结果被跳过。
+// n-of-n 模式下未通过验证的份额使收集无法完成，返回错误；t-of-n 模式下跳过该份额。
+func (c *keySwitchShareCollector) add(ksResult *keyswitch.KeySwitchResultStored) error {
+	if !c.isWanted(ksResult.Creator) || c.ksPKsByCreator[ksResult.Creator] != ksResult.KeySwitchPK {
+		return nil
+	}
+
+	isThreshold := isThresholdMode()
+	index := 0
+	if isThreshold {
+		var ok bool
+		index, ok = global.KeySwitchKeys.ShareIndices[ksResult.KeySwitchPK]
+		if !ok || c.isIndexCollected[index] {
+			return nil
+		}
+	}
+
+	for resourceID, encryptedKey := range c.encryptedKeys {
+		ksResultForResource := ksResult.GetResultForResource(resourceID)
+		err := fmt.Errorf("密钥置换结果中没有资源 '%v' 的份额", resourceID)
+		if ksResultForResource != nil {
+			_, err = parseAndVerifyShareFromKeySwitchResult(ksResultForResource, c.targetPublicKey, encryptedKey, c.keySwitchService)
+		}
 		if err != nil {
-			return nil, errors.Wrap(err, "无法解析份额创建者的密钥置换公钥")
+			if isThreshold {
+				log.Debugf("跳过未通过验证的密钥置换结果: %v", err)
+				return nil
+			}
+			return err
 		}
+	}
+
+	ksResultBytes, err := json.Marshal(ksResult)
+	if err != nil {
+		return errors.Wrap(err, "无法序列化密钥置换结果")
+	}
+
+	c.results = append(c.results, ksResultBytes)
+	c.isCreatorCollected[ksResult.Creator] = true
+	if isThreshold {
+		c.isIndexCollected[index] = true
+	}
+
+	return nil
+}
+
+// 获取完成密钥置换所需的份额数量。以链码创建触发器时按会话配置记录的数量为准：t-of-n 模式下为门限值，n-of-n 模式下为当时登记的密钥置换服务器数量。
+func getNumSharesExpected(ksTrigger *keyswitch.KeySwitchTriggerStored) (int, error) {
+	if ksTrigger.NumSharesExpected <= 0 {
+		return 0, fmt.Errorf("密钥置换会话 '%v' 没有记录所需的份额数量", ksTrigger.KeySwitchSessionID)
+	}
 
-		shareCreatorPublicKey, err := cipherutils.DeserializeSM2PublicKey(shareCreatorPublicKeyBytes)
+	return ksTrigger.NumSharesExpected, nil
+}
+
+// 是否处于 t-of-n 模式。配置了门限密钥信息（即各份额持有者的份额序号）时份额须以拉格朗日插值合并，否则直接相加。
+func isThresholdMode() bool {
+	return len(global.KeySwitchKeys.ShareIndices) > 0
+}
+
+// 解析并验证份额，若过程出现无法解析、无法验证或验证不通过的份额则返回错误，全部通过后解析的份额将通过列表返回。
+func parseAndVerifySharesFromKeySwitchResults(ksResults []*keyswitch.KeySwitchResultStored, targetPublicKey *sm2.PublicKey, encryptedKey *ppks.CipherText, keySwitchService KeySwitchServiceInterface) ([]*ppks.CipherText, error) {
+	shares, errs := verifySharesFromKeySwitchResultsConcurrently(ksResults, targetPublicKey, encryptedKey, keySwitchService)
+	for _, err := range errs {
 		if err != nil {
 			return nil, err
 		}
+	}
+
+	return shares, nil
+}
+
+// 并发地解析并验证各密钥置换结果中的份额。零知识证明的验证彼此独立，逐份验证时耗时随份额数量线性增长。
+//
+// 返回：
+//   与密钥置换结果一一对应的份额。未通过验证的位置为 nil。
+//   与密钥置换结果一一对应的错误。通过验证的位置为 nil。
+func verifySharesFromKeySwitchResultsConcurrently(ksResults []*keyswitch.KeySwitchResultStored, targetPublicKey *sm2.PublicKey, encryptedKey *ppks.CipherText, keySwitchService KeySwitchServiceInterface) ([]*ppks.CipherText, []error) {
+	shares := make([]*ppks.CipherText, len(ksResults))
+	errs := make([]error, len(ksResults))
+
+	var wg sync.WaitGroup
+	for i, ksResult := range ksResults {
+		wg.Add(1)
+		go func(i int, ksResult *keyswitch.KeySwitchResultStored) {
+			defer wg.Done()
+			shares[i], errs[i] = parseAndVerifyShareFromKeySwitchResult(ksResult, targetPublicKey, encryptedKey, keySwitchService)
+		}(i, ksResult)
+	}
+	wg.Wait()
 
-		isShareVerified, err := keySwitchService.VerifyShare(share, proof, shareCreatorPublicKey, targetPublicKey, encryptedKey)
+	return shares, errs
+}
+
+// 解析并验证一份份额，无法解析、无法验证或验证不通过时返回错误。
+func parseAndVerifyShareFromKeySwitchResult(ksResult *keyswitch.KeySwitchResultStored, targetPublicKey *sm2.PublicKey, encryptedKey *ppks.CipherText, keySwitchService KeySwitchServiceInterface) (*ppks.CipherText, error) {
+	// 链下交付的份额在链上只有承诺，先取出交付的份额并以承诺核对，再与链上的份额一样验证
+	shareAsBase64, proofAsBase64 := ksResult.Share, ksResult.ZKProof
+	if ksResult.Commitment != "" {
+		var err error
+		shareAsBase64, proofAsBase64, err = keySwitchService.GetDeliveredShare(ksResult.KeySwitchSessionID, ksResult.Commitment)
 		if err != nil {
-			return nil, errors.Wrap(err, "无法验证份额")
+			return nil, errors.Wrap(err, "无法取得链下交付的份额")
 		}
+	}
 
-		if !isShareVerified {
-			return nil, fmt.Errorf("份额验证未通过")
-		}
+	shareBytes, err := base64.StdEncoding.DecodeString(shareAsBase64)
+	if err != nil {
+		return nil, errors.Wrap(err, "无法解析份额")
+	}
 
-		shares = append(shares, share)
+	// 将 share 解析为一个 share *ppks.CipherText，并用对应的证明验证它。
+	share, err := cipherutils.DeserializeCipherText(shareBytes)
+	if err != nil {
+		return nil, err
 	}
 
-	return shares, nil
+	proofBytes, err := base64.StdEncoding.DecodeString(proofAsBase64)
+	if err != nil {
+		return nil, errors.Wrap(err, "无法解析零知识证明")
+	}
+
+	proof, err := cipherutils.DeserializeZKProof(proofBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	shareCreatorPublicKeyBytes, err := base64.StdEncoding.DecodeString(ksResult.KeySwitchPK)
+	if err != nil {
+		return nil, errors.Wrap(err, "无法解析份额创建者的密钥置换公钥")
+	}
+
+	shareCreatorPublicKey, err := cipherutils.DeserializeSM2PublicKey(shareCreatorPublicKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	isShareVerified, err := keySwitchService.VerifyShare(share, proof, shareCreatorPublicKey, targetPublicKey, encryptedKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "无法验证份额")
+	}
+
+	if !isShareVerified {
+		return nil, fmt.Errorf("份额验证未通过")
+	}
+
+	return share, nil
 }
@@ -22,14 +22,20 @@ import (
 func SerializeCipherText(cipherText *ppks.CipherText) []byte {
 	// 将左侧点 K 装入 [0:64]，将右侧点 C 装入 [64:128]
 	encryptedKeyBytes := make([]byte, 128)
-	copy(encryptedKeyBytes[:32], cipherText.K.X.Bytes())
-	copy(encryptedKeyBytes[32:64], cipherText.K.Y.Bytes())
-	copy(encryptedKeyBytes[64:96], cipherText.C.X.Bytes())
-	copy(encryptedKeyBytes[96:], cipherText.C.Y.Bytes())
+	putBigIntBytes(encryptedKeyBytes[:32], cipherText.K.X)
+	putBigIntBytes(encryptedKeyBytes[32:64], cipherText.K.Y)
+	putBigIntBytes(encryptedKeyBytes[64:96], cipherText.C.X)
+	putBigIntBytes(encryptedKeyBytes[96:], cipherText.C.Y)
 
 	return encryptedKeyBytes
 }
 
+// putBigIntBytes 将 x 以大端序右对齐写入 dst，高位不足处补 0。`x.Bytes()` 会省略前导的 0 字节，直接从左侧复制会错位。
+func putBigIntBytes(dst []byte, x *big.Int) {
+	b := x.Bytes()
+	copy(dst[len(dst)-len(b):], b)
+}
+
 // DeserializeCipherText parses a byte slice of length of 128 into a `CipherText` object.
 func DeserializeCipherText(encryptedKeyBytes []byte) (*ppks.CipherText, error) {
 	// 解析加密后的密钥材料，将其转化为两个 CurvePoint 后，分别作为 CipherText 的 K 和 C
@@ -67,9 +73,9 @@ func SerializeZKProof(proof *ZKProof) []byte {
 	// 一份 proof 的内容是 3 个 big.Int，每个用 .Bytes() 提取信息得到长度为 32 的 []byte。
 	// 3 个 big.Int 提取 []byte 后按顺序拼接成长度为 96 的 []byte，作为序列化结果。
 	proofBytes := make([]byte, 96)
-	copy(proofBytes[:32], proof.C.Bytes())
-	copy(proofBytes[32:64], proof.R1.Bytes())
-	copy(proofBytes[64:], proof.R2.Bytes())
+	putBigIntBytes(proofBytes[:32], proof.C)
+	putBigIntBytes(proofBytes[32:64], proof.R1)
+	putBigIntBytes(proofBytes[64:], proof.R2)
 
 	return proofBytes
 }
@@ -99,8 +105,8 @@ func DeserializeZKProof(proofBytes []byte) (*ZKProof, error) {
 // SerializeSM2PublicKey 将一个 SM2 公钥序列化成一个长度为 64 的字节切片。
 func SerializeSM2PublicKey(publicKey *sm2.PublicKey) []byte {
 	pubKeyBytes := [64]byte{}
-	copy(pubKeyBytes[:32], publicKey.X.Bytes())
-	copy(pubKeyBytes[32:], publicKey.Y.Bytes())
+	putBigIntBytes(pubKeyBytes[:32], publicKey.X)
+	putBigIntBytes(pubKeyBytes[32:], publicKey.Y)
 	return pubKeyBytes[:]
 }
 
@@ -0,0 +1,118 @@
+package cipherutils
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+
+	"github.com/XiaoYao-austin/ppks"
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+// SplitSM2PrivateKey 使用 Shamir 秘密共享将 SM2 私钥拆分为 `numShares` 份，任意 `threshold` 份即可恢复该私钥。
+// 第 i 份（从 0 开始）的份额序号为 i + 1，即多项式在 x = i + 1 处的值。每份均是合法的 SM2 私钥。
+//
+// 参数：
+//   要拆分的私钥
+//   门限值 t
+//   份数 n
+//
+// 返回：
+//   按份额序号排列的私钥份额
+func SplitSM2PrivateKey(privateKey *sm2.PrivateKey, threshold int, numShares int) ([]*sm2.PrivateKey, error) {
+	if threshold < 1 || threshold > numShares {
+		return nil, fmt.Errorf("门限值应在 1 至 %v 之间", numShares)
+	}
+
+	curve := sm2.P256Sm2()
+	n := curve.Params().N
+
+	// 构造 t - 1 次多项式 f(x)，常数项为私钥，其余系数随机
+	coefficients := []*big.Int{new(big.Int).Set(privateKey.D)}
+	for i := 1; i < threshold; i++ {
+		coefficient, err := rand.Int(rand.Reader, n)
+		if err != nil {
+			return nil, fmt.Errorf("无法生成随机系数: %v", err)
+		}
+		coefficients = append(coefficients, coefficient)
+	}
+
+	var shares []*sm2.PrivateKey
+	for index := 1; index <= numShares; index++ {
+		// 以秦九韶算法求 f(index)
+		x := big.NewInt(int64(index))
+		d := new(big.Int)
+		for i := len(coefficients) - 1; i >= 0; i-- {
+			d.Mul(d, x)
+			d.Add(d, coefficients[i])
+			d.Mod(d, n)
+		}
+		if d.Sign() == 0 {
+			return nil, fmt.Errorf("份额 %v 为 0，请重新生成", index)
+		}
+
+		share := new(sm2.PrivateKey)
+		share.D = d
+		share.PublicKey.Curve = curve
+		share.PublicKey.X, share.PublicKey.Y = curve.ScalarBaseMult(d.Bytes())
+		shares = append(shares, share)
+	}
+
+	return shares, nil
+}
+
+// LagrangeCoefficientAtZero 计算份额序号为 `index` 的份额在 x = 0 处的拉格朗日系数。
+// 参与恢复的各份额以各自的系数加权求和，即得到原私钥。
+//
+// 参数：
+//   份额序号
+//   参与恢复的全部份额序号（包含 `index`）
+//
+// 返回：
+//   拉格朗日系数
+func LagrangeCoefficientAtZero(index int, indices []int) (*big.Int, error) {
+	n := sm2.P256Sm2().Params().N
+
+	numerator, denominator := big.NewInt(1), big.NewInt(1)
+	isIndexIncluded := false
+	for _, j := range indices {
+		if j < 1 {
+			return nil, fmt.Errorf("份额序号应为正整数")
+		}
+		if j == index {
+			if isIndexIncluded {
+				return nil, fmt.Errorf("份额序号 %v 重复", index)
+			}
+			isIndexIncluded = true
+			continue
+		}
+
+		// λ_i = ∏ j / (j - i)
+		numerator.Mul(numerator, big.NewInt(int64(j)))
+		numerator.Mod(numerator, n)
+		denominator.Mul(denominator, big.NewInt(int64(j-index)))
+		denominator.Mod(denominator, n)
+	}
+
+	if !isIndexIncluded {
+		return nil, fmt.Errorf("份额序号 %v 不在参与恢复的份额序号中", index)
+	}
+
+	coefficient := new(big.Int).ModInverse(denominator, n)
+	coefficient.Mul(coefficient, numerator)
+	coefficient.Mod(coefficient, n)
+
+	return coefficient, nil
+}
+
+// ScaleCipherText 将 `CipherText` 的两个点分别乘以标量 `k`。
+func ScaleCipherText(cipherText *ppks.CipherText, k *big.Int) *ppks.CipherText {
+	curve := sm2.P256Sm2()
+	kx, ky := curve.ScalarMult(cipherText.K.X, cipherText.K.Y, k.Bytes())
+	cx, cy := curve.ScalarMult(cipherText.C.X, cipherText.C.Y, k.Bytes())
+
+	return &ppks.CipherText{
+		K: ppks.CurvePoint{Curve: curve, X: kx, Y: ky},
+		C: ppks.CurvePoint{Curve: curve, X: cx, Y: cy},
+	}
+}
@@ -0,0 +1,68 @@
+package cipherutils
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/XiaoYao-austin/ppks"
+	"github.com/stretchr/testify/assert"
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+func TestSplitAndRecoverSM2PrivateKey(t *testing.T) {
+	privateKey, err := ppks.GenPrivKey()
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	shares, err := SplitSM2PrivateKey(privateKey, 2, 3)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	if isLenCorrect := assert.Len(t, shares, 3); !isLenCorrect {
+		t.FailNow()
+	}
+
+	// 任意 2 份均可恢复私钥
+	n := sm2.P256Sm2().Params().N
+	for _, indices := range [][]int{{1, 2}, {1, 3}, {3, 2}, {1, 2, 3}} {
+		d := new(big.Int)
+		for _, index := range indices {
+			coefficient, err := LagrangeCoefficientAtZero(index, indices)
+			if isNoError := assert.NoError(t, err, indices); !isNoError {
+				t.FailNow()
+			}
+			d.Add(d, new(big.Int).Mul(coefficient, shares[index-1].D))
+			d.Mod(d, n)
+		}
+		assert.Equal(t, 0, d.Cmp(privateKey.D), indices)
+	}
+
+	// 只有 1 份时不能恢复
+	coefficient, err := LagrangeCoefficientAtZero(2, []int{2})
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	assert.NotEqual(t, 0, new(big.Int).Mod(new(big.Int).Mul(coefficient, shares[1].D), n).Cmp(privateKey.D))
+}
+
+func TestSplitSM2PrivateKeyWithInvalidThreshold(t *testing.T) {
+	privateKey, err := ppks.GenPrivKey()
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	_, err = SplitSM2PrivateKey(privateKey, 0, 3)
+	assert.Error(t, err)
+	_, err = SplitSM2PrivateKey(privateKey, 4, 3)
+	assert.Error(t, err)
+}
+
+func TestLagrangeCoefficientWithInvalidIndices(t *testing.T) {
+	_, err := LagrangeCoefficientAtZero(1, []int{2, 3})
+	assert.Error(t, err)
+	_, err = LagrangeCoefficientAtZero(1, []int{1, 1, 2})
+	assert.Error(t, err)
+	_, err = LagrangeCoefficientAtZero(0, []int{0, 1})
+	assert.Error(t, err)
+}
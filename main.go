@@ -34,8 +34,10 @@ func main() {
 	// Functions to be used by the cli helper
 	initFunc := getInitFunc(&configPath, &sdkConfigPath)
 	serveFunc := getServeFunc(&configPath, &sdkConfigPath)
+	backfillFunc := getBackfillFunc(&configPath, &sdkConfigPath)
 
 	app := &cli.App{
+		Version: global.Version,
 		Commands: []*cli.Command{
 			{
 				Name:    "init",
@@ -81,6 +83,27 @@ func main() {
 				},
 				Action: serveFunc,
 			},
+			{
+				Name:  "backfill",
+				Usage: "Decrypt the encrypted resources the regulator has missed into the local database",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "conf",
+						Aliases:     []string{"c"},
+						Value:       "server.yaml",
+						EnvVars:     []string{"FST_CONF"},
+						Destination: &configPath,
+					},
+					&cli.StringFlag{
+						Name:        "sdkconf",
+						Aliases:     []string{"s"},
+						Value:       "config-network.yaml",
+						EnvVars:     []string{"FST_SDK_CONF"},
+						Destination: &sdkConfigPath,
+					},
+				},
+				Action: backfillFunc,
+			},
 		},
 	}
 
@@ -185,7 +208,7 @@ func getServeFunc(configPath *string, sdkConfigPath *string) func(c *cli.Context
 		}
 
 		// Auto migrate schemas
-		err = db.AutoMigrate(&sqlmodel.DocumentProperties{}, &sqlmodel.Document{}, &sqlmodel.EntityAsset{}, &sqlmodel.Component{})
+		err = db.AutoMigrate(&sqlmodel.DocumentProperties{}, &sqlmodel.Document{}, &sqlmodel.EntityAsset{}, &sqlmodel.Component{}, &sqlmodel.BackgroundServerCheckpoint{}, &sqlmodel.BackfillCheckpoint{})
 		if err != nil {
 			return errors.Wrap(err, "无法创建数据库表")
 		}
@@ -243,7 +266,19 @@ func getServeFunc(configPath *string, sdkConfigPath *string) func(c *cli.Context
 			IPFSSh:        ipfsSh,
 		}
 
-		keySwitchSvc := &service.KeySwitchService{ServiceInfo: universalCcServiceInfo}
+		keySwitchSvc := &service.KeySwitchService{
+			ServiceInfo:      universalCcServiceInfo,
+			ShareDeliveryURL: serverInfo.ShareDeliveryURL,
+		}
+
+		// Bind the key switch public key of this instance to its identity so that it can be used to create key switch triggers
+		txID, err := keySwitchSvc.EnsureKeySwitchPKRegistered(global.KeySwitchKeys.PrivateKey)
+		if err != nil {
+			return errors.Wrap(err, "无法登记密钥置换公钥")
+		}
+		if txID != "" {
+			log.Infof("已登记本实例的密钥置换公钥。交易 ID: %v", txID)
+		}
 
 		// Instantiate a document service
 		documentSvc := &service.DocumentService{
@@ -268,6 +303,17 @@ func getServeFunc(configPath *string, sdkConfigPath *string) func(c *cli.Context
 			ServerInfo:  &serverInfo,
 		}
 
+		// Instantiate a policy service
+		policySvc := &service.PolicyService{
+			ServiceInfo: universalCcServiceInfo,
+		}
+
+		// Instantiate a key rotation service
+		keyRotationSvc := &service.KeyRotationService{
+			ServiceInfo:      universalCcServiceInfo,
+			KeySwitchService: keySwitchSvc,
+		}
+
 		// Prepare a key switch server. It will be of use if the app is enabled as a key switch server.
 		ksServer := background.NewKeySwitchServer(universalCcServiceInfo, keySwitchSvc, runtime.NumCPU())
 		if isKeySwitchServer {
@@ -288,6 +334,12 @@ func getServeFunc(configPath *string, sdkConfigPath *string) func(c *cli.Context
 			}
 		}
 
+		// Prepare a key re-encryption job. It runs only when requested through the API.
+		keyReencryptionJob := background.NewKeyReencryptionJob(keyRotationSvc, keySwitchSvc, runtime.NumCPU())
+
+		// Prepare a regulator backfill job. It runs only when requested through the API.
+		regulatorBackfillJob := background.NewRegulatorBackfillJob(universalCcServiceInfo, regulatorServer, runtime.NumCPU())
+
 		// // Make a "transfer" request to transfer 10 screws from "Org1" to "Org2" and show the transaction ID
 		// respMsg, err := screwSvc.TransferAndShowEvent("Org1", "Org2", 10)
 		// if err != nil {
@@ -347,6 +399,33 @@ func getServeFunc(configPath *string, sdkConfigPath *string) func(c *cli.Context
 			IdentitySvc:    identitySvc,
 		}
 
+		// Instantiate a policy controller
+		policyController := &controller.PolicyController{
+			GroupName: "/",
+			PolicySvc: policySvc,
+		}
+
+		// Instantiate a key rotation controller
+		keyRotationController := &controller.KeyRotationController{
+			GroupName:       "/key-rotation",
+			KeyRotationSvc:  keyRotationSvc,
+			ReencryptionJob: keyReencryptionJob,
+		}
+
+		// Instantiate a regulator controller
+		regulatorController := &controller.RegulatorController{
+			GroupName:   "/regulator",
+			BackfillJob: regulatorBackfillJob,
+			Token:       serverInfo.RegulatorToken,
+		}
+
+		// Instantiate a background controller
+		backgroundController := &controller.BackgroundController{
+			GroupName:       "/background",
+			KeySwitchServer: ksServer,
+			RegulatorServer: regulatorServer,
+		}
+
 		// Register controller handlers
 		router := gin.Default()
 		router.Use(controller.CORSMiddleware())
@@ -358,6 +437,13 @@ func getServeFunc(configPath *string, sdkConfigPath *string) func(c *cli.Context
 		_ = controller.RegisterHandlers(apiv1Group, authController)
 		_ = controller.RegisterHandlers(apiv1Group, keySwitchController)
 		_ = controller.RegisterHandlers(apiv1Group, identityController)
+		_ = controller.RegisterHandlers(apiv1Group, policyController)
+		_ = controller.RegisterHandlers(apiv1Group, keyRotationController)
+		_ = controller.RegisterHandlers(apiv1Group, backgroundController)
+		if isRegulator {
+			// The regulator backfill job can only be managed on a regulator instance
+			_ = controller.RegisterHandlers(apiv1Group, regulatorController)
+		}
 
 		// Start the HTTP server
 		log.Infoln(fmt.Sprintf("正在端口 %v 上启动 HTTP 服务器...", serverInfo.Port))
@@ -394,9 +480,31 @@ func getServeFunc(configPath *string, sdkConfigPath *string) func(c *cli.Context
 			// Stop the key switch server if enabled
 			if isKeySwitchServer {
 				log.Infoln("正在停止密钥置换服务器...")
-				wg, err := ksServer.Stop()
-				defer wg.Wait()
-				if err != nil {
+				if err := ksServer.Stop(ctx); err != nil {
+					return err
+				}
+			}
+
+			// Stop the regulator server if enabled
+			if isRegulator {
+				log.Infoln("正在停止监管者服务器...")
+				if err := regulatorServer.Stop(ctx); err != nil {
+					return err
+				}
+			}
+
+			// Stop the key re-encryption job if it's running. The resources left can be processed by running the job again.
+			if keyReencryptionJob.Progress().IsRunning {
+				log.Infoln("正在停止密钥重加密任务...")
+				if err := keyReencryptionJob.Stop(ctx); err != nil {
+					return err
+				}
+			}
+
+			// Stop the regulator backfill job if it's running. The next run resumes after the saved checkpoint.
+			if regulatorBackfillJob.Progress().IsRunning {
+				log.Infoln("正在停止监管者补处理任务...")
+				if err := regulatorBackfillJob.Stop(ctx); err != nil {
 					return err
 				}
 			}
@@ -407,3 +515,105 @@ func getServeFunc(configPath *string, sdkConfigPath *string) func(c *cli.Context
 
 	return serveFunc
 }
+
+func getBackfillFunc(configPath *string, sdkConfigPath *string) func(c *cli.Context) error {
+	// The func for subcommand "backfill". It runs the regulator backfill job in the foreground and reports its progress until it ends.
+	backfillFunc := func(c *cli.Context) error {
+		// Create a Fabric SDK instance
+		err := appinit.SetupSDK(*sdkConfigPath)
+		if err != nil {
+			return err
+		}
+
+		defer global.SDKInstance.Close()
+
+		// Load serve info from `serve.yaml`
+		serverInfo, err := appinit.LoadServerInfo(*configPath)
+		if err != nil {
+			return err
+		}
+
+		orgName := serverInfo.User.OrgName
+		userID := serverInfo.User.UserID
+
+		// Only channel clients are needed to query the chain
+		for _, channelID := range serverInfo.Channels {
+			if err = appinit.InstantiateChannelClient(global.SDKInstance, channelID, orgName, userID); err != nil {
+				return err
+			}
+		}
+
+		// Check and create a MySQL database connection
+		db, err := gorm.Open(mysql.Open(serverInfo.LocalDBSourceName), &gorm.Config{})
+		if err != nil {
+			return errors.Wrap(err, "无法连接数据库")
+		}
+
+		// Auto migrate schemas
+		err = db.AutoMigrate(&sqlmodel.DocumentProperties{}, &sqlmodel.Document{}, &sqlmodel.EntityAsset{}, &sqlmodel.Component{}, &sqlmodel.BackgroundServerCheckpoint{}, &sqlmodel.BackfillCheckpoint{})
+		if err != nil {
+			return errors.Wrap(err, "无法创建数据库表")
+		}
+
+		// Make sure the collective private key is specified and load the keys
+		if serverInfo.KeySwitchKeys == nil || serverInfo.KeySwitchKeys.CollectivePublicKey == "" {
+			return fmt.Errorf("未指定密钥置换集合公钥")
+		}
+
+		if serverInfo.KeySwitchKeys.CollectivePrivateKey == "" {
+			return fmt.Errorf("未指定监管者功能所需的集合私钥")
+		}
+
+		err = appinit.LoadKeySwitchServerKeys(serverInfo.KeySwitchKeys)
+		if err != nil {
+			return err
+		}
+
+		universalCcServiceInfo := &service.Info{
+			ChaincodeID:   "universalCc",
+			ChannelClient: global.ChannelClientInstances["mychannel"][orgName][userID],
+			DB:            db,
+		}
+
+		documentSvc := &service.DocumentService{ServiceInfo: universalCcServiceInfo}
+		entityAssetSvc := &service.EntityAssetService{ServiceInfo: universalCcServiceInfo}
+
+		// The regulator server is not started. The job only reuses its way of processing a resource.
+		regulatorServer := background.NewRegulatorServer(universalCcServiceInfo, documentSvc, entityAssetSvc)
+		backfillJob := background.NewRegulatorBackfillJob(universalCcServiceInfo, regulatorServer, runtime.NumCPU())
+		if err = backfillJob.Start(); err != nil {
+			return err
+		}
+
+		// Report the progress periodically. On Ctrl+C, stop the job and leave the rest for the next run.
+		chanQuit := make(chan os.Signal, 1)
+		signal.Notify(chanQuit, os.Interrupt)
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-backfillJob.Done():
+				progress := backfillJob.Progress()
+				if progress.Error != "" {
+					return fmt.Errorf("监管者补处理任务未完成: %v", progress.Error)
+				}
+				if len(progress.Failures) > 0 {
+					return fmt.Errorf("监管者补处理任务有 %v 个资源失败，可重新运行以重试", len(progress.Failures))
+				}
+				return nil
+			case <-ticker.C:
+				progress := backfillJob.Progress()
+				log.Infof("监管者补处理进度：补处理 %v 个，跳过 %v 个，失败 %v 个。检查点: %v", progress.NumBackfilled, progress.NumSkipped, len(progress.Failures), progress.LastResourceID)
+			case <-chanQuit:
+				log.Infoln("收到 Ctrl+C 信号，正在停止监管者补处理任务...")
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				err := backfillJob.Stop(ctx)
+				cancel()
+				return err
+			}
+		}
+	}
+
+	return backfillFunc
+}
@@ -1,6 +1,9 @@
 package errorcode
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 const (
 	// CodeForbidden 表示参数被理解，但无权进行操作。收到的错误中若是这样的错误信息则表示是操作权限的问题，而非链码运行出错。对应 HTTP 状态码的 403。
@@ -11,6 +14,8 @@ const (
 	CodeNotImplemented = "~NOTIMPLEMENTED~"
 	// CodeGatewayTimeout 是个在这个项目中约定俗成的代号。收到错误中若是这样的错误信息则表示是因操作超时引起的。对应 HTTP 状态码的 504。
 	CodeGatewayTimeout = "~GATEWAYTIMEOUT~"
+	// CodeServiceUnavailable 是个在这个项目中约定俗成的代号。收到错误中若是这样的错误信息则表示是因所依赖的服务暂时不可用引起的。对应 HTTP 状态码的 503。
+	CodeServiceUnavailable = "~SERVICEUNAVAILABLE~"
 )
 
 // ErrorForbidden 为使用了 `CodeForbidden` 的 error 实例
@@ -24,3 +29,43 @@ var ErrorNotImplemented = fmt.Errorf(CodeNotImplemented)
 
 // ErrorGatewayTimeout 为使用了 `CodeGatewayTimeout` 的 error 实例
 var ErrorGatewayTimeout = fmt.Errorf(CodeGatewayTimeout)
+
+// ErrorServiceUnavailable 为使用了 `CodeServiceUnavailable` 的 error 实例
+var ErrorServiceUnavailable = fmt.Errorf(CodeServiceUnavailable)
+
+// 错误详情的起始标记
+const detailMarker = "~DETAIL~"
+
+// WithDetail 在错误代号前附上详情，得到形如 "~DETAIL~<详情>~FORBIDDEN~" 的错误信息。这样的错误信息仍以错误代号结尾，因此仍能按错误代号分类。
+//
+// 参数：
+//   错误代号
+//   详情
+//
+// 返回：
+//   错误信息
+func WithDetail(code string, detail string) string {
+	return detailMarker + detail + code
+}
+
+// ExtractDetail 从以错误代号 `code` 结尾的错误信息中取出由 `WithDetail` 附上的详情。
+//
+// 参数：
+//   错误信息
+//   错误代号
+//
+// 返回：
+//   详情
+//   错误信息是否附有详情
+func ExtractDetail(errMsg string, code string) (string, bool) {
+	if !strings.HasSuffix(errMsg, code) {
+		return "", false
+	}
+
+	start := strings.Index(errMsg, detailMarker)
+	if start < 0 {
+		return "", false
+	}
+
+	return errMsg[start+len(detailMarker) : len(errMsg)-len(code)], true
+}
@@ -0,0 +1,191 @@
+// Package ksclient 供自行持有密钥置换私钥的访问申请者在本地解密资源。
+//
+// 访问申请者以自己的密钥置换公钥创建密钥置换触发器，待密钥置换服务器提交份额后获取解密材料，再以私钥在本地解密，应用实例不接触明文。
+package ksclient
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/utils/cipherutils"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/keyswitch"
+	"github.com/XiaoYao-austin/ppks"
+	"github.com/pkg/errors"
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+// EncodePublicKey 将密钥置换公钥编码为创建密钥置换触发器时使用的形式（[64]byte 的 Base64 编码）。
+func EncodePublicKey(publicKey *sm2.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(cipherutils.SerializeSM2PublicKey(publicKey))
+}
+
+// SignKeySwitchPKRegistration 生成登记密钥置换公钥所需的签名。以密钥置换私钥对绑定的身份签名，证明登记者持有该私钥。
+//
+// 参数：
+//   密钥置换私钥
+//   登记者身份的公钥（Base64 编码的 DER）
+//
+// 返回：
+//   密钥置换公钥登记
+func SignKeySwitchPKRegistration(privateKey *sm2.PrivateKey, ownerAsBase64 string) (*keyswitch.KeySwitchPKRegistration, error) {
+	if privateKey == nil {
+		return nil, fmt.Errorf("密钥置换私钥不能为 nil")
+	}
+
+	keySwitchPK := EncodePublicKey(&privateKey.PublicKey)
+	message := keyswitch.GetKeySwitchPKRegistrationMessage(ownerAsBase64, keySwitchPK)
+	signature, err := privateKey.Sign(rand.Reader, message, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "无法签名")
+	}
+
+	return &keyswitch.KeySwitchPKRegistration{
+		KeySwitchPK: keySwitchPK,
+		Signature:   base64.StdEncoding.EncodeToString(signature),
+	}, nil
+}
+
+// DecryptKeyWithShares 以份额对加密的对称密钥材料进行密钥置换，再以目标用户的私钥解密。
+//
+// 参数：
+//   经零知识证明验证的份额
+//   各份额的份额序号。为 nil 时各份额直接相加（n-of-n）；否则各份额按其拉格朗日系数加权后相加（t-of-n），此时只需门限值个份额。
+//   加密后的对称密钥材料
+//   目标用户用于密钥置换的私钥
+//
+// 返回：
+//   解密后的对称密钥材料
+func DecryptKeyWithShares(shares []*ppks.CipherText, shareIndices []int, encryptedKey *ppks.CipherText, targetPrivateKey *sm2.PrivateKey) (*ppks.CurvePoint, error) {
+	if shareIndices != nil && len(shareIndices) != len(shares) {
+		return nil, fmt.Errorf("份额序号数量与份额数量不一致")
+	}
+
+	// 组建一个 CipherVector，将每个 CipherText 放入 CipherVector。门限模式下先以拉格朗日系数加权。
+	var cipherVector ppks.CipherVector
+	for i, share := range shares {
+		if shareIndices != nil {
+			coefficient, err := cipherutils.LagrangeCoefficientAtZero(shareIndices[i], shareIndices)
+			if err != nil {
+				return nil, errors.Wrap(err, "无法计算拉格朗日系数")
+			}
+			share = cipherutils.ScaleCipherText(share, coefficient)
+		}
+		cipherVector = append(cipherVector, *share)
+	}
+
+	// 密钥置换
+	shareReplacedCipherText, err := ppks.ShareReplace(&cipherVector, encryptedKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "无法进行密钥置换")
+	}
+
+	// 用用户的私钥解密 CipherText
+	decryptedKey, err := ppks.PointDecrypt(shareReplacedCipherText, targetPrivateKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "无法解密对称密钥材料")
+	}
+
+	return decryptedKey, nil
+}
+
+// DecryptKey 以解密材料中的份额解密资源的对称密钥材料。
+//
+// 参数：
+//   解密材料
+//   创建触发器时所用的密钥置换公钥对应的私钥
+//
+// 返回：
+//   解密后的对称密钥材料
+func DecryptKey(materials *keyswitch.ClientDecryptionMaterials, privateKey *sm2.PrivateKey) (*ppks.CurvePoint, error) {
+	if materials == nil {
+		return nil, fmt.Errorf("解密材料不能为 nil")
+	}
+
+	encryptedKeyBytes, err := base64.StdEncoding.DecodeString(materials.EncryptedKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "无法解析加密密钥")
+	}
+
+	encryptedKey, err := cipherutils.DeserializeCipherText(encryptedKeyBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "无法解析加密密钥")
+	}
+
+	var shares []*ppks.CipherText
+	for _, shareAsBase64 := range materials.Shares {
+		shareBytes, err := base64.StdEncoding.DecodeString(shareAsBase64)
+		if err != nil {
+			return nil, errors.Wrap(err, "无法解析份额")
+		}
+
+		share, err := cipherutils.DeserializeCipherText(shareBytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "无法解析份额")
+		}
+
+		shares = append(shares, share)
+	}
+
+	return DecryptKeyWithShares(shares, materials.ShareIndices, encryptedKey, privateKey)
+}
+
+// DecryptBytes 以解密出的对称密钥材料解密密文。
+//
+// 参数：
+//   密文
+//   对称密钥材料
+//
+// 返回：
+//   明文
+func DecryptBytes(encryptedBytes []byte, key *ppks.CurvePoint) ([]byte, error) {
+	return cipherutils.DecryptBytesUsingAESKey(encryptedBytes, cipherutils.DeriveSymmetricKeyBytesFromCurvePoint(key))
+}
+
+// Decrypt 解密资源，并以元数据检查明文的大小和哈希。加密资源的密文取自解密材料；链下资源的密文须由调用者按 CID 从 IPFS 网络获取后传入。
+//
+// 参数：
+//   解密材料
+//   创建触发器时所用的密钥置换公钥对应的私钥
+//   链下资源的密文。加密资源传入 nil。
+//
+// 返回：
+//   明文
+func Decrypt(materials *keyswitch.ClientDecryptionMaterials, privateKey *sm2.PrivateKey, offchainCiphertext []byte) ([]byte, error) {
+	key, err := DecryptKey(materials, privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedBytes := offchainCiphertext
+	if encryptedBytes == nil {
+		if materials.Ciphertext == "" {
+			return nil, fmt.Errorf("解密材料中没有密文，链下资源的密文须从 IPFS 网络获取")
+		}
+
+		encryptedBytes, err = base64.StdEncoding.DecodeString(materials.Ciphertext)
+		if err != nil {
+			return nil, errors.Wrap(err, "无法解析密文")
+		}
+	}
+
+	plaintext, err := DecryptBytes(encryptedBytes, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "无法解密资源")
+	}
+
+	// 检查解密出的内容的大小和哈希是否匹配
+	if materials.Metadata != nil {
+		if uint64(len(plaintext)) != materials.Metadata.Size {
+			return nil, fmt.Errorf("解密出的资源大小不匹配")
+		}
+
+		hash := sha256.Sum256(plaintext)
+		if base64.StdEncoding.EncodeToString(hash[:]) != materials.Metadata.Hash {
+			return nil, fmt.Errorf("解密出的资源哈希不匹配")
+		}
+	}
+
+	return plaintext, nil
+}
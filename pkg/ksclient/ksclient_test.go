@@ -0,0 +1,118 @@
+package ksclient
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/internal/utils/cipherutils"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/data"
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/keyswitch"
+	"github.com/XiaoYao-austin/ppks"
+	"github.com/stretchr/testify/assert"
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+func TestDecrypt(t *testing.T) {
+	// 两个密钥置换服务器的私钥之和为集合私钥
+	server1Key, err := ppks.GenPrivKey()
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	server2Key, err := ppks.GenPrivKey()
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	collPubKey := ppks.CollPubKey([]sm2.PublicKey{server1Key.PublicKey, server2Key.PublicKey})
+
+	// 访问申请者自行持有的密钥
+	clientKey, err := ppks.GenPrivKey()
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	// 以集合公钥加密对称密钥，以对称密钥加密资源
+	key := ppks.GenPoint()
+	encryptedKey, err := ppks.PointEncrypt(collPubKey, key)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	plaintext := []byte("client-held private key")
+	ciphertext, err := cipherutils.EncryptBytesUsingAESKey(plaintext, cipherutils.DeriveSymmetricKeyBytesFromCurvePoint(key))
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	// 服务器以访问申请者的公钥为目标计算份额
+	share1, _, err := ppks.ShareCal(&clientKey.PublicKey, &encryptedKey.K, server1Key)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	share2, _, err := ppks.ShareCal(&clientKey.PublicKey, &encryptedKey.K, server2Key)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	hash := sha256.Sum256(plaintext)
+	materials := &keyswitch.ClientDecryptionMaterials{
+		Metadata: &data.ResMetadataStored{
+			ResourceType: data.Encrypted,
+			Hash:         base64.StdEncoding.EncodeToString(hash[:]),
+			Size:         uint64(len(plaintext)),
+		},
+		EncryptedKey: base64.StdEncoding.EncodeToString(cipherutils.SerializeCipherText(encryptedKey)),
+		Shares: []string{
+			base64.StdEncoding.EncodeToString(cipherutils.SerializeCipherText(share1)),
+			base64.StdEncoding.EncodeToString(cipherutils.SerializeCipherText(share2)),
+		},
+		Ciphertext: base64.StdEncoding.EncodeToString(ciphertext),
+	}
+
+	decrypted, err := Decrypt(materials, clientKey, nil)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	assert.Equal(t, plaintext, decrypted)
+
+	// 链下资源的密文由调用者传入
+	materials.Ciphertext = ""
+	_, err = Decrypt(materials, clientKey, nil)
+	assert.Error(t, err)
+
+	decrypted, err = Decrypt(materials, clientKey, ciphertext)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	assert.Equal(t, plaintext, decrypted)
+
+	// 其他私钥无法解密
+	otherKey, err := ppks.GenPrivKey()
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	_, err = Decrypt(materials, otherKey, ciphertext)
+	assert.Error(t, err)
+}
+
+func TestSignKeySwitchPKRegistration(t *testing.T) {
+	privateKey, err := ppks.GenPrivKey()
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	owner := base64.StdEncoding.EncodeToString([]byte("owner"))
+	registration, err := SignKeySwitchPKRegistration(privateKey, owner)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	assert.Equal(t, EncodePublicKey(&privateKey.PublicKey), registration.KeySwitchPK)
+
+	// 签名绑定了登记者身份
+	signature, err := base64.StdEncoding.DecodeString(registration.Signature)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	assert.True(t, privateKey.PublicKey.Verify(keyswitch.GetKeySwitchPKRegistrationMessage(owner, registration.KeySwitchPK), signature))
+	assert.False(t, privateKey.PublicKey.Verify(keyswitch.GetKeySwitchPKRegistrationMessage("other", registration.KeySwitchPK), signature))
+}
@@ -0,0 +1,23 @@
+package accesspolicy
+
+import "gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/identity"
+
+// PolicyEvaluationRequest 表示要传给链码的访问策略试算请求
+type PolicyEvaluationRequest struct {
+	Policy             string                             `json:"policy"`             // 访问策略
+	DepartmentIdentity *identity.DepartmentIdentityStored `json:"departmentIdentity"` // 用于求值的部门身份信息。为 nil 时使用调用者证书上的部门身份信息。
+	ResourceID         string                             `json:"resourceID"`         // 用于提供资源属性的资源 ID。为空时策略不能引用资源属性。
+}
+
+// PolicyTemplate 表示要传给链码的访问策略模板。以已有的模板 ID 创建时将产生该模板的新版本。
+type PolicyTemplate struct {
+	TemplateID  string `json:"templateID"`  // 模板 ID
+	Description string `json:"description"` // 模板描述
+	Policy      string `json:"policy"`      // 访问策略
+}
+
+// PolicyTemplateReference 表示资源对访问策略模板的引用
+type PolicyTemplateReference struct {
+	TemplateID string `json:"templateID"` // 模板 ID
+	Version    int    `json:"version"`    // 模板版本。传给链码时为零值表示引用当前最新版本，链码会将其固定为具体版本。
+}
@@ -0,0 +1,38 @@
+package accesspolicy
+
+import "time"
+
+// PolicyEvaluationResult 表示从链码得到的访问策略试算结果
+type PolicyEvaluationResult struct {
+	IsAllowed      bool     `json:"isAllowed"`      // 主体是否满足访问策略
+	MatchedClauses []string `json:"matchedClauses"` // 满足的条件
+	FailedClauses  []string `json:"failedClauses"`  // 不满足或求值出错的条件
+	ErrorMessage   string   `json:"errorMessage"`   // 求值出错时的错误信息。出错时视为不满足。
+}
+
+// PolicyTemplateStored 表示从链码得到的访问策略模板
+type PolicyTemplateStored struct {
+	TemplateID  string    `json:"templateID"`  // 模板 ID
+	Version     int       `json:"version"`     // 模板版本，从 1 开始
+	Description string    `json:"description"` // 模板描述
+	Policy      string    `json:"policy"`      // 访问策略
+	Creator     string    `json:"creator"`     // 该版本创建者的公钥（Base64 编码）
+	Timestamp   time.Time `json:"timestamp"`   // 该版本的创建时间
+}
+
+// PolicyDenialReason 表示访问策略拒绝密钥置换请求的原因，由链码附在 `errorcode.CodeForbidden` 错误中返回
+type PolicyDenialReason struct {
+	ResourceID    string                `json:"resourceID"`    // 资源 ID
+	FailedClauses []PolicyClauseFailure `json:"failedClauses"` // 不满足或求值出错的条件
+}
+
+// PolicyClauseFailure 表示访问策略中一个不满足的条件
+type PolicyClauseFailure struct {
+	Clause       string                 `json:"clause"`                 // 条件的规范文本形式
+	IsNegated    bool                   `json:"isNegated"`              // 条件是否处于 `!` 之下，即条件为真时导致不满足
+	Values       map[string]interface{} `json:"values"`                 // 条件所比较的属性值。按配置脱敏的属性值为 `RedactedValue`。
+	ErrorMessage string                 `json:"errorMessage,omitempty"` // 求值出错时的错误信息
+}
+
+// RedactedValue 为脱敏后的属性值
+const RedactedValue = "***"
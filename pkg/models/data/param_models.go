@@ -1,6 +1,10 @@
 package data
 
-import "fmt"
+import (
+	"fmt"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/accesspolicy"
+)
 
 // ResourceType 用于标志一个资源的加密类别
 type ResourceType int
@@ -62,16 +66,20 @@ type PlainData struct {
 
 // EncryptedData 用于表示要传入链码的加密资源
 type EncryptedData struct {
-	Metadata ResMetadata `json:"metadata"` // 资源的元数据
-	Data     string      `json:"data"`     // 资源的数据本体（密文）（Base64 编码）
-	Key      string      `json:"key"`      // 对称密钥（密文）（Base64 编码）
-	Policy   string      `json:"policy"`   // 策略
+	Metadata       ResMetadata                           `json:"metadata"`           // 资源的元数据
+	Data           string                                `json:"data"`               // 资源的数据本体（密文）（Base64 编码）
+	Key            string                                `json:"key"`                // 对称密钥（密文）（Base64 编码）
+	Policy         string                                `json:"policy"`             // 策略。与 PolicyTemplate 二者只能指定其一。
+	PolicyTemplate *accesspolicy.PolicyTemplateReference `json:"policyTemplate"`     // 引用的策略模板。与 Policy 二者只能指定其一。
+	KeyEpoch       int                                   `json:"keyEpoch,omitempty"` // 加密对称密钥所用的集合公钥的纪元
 }
 
 // OffchainData 用于表示要传入链码的链下资源
 type OffchainData struct {
-	Metadata ResMetadata `json:"metadata"` // 资源的元数据
-	CID      string      `json:"cid"`      // 资源在 IPFS 网络上的内容 ID
-	Key      string      `json:"key"`      // 对称密钥（密文）（Base64 编码）
-	Policy   string      `json:"policy"`   // 策略
+	Metadata       ResMetadata                           `json:"metadata"`           // 资源的元数据
+	CID            string                                `json:"cid"`                // 资源在 IPFS 网络上的内容 ID
+	Key            string                                `json:"key"`                // 对称密钥（密文）（Base64 编码）
+	Policy         string                                `json:"policy"`             // 策略。与 PolicyTemplate 二者只能指定其一。
+	PolicyTemplate *accesspolicy.PolicyTemplateReference `json:"policyTemplate"`     // 引用的策略模板。与 Policy 二者只能指定其一。
+	KeyEpoch       int                                   `json:"keyEpoch,omitempty"` // 加密对称密钥所用的集合公钥的纪元
 }
@@ -0,0 +1,14 @@
+package identity
+
+// OrgUnit 用于创建或更新组织树中的部门
+type OrgUnit struct {
+	DeptName      string `json:"deptName"`      // 部门名称
+	SuperDeptName string `json:"superDeptName"` // 上级部门名称。为空时该部门为根部门。
+}
+
+// RegisteredAttributesUpdate 用于更新属性登记簿中某一身份的登记属性
+type RegisteredAttributesUpdate struct {
+	PublicKey  string            `json:"publicKey"`  // 身份的公钥（Base64 编码的 DER）
+	Attributes map[string]string `json:"attributes"` // 登记的属性，键为与证书属性相同的属性名。将整体替换之前登记的属性，为空时清除登记。
+	Reason     string            `json:"reason"`     // 更新原因
+}
@@ -1,5 +1,7 @@
 package identity
 
+import "time"
+
 // DepartmentIdentityStored 表示由链码返回的部门身份信息
 type DepartmentIdentityStored struct {
 	DeptType      string `json:"deptType"`      // 部门类型
@@ -7,3 +9,21 @@ type DepartmentIdentityStored struct {
 	DeptName      string `json:"deptName"`      // 部门名称
 	SuperDeptName string `json:"superDeptName"` // 上级部门名称
 }
+
+// OrgUnitStored 表示由链码返回的组织树中的部门
+type OrgUnitStored struct {
+	DeptName      string    `json:"deptName"`      // 部门名称
+	SuperDeptName string    `json:"superDeptName"` // 上级部门名称。为空时该部门为根部门。
+	Creator       string    `json:"creator"`       // 最近一次写入者的公钥（Base64 编码）
+	Timestamp     time.Time `json:"timestamp"`     // 最近一次写入的时间
+}
+
+// RegisteredAttributesStored 表示由链码返回的属性登记簿中某一身份的一个版本的登记属性
+type RegisteredAttributesStored struct {
+	PublicKey  string            `json:"publicKey"`  // 身份的公钥（Base64 编码的 DER）
+	Version    int               `json:"version"`    // 登记版本，从 1 开始
+	Attributes map[string]string `json:"attributes"` // 登记的属性，键为与证书属性相同的属性名
+	Reason     string            `json:"reason"`     // 更新原因
+	Updater    string            `json:"updater"`    // 更新者的公钥（Base64 编码）
+	Timestamp  time.Time         `json:"timestamp"`  // 更新时间
+}
@@ -0,0 +1,14 @@
+package keyswitch
+
+import "gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/data"
+
+// ClientDecryptionMaterials 表示由访问申请者自行解密一个资源所需的材料。份额已以触发器中访问申请者的密钥置换公钥验证，服务端不接触明文。
+type ClientDecryptionMaterials struct {
+	KeySwitchSessionID string                  `json:"keySwitchSessionID"`     // 密钥置换会话 ID
+	Metadata           *data.ResMetadataStored `json:"metadata"`               // 资源的元数据，用于检查解密出的明文的大小与哈希
+	EncryptedKey       string                  `json:"encryptedKey"`           // 资源的加密密钥（序列化后的 CipherText 的 Base64 编码）
+	Shares             []string                `json:"shares"`                 // 通过验证的份额（序列化后的 CipherText 的 Base64 编码）
+	ShareIndices       []int                   `json:"shareIndices,omitempty"` // 各份额的份额序号。n-of-n 模式下为空。
+	Ciphertext         string                  `json:"ciphertext,omitempty"`   // 资源的密文（Base64 编码）。仅加密资源有此项。
+	CID                string                  `json:"cid,omitempty"`          // 资源的密文在 IPFS 网络上的 CID。仅链下资源有此项。
+}
@@ -0,0 +1,59 @@
+package keyswitch
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// KeySwitchShareDelivery 表示密钥置换服务器直接交付给访问申请者的份额。链上只记录各份额的承诺，访问申请者以承诺核对交付的份额。
+type KeySwitchShareDelivery struct {
+	KeySwitchSessionID string           `json:"keySwitchSessionID"` // 密钥置换会话 ID
+	Shares             []KeySwitchShare `json:"shares"`             // 按触发器中资源的顺序排列的各资源的份额。单资源会话只有一份。
+	KeySwitchPK        string           `json:"keySwitchPK"`        // 份额生成者的密钥置换公钥（[64]byte 的 Base64 编码）
+	Signature          string           `json:"signature"`          // 以份额生成者的密钥置换私钥对 `GetKeySwitchShareDeliveryMessage()` 给出的消息的 SM2 签名（ASN.1 编码的 Base64 编码）
+}
+
+// GetKeySwitchShareCommitment 计算份额的承诺，即份额与零知识证明依次拼接后的 SHA-256 哈希。
+//
+// 参数：
+//   份额（[128]byte 的 Base64 编码）
+//   零知识证明（[96]byte 的 Base64 编码）
+//
+// 返回：
+//   承诺（[32]byte 的 Base64 编码）
+func GetKeySwitchShareCommitment(share string, zkProof string) (string, error) {
+	shareBytes, err := base64.StdEncoding.DecodeString(share)
+	if err != nil {
+		return "", fmt.Errorf("无法解析份额: %v", err)
+	}
+
+	proofBytes, err := base64.StdEncoding.DecodeString(zkProof)
+	if err != nil {
+		return "", fmt.Errorf("无法解析零知识证明: %v", err)
+	}
+
+	hash := sha256.Sum256(append(shareBytes, proofBytes...))
+	return base64.StdEncoding.EncodeToString(hash[:]), nil
+}
+
+// GetKeySwitchShareDeliveryMessage 得到交付份额时须签名的消息。消息包含会话 ID 与各份额的承诺，使签名覆盖交付的全部份额。
+//
+// 参数：
+//   交付的份额
+//
+// 返回：
+//   待签名的消息
+func GetKeySwitchShareDeliveryMessage(delivery *KeySwitchShareDelivery) ([]byte, error) {
+	var commitments []string
+	for _, resourceShare := range delivery.Shares {
+		commitment, err := GetKeySwitchShareCommitment(resourceShare.Share, resourceShare.ZKProof)
+		if err != nil {
+			return nil, err
+		}
+		commitments = append(commitments, commitment)
+	}
+
+	return []byte(fmt.Sprintf("ksshare:%s:%s:%s", delivery.KeySwitchSessionID, delivery.KeySwitchPK, strings.Join(commitments, ","))), nil
+}
@@ -1,18 +1,33 @@
 package keyswitch
 
+import "fmt"
+
 // KeySwitchTrigger 表示要传给链码的密文资源访问请求
 type KeySwitchTrigger struct {
-	ResourceID    string `json:"resourceID"`    // 资源 ID
-	AuthSessionID string `json:"authSessionID"` // 授权会话 ID。为零值时可忽略。
-	KeySwitchPK   string `json:"keySwitchPK"`   // 访问申请者用于密钥置换的公钥（[64]byte 的 Base64 编码）
+	ResourceID       string            `json:"resourceID"`                 // 资源 ID
+	ResourceIDs      []string          `json:"resourceIDs,omitempty"`      // 多资源会话的资源 ID 列表。指定时 ResourceID 与 AuthSessionID 须为空。
+	AuthSessionID    string            `json:"authSessionID"`              // 授权会话 ID。为零值时可忽略。
+	AuthSessionIDs   map[string]string `json:"authSessionIDs,omitempty"`   // 多资源会话中按资源 ID 索引的授权会话 ID。未指定的资源依据其访问策略检查。
+	KeySwitchPK      string            `json:"keySwitchPK"`                // 访问申请者用于密钥置换的公钥（[64]byte 的 Base64 编码）
+	ShareDeliveryURL string            `json:"shareDeliveryURL,omitempty"` // 链下交付份额的地址。指定时密钥置换服务器将份额直接交付到该地址，链上只记录份额的承诺。
 }
 
 // KeySwitchResult 表示要传给链码的密钥置换结果
 type KeySwitchResult struct {
-	KeySwitchSessionID string `json:"keySwitchSessionID"` // 密钥置换会话 ID
-	Share              string `json:"share"`              // 个人份额（[64]byte 的 Base64 编码）
-	ZKProof            string `json:"zkproof"`            // 零知识证明（[96]byte 的 Base64 编码），用于验证份额
-	KeySwitchPK        string `json:"keySwitchPK"`        // 份额生成者的密钥置换公钥（[64]byte 的 Base64 编码），用于验证份额
+	KeySwitchSessionID string           `json:"keySwitchSessionID"`   // 密钥置换会话 ID
+	Share              string           `json:"share"`                // 个人份额（[64]byte 的 Base64 编码）
+	ZKProof            string           `json:"zkproof"`              // 零知识证明（[96]byte 的 Base64 编码），用于验证份额
+	Shares             []KeySwitchShare `json:"shares,omitempty"`     // 多资源会话中按触发器中资源的顺序排列的各资源的份额。此时 Share 与 ZKProof 为空。
+	KeySwitchPK        string           `json:"keySwitchPK"`          // 份额生成者的密钥置换公钥（[64]byte 的 Base64 编码），用于验证份额
+	Commitment         string           `json:"commitment,omitempty"` // 链下交付的份额的承诺（见 `GetKeySwitchShareCommitment()`）。指定时 Share 与 ZKProof 为空。
+}
+
+// KeySwitchShare 表示多资源密钥置换会话中针对一个资源的份额
+type KeySwitchShare struct {
+	ResourceID string `json:"resourceID"`           // 资源 ID
+	Share      string `json:"share"`                // 个人份额（[64]byte 的 Base64 编码）
+	ZKProof    string `json:"zkproof"`              // 零知识证明（[96]byte 的 Base64 编码），用于验证份额
+	Commitment string `json:"commitment,omitempty"` // 链下交付的份额的承诺。指定时 Share 与 ZKProof 为空。
 }
 
 // KeySwitchResultQuery 表示密钥置换的查询请求
@@ -20,3 +35,55 @@ type KeySwitchResultQuery struct {
 	KeySwitchSessionID string `json:"keySwitchSessionID"` // 密钥置换会话 ID
 	ResultCreator      string `json:"resultCreator"`      // 密钥置换结果的创建者公钥（Base 64 编码）
 }
+
+// KeySwitchServer 表示要传给链码的密钥置换服务器登记
+type KeySwitchServer struct {
+	PublicKey   string `json:"publicKey"`   // 服务器身份的公钥（Base64 编码的 DER），即其提交的密钥置换结果的创建者
+	Name        string `json:"name"`        // 服务器名称
+	KeySwitchPK string `json:"keySwitchPK"` // 服务器的密钥置换公钥（[64]byte 的 Base64 编码）
+}
+
+// KeySwitchServerHeartbeat 表示要传给链码的密钥置换服务器心跳
+type KeySwitchServerHeartbeat struct {
+	Version       string `json:"version"`       // 服务器的程序版本
+	LastSessionID string `json:"lastSessionID"` // 最近处理完的密钥置换会话 ID。尚未处理过会话时为空。
+	NumWorkers    int    `json:"numWorkers"`    // 服务器的工作单元数量
+}
+
+// KeySwitchSessionConfig 表示链上的密钥置换会话配置
+type KeySwitchSessionConfig struct {
+	SessionTTL int `json:"sessionTTL"` // 会话的有效期（秒），自触发器创建的交易时间起算
+	Threshold  int `json:"threshold"`  // 门限值，即会话完成所需的份额数量。为 0 时需要所有登记的服务器的份额。
+}
+
+// CollectiveKey 表示要传给链码的集合公钥。集合公钥按纪元发布，纪元从 1 起依次递增，未发布过的初始集合公钥视为纪元 0。
+type CollectiveKey struct {
+	Epoch     int    `json:"epoch"`     // 纪元
+	PublicKey string `json:"publicKey"` // 集合公钥（[64]byte 的 Base64 编码）
+}
+
+// ResourceKeyUpdate 表示要传给链码的资源的新加密密钥
+type ResourceKeyUpdate struct {
+	ResourceID string `json:"resourceID"` // 资源 ID
+	Key        string `json:"key"`        // 以新纪元的集合公钥加密的对称密钥（Base64 编码）
+	Epoch      int    `json:"epoch"`      // 新的集合公钥的纪元
+}
+
+// KeySwitchPKRegistration 表示要传给链码的密钥置换公钥登记。登记者须以对应的密钥置换私钥对 `GetKeySwitchPKRegistrationMessage()` 给出的消息签名，以证明持有该私钥。
+type KeySwitchPKRegistration struct {
+	KeySwitchPK      string `json:"keySwitchPK"`                // 密钥置换公钥（[64]byte 的 Base64 编码）
+	Signature        string `json:"signature"`                  // 以密钥置换私钥对登记消息的 SM2 签名（ASN.1 编码的 Base64 编码）
+	ShareDeliveryURL string `json:"shareDeliveryURL,omitempty"` // （可选）链下交付份额的地址。以该公钥创建的密钥置换会话只能将份额交付到此地址。
+}
+
+// GetKeySwitchPKRegistrationMessage 得到登记密钥置换公钥时须签名的消息。消息包含登记者身份，使签名不能被其他身份重放。
+//
+// 参数：
+//   登记者身份的公钥（Base64 编码的 DER）
+//   密钥置换公钥（[64]byte 的 Base64 编码）
+//
+// 返回：
+//   待签名的消息
+func GetKeySwitchPKRegistrationMessage(ownerAsBase64 string, keySwitchPK string) []byte {
+	return []byte(fmt.Sprintf("kspk:%s:%s", ownerAsBase64, keySwitchPK))
+}
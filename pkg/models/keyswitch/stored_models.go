@@ -1,24 +1,164 @@
 package keyswitch
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
+
+// KeySwitchSessionState 表示密钥置换会话的状态
+type KeySwitchSessionState int
+
+const (
+	// Open 表示会话仍在接收密钥置换结果。
+	Open KeySwitchSessionState = iota
+	// Complete 表示会话已收齐所需的份额，不再接收密钥置换结果。
+	Complete
+	// Expired 表示会话已过期，不再接收密钥置换结果。
+	Expired
+)
+
+func (s KeySwitchSessionState) String() string {
+	switch s {
+	case Open:
+		return "Open"
+	case Complete:
+		return "Complete"
+	case Expired:
+		return "Expired"
+	default:
+		return fmt.Sprintf("%d", int(s))
+	}
+}
 
 // KeySwitchTriggerStored 表示从链码得到的密文资源访问请求
 type KeySwitchTriggerStored struct {
-	KeySwitchSessionID string    `json:"keySwitchSessionID"` // 密钥置换会话 ID
-	ResourceID         string    `json:"resourceID"`         // 资源 ID
-	AuthSessionID      string    `json:"authSessionID"`      // 授权会话 ID。为零值时可忽略。
-	Creator            string    `json:"creator"`            // 访问申请者公钥（Base64 编码）
-	KeySwitchPK        string    `json:"keySwitchPK"`        // 访问申请者用于密钥置换的公钥（[64]byte 的 Base64 编码）
-	Timestamp          time.Time `json:"timestamp"`          // 时间戳
-	ValidationResult   bool      `json:"validationResult"`   // 访问申请是否通过验证
+	KeySwitchSessionID string                `json:"keySwitchSessionID"`         // 密钥置换会话 ID
+	ResourceID         string                `json:"resourceID"`                 // 资源 ID。多资源会话中为空。
+	ResourceIDs        []string              `json:"resourceIDs,omitempty"`      // 多资源会话的资源 ID 列表
+	AuthSessionID      string                `json:"authSessionID"`              // 授权会话 ID。为零值时可忽略。
+	AuthSessionIDs     map[string]string     `json:"authSessionIDs,omitempty"`   // 多资源会话中按资源 ID 索引的授权会话 ID
+	Creator            string                `json:"creator"`                    // 访问申请者公钥（Base64 编码）
+	KeySwitchPK        string                `json:"keySwitchPK"`                // 访问申请者用于密钥置换的公钥（[64]byte 的 Base64 编码）
+	Timestamp          time.Time             `json:"timestamp"`                  // 时间戳
+	ValidationResult   bool                  `json:"validationResult"`           // 访问申请是否通过验证
+	State              KeySwitchSessionState `json:"state"`                      // 密钥置换会话的状态
+	NumSharesExpected  int                   `json:"numSharesExpected"`          // 会话完成所需的份额数量。为 0 时会话不会因份额齐备而完成。
+	ExpiresAt          time.Time             `json:"expiresAt"`                  // 会话的过期时间。此后提交的密钥置换结果将被拒绝。
+	ShareDeliveryURL   string                `json:"shareDeliveryURL,omitempty"` // 链下交付份额的地址。为空时份额上链。
+}
+
+// GetResourceIDs 返回会话涵盖的资源 ID。单资源会话只有 ResourceID 一个。
+func (t *KeySwitchTriggerStored) GetResourceIDs() []string {
+	if len(t.ResourceIDs) != 0 {
+		return t.ResourceIDs
+	}
+
+	return []string{t.ResourceID}
+}
+
+// GetResultForResource 返回密钥置换结果中针对某一资源的份额，形如单资源会话的结果。单资源会话的结果原样返回。多资源会话的结果中没有该资源的份额时返回 nil。
+func (r *KeySwitchResultStored) GetResultForResource(resourceID string) *KeySwitchResultStored {
+	if len(r.Shares) == 0 {
+		return r
+	}
+
+	for _, resourceShare := range r.Shares {
+		if resourceShare.ResourceID == resourceID {
+			ret := *r
+			ret.Share = resourceShare.Share
+			ret.ZKProof = resourceShare.ZKProof
+			ret.Commitment = resourceShare.Commitment
+			ret.Shares = nil
+			return &ret
+		}
+	}
+
+	return nil
 }
 
 // KeySwitchResultStored 表示从链码得到的密钥置换结果
 type KeySwitchResultStored struct {
-	KeySwitchSessionID string    `json:"keySwitchSessionID"` // 密钥置换会话 ID
-	Share              string    `json:"share"`              // 个人份额（[64]byte 的 Base64 编码）
-	ZKProof            string    `json:"zkproof"`            // 零知识证明（[96]byte 的 Base64 编码），用于验证份额
-	KeySwitchPK        string    `json:"keySwitchPK"`        // 份额生成者的密钥置换公钥（[64]byte 的 Base64 编码），用于验证份额
-	Creator            string    `json:"creator"`            // 密钥置换响应者的公钥（Base64 编码）
-	Timestamp          time.Time `json:"timestamp"`          // 时间戳
+	KeySwitchSessionID string           `json:"keySwitchSessionID"`   // 密钥置换会话 ID
+	Share              string           `json:"share"`                // 个人份额（[64]byte 的 Base64 编码）
+	ZKProof            string           `json:"zkproof"`              // 零知识证明（[96]byte 的 Base64 编码），用于验证份额
+	Shares             []KeySwitchShare `json:"shares,omitempty"`     // 多资源会话中按触发器中资源的顺序排列的各资源的份额
+	KeySwitchPK        string           `json:"keySwitchPK"`          // 份额生成者的密钥置换公钥（[64]byte 的 Base64 编码），用于验证份额
+	Creator            string           `json:"creator"`              // 密钥置换响应者的公钥（Base64 编码）
+	Timestamp          time.Time        `json:"timestamp"`            // 时间戳
+	ValidationResult   bool             `json:"validationResult"`     // 份额是否通过链码的零知识证明验证。链下交付的份额由访问申请者验证，此时为 false。
+	Commitment         string           `json:"commitment,omitempty"` // 链下交付的份额的承诺。指定时 Share 与 ZKProof 为空。
+}
+
+// KeySwitchServerStored 表示从链码得到的密钥置换服务器登记
+type KeySwitchServerStored struct {
+	PublicKey   string    `json:"publicKey"`   // 服务器身份的公钥（Base64 编码的 DER），即其提交的密钥置换结果的创建者
+	Name        string    `json:"name"`        // 服务器名称
+	KeySwitchPK string    `json:"keySwitchPK"` // 服务器的密钥置换公钥（[64]byte 的 Base64 编码）
+	Creator     string    `json:"creator"`     // 登记者的公钥（Base64 编码）
+	Timestamp   time.Time `json:"timestamp"`   // 登记时间
+}
+
+// KeySwitchServerHeartbeatStored 表示从链码得到的密钥置换服务器心跳
+type KeySwitchServerHeartbeatStored struct {
+	PublicKey     string    `json:"publicKey"`     // 服务器身份的公钥（Base64 编码的 DER）
+	Version       string    `json:"version"`       // 服务器的程序版本
+	LastSessionID string    `json:"lastSessionID"` // 最近处理完的密钥置换会话 ID。尚未处理过会话时为空。
+	NumWorkers    int       `json:"numWorkers"`    // 服务器的工作单元数量
+	Timestamp     time.Time `json:"timestamp"`     // 记录心跳的时间
+}
+
+// KeySwitchServerLiveness 表示登记的密钥置换服务器的存活状态
+type KeySwitchServerLiveness int
+
+const (
+	// Alive 表示服务器近期记录过心跳。
+	Alive KeySwitchServerLiveness = iota
+	// Stale 表示服务器记录过心跳，但已超过时限未再记录。
+	Stale
+	// Missing 表示服务器从未记录过心跳。
+	Missing
+)
+
+func (l KeySwitchServerLiveness) String() string {
+	switch l {
+	case Alive:
+		return "Alive"
+	case Stale:
+		return "Stale"
+	case Missing:
+		return "Missing"
+	default:
+		return fmt.Sprintf("%d", int(l))
+	}
+}
+
+// KeySwitchServerStatus 表示登记的密钥置换服务器及其存活状态
+type KeySwitchServerStatus struct {
+	KeySwitchServerStored
+	Liveness  KeySwitchServerLiveness         `json:"liveness"`            // 存活状态
+	Heartbeat *KeySwitchServerHeartbeatStored `json:"heartbeat,omitempty"` // 最近一次心跳。从未记录过心跳时为空。
+}
+
+// KeySwitchPKRegistrationStored 表示从链码得到的密钥置换公钥登记。一个身份可以登记多个密钥置换公钥。
+type KeySwitchPKRegistrationStored struct {
+	Owner            string    `json:"owner"`                      // 登记者身份的公钥（Base64 编码的 DER）
+	KeySwitchPK      string    `json:"keySwitchPK"`                // 密钥置换公钥（[64]byte 的 Base64 编码）
+	ShareDeliveryURL string    `json:"shareDeliveryURL,omitempty"` // 链下交付份额的地址。为空时以该公钥创建的会话不能启用链下份额交付。
+	Timestamp        time.Time `json:"timestamp"`                  // 登记时间
+}
+
+// CollectiveKeyStored 表示从链码得到的集合公钥
+type CollectiveKeyStored struct {
+	Epoch     int       `json:"epoch"`     // 纪元
+	PublicKey string    `json:"publicKey"` // 集合公钥（[64]byte 的 Base64 编码）
+	Creator   string    `json:"creator"`   // 发布者的公钥（Base64 编码）
+	Timestamp time.Time `json:"timestamp"` // 发布时间
+}
+
+// ResourceKeyEpochStored 表示从链码得到的资源的加密密钥所属的纪元
+type ResourceKeyEpochStored struct {
+	ResourceID string    `json:"resourceID"`          // 资源 ID
+	Epoch      int       `json:"epoch"`               // 加密对称密钥所用的集合公钥的纪元
+	Updater    string    `json:"updater,omitempty"`   // 最近更新加密密钥者的公钥（Base64 编码）。创建后未更新过时为空。
+	Timestamp  time.Time `json:"timestamp,omitempty"` // 记录时间
 }
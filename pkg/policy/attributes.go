@@ -0,0 +1,22 @@
+package policy
+
+import "gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/identity"
+
+// DepartmentIdentityAttributeNames 为由部门身份信息构建的主体属性的属性名。
+var DepartmentIdentityAttributeNames = []string{"DeptType", "DeptLevel", "DeptName", "SuperDeptName"}
+
+// OrganizationPredicateNames 为由 `AddOrganizationPredicates` 加入的组织层级谓词的谓词名。
+var OrganizationPredicateNames = []string{"descendantOf", "levelAtMost"}
+
+// SubjectNames 为资源访问策略可引用的全部属性名与谓词名。以 "." 结尾的为属性名前缀。
+var SubjectNames = append(append(append([]string{}, DepartmentIdentityAttributeNames...), OrganizationPredicateNames...), ContextAttributeNames...)
+
+// NewAttributesFromDepartmentIdentity 由部门身份信息构建策略求值所用的主体属性。属性名与证书中的属性名相同。
+func NewAttributesFromDepartmentIdentity(deptIdentity *identity.DepartmentIdentityStored) Attributes {
+	return Attributes{
+		"DeptType":      deptIdentity.DeptType,
+		"DeptLevel":     deptIdentity.DeptLevel,
+		"DeptName":      deptIdentity.DeptName,
+		"SuperDeptName": deptIdentity.SuperDeptName,
+	}
+}
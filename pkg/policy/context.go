@@ -0,0 +1,83 @@
+package policy
+
+import (
+	"time"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/data"
+)
+
+// ResourceAttributePrefix 为资源属性的属性名前缀。资源的公开扩展字段以 `Resource.<字段名>` 的形式引用。
+const ResourceAttributePrefix = "Resource."
+
+// ContextAttributeNames 为由 `AddContextAttributes` 加入的上下文属性的属性名。以 "." 结尾的为属性名前缀。
+var ContextAttributeNames = []string{
+	"Tx.Time", "Tx.Date", "Tx.Clock", "Tx.Hour", "Tx.Weekday", "Tx.Unix",
+	"Caller.MSPID", "Caller.Org", "Caller.EnrollmentID", "Caller.Role", "Caller.CommonName",
+	ResourceAttributePrefix,
+}
+
+// CallerIdentity 表示调用者的 MSP 与证书身份。
+type CallerIdentity struct {
+	MSPID        string // 调用者的 MSP ID
+	Org          string // 证书主体的组织（O）
+	EnrollmentID string // 注册 ID
+	Role         string // 角色，如 client、peer、admin
+	CommonName   string // 证书主体的通用名（CN）
+}
+
+// Context 表示策略求值时部门身份以外的上下文。
+type Context struct {
+	Time     time.Time               // 交易时间。时间属性按其所带的时区计算。
+	Caller   CallerIdentity          // 调用者的 MSP 与证书身份
+	Resource *data.ResMetadataStored // 被访问资源的元数据。为 nil 时不加入资源属性。
+}
+
+// AddContextAttributes 向主体属性中加入上下文属性：
+//   Tx.Time：交易时间，形如 "2006-01-02T15:04:05+08:00"；
+//   Tx.Date：交易日期，形如 "2006-01-02"；
+//   Tx.Clock：交易时刻，形如 "15:04"；
+//   Tx.Hour：交易时刻的小时数（0 至 23）；
+//   Tx.Weekday：交易日期是星期几（1 至 7，7 为星期日）；
+//   Tx.Unix：交易时间的 Unix 时间戳（秒）；
+//   Caller.MSPID：调用者的 MSP ID；
+//   Caller.Org：调用者证书主体的组织（O）；
+//   Caller.EnrollmentID：调用者的注册 ID；
+//   Caller.Role：调用者的角色；
+//   Caller.CommonName：调用者证书主体的通用名（CN）；
+//   Resource.ID：资源 ID；
+//   Resource.<字段名>：资源的扩展字段。只加入值为字符串、数值或布尔值的字段。
+// 日期、时刻与时间字符串按字典序比较即按时间先后比较。
+//
+// 参数：
+//   主体属性
+//   上下文
+func AddContextAttributes(attrs Attributes, ctx *Context) {
+	attrs["Tx.Time"] = ctx.Time.Format(time.RFC3339)
+	attrs["Tx.Date"] = ctx.Time.Format("2006-01-02")
+	attrs["Tx.Clock"] = ctx.Time.Format("15:04")
+	attrs["Tx.Hour"] = ctx.Time.Hour()
+
+	weekday := int(ctx.Time.Weekday())
+	if weekday == 0 {
+		weekday = 7
+	}
+	attrs["Tx.Weekday"] = weekday
+	attrs["Tx.Unix"] = ctx.Time.Unix()
+
+	attrs["Caller.MSPID"] = ctx.Caller.MSPID
+	attrs["Caller.Org"] = ctx.Caller.Org
+	attrs["Caller.EnrollmentID"] = ctx.Caller.EnrollmentID
+	attrs["Caller.Role"] = ctx.Caller.Role
+	attrs["Caller.CommonName"] = ctx.Caller.CommonName
+
+	if ctx.Resource == nil {
+		return
+	}
+
+	for name, value := range ctx.Resource.Extensions {
+		if _, err := normalizeValue(name, value); err == nil {
+			attrs[ResourceAttributePrefix+name] = value
+		}
+	}
+	attrs[ResourceAttributePrefix+"ID"] = ctx.Resource.ResourceID
+}
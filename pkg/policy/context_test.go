@@ -0,0 +1,81 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextAttributes(t *testing.T) {
+	// 2021-03-07 为星期日
+	location := time.FixedZone("UTC+8", 8*60*60)
+	ctx := &Context{
+		Time: time.Date(2021, 3, 7, 9, 30, 0, 0, location),
+		Caller: CallerIdentity{
+			MSPID:        "Org1MSP",
+			Org:          "org1.lab805.com",
+			EnrollmentID: "User1",
+			Role:         "client",
+			CommonName:   "User1@org1.lab805.com",
+		},
+		Resource: &data.ResMetadataStored{
+			ResourceID: "101",
+			Extensions: map[string]interface{}{
+				"embargoDate": "2021-04-01",
+				"pageCount":   12.0,
+				"nested":      map[string]interface{}{"a": 1},
+			},
+		},
+	}
+
+	attrs := Attributes{}
+	AddContextAttributes(attrs, ctx)
+
+	results := map[string]bool{
+		`Tx.Date < Resource.embargoDate`:                                 true,
+		`Tx.Date >= "2021-03-07" && Tx.Date <= "2021-03-31"`:             true,
+		`Tx.Clock >= "09:00" && Tx.Clock < "18:00"`:                      true,
+		`Tx.Hour == 9 && Tx.Weekday == 7`:                                true,
+		`Tx.Time == "2021-03-07T09:30:00+08:00"`:                         true,
+		`Tx.Unix == 1615080600`:                                          true,
+		`Caller.MSPID == "Org1MSP" && Resource.ID == "101"`:              true,
+		`Caller.Org == "org1.lab805.com" && Caller.Role == "client"`:     true,
+		`Caller.EnrollmentID == "User1" && Caller.CommonName != "User1"`: true,
+		`Caller.MSPID == "Org2MSP"`:                                      false,
+		`Resource.pageCount > 10`:                                        true,
+		`Tx.Weekday <= 5`:                                                false,
+		`Tx.Date >= Resource.embargoDate`:                                false,
+	}
+
+	for policyText, expected := range results {
+		if isNoError := assert.NoError(t, Validate(policyText, SubjectNames), policyText); !isNoError {
+			t.FailNow()
+		}
+
+		expr, err := Parse(policyText)
+		if isNoError := assert.NoError(t, err, policyText); !isNoError {
+			t.FailNow()
+		}
+
+		result, err := expr.Evaluate(attrs)
+		if isNoError := assert.NoError(t, err, policyText); !isNoError {
+			t.FailNow()
+		}
+		assert.Equal(t, expected, result, policyText)
+	}
+
+	// 不是标量的扩展字段不加入
+	_, ok := attrs["Resource.nested"]
+	assert.False(t, ok)
+}
+
+func TestValidateWithAttributePrefix(t *testing.T) {
+	assert.NoError(t, Validate(`Resource.embargoDate > "2021-01-01"`, SubjectNames))
+
+	for _, policyText := range []string{`Resource. == "x"`, `Tx.Year == 2021`, `Caller.Name == "x"`} {
+		err := Validate(policyText, SubjectNames)
+		assert.IsType(t, &UnknownAttributeError{}, err, policyText)
+	}
+}
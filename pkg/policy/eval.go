@@ -0,0 +1,318 @@
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expr 表示一个解析后的策略表达式。
+type Expr interface {
+	// Evaluate 以 `attrs` 为主体属性对表达式求值，返回主体是否满足策略。
+	Evaluate(attrs Attributes) (bool, error)
+	// String 返回表达式的规范文本形式。
+	String() string
+}
+
+// operand 表示比较与集合运算中的操作数，即属性或字面量。
+type operand interface {
+	resolve(attrs Attributes) (interface{}, error)
+	String() string
+}
+
+type orExpr struct {
+	left, right Expr
+}
+
+func (e *orExpr) Evaluate(attrs Attributes) (bool, error) {
+	result, err := e.left.Evaluate(attrs)
+	if err != nil || result {
+		return result, err
+	}
+
+	return e.right.Evaluate(attrs)
+}
+
+func (e *orExpr) String() string {
+	return fmt.Sprintf("(%v || %v)", e.left, e.right)
+}
+
+type andExpr struct {
+	left, right Expr
+}
+
+func (e *andExpr) Evaluate(attrs Attributes) (bool, error) {
+	result, err := e.left.Evaluate(attrs)
+	if err != nil || !result {
+		return result, err
+	}
+
+	return e.right.Evaluate(attrs)
+}
+
+func (e *andExpr) String() string {
+	return fmt.Sprintf("(%v && %v)", e.left, e.right)
+}
+
+type notExpr struct {
+	operand Expr
+}
+
+func (e *notExpr) Evaluate(attrs Attributes) (bool, error) {
+	result, err := e.operand.Evaluate(attrs)
+	if err != nil {
+		return false, err
+	}
+
+	return !result, nil
+}
+
+func (e *notExpr) String() string {
+	return fmt.Sprintf("!%v", e.operand)
+}
+
+type comparisonExpr struct {
+	op          string
+	left, right operand
+}
+
+func (e *comparisonExpr) Evaluate(attrs Attributes) (bool, error) {
+	left, err := e.left.resolve(attrs)
+	if err != nil {
+		return false, err
+	}
+
+	right, err := e.right.resolve(attrs)
+	if err != nil {
+		return false, err
+	}
+
+	if typeNameOf(left) != typeNameOf(right) {
+		return false, fmt.Errorf("类型不匹配，无法比较 %v（%v）与 %v（%v）", e.left, typeNameOf(left), e.right, typeNameOf(right))
+	}
+
+	switch e.op {
+	case "==":
+		return left == right, nil
+	case "!=":
+		return left != right, nil
+	}
+
+	// 有序比较只适用于数值与字符串
+	var cmp int
+	switch l := left.(type) {
+	case float64:
+		r := right.(float64)
+		if l < r {
+			cmp = -1
+		} else if l > r {
+			cmp = 1
+		}
+	case string:
+		cmp = strings.Compare(l, right.(string))
+	default:
+		return false, fmt.Errorf("无法对%v进行有序比较: %v", typeNameOf(left), e)
+	}
+
+	switch e.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	}
+
+	return false, fmt.Errorf("未知的比较运算符 '%v'", e.op)
+}
+
+func (e *comparisonExpr) String() string {
+	return fmt.Sprintf("%v %v %v", e.left, e.op, e.right)
+}
+
+type membershipExpr struct {
+	target    operand
+	values    []*literal
+	isNegated bool
+}
+
+func (e *membershipExpr) Evaluate(attrs Attributes) (bool, error) {
+	target, err := e.target.resolve(attrs)
+	if err != nil {
+		return false, err
+	}
+
+	// 解析阶段已保证集合非空且元素类型一致
+	if typeNameOf(target) != typeNameOf(e.values[0].value) {
+		return false, fmt.Errorf("类型不匹配，%v（%v）不能与%v集合比较", e.target, typeNameOf(target), typeNameOf(e.values[0].value))
+	}
+
+	isFound := false
+	for _, value := range e.values {
+		if value.value == target {
+			isFound = true
+			break
+		}
+	}
+
+	return isFound != e.isNegated, nil
+}
+
+func (e *membershipExpr) String() string {
+	values := make([]string, 0, len(e.values))
+	for _, value := range e.values {
+		values = append(values, value.String())
+	}
+
+	op := "in"
+	if e.isNegated {
+		op = "not in"
+	}
+
+	return fmt.Sprintf("%v %v [%v]", e.target, op, strings.Join(values, ", "))
+}
+
+// operandExpr 表示单独作为条件出现的操作数，其值须为布尔值。
+type operandExpr struct {
+	operand operand
+}
+
+func (e *operandExpr) Evaluate(attrs Attributes) (bool, error) {
+	value, err := e.operand.resolve(attrs)
+	if err != nil {
+		return false, err
+	}
+
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("%v 的值为%v，不能单独作为条件", e.operand, typeNameOf(value))
+	}
+
+	return result, nil
+}
+
+func (e *operandExpr) String() string {
+	return e.operand.String()
+}
+
+// callExpr 表示对主体所提供的谓词的调用。
+type callExpr struct {
+	name string
+	pos  int // 谓词名在策略中的起始位置
+	args []*literal
+}
+
+func (e *callExpr) Evaluate(attrs Attributes) (bool, error) {
+	value, ok := attrs[e.name]
+	if !ok {
+		return false, fmt.Errorf("主体不具有谓词 '%v'", e.name)
+	}
+
+	predicate, ok := value.(Predicate)
+	if !ok {
+		return false, fmt.Errorf("'%v' 不是谓词，不能调用", e.name)
+	}
+
+	args := make([]interface{}, 0, len(e.args))
+	for _, arg := range e.args {
+		args = append(args, arg.value)
+	}
+
+	result, err := predicate(args)
+	if err != nil {
+		return false, fmt.Errorf("%v: %v", e, err)
+	}
+
+	return result, nil
+}
+
+func (e *callExpr) String() string {
+	args := make([]string, 0, len(e.args))
+	for _, arg := range e.args {
+		args = append(args, arg.String())
+	}
+
+	return fmt.Sprintf("%v(%v)", e.name, strings.Join(args, ", "))
+}
+
+type attribute struct {
+	name string
+	pos  int // 属性名在策略中的起始位置
+}
+
+func (a *attribute) resolve(attrs Attributes) (interface{}, error) {
+	value, ok := attrs[a.name]
+	if !ok {
+		return nil, fmt.Errorf("主体不具有属性 '%v'", a.name)
+	}
+
+	return normalizeValue(a.name, value)
+}
+
+func (a *attribute) String() string {
+	return a.name
+}
+
+type literal struct {
+	value interface{} // string、float64 或 bool
+}
+
+func (l *literal) resolve(_ Attributes) (interface{}, error) {
+	return l.value, nil
+}
+
+func (l *literal) String() string {
+	return formatValue(l.value)
+}
+
+// 将属性值统一为 string、float64 或 bool 以便比较。
+func normalizeValue(name string, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string, bool, float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint:
+		return float64(v), nil
+	case uint32:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	}
+
+	return nil, fmt.Errorf("属性 '%v' 的值类型 %T 不受支持", name, value)
+}
+
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+
+	return fmt.Sprintf("%v", value)
+}
+
+func typeNameOf(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "字符串"
+	case float64:
+		return "数值"
+	case bool:
+		return "布尔值"
+	}
+
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,73 @@
+package policy
+
+// ClauseResult 表示策略中单个条件（比较、集合运算、谓词调用或单独出现的操作数）的求值结果。
+type ClauseResult struct {
+	Clause    string                 // 条件的规范文本形式
+	Result    bool                   // 条件本身的求值结果
+	Err       error                  // 求值出错时的错误
+	IsNegated bool                   // 条件是否处于奇数层 `!` 之下，即条件为假时才有利于满足策略
+	Values    map[string]interface{} // 条件所引用的属性在主体中的值。主体不具有的属性不在其中。
+}
+
+// IsSatisfied 返回条件是否朝着满足策略的方向求值，即求值未出错，且考虑其外层的 `!` 后为真。
+func (c ClauseResult) IsSatisfied() bool {
+	return c.Err == nil && c.Result != c.IsNegated
+}
+
+// Explain 以 `attrs` 为主体属性对表达式求值，并给出其中每个条件各自的求值结果。
+//
+// 整体结果与 `Expr.Evaluate` 一致；条件则不论是否被短路都会求值，以便说明策略的哪些部分满足、哪些不满足。
+//
+// 参数：
+//   解析后的表达式
+//   主体属性
+//
+// 返回：
+//   主体是否满足策略
+//   按出现顺序排列的各条件的求值结果
+//   整体求值出错时的错误
+func Explain(expr Expr, attrs Attributes) (bool, []ClauseResult, error) {
+	var clauses []ClauseResult
+	for _, clause := range clausesOf(expr, false) {
+		result, err := clause.expr.Evaluate(attrs)
+
+		values := map[string]interface{}{}
+		for _, ref := range referencedNames(clause.expr) {
+			if value, ok := attrs[ref.name]; ok {
+				if _, isPredicate := value.(Predicate); !isPredicate {
+					values[ref.name] = value
+				}
+			}
+		}
+
+		clauses = append(clauses, ClauseResult{
+			Clause:    clause.expr.String(),
+			Result:    result,
+			Err:       err,
+			IsNegated: clause.isNegated,
+			Values:    values,
+		})
+	}
+
+	result, err := expr.Evaluate(attrs)
+	return result, clauses, err
+}
+
+type clause struct {
+	expr      Expr
+	isNegated bool
+}
+
+// 按出现顺序收集表达式中的所有条件。
+func clausesOf(expr Expr, isNegated bool) []clause {
+	switch e := expr.(type) {
+	case *orExpr:
+		return append(clausesOf(e.left, isNegated), clausesOf(e.right, isNegated)...)
+	case *andExpr:
+		return append(clausesOf(e.left, isNegated), clausesOf(e.right, isNegated)...)
+	case *notExpr:
+		return clausesOf(e.operand, !isNegated)
+	}
+
+	return []clause{{expr: expr, isNegated: isNegated}}
+}
@@ -0,0 +1,205 @@
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenTrue
+	tokenFalse
+	tokenIn
+	tokenNot
+	tokenAnd
+	tokenOr
+	tokenBang
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+	tokenComma
+	tokenEq
+	tokenNeq
+	tokenLt
+	tokenLe
+	tokenGt
+	tokenGe
+)
+
+// 关键字。关键字区分大小写。
+var keywords = map[string]tokenKind{
+	"true":  tokenTrue,
+	"false": tokenFalse,
+	"in":    tokenIn,
+	"not":   tokenNot,
+}
+
+type token struct {
+	kind  tokenKind
+	text  string      // 记号在策略中的原始文本
+	value interface{} // 字面量的值。仅字符串与数值记号有值。
+	pos   int         // 记号在策略中的起始位置（字符下标）
+}
+
+// 将策略文本切分为记号序列，序列总以 `tokenEOF` 结尾。
+func tokenize(policy string) ([]token, error) {
+	runes := []rune(policy)
+	var tokens []token
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case isIdentStart(r):
+			for i < len(runes) && isIdentPart(runes[i]) {
+				i++
+			}
+			text := string(runes[start:i])
+			kind, isKeyword := keywords[text]
+			if !isKeyword {
+				kind = tokenIdent
+			}
+			tokens = append(tokens, token{kind: kind, text: text, pos: start})
+			continue
+		case r == '"' || r == '\'':
+			value, end, err := scanString(runes, start)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+			tokens = append(tokens, token{kind: tokenString, text: string(runes[start:i]), value: value, pos: start})
+			continue
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			i++
+			for i < len(runes) && unicode.IsDigit(runes[i]) {
+				i++
+			}
+			if i+1 < len(runes) && runes[i] == '.' && unicode.IsDigit(runes[i+1]) {
+				i++
+				for i < len(runes) && unicode.IsDigit(runes[i]) {
+					i++
+				}
+			}
+			text := string(runes[start:i])
+			value, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, &ParseError{Pos: start, Msg: fmt.Sprintf("不合法的数值 '%v'", text)}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: text, value: value, pos: start})
+			continue
+		}
+
+		// 运算符与分隔符
+		var kind tokenKind
+		width := 1
+		next := rune(0)
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+
+		switch r {
+		case '&':
+			if next != '&' {
+				return nil, &ParseError{Pos: start, Msg: "应为 '&&'"}
+			}
+			kind, width = tokenAnd, 2
+		case '|':
+			if next != '|' {
+				return nil, &ParseError{Pos: start, Msg: "应为 '||'"}
+			}
+			kind, width = tokenOr, 2
+		case '=':
+			if next != '=' {
+				return nil, &ParseError{Pos: start, Msg: "应为 '=='"}
+			}
+			kind, width = tokenEq, 2
+		case '!':
+			if next == '=' {
+				kind, width = tokenNeq, 2
+			} else {
+				kind = tokenBang
+			}
+		case '<':
+			if next == '=' {
+				kind, width = tokenLe, 2
+			} else {
+				kind = tokenLt
+			}
+		case '>':
+			if next == '=' {
+				kind, width = tokenGe, 2
+			} else {
+				kind = tokenGt
+			}
+		case '(':
+			kind = tokenLParen
+		case ')':
+			kind = tokenRParen
+		case '[':
+			kind = tokenLBracket
+		case ']':
+			kind = tokenRBracket
+		case ',':
+			kind = tokenComma
+		default:
+			return nil, &ParseError{Pos: start, Msg: fmt.Sprintf("意外的字符 '%c'", r)}
+		}
+
+		i += width
+		tokens = append(tokens, token{kind: kind, text: string(runes[start:i]), pos: start})
+	}
+
+	tokens = append(tokens, token{kind: tokenEOF, text: "", pos: len(runes)})
+	return tokens, nil
+}
+
+// 从 `start` 处的引号开始读取一个字符串字面量，返回其值与字面量结束后的下标。
+func scanString(runes []rune, start int) (string, int, error) {
+	quote := runes[start]
+	var sb strings.Builder
+
+	for i := start + 1; i < len(runes); i++ {
+		r := runes[i]
+		if r == quote {
+			return sb.String(), i + 1, nil
+		}
+
+		if r == '\\' {
+			if i+1 >= len(runes) {
+				break
+			}
+			i++
+			switch runes[i] {
+			case '"', '\'', '\\':
+				sb.WriteRune(runes[i])
+			default:
+				return "", 0, &ParseError{Pos: i - 1, Msg: fmt.Sprintf("不支持的转义序列 '\\%c'", runes[i])}
+			}
+			continue
+		}
+
+		sb.WriteRune(r)
+	}
+
+	return "", 0, &ParseError{Pos: start, Msg: "字符串未闭合"}
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
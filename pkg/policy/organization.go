@@ -0,0 +1,78 @@
+package policy
+
+import (
+	"fmt"
+	"math"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/identity"
+)
+
+// OrganizationTree 表示组织树，用于查询部门的上级部门。
+type OrganizationTree interface {
+	// GetSuperDeptName 返回部门在组织树中的上级部门名称。根部门的上级部门名称为空串。部门不在组织树中时 `isFound` 为 false。
+	GetSuperDeptName(deptName string) (superDeptName string, isFound bool, err error)
+}
+
+// AddOrganizationPredicates 向主体属性中加入组织层级谓词：
+//   descendantOf(name)：主体所在部门是部门 `name` 在组织树中的下级部门（不含其自身，可跨越多级）；
+//   levelAtMost(n)：主体所在部门的级别不大于 `n`。
+// 主体所在部门不在组织树中时，以其身份信息中的上级部门作为向上查找的起点。
+//
+// 参数：
+//   主体属性
+//   主体的部门身份信息
+//   组织树
+func AddOrganizationPredicates(attrs Attributes, deptIdentity *identity.DepartmentIdentityStored, tree OrganizationTree) {
+	attrs["descendantOf"] = Predicate(func(args []interface{}) (bool, error) {
+		if len(args) != 1 {
+			return false, fmt.Errorf("参数数量不正确。应为 1 个")
+		}
+		ancestor, ok := args[0].(string)
+		if !ok {
+			return false, fmt.Errorf("参数应为字符串")
+		}
+
+		return isDescendantOf(deptIdentity, ancestor, tree)
+	})
+
+	attrs["levelAtMost"] = Predicate(func(args []interface{}) (bool, error) {
+		if len(args) != 1 {
+			return false, fmt.Errorf("参数数量不正确。应为 1 个")
+		}
+		maxLevel, ok := args[0].(float64)
+		if !ok || maxLevel != math.Trunc(maxLevel) {
+			return false, fmt.Errorf("参数应为整数")
+		}
+
+		return float64(deptIdentity.DeptLevel) <= maxLevel, nil
+	})
+}
+
+func isDescendantOf(deptIdentity *identity.DepartmentIdentityStored, ancestor string, tree OrganizationTree) (bool, error) {
+	superDeptName, isFound, err := tree.GetSuperDeptName(deptIdentity.DeptName)
+	if err != nil {
+		return false, err
+	}
+	if !isFound {
+		superDeptName = deptIdentity.SuperDeptName
+	}
+
+	// 沿组织树向上查找。组织树在写入时已保证无环，此处仍记录已访问的部门以防数据损坏导致死循环。
+	isVisited := map[string]bool{deptIdentity.DeptName: true}
+	for superDeptName != "" && !isVisited[superDeptName] {
+		if superDeptName == ancestor {
+			return true, nil
+		}
+		isVisited[superDeptName] = true
+
+		superDeptName, isFound, err = tree.GetSuperDeptName(superDeptName)
+		if err != nil {
+			return false, err
+		}
+		if !isFound {
+			break
+		}
+	}
+
+	return false, nil
+}
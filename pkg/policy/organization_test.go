@@ -0,0 +1,104 @@
+package policy
+
+import (
+	"testing"
+
+	"gitee.com/czyczk/fabric-sdk-tutorial/pkg/models/identity"
+	"github.com/stretchr/testify/assert"
+)
+
+// mapOrganizationTree 以部门名到上级部门名的映射表示组织树。
+type mapOrganizationTree map[string]string
+
+func (tree mapOrganizationTree) GetSuperDeptName(deptName string) (string, bool, error) {
+	superDeptName, ok := tree[deptName]
+	return superDeptName, ok, nil
+}
+
+// Manufacturing -> 804 -> 812
+var sampleOrganizationTree = mapOrganizationTree{
+	"Manufacturing": "",
+	"804":           "Manufacturing",
+	"812":           "804",
+	"Finance":       "",
+}
+
+func evaluateWithOrganizationPredicates(t *testing.T, policyText string, deptIdentity *identity.DepartmentIdentityStored, tree OrganizationTree) (bool, error) {
+	if err := Validate(policyText, SubjectNames); err != nil {
+		t.Fatal(err)
+	}
+
+	expr, err := Parse(policyText)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attrs := NewAttributesFromDepartmentIdentity(deptIdentity)
+	AddOrganizationPredicates(attrs, deptIdentity, tree)
+	return expr.Evaluate(attrs)
+}
+
+func TestOrganizationPredicates(t *testing.T) {
+	deptIdentity := &identity.DepartmentIdentityStored{
+		DeptType:      "computer",
+		DeptLevel:     2,
+		DeptName:      "812",
+		SuperDeptName: "804",
+	}
+
+	results := map[string]bool{
+		`descendantOf("804")`:                             true,
+		`descendantOf("Manufacturing")`:                   true,
+		`descendantOf("812")`:                             false,
+		`descendantOf("Finance")`:                         false,
+		`levelAtMost(2)`:                                  true,
+		`levelAtMost(1)`:                                  false,
+		`descendantOf("Manufacturing") && levelAtMost(2)`: true,
+	}
+
+	for policyText, expected := range results {
+		result, err := evaluateWithOrganizationPredicates(t, policyText, deptIdentity, sampleOrganizationTree)
+		if isNoError := assert.NoError(t, err, policyText); !isNoError {
+			t.FailNow()
+		}
+		assert.Equal(t, expected, result, policyText)
+	}
+}
+
+func TestDescendantOfWithDepartmentNotInTree(t *testing.T) {
+	// 主体所在部门不在组织树中时，从证书中的上级部门开始向上查找
+	deptIdentity := &identity.DepartmentIdentityStored{DeptName: "813", SuperDeptName: "804"}
+
+	result, err := evaluateWithOrganizationPredicates(t, `descendantOf("Manufacturing")`, deptIdentity, sampleOrganizationTree)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	assert.True(t, result)
+}
+
+func TestDescendantOfWithCycle(t *testing.T) {
+	tree := mapOrganizationTree{"a": "b", "b": "a"}
+	deptIdentity := &identity.DepartmentIdentityStored{DeptName: "a"}
+
+	result, err := evaluateWithOrganizationPredicates(t, `descendantOf("c")`, deptIdentity, tree)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	assert.False(t, result)
+}
+
+func TestOrganizationPredicatesWithInvalidArguments(t *testing.T) {
+	deptIdentity := &identity.DepartmentIdentityStored{DeptName: "812", DeptLevel: 2}
+	policies := []string{
+		`descendantOf()`,
+		`descendantOf(804)`,
+		`descendantOf("804", "Manufacturing")`,
+		`levelAtMost("2")`,
+		`levelAtMost(1.5)`,
+	}
+
+	for _, policyText := range policies {
+		_, err := evaluateWithOrganizationPredicates(t, policyText, deptIdentity, sampleOrganizationTree)
+		assert.Error(t, err, policyText)
+	}
+}
@@ -0,0 +1,227 @@
+package policy
+
+import "fmt"
+
+// parser 以递归下降的方式将记号序列解析为表达式。
+type parser struct {
+	tokens []token
+	cur    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.cur]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.cur]
+	if tok.kind != tokenEOF {
+		p.cur++
+	}
+	return tok
+}
+
+func (p *parser) expect(kind tokenKind, desc string) (token, error) {
+	tok := p.next()
+	if tok.kind != kind {
+		return tok, unexpectedToken(tok, desc)
+	}
+	return tok, nil
+}
+
+func unexpectedToken(tok token, expected string) error {
+	if tok.kind == tokenEOF {
+		return &ParseError{Pos: tok.pos, Msg: fmt.Sprintf("策略意外结束，应为%v", expected)}
+	}
+	return &ParseError{Pos: tok.pos, Msg: fmt.Sprintf("意外的 '%v'，应为%v", tok.text, expected)}
+}
+
+// orExpr = andExpr { "||" andExpr }
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orExpr{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+// andExpr = unaryExpr { "&&" unaryExpr }
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenAnd {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andExpr{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+// unaryExpr = "!" unaryExpr | primary
+func (p *parser) parseUnary() (Expr, error) {
+	if p.peek().kind == tokenBang {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{operand: operand}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+// primary = "(" orExpr ")" | call | comparison | membership | operand
+func (p *parser) parsePrimary() (Expr, error) {
+	if p.peek().kind == tokenLParen {
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err = p.expect(tokenRParen, " ')'"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	}
+
+	if p.peek().kind == tokenIdent && p.tokens[p.cur+1].kind == tokenLParen {
+		return p.parseCall()
+	}
+
+	operandTok := p.peek()
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok := p.peek(); tok.kind {
+	case tokenEq, tokenNeq, tokenLt, tokenLe, tokenGt, tokenGe:
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &comparisonExpr{op: tok.text, left: left, right: right}, nil
+	case tokenIn, tokenNot:
+		return p.parseMembership(left)
+	}
+
+	// 单独出现的操作数作为条件时，字面量只能是布尔值
+	if lit, ok := left.(*literal); ok {
+		if _, isBool := lit.value.(bool); !isBool {
+			return nil, &ParseError{Pos: operandTok.pos, Msg: fmt.Sprintf("字面量 %v 不能单独作为条件", lit)}
+		}
+	}
+
+	return &operandExpr{operand: left}, nil
+}
+
+// call = attribute "(" [ literal { "," literal } ] ")"
+func (p *parser) parseCall() (Expr, error) {
+	nameTok := p.next()
+	p.next() // "("
+
+	var args []*literal
+	if p.peek().kind != tokenRParen {
+		for {
+			lit, err := p.parseLiteral()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, lit)
+
+			if p.peek().kind != tokenComma {
+				break
+			}
+			p.next()
+		}
+	}
+
+	if _, err := p.expect(tokenRParen, " ',' 或 ')'"); err != nil {
+		return nil, err
+	}
+
+	return &callExpr{name: nameTok.text, pos: nameTok.pos, args: args}, nil
+}
+
+// membership = operand [ "not" ] "in" "[" literal { "," literal } "]"
+func (p *parser) parseMembership(target operand) (Expr, error) {
+	isNegated := false
+	if p.peek().kind == tokenNot {
+		p.next()
+		isNegated = true
+	}
+
+	if _, err := p.expect(tokenIn, " 'in'"); err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokenLBracket, " '['"); err != nil {
+		return nil, err
+	}
+
+	var values []*literal
+	for {
+		tok := p.peek()
+		lit, err := p.parseLiteral()
+		if err != nil {
+			return nil, err
+		}
+		if len(values) > 0 && typeNameOf(lit.value) != typeNameOf(values[0].value) {
+			return nil, &ParseError{Pos: tok.pos, Msg: "集合中的元素类型必须一致"}
+		}
+		values = append(values, lit)
+
+		if p.peek().kind != tokenComma {
+			break
+		}
+		p.next()
+	}
+
+	if _, err := p.expect(tokenRBracket, " ',' 或 ']'"); err != nil {
+		return nil, err
+	}
+
+	return &membershipExpr{target: target, values: values, isNegated: isNegated}, nil
+}
+
+// operand = attribute | literal
+func (p *parser) parseOperand() (operand, error) {
+	if tok := p.peek(); tok.kind == tokenIdent {
+		p.next()
+		return &attribute{name: tok.text, pos: tok.pos}, nil
+	}
+
+	return p.parseLiteral()
+}
+
+// literal = string | number | "true" | "false"
+func (p *parser) parseLiteral() (*literal, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenString, tokenNumber:
+		return &literal{value: tok.value}, nil
+	case tokenTrue:
+		return &literal{value: true}, nil
+	case tokenFalse:
+		return &literal{value: false}, nil
+	}
+
+	return nil, unexpectedToken(tok, "属性名或字面量")
+}
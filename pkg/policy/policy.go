@@ -0,0 +1,180 @@
+// Package policy 实现了资源访问策略的语言，包括策略的词法分析、语法分析与求值。
+//
+// 访问策略是一个布尔表达式，在密钥置换触发时以访问申请者的属性为主体进行求值。其语法如下（EBNF）：
+//
+//   policy     = orExpr ;
+//   orExpr     = andExpr { "||" andExpr } ;
+//   andExpr    = unaryExpr { "&&" unaryExpr } ;
+//   unaryExpr  = "!" unaryExpr | primary ;
+//   primary    = "(" orExpr ")" | call | comparison | membership | operand ;
+//   call       = attribute "(" [ literal { "," literal } ] ")" ;
+//   comparison = operand ( "==" | "!=" | "<" | "<=" | ">" | ">=" ) operand ;
+//   membership = operand [ "not" ] "in" "[" literal { "," literal } "]" ;
+//   operand    = attribute | literal ;
+//   literal    = string | number | "true" | "false" ;
+//
+// 其中 attribute 为属性名，由字母或下划线开头，可包含字母、数字、下划线与点号；
+// string 为由双引号或单引号括起的字符串，支持 `\"`、`\'` 与 `\\` 转义；number 为可带负号与小数部分的十进制数。
+// 运算符优先级由高到低依次为 `!`、比较与集合运算、`&&`、`||`。
+//
+// 求值时：
+//   `==` 与 `!=` 只能比较同一类型的值；
+//   `<`、`<=`、`>`、`>=` 只能比较两个数值或两个字符串（按字典序）；
+//   `in` 要求被检查的值与集合元素类型相同，集合元素的类型必须一致；
+//   单独出现的属性须为布尔值；
+//   call 调用主体所提供的同名谓词（见 `Predicate`）。
+// 类型不满足要求或引用了主体不具有的属性时，求值返回错误而不是拒绝。
+//
+// 示例：
+//   DeptType == "computer" && DeptLevel <= 2
+//   DeptName in ["812", "804"] || !(SuperDeptName == "804")
+//   descendantOf("Manufacturing") && levelAtMost(2)
+//   Tx.Date < Resource.embargoDate && Caller.MSPID == "Org1MSP"
+package policy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Attributes 表示策略求值时主体所具有的属性，键为属性名。值的类型可为 string、整数、浮点数、bool 与 `Predicate`。
+type Attributes map[string]interface{}
+
+// Predicate 表示主体所提供的谓词，在策略中以函数调用的形式使用。参数为调用时给出的字面量（string、float64 或 bool）。
+type Predicate func(args []interface{}) (bool, error)
+
+// ParseError 表示策略的语法错误。
+type ParseError struct {
+	Pos int    // 出错位置（从 0 开始的字符下标）
+	Msg string // 错误描述
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("策略语法错误（第 %d 个字符处）: %s", e.Pos+1, e.Msg)
+}
+
+// UnknownAttributeError 表示策略引用了不在允许范围内的属性或谓词。
+type UnknownAttributeError struct {
+	Pos  int    // 属性名或谓词名的位置（从 0 开始的字符下标）
+	Name string // 属性名或谓词名
+}
+
+func (e *UnknownAttributeError) Error() string {
+	return fmt.Sprintf("策略引用了未知的属性或谓词 '%v'（第 %d 个字符处）", e.Name, e.Pos+1)
+}
+
+// Parse 解析策略文本，得到可供求值的表达式。
+//
+// 参数：
+//   策略文本
+//
+// 返回：
+//   解析后的表达式
+func Parse(policy string) (Expr, error) {
+	if strings.TrimSpace(policy) == "" {
+		return nil, &ParseError{Pos: 0, Msg: "策略不能为空"}
+	}
+
+	tokens, err := tokenize(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, &ParseError{Pos: tok.pos, Msg: fmt.Sprintf("多余的内容 '%v'", tok.text)}
+	}
+
+	return expr, nil
+}
+
+// Validate 检查策略的语法，并检查其引用的属性与谓词是否都在 `attributeNames` 之中。
+// `attributeNames` 中以 "." 结尾的名称为前缀，允许引用以其开头的任意属性。
+//
+// 参数：
+//   策略文本
+//   允许引用的属性名与谓词名
+//
+// 返回：
+//   策略不合法时为 `*ParseError` 或 `*UnknownAttributeError`
+func Validate(policy string, attributeNames []string) error {
+	expr, err := Parse(policy)
+	if err != nil {
+		return err
+	}
+
+	isKnown := make(map[string]bool, len(attributeNames))
+	var prefixes []string
+	for _, name := range attributeNames {
+		if strings.HasSuffix(name, ".") {
+			prefixes = append(prefixes, name)
+		} else {
+			isKnown[name] = true
+		}
+	}
+
+	for _, ref := range referencedNames(expr) {
+		if !isKnown[ref.name] && !hasAnyPrefix(ref.name, prefixes) {
+			return &UnknownAttributeError{Pos: ref.pos, Name: ref.name}
+		}
+	}
+
+	return nil
+}
+
+// 判断名称是否以某一前缀开头，且前缀之后还有内容。
+func hasAnyPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if len(name) > len(prefix) && strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type nameRef struct {
+	name string
+	pos  int
+}
+
+// 按出现顺序收集表达式中引用的所有属性名与谓词名。
+func referencedNames(expr Expr) []nameRef {
+	var refs []nameRef
+	collectOperand := func(o operand) {
+		if attr, ok := o.(*attribute); ok {
+			refs = append(refs, nameRef{name: attr.name, pos: attr.pos})
+		}
+	}
+
+	var walk func(e Expr)
+	walk = func(e Expr) {
+		switch e := e.(type) {
+		case *orExpr:
+			walk(e.left)
+			walk(e.right)
+		case *andExpr:
+			walk(e.left)
+			walk(e.right)
+		case *notExpr:
+			walk(e.operand)
+		case *comparisonExpr:
+			collectOperand(e.left)
+			collectOperand(e.right)
+		case *membershipExpr:
+			collectOperand(e.target)
+		case *operandExpr:
+			collectOperand(e.operand)
+		case *callExpr:
+			refs = append(refs, nameRef{name: e.name, pos: e.pos})
+		}
+	}
+	walk(expr)
+
+	return refs
+}
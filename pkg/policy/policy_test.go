@@ -0,0 +1,273 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var sampleAttributes = Attributes{
+	"DeptType":      "computer",
+	"DeptLevel":     2,
+	"DeptName":      "812",
+	"SuperDeptName": "804",
+	"IsAdmin":       false,
+}
+
+func TestEvaluateSatisfiedPolicies(t *testing.T) {
+	policies := []string{
+		`DeptType == "computer"`,
+		`(DeptType == "computer" && DeptLevel == 2)`,
+		`DeptType=="computer"&&DeptLevel>=2`,
+		`DeptLevel < 3 && DeptLevel > 1.5 && DeptLevel != 1`,
+		`DeptName in ["812", "813"]`,
+		`DeptName not in ['813']`,
+		`!IsAdmin`,
+		`!(SuperDeptName == "805") || IsAdmin`,
+		`IsAdmin || DeptType == "computer" && DeptLevel <= 2`,
+		`"computer" == DeptType`,
+		`true`,
+	}
+
+	for _, policy := range policies {
+		expr, err := Parse(policy)
+		if isNoError := assert.NoError(t, err, policy); !isNoError {
+			t.FailNow()
+		}
+
+		result, err := expr.Evaluate(sampleAttributes)
+		if isNoError := assert.NoError(t, err, policy); !isNoError {
+			t.FailNow()
+		}
+		assert.True(t, result, policy)
+	}
+}
+
+func TestEvaluateUnsatisfiedPolicies(t *testing.T) {
+	policies := []string{
+		`DeptType == "finance"`,
+		`(DeptType == "computer" && DeptLevel == 1)`,
+		`DeptName not in ["812", "813"]`,
+		`IsAdmin`,
+		`!(DeptType == "computer")`,
+		`(IsAdmin || DeptType == "computer") && DeptLevel > 2`,
+		`DeptName > "9"`,
+	}
+
+	for _, policy := range policies {
+		expr, err := Parse(policy)
+		if isNoError := assert.NoError(t, err, policy); !isNoError {
+			t.FailNow()
+		}
+
+		result, err := expr.Evaluate(sampleAttributes)
+		if isNoError := assert.NoError(t, err, policy); !isNoError {
+			t.FailNow()
+		}
+		assert.False(t, result, policy)
+	}
+}
+
+func TestParseInvalidPolicies(t *testing.T) {
+	policies := []string{
+		``,
+		`   `,
+		`DeptType = "computer"`,
+		`DeptType == "computer" &`,
+		`(DeptType == "computer"`,
+		`DeptType == "computer")`,
+		`DeptType == `,
+		`DeptType == "computer`,
+		`DeptName in []`,
+		`DeptName in ["812", 813]`,
+		`DeptName not ["812"]`,
+		`"computer"`,
+		`DeptType == "computer" DeptLevel == 2`,
+		`DeptType == "a\n"`,
+		`DeptType # "computer"`,
+		`descendantOf("804"`,
+		`descendantOf(DeptName)`,
+		`descendantOf("804",)`,
+	}
+
+	for _, policy := range policies {
+		_, err := Parse(policy)
+		if isError := assert.Error(t, err, policy); !isError {
+			t.FailNow()
+		}
+		assert.IsType(t, &ParseError{}, err, policy)
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	_, err := Parse(`DeptType == "computer" && && DeptLevel == 2`)
+	if isError := assert.Error(t, err); !isError {
+		t.FailNow()
+	}
+
+	parseErr, ok := err.(*ParseError)
+	if !ok {
+		t.FailNow()
+	}
+	assert.Equal(t, 26, parseErr.Pos)
+}
+
+func TestEvaluateWithInvalidAttributes(t *testing.T) {
+	policies := []string{
+		`UnknownAttr == "x"`,
+		`DeptLevel == "2"`,
+		`DeptName in [812]`,
+		`DeptType`,
+		`IsAdmin < true`,
+	}
+
+	for _, policy := range policies {
+		expr, err := Parse(policy)
+		if isNoError := assert.NoError(t, err, policy); !isNoError {
+			t.FailNow()
+		}
+
+		_, err = expr.Evaluate(sampleAttributes)
+		assert.Error(t, err, policy)
+	}
+}
+
+func TestEvaluateShortCircuit(t *testing.T) {
+	// 右侧引用了不存在的属性，但左侧已能决定结果，因此不应报错
+	expr, err := Parse(`DeptType == "computer" || UnknownAttr == "x"`)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	result, err := expr.Evaluate(sampleAttributes)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	assert.True(t, result)
+}
+
+func TestExprString(t *testing.T) {
+	expr, err := Parse(`a == 'x' || !b && c not in [1, 2.5]`)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	assert.Equal(t, `(a == "x" || (!b && c not in [1, 2.5]))`, expr.String())
+}
+
+func TestValidate(t *testing.T) {
+	attributeNames := []string{"DeptType", "DeptLevel"}
+
+	err := Validate(`DeptType == "computer" && DeptLevel <= 2`, attributeNames)
+	assert.NoError(t, err)
+
+	err = Validate(`DeptType == "computer" &&`, attributeNames)
+	assert.IsType(t, &ParseError{}, err)
+
+	err = Validate(`DeptType == "computer" || !(DeptName in ["812"])`, attributeNames)
+	if isError := assert.Error(t, err); !isError {
+		t.FailNow()
+	}
+	unknownAttrErr, ok := err.(*UnknownAttributeError)
+	if !ok {
+		t.FailNow()
+	}
+	assert.Equal(t, "DeptName", unknownAttrErr.Name)
+	assert.Equal(t, 28, unknownAttrErr.Pos)
+}
+
+func TestEvaluateCall(t *testing.T) {
+	var receivedArgs []interface{}
+	attrs := Attributes{
+		"DeptType": "computer",
+		"isIn": Predicate(func(args []interface{}) (bool, error) {
+			receivedArgs = args
+			return true, nil
+		}),
+	}
+
+	expr, err := Parse(`DeptType == "computer" && isIn("804", 2, true)`)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	assert.Equal(t, `(DeptType == "computer" && isIn("804", 2, true))`, expr.String())
+
+	result, err := expr.Evaluate(attrs)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	assert.True(t, result)
+	assert.Equal(t, []interface{}{"804", 2.0, true}, receivedArgs)
+
+	// 调用非谓词的属性或主体不具有的谓词时应报错
+	for _, policy := range []string{`DeptType()`, `unknown("x")`} {
+		expr, err := Parse(policy)
+		if isNoError := assert.NoError(t, err, policy); !isNoError {
+			t.FailNow()
+		}
+
+		_, err = expr.Evaluate(attrs)
+		assert.Error(t, err, policy)
+	}
+
+	// 谓词名同样受 `Validate` 检查
+	err = Validate(`DeptType == "computer" && isIn("804")`, []string{"DeptType"})
+	if unknownAttrErr, ok := err.(*UnknownAttributeError); assert.True(t, ok) {
+		assert.Equal(t, "isIn", unknownAttrErr.Name)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	expr, err := Parse(`DeptType == "computer" || (DeptLevel > 2 && !IsAdmin)`)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	result, clauses, err := Explain(expr, sampleAttributes)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+	assert.True(t, result)
+
+	// 被短路的条件也应给出结果
+	if isLenCorrect := assert.Len(t, clauses, 3); !isLenCorrect {
+		t.FailNow()
+	}
+	assert.Equal(t, ClauseResult{
+		Clause: `DeptType == "computer"`,
+		Result: true,
+		Values: map[string]interface{}{"DeptType": "computer"},
+	}, clauses[0])
+	assert.Equal(t, ClauseResult{
+		Clause: `DeptLevel > 2`,
+		Result: false,
+		Values: map[string]interface{}{"DeptLevel": 2},
+	}, clauses[1])
+	assert.Equal(t, ClauseResult{
+		Clause:    `IsAdmin`,
+		Result:    false,
+		IsNegated: true,
+		Values:    map[string]interface{}{"IsAdmin": false},
+	}, clauses[2])
+
+	// 处于 `!` 之下的条件为假时才有利于满足策略
+	assert.True(t, clauses[0].IsSatisfied())
+	assert.False(t, clauses[1].IsSatisfied())
+	assert.True(t, clauses[2].IsSatisfied())
+}
+
+func TestExplainWithEvaluationError(t *testing.T) {
+	expr, err := Parse(`DeptLevel == "2" || DeptType == "computer"`)
+	if isNoError := assert.NoError(t, err); !isNoError {
+		t.FailNow()
+	}
+
+	result, clauses, err := Explain(expr, sampleAttributes)
+	assert.Error(t, err)
+	assert.False(t, result)
+	if isLenCorrect := assert.Len(t, clauses, 2); !isLenCorrect {
+		t.FailNow()
+	}
+	assert.Error(t, clauses[0].Err)
+	assert.True(t, clauses[1].Result)
+}